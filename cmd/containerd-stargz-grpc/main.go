@@ -139,13 +139,52 @@ func main() {
 	if err := tree.Unmarshal(&config); err != nil {
 		log.G(ctx).WithError(err).Fatalf("failed to unmarshal config file %q", *configPath)
 	}
+	// STARGZ_* environment variables override the config file
+	if config.Config, err = config.Config.ApplyEnv(); err != nil {
+		log.G(ctx).WithError(err).Fatalf("failed to apply environment variables")
+	}
+	if err := config.Config.Validate(); err != nil {
+		log.G(ctx).WithError(err).Fatalf("invalid config file %q", *configPath)
+	}
+
+	if config.LogLevel != "" && !isFlagSet("log-level") {
+		if err := log.SetLevel(config.LogLevel); err != nil {
+			log.G(ctx).WithError(err).Fatalf("failed to set log level %q", config.LogLevel)
+		}
+	}
+
+	if err := service.ApplySecurityConfig(config.SecurityConfig); err != nil {
+		log.G(ctx).WithError(err).Fatalf("failed to apply security config")
+	}
 
 	if err := service.Supported(*rootDir); err != nil {
 		log.G(ctx).WithError(err).Fatalf("snapshotter is not supported")
 	}
 
+	var health *service.HealthChecker
+	if config.HealthCheckConfig.Address != "" {
+		health = service.NewHealthChecker(config.HealthCheckConfig)
+		l, err := net.Listen("tcp", config.HealthCheckConfig.Address)
+		if err != nil {
+			log.G(ctx).WithError(err).Fatalf("failed to get listener for health check endpoint")
+		}
+		go func() {
+			if err := http.Serve(l, health.Handler()); err != nil {
+				log.G(ctx).WithError(err).Errorf("error on serving health check endpoint")
+			}
+		}()
+	}
+
+	if config.NetworkConfig.SocketPath != "" && !isFlagSet("address") {
+		*address = config.NetworkConfig.SocketPath
+	}
+
 	// Create a gRPC server
-	rpc := grpc.NewServer()
+	grpcOpts, err := config.NetworkConfig.GRPCServerOptions()
+	if err != nil {
+		log.G(ctx).WithError(err).Fatalf("failed to configure gRPC server")
+	}
+	rpc := grpc.NewServer(grpcOpts...)
 
 	// Configure FUSE passthrough
 	// Always set Direct to true to ensure that
@@ -159,6 +198,7 @@ func main() {
 		EnableKubeKeychain:         config.KubeconfigKeychainConfig.EnableKeychain,
 		EnableCRIKeychain:          config.CRIKeychainConfig.EnableKeychain,
 		KubeconfigPath:             config.KubeconfigPath,
+		KubeconfigNamespaceScope:   config.NamespaceScope,
 		DefaultImageServiceAddress: defaultImageServiceAddress,
 		ImageServicePath:           config.ImageServicePath,
 	}
@@ -182,7 +222,7 @@ func main() {
 		if !filepath.IsAbs(fmAddr) {
 			log.G(ctx).WithError(err).Fatalf("fuse manager address must be an absolute path: %s", fmAddr)
 		}
-		managerNewlyStarted, err := fusemanager.StartFuseManager(ctx, fmPath, fmAddr, filepath.Join(*rootDir, "fusestore.db"), *logLevel, filepath.Join(*rootDir, "stargz-fuse-manager.log"))
+		managerNewlyStarted, err := fusemanager.StartFuseManager(ctx, fmPath, fmAddr, filepath.Join(*rootDir, "fusestore.db"), log.GetLevel().String(), filepath.Join(*rootDir, "stargz-fuse-manager.log"))
 		if err != nil {
 			log.G(ctx).WithError(err).Fatalf("failed to start fusemanager")
 		}
@@ -218,7 +258,7 @@ func main() {
 		if serveCRISocket {
 			crirpc = grpc.NewServer()
 		}
-		credsFuncs, err := keychainconfig.ConfigKeychain(ctx, crirpc, &keyChainConfig)
+		credsFuncs, podCredsFuncs, err := keychainconfig.ConfigKeychain(ctx, crirpc, &keyChainConfig)
 		if err != nil {
 			log.G(ctx).WithError(err).Fatalf("failed to configure keychain")
 		}
@@ -263,13 +303,14 @@ func main() {
 		}
 
 		rs, err = service.NewStargzSnapshotterService(ctx, *rootDir, &config.Config,
-			service.WithCredsFuncs(credsFuncs...), service.WithFilesystemOptions(fsOpts...))
+			service.WithCredsFuncs(credsFuncs...), service.WithPodCredsFuncs(podCredsFuncs...),
+			service.WithFilesystemOptions(fsOpts...))
 		if err != nil {
 			log.G(ctx).WithError(err).Fatalf("failed to configure snapshotter")
 		}
 	}
 
-	cleanup, err := serve(ctx, rpc, *address, rs, config)
+	cleanup, err := serve(ctx, rpc, *address, rs, config, health)
 	if err != nil {
 		log.G(ctx).WithError(err).Fatalf("failed to serve snapshotter")
 	}
@@ -292,7 +333,16 @@ func main() {
 	log.G(ctx).Info("Exiting")
 }
 
-func serve(ctx context.Context, rpc *grpc.Server, addr string, rs snapshots.Snapshotter, config snapshotterConfig) (bool, error) {
+func isFlagSet(name string) (set bool) {
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return
+}
+
+func serve(ctx context.Context, rpc *grpc.Server, addr string, rs snapshots.Snapshotter, config snapshotterConfig, health *service.HealthChecker) (bool, error) {
 	// Convert the snapshotter to a gRPC service,
 	snsvc := snapshotservice.FromSnapshotter(rs)
 
@@ -333,7 +383,7 @@ func serve(ctx context.Context, rpc *grpc.Server, addr string, rs snapshots.Snap
 			return false, fmt.Errorf("failed to listen %q: %w", config.DebugAddress, err)
 		}
 		go func() {
-			if err := http.Serve(l, debugServerMux()); err != nil {
+			if err := http.Serve(l, debugServerMux(rs)); err != nil {
 				errCh <- fmt.Errorf("error on serving a debug endpoint via socket %q: %w", addr, err)
 			}
 		}()
@@ -350,6 +400,12 @@ func serve(ctx context.Context, rpc *grpc.Server, addr string, rs snapshots.Snap
 		}
 	}()
 
+	if health != nil {
+		// The metadata store has been loaded and the socket accepts connections
+		health.SetReady(ctx, func(ctx context.Context) error {
+			return rs.Walk(ctx, func(context.Context, snapshots.Info) error { return nil })
+		})
+	}
 	if os.Getenv("NOTIFY_SOCKET") != "" {
 		notified, notifyErr := sddaemon.SdNotify(false, sddaemon.SdNotifyReady)
 		log.G(ctx).Debugf("SdNotifyReady notified=%v, err=%v", notified, notifyErr)
@@ -20,9 +20,13 @@ import (
 	"expvar"
 	"net/http"
 	"net/http/pprof"
+
+	"github.com/containerd/containerd/v2/core/snapshots"
+	"github.com/containerd/stargz-snapshotter/service"
+	"github.com/containerd/stargz-snapshotter/snapshot"
 )
 
-func debugServerMux() *http.ServeMux {
+func debugServerMux(rs snapshots.Snapshotter) *http.ServeMux {
 	m := http.NewServeMux()
 	m.Handle("/debug/vars", expvar.Handler())
 	m.Handle("/debug/pprof/", http.HandlerFunc(pprof.Index))
@@ -30,5 +34,8 @@ func debugServerMux() *http.ServeMux {
 	m.Handle("/debug/pprof/profile", http.HandlerFunc(pprof.Profile))
 	m.Handle("/debug/pprof/symbol", http.HandlerFunc(pprof.Symbol))
 	m.Handle("/debug/pprof/trace", http.HandlerFunc(pprof.Trace))
+	if l, ok := rs.(snapshot.InvalidMountLister); ok {
+		m.Handle(service.InvalidMountsPath, service.InvalidMountsHandler(l))
+	}
 	return m
 }
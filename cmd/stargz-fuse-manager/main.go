@@ -50,6 +50,7 @@ func init() {
 			EnableKubeKeychain:         cc.Config.Config.KubeconfigKeychainConfig.EnableKeychain,
 			EnableCRIKeychain:          cc.Config.Config.CRIKeychainConfig.EnableKeychain,
 			KubeconfigPath:             cc.Config.Config.KubeconfigPath,
+			KubeconfigNamespaceScope:   cc.Config.Config.NamespaceScope,
 			DefaultImageServiceAddress: cc.Config.DefaultImageServiceAddress,
 			ImageServicePath:           cc.Config.Config.ImageServicePath,
 		}
@@ -61,7 +62,7 @@ func init() {
 		if serveCRISocket {
 			cc.CRIServer = grpc.NewServer()
 		}
-		credsFuncs, err := keychainconfig.ConfigKeychain(cc.Ctx, cc.CRIServer, &keyChainConfig)
+		credsFuncs, podCredsFuncs, err := keychainconfig.ConfigKeychain(cc.Ctx, cc.CRIServer, &keyChainConfig)
 		if err != nil {
 			return nil, err
 		}
@@ -88,7 +89,7 @@ func init() {
 				}
 			}()
 		}
-		return []service.Option{service.WithCredsFuncs(credsFuncs...)}, nil
+		return []service.Option{service.WithCredsFuncs(credsFuncs...), service.WithPodCredsFuncs(podCredsFuncs...)}, nil
 	})
 }
 
@@ -0,0 +1,65 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package auto creates writers of the compression formats registered in
+// compzstd.DefaultRegistry by name.
+package auto
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	// Register the gzip and lz4 formats
+	_ "github.com/containerd/stargz-snapshotter/compression/gzip"
+	_ "github.com/containerd/stargz-snapshotter/compression/lz4"
+	compzstd "github.com/containerd/stargz-snapshotter/compression/zstd"
+)
+
+const (
+	// FormatZstd is the zstd format, compressed by the implementation selected by
+	// compzstd.GetCompressor unless another zstd compressor is registered as "zstd"
+	FormatZstd = "zstd"
+
+	// FormatAuto selects the implementation of compzstd.GetCompressor
+	FormatAuto = "auto"
+)
+
+// NewWriter creates a writer compressing to dst in format at level. format is the
+// name of a compressor in compzstd.DefaultRegistry, e.g. "gzip" or "lz4", FormatZstd
+// or FormatAuto.
+func NewWriter(dst io.Writer, format string, level int) (compzstd.WriteFlushCloser, error) {
+	c, err := Compressor(format)
+	if err != nil {
+		return nil, err
+	}
+	return c.NewWriter(dst, level)
+}
+
+// Compressor returns the compressor of format as selected by NewWriter
+func Compressor(format string) (compzstd.Compressor, error) {
+	if format == FormatAuto {
+		return compzstd.GetCompressor(), nil
+	}
+	if c, ok := compzstd.DefaultRegistry.Get(format); ok {
+		return c, nil
+	}
+	if format == FormatZstd {
+		return compzstd.GetCompressor(), nil
+	}
+	formats := append(compzstd.DefaultRegistry.Names(), FormatZstd, FormatAuto)
+	return nil, fmt.Errorf("unknown compression format %q: must be one of %s", format, strings.Join(formats, ", "))
+}
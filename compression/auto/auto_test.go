@@ -0,0 +1,84 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package auto
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	compzstd "github.com/containerd/stargz-snapshotter/compression/zstd"
+)
+
+var testData = bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog. "), 1000)
+
+func TestNewWriter(t *testing.T) {
+	for _, format := range []string{"zstd", "gzip", "lz4", "auto"} {
+		t.Run(format, func(t *testing.T) {
+			var compressed bytes.Buffer
+			w, err := NewWriter(&compressed, format, 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := w.Write(testData); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if isZstd := compzstd.IsZstdData(compressed.Bytes()); isZstd != (format == "zstd" || format == "auto") {
+				t.Errorf("output detected as zstd: %v", isZstd)
+			}
+
+			c, err := Compressor(format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r, err := c.NewReader(bytes.NewReader(compressed.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			if got, err := io.ReadAll(r); err != nil || !bytes.Equal(got, testData) {
+				t.Errorf("failed to decompress the output: %v", err)
+			}
+		})
+	}
+}
+
+func TestNewWriterAuto(t *testing.T) {
+	orig := compzstd.GetCompressor()
+	defer compzstd.SetCompressor(orig)
+	mock := compzstd.NewMockCompressor()
+	compzstd.SetCompressor(mock)
+
+	for _, format := range []string{"auto", "zstd"} {
+		if _, err := NewWriter(io.Discard, format, 3); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := mock.NewWriterCalls(); n != 2 {
+		t.Errorf("GetCompressor().NewWriter was called %d times; want 2", n)
+	}
+
+	if _, err := NewWriter(io.Discard, "brotli", 3); err == nil {
+		t.Error("unknown format should be rejected")
+	}
+	if _, err := NewWriter(io.Discard, "gzip", 100); err == nil {
+		t.Error("invalid gzip level should be rejected")
+	}
+}
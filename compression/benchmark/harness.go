@@ -0,0 +1,225 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package benchmark provides a shared benchmark harness that runs the same
+// matrix of compression and decompression benchmarks against several
+// Compressor implementations.
+package benchmark
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"text/tabwriter"
+
+	compzstd "github.com/containerd/stargz-snapshotter/compression/zstd"
+)
+
+const (
+	opCompress   = "Compress"
+	opDecompress = "Decompress"
+)
+
+// Result is the outcome of a single benchmark of the matrix
+type Result struct {
+	Op      string
+	Size    int
+	Level   int
+	NsPerOp int64
+	// Ratio is the compressed size divided by the original size
+	Ratio float64
+}
+
+type resultKey struct {
+	op    string
+	size  int
+	level int
+}
+
+// Harness runs benchmarks for a set of named implementations and keeps the
+// results so they can be compared afterwards.
+type Harness struct {
+	implementations map[string]compzstd.Compressor
+
+	mu      sync.Mutex
+	results map[string]map[resultKey]Result
+}
+
+// NewHarness creates a harness for the given implementations keyed by name
+func NewHarness(implementations map[string]compzstd.Compressor) *Harness {
+	return &Harness{
+		implementations: implementations,
+		results:         make(map[string]map[resultKey]Result),
+	}
+}
+
+// RunAll runs compression and decompression benchmarks for every
+// implementation, size and level. Levels above an implementation's
+// MaxCompressionLevel are skipped.
+func (h *Harness) RunAll(b *testing.B, sizes []int, levels []int) {
+	names := make([]string, 0, len(h.implementations))
+	for name := range h.implementations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		c := h.implementations[name]
+		for _, size := range sizes {
+			data := generateData(size)
+			for _, level := range levels {
+				if level > c.MaxCompressionLevel() {
+					continue
+				}
+				compressed, err := compress(c, data, level)
+				if err != nil {
+					b.Fatalf("%s: failed to compress at level %d: %v", name, level, err)
+				}
+				ratio := float64(len(compressed)) / float64(len(data))
+
+				b.Run(fmt.Sprintf("%s/%s/Size%d/Level%d", name, opCompress, size, level), func(b *testing.B) {
+					b.ReportAllocs()
+					b.SetBytes(int64(len(data)))
+					b.ResetTimer()
+					for i := 0; i < b.N; i++ {
+						if _, err := compress(c, data, level); err != nil {
+							b.Fatal(err)
+						}
+					}
+					h.record(name, b, Result{Op: opCompress, Size: size, Level: level, Ratio: ratio})
+				})
+
+				b.Run(fmt.Sprintf("%s/%s/Size%d/Level%d", name, opDecompress, size, level), func(b *testing.B) {
+					b.ReportAllocs()
+					b.SetBytes(int64(len(data)))
+					b.ResetTimer()
+					for i := 0; i < b.N; i++ {
+						if err := decompress(c, compressed, len(data)); err != nil {
+							b.Fatal(err)
+						}
+					}
+					h.record(name, b, Result{Op: opDecompress, Size: size, Level: level, Ratio: ratio})
+				})
+			}
+		}
+	}
+}
+
+// Results returns the recorded results of the named implementation
+func (h *Harness) Results(name string) []Result {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	res := make([]Result, 0, len(h.results[name]))
+	for _, r := range h.results[name] {
+		res = append(res, r)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Op != res[j].Op {
+			return res[i].Op < res[j].Op
+		}
+		if res[i].Size != res[j].Size {
+			return res[i].Size < res[j].Size
+		}
+		return res[i].Level < res[j].Level
+	})
+	return res
+}
+
+// CompareResults returns a table comparing the results that implementations
+// a and b have in common.
+func (h *Harness) CompareResults(a, b string) string {
+	h.mu.Lock()
+	other := h.results[b]
+	h.mu.Unlock()
+
+	var buf strings.Builder
+	tw := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "OP\tSIZE\tLEVEL\t%s NS/OP\t%s NS/OP\tSPEEDUP\t%s RATIO\t%s RATIO\n", a, b, a, b)
+	for _, ra := range h.Results(a) {
+		rb, ok := other[resultKey{ra.Op, ra.Size, ra.Level}]
+		if !ok {
+			continue
+		}
+		speedup := 0.0
+		if ra.NsPerOp > 0 {
+			speedup = float64(rb.NsPerOp) / float64(ra.NsPerOp)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%.2fx\t%.4f\t%.4f\n",
+			ra.Op, ra.Size, ra.Level, ra.NsPerOp, rb.NsPerOp, speedup, ra.Ratio, rb.Ratio)
+	}
+	tw.Flush()
+	return buf.String()
+}
+
+// record stores the result of the latest run of b. The benchmark function is
+// called with increasing b.N so the last call wins.
+func (h *Harness) record(name string, b *testing.B, r Result) {
+	if b.N > 0 {
+		r.NsPerOp = b.Elapsed().Nanoseconds() / int64(b.N)
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.results[name] == nil {
+		h.results[name] = make(map[resultKey]Result)
+	}
+	h.results[name][resultKey{r.Op, r.Size, r.Level}] = r
+}
+
+func compress(c compzstd.Compressor, data []byte, level int) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := c.NewWriter(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decompress(c compzstd.Compressor, compressed []byte, size int) error {
+	r, err := c.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	n, err := io.Copy(io.Discard, r)
+	if err != nil {
+		return err
+	}
+	if n != int64(size) {
+		return fmt.Errorf("decompressed size mismatch: %d/%d", n, size)
+	}
+	return nil
+}
+
+// generateData returns size bytes of compressible data
+func generateData(size int) []byte {
+	pattern := []byte("The quick brown fox jumps over the lazy dog. ")
+	data := make([]byte, size)
+	for i := 0; i < size; i += len(pattern) {
+		copy(data[i:], pattern)
+	}
+	return data
+}
@@ -0,0 +1,51 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package benchmark
+
+import (
+	"strings"
+	"testing"
+
+	compzstd "github.com/containerd/stargz-snapshotter/compression/zstd"
+)
+
+func TestCompareResults(t *testing.T) {
+	h := NewHarness(map[string]compzstd.Compressor{"a": nil, "b": nil})
+	h.results["a"] = map[resultKey]Result{
+		{opCompress, 1024, 3}: {Op: opCompress, Size: 1024, Level: 3, NsPerOp: 100, Ratio: 0.5},
+		{opCompress, 1024, 9}: {Op: opCompress, Size: 1024, Level: 9, NsPerOp: 300, Ratio: 0.4},
+	}
+	h.results["b"] = map[resultKey]Result{
+		{opCompress, 1024, 3}: {Op: opCompress, Size: 1024, Level: 3, NsPerOp: 200, Ratio: 0.5},
+	}
+
+	table := h.CompareResults("a", "b")
+	lines := strings.Split(strings.TrimSpace(table), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected header and one row; got:\n%s", table)
+	}
+	if !strings.Contains(lines[1], "2.00x") {
+		t.Errorf("unexpected speedup in row %q", lines[1])
+	}
+}
+
+func BenchmarkHarness(b *testing.B) {
+	h := NewHarness(map[string]compzstd.Compressor{
+		"klauspost": compzstd.NewPureGoCompressor(),
+	})
+	h.RunAll(b, []int{64 * 1024}, []int{1, 3})
+}
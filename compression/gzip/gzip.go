@@ -0,0 +1,94 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package gzip provides a Compressor backed by the standard compress/gzip package.
+package gzip
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	compzstd "github.com/containerd/stargz-snapshotter/compression/zstd"
+)
+
+func init() {
+	if err := compzstd.DefaultRegistry.Register("gzip", NewCompressor()); err != nil {
+		panic(err)
+	}
+}
+
+// Compressor implements compzstd.Compressor using compress/gzip
+type Compressor struct{}
+
+// NewCompressor creates a new gzip compressor
+func NewCompressor() compzstd.Compressor {
+	return &Compressor{}
+}
+
+// NewWriter creates a new gzip writer with the specified compression level.
+// Level 0 selects gzip.DefaultCompression as with the zstd implementations.
+func (c *Compressor) NewWriter(w io.Writer, level int) (compzstd.WriteFlushCloser, error) {
+	if level < 0 || level > gzip.BestCompression {
+		return nil, fmt.Errorf("invalid compression level %d: must be between 0 and %d", level, gzip.BestCompression)
+	}
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	zw, err := gzip.NewWriterLevel(w, level)
+	if err != nil {
+		return nil, err
+	}
+	return &writer{Writer: zw}, nil
+}
+
+// NewReader creates a new gzip reader
+func (c *Compressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+// Name returns the name of the compressor implementation
+func (c *Compressor) Name() string {
+	return "gzip (compress/gzip)"
+}
+
+// IsLibzstdAvailable returns false as this isn't a zstd implementation
+func (c *Compressor) IsLibzstdAvailable() bool {
+	return false
+}
+
+// MaxCompressionLevel returns the maximum supported compression level
+func (c *Compressor) MaxCompressionLevel() int {
+	return gzip.BestCompression
+}
+
+// writer wraps gzip.Writer to implement compzstd.WriteFlushCloser
+type writer struct {
+	*gzip.Writer
+	compzstd.PlaintextChecksum
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	w.Update(p[:n])
+	return n, err
+}
+
+func (w *writer) Reset(dst io.Writer) error {
+	w.Writer.Reset(dst)
+	w.ResetChecksum()
+	return nil
+}
@@ -0,0 +1,83 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package gzip
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+
+	compzstd "github.com/containerd/stargz-snapshotter/compression/zstd"
+)
+
+var testData = bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog. "), 1000)
+
+func TestCompatibilityWithStdlib(t *testing.T) {
+	c := NewCompressor()
+
+	// Compressor -> compress/gzip
+	var compressed bytes.Buffer
+	w, err := c.NewWriter(&compressed, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(testData); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if compzstd.IsZstdData(compressed.Bytes()) {
+		t.Errorf("gzip output is detected as zstd")
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(compressed.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := io.ReadAll(zr); err != nil || !bytes.Equal(got, testData) {
+		t.Errorf("compress/gzip failed to read the output: %v", err)
+	}
+
+	// compress/gzip -> Compressor
+	var stdCompressed bytes.Buffer
+	zw := gzip.NewWriter(&stdCompressed)
+	if _, err := zw.Write(testData); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := c.NewReader(&stdCompressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if got, err := io.ReadAll(r); err != nil || !bytes.Equal(got, testData) {
+		t.Errorf("failed to read the output of compress/gzip: %v", err)
+	}
+}
+
+func TestRegistered(t *testing.T) {
+	c, ok := compzstd.DefaultRegistry.Get("gzip")
+	if !ok {
+		t.Fatal("gzip isn't registered")
+	}
+	if c.MaxCompressionLevel() != 9 {
+		t.Errorf("max compression level = %d; want 9", c.MaxCompressionLevel())
+	}
+}
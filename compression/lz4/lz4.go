@@ -0,0 +1,117 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package lz4 provides a Compressor for layers of the OCI media type
+// "application/vnd.oci.image.layer.v1.tar+lz4".
+package lz4
+
+import (
+	"fmt"
+	"io"
+
+	compzstd "github.com/containerd/stargz-snapshotter/compression/zstd"
+	"github.com/pierrec/lz4/v4"
+)
+
+// MediaTypeImageLayerLz4 is the media type of lz4-compressed OCI layers.
+const MediaTypeImageLayerLz4 = "application/vnd.oci.image.layer.v1.tar+lz4"
+
+// maxCompressionLevel is the highest level accepted by the lz4 CLI.
+const maxCompressionLevel = 12
+
+func init() {
+	if err := compzstd.DefaultRegistry.Register("lz4", NewCompressor()); err != nil {
+		panic(err)
+	}
+}
+
+// Compressor implements compzstd.Compressor using the pure Go pierrec/lz4 library.
+// Output uses the lz4 frame format.
+type Compressor struct{}
+
+// NewCompressor creates a new lz4 compressor
+func NewCompressor() compzstd.Compressor {
+	return &Compressor{}
+}
+
+// NewWriter creates a new lz4 frame writer with the specified compression level.
+// Levels follow the lz4 CLI: 0 selects the default, 1-2 use the fast compressor
+// and 3-12 use the high compression compressor with increasing depth.
+func (c *Compressor) NewWriter(w io.Writer, level int) (compzstd.WriteFlushCloser, error) {
+	if level < 0 || level > maxCompressionLevel {
+		return nil, fmt.Errorf("invalid compression level %d: must be between 0 and %d", level, maxCompressionLevel)
+	}
+	zw := lz4.NewWriter(w)
+	if err := zw.Apply(lz4.CompressionLevelOption(compressionLevel(level))); err != nil {
+		return nil, err
+	}
+	return &writer{Writer: zw}, nil
+}
+
+// NewReader creates a new lz4 frame reader
+func (c *Compressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(lz4.NewReader(r)), nil
+}
+
+// Name returns the name of the compressor implementation
+func (c *Compressor) Name() string {
+	return "lz4 (pierrec/lz4)"
+}
+
+// IsLibzstdAvailable returns false as this isn't a zstd implementation
+func (c *Compressor) IsLibzstdAvailable() bool {
+	return false
+}
+
+// MaxCompressionLevel returns the maximum supported compression level
+func (c *Compressor) MaxCompressionLevel() int {
+	return maxCompressionLevel
+}
+
+// compressionLevel maps lz4 CLI levels to the library's levels.
+func compressionLevel(level int) lz4.CompressionLevel {
+	if level <= 2 {
+		return lz4.Fast
+	}
+	levels := []lz4.CompressionLevel{lz4.Level1, lz4.Level2, lz4.Level3, lz4.Level4,
+		lz4.Level5, lz4.Level6, lz4.Level7, lz4.Level8, lz4.Level9}
+	if n := level - 3; n < len(levels) {
+		return levels[n]
+	}
+	return lz4.Level9
+}
+
+// writer wraps lz4.Writer to implement compzstd.WriteFlushCloser
+type writer struct {
+	*lz4.Writer
+	compzstd.PlaintextChecksum
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	w.Update(p[:n])
+	return n, err
+}
+
+func (w *writer) ReadFrom(r io.Reader) (int64, error) {
+	return w.Writer.ReadFrom(w.TeeReader(r))
+}
+
+func (w *writer) Reset(dst io.Writer) error {
+	w.Writer.Reset(dst)
+	w.ResetChecksum()
+	return nil
+}
@@ -0,0 +1,92 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package lz4
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"testing"
+)
+
+var testData = bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog. "), 10000)
+
+func compress(t *testing.T, level int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewCompressor().NewWriter(&buf, level)
+	if err != nil {
+		t.Fatalf("failed to create writer: %v", err)
+	}
+	if _, err := w.Write(testData); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, level := range []int{1, 6, 12} {
+		t.Run(fmt.Sprintf("Level_%d", level), func(t *testing.T) {
+			compressed := compress(t, level)
+			r, err := NewCompressor().NewReader(bytes.NewReader(compressed))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			decompressed, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(decompressed, testData) {
+				t.Errorf("decompressed data doesn't match original")
+			}
+		})
+	}
+}
+
+func TestLz4CatCompatibility(t *testing.T) {
+	lz4cat, err := exec.LookPath("lz4cat")
+	if err != nil {
+		t.Skip("lz4cat not found")
+	}
+	for _, level := range []int{1, 6, 12} {
+		t.Run(fmt.Sprintf("Level_%d", level), func(t *testing.T) {
+			cmd := exec.Command(lz4cat)
+			cmd.Stdin = bytes.NewReader(compress(t, level))
+			out, err := cmd.Output()
+			if err != nil {
+				t.Fatalf("lz4cat failed: %v", err)
+			}
+			if !bytes.Equal(out, testData) {
+				t.Errorf("output of lz4cat doesn't match original")
+			}
+		})
+	}
+}
+
+func TestInvalidCompressionLevel(t *testing.T) {
+	c := NewCompressor()
+	for _, level := range []int{-1, c.MaxCompressionLevel() + 1} {
+		if _, err := c.NewWriter(io.Discard, level); err == nil {
+			t.Errorf("expected error for level %d", level)
+		}
+	}
+}
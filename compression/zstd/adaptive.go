@@ -0,0 +1,174 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package zstd
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// adaptiveSmoothing is the weight of the latest Write call in the moving
+	// averages of AdaptiveCompressor
+	adaptiveSmoothing = 0.5
+
+	// adaptiveHeadroom is how much the throughput must exceed the target before
+	// AdaptiveCompressor raises the level, so that it doesn't oscillate around it
+	adaptiveHeadroom = 1.25
+)
+
+// AdaptiveCompressor is a Compressor that tunes the compression level of inner to
+// keep the throughput of its writers at a target rate. It keeps a moving average
+// of the bytes per second of the Write calls of all its writers, lowers the level
+// by one after each Write while the average is below the target and raises it by
+// one while the average exceeds the target with some headroom, between 1 and
+// inner.MaxCompressionLevel().
+//
+// The level of a writer can't change while it is compressing a stream, so the
+// tuned level applies to the writers created afterwards. The level passed to the
+// first NewWriter call is the initial level; later calls use the tuned level.
+type AdaptiveCompressor struct {
+	inner      Compressor
+	targetMBps float64
+	now        func() time.Time
+
+	mu    sync.Mutex
+	level int // 0 until the first NewWriter call
+
+	// moving averages of the size and duration of the Write calls
+	avgBytes    float64
+	avgDuration float64
+}
+
+// NewAdaptiveCompressor creates an AdaptiveCompressor keeping the throughput of
+// the writers of inner at targetMBps megabytes (1e6 bytes) per second
+func NewAdaptiveCompressor(inner Compressor, targetMBps float64) *AdaptiveCompressor {
+	return &AdaptiveCompressor{
+		inner:      inner,
+		targetMBps: targetMBps,
+		now:        time.Now,
+	}
+}
+
+// NewWriter creates a writer of the inner compressor with the tuned level. level
+// is only used by the first call, as the initial level.
+func (a *AdaptiveCompressor) NewWriter(w io.Writer, level int) (WriteFlushCloser, error) {
+	a.mu.Lock()
+	if a.level == 0 {
+		a.level = a.clamp(level)
+	}
+	level = a.level
+	a.mu.Unlock()
+
+	zw, err := a.inner.NewWriter(w, level)
+	if err != nil {
+		return nil, err
+	}
+	return &adaptiveWriter{WriteFlushCloser: zw, a: a}, nil
+}
+
+// NewReader creates a reader of the inner compressor
+func (a *AdaptiveCompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return a.inner.NewReader(r)
+}
+
+// Name returns the name of the inner compressor
+func (a *AdaptiveCompressor) Name() string {
+	return fmt.Sprintf("adaptive %s", a.inner.Name())
+}
+
+// IsLibzstdAvailable returns whether the inner compressor uses libzstd
+func (a *AdaptiveCompressor) IsLibzstdAvailable() bool {
+	return a.inner.IsLibzstdAvailable()
+}
+
+// MaxCompressionLevel returns the maximum level of the inner compressor
+func (a *AdaptiveCompressor) MaxCompressionLevel() int {
+	return a.inner.MaxCompressionLevel()
+}
+
+// Level returns the level that the next writer will be created with, or 0 if
+// NewWriter hasn't been called yet
+func (a *AdaptiveCompressor) Level() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.level
+}
+
+// Throughput returns the moving average of the throughput of the writers in
+// megabytes per second
+func (a *AdaptiveCompressor) Throughput() float64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.throughput()
+}
+
+func (a *AdaptiveCompressor) throughput() float64 {
+	if a.avgDuration == 0 {
+		if a.avgBytes == 0 {
+			return 0
+		}
+		return math.Inf(1)
+	}
+	return a.avgBytes / a.avgDuration / 1e6
+}
+
+// observe records a Write call of n bytes that took d and adjusts the level
+func (a *AdaptiveCompressor) observe(n int, d time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.avgBytes == 0 && a.avgDuration == 0 {
+		a.avgBytes, a.avgDuration = float64(n), d.Seconds()
+	} else {
+		a.avgBytes += adaptiveSmoothing * (float64(n) - a.avgBytes)
+		a.avgDuration += adaptiveSmoothing * (d.Seconds() - a.avgDuration)
+	}
+	switch mbps := a.throughput(); {
+	case mbps < a.targetMBps:
+		a.level = a.clamp(a.level - 1)
+	case mbps > a.targetMBps*adaptiveHeadroom:
+		a.level = a.clamp(a.level + 1)
+	}
+}
+
+func (a *AdaptiveCompressor) clamp(level int) int {
+	if maxLevel := a.inner.MaxCompressionLevel(); level > maxLevel {
+		return maxLevel
+	}
+	if level < 1 {
+		return 1
+	}
+	return level
+}
+
+// adaptiveWriter measures the throughput of a writer of AdaptiveCompressor
+type adaptiveWriter struct {
+	WriteFlushCloser
+	a *AdaptiveCompressor
+}
+
+func (aw *adaptiveWriter) Write(p []byte) (int, error) {
+	start := aw.a.now()
+	n, err := aw.WriteFlushCloser.Write(p)
+	if n > 0 {
+		aw.a.observe(n, aw.a.now().Sub(start))
+	}
+	return n, err
+}
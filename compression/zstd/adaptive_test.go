@@ -0,0 +1,109 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package zstd
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+// clockWriter advances a fake clock by delay on each write
+type clockWriter struct {
+	w     io.Writer
+	clock *time.Time
+	delay time.Duration
+}
+
+func (cw *clockWriter) Write(p []byte) (int, error) {
+	*cw.clock = cw.clock.Add(cw.delay)
+	return cw.w.Write(p)
+}
+
+func TestAdaptiveCompressor(t *testing.T) {
+	inner := NewMockCompressor()
+	a := NewAdaptiveCompressor(inner, 10)
+	clock := time.Unix(0, 0)
+	a.now = func() time.Time { return clock }
+
+	// 1KB per 10ms is 0.1MB/s, far below the target
+	var buf bytes.Buffer
+	slow := &clockWriter{w: &buf, clock: &clock, delay: 10 * time.Millisecond}
+	w, err := a.NewWriter(slow, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Level() != 5 {
+		t.Fatalf("initial level = %d; want 5", a.Level())
+	}
+	chunk := make([]byte, 1024)
+	var writes int
+	for ; writes < 5 && a.Level() == 5; writes++ {
+		if _, err := w.Write(chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if a.Level() >= 5 {
+		t.Fatalf("level = %d after 5 slow writes; want < 5", a.Level())
+	}
+	for i := 0; i < 10; i++ {
+		if _, err := w.Write(chunk); err != nil {
+			t.Fatal(err)
+		}
+		writes++
+	}
+	if a.Level() != 1 {
+		t.Errorf("level = %d after %d slow writes; want the minimum 1", a.Level(), writes)
+	}
+	if got := a.Throughput(); got > 0.2 {
+		t.Errorf("throughput = %.2fMB/s; want about 0.1MB/s", got)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != writes*len(chunk) {
+		t.Errorf("wrote %d bytes; want %d", buf.Len(), writes*len(chunk))
+	}
+
+	// Writers created afterwards use the tuned level, not the requested one, and
+	// 1MB per 1ms raises it up to the maximum once the average recovers
+	fast := &clockWriter{w: io.Discard, clock: &clock, delay: time.Millisecond}
+	if w, err = a.NewWriter(fast, 5); err != nil {
+		t.Fatal(err)
+	}
+	if a.Level() != 1 {
+		t.Errorf("level = %d after NewWriter; want the tuned level 1", a.Level())
+	}
+	chunk = make([]byte, 1<<20)
+	for i := 0; i < 5 && a.Level() == 1; i++ {
+		if _, err := w.Write(chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if a.Level() <= 1 {
+		t.Fatalf("level = %d after 5 fast writes; want > 1", a.Level())
+	}
+	for i := 0; i < 2*inner.MaxCompressionLevel(); i++ {
+		if _, err := w.Write(chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if a.Level() != inner.MaxCompressionLevel() {
+		t.Errorf("level = %d after fast writes; want the maximum %d", a.Level(), inner.MaxCompressionLevel())
+	}
+}
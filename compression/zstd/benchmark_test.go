@@ -14,13 +14,15 @@
    limitations under the License.
 */
 
-package zstd
+package zstd_test
 
 import (
 	"bytes"
 	"fmt"
-	"io"
 	"testing"
+
+	"github.com/containerd/stargz-snapshotter/compression/benchmark"
+	"github.com/containerd/stargz-snapshotter/compression/zstd"
 )
 
 // Test data sizes
@@ -40,158 +42,28 @@ func generateTestData() []byte {
 	return data
 }
 
-// Benchmark compression at different levels
-func benchmarkCompression(b *testing.B, compressor Compressor, level int) {
-	b.ResetTimer()
-	b.SetBytes(int64(len(testData)))
-	
-	for i := 0; i < b.N; i++ {
-		var buf bytes.Buffer
-		writer, err := compressor.NewWriter(&buf, level)
-		if err != nil {
-			b.Fatal(err)
-		}
-		
-		n, err := writer.Write(testData)
-		if err != nil {
-			b.Fatal(err)
-		}
-		if n != len(testData) {
-			b.Fatalf("short write: %d/%d", n, len(testData))
-		}
-		
-		if err := writer.Close(); err != nil {
-			b.Fatal(err)
-		}
-	}
-}
+// BenchmarkImplementations runs the shared benchmark matrix against all
+// available implementations
+func BenchmarkImplementations(b *testing.B) {
+	defer zstd.SetupSingleThreadedBenchmark(b)()
 
-// Benchmark decompression
-func benchmarkDecompression(b *testing.B, compressor Compressor, level int) {
-	// First compress the data
-	var compressed bytes.Buffer
-	writer, err := compressor.NewWriter(&compressed, level)
-	if err != nil {
-		b.Fatal(err)
+	implementations := map[string]zstd.Compressor{
+		"PureGo": zstd.NewPureGoCompressor(),
 	}
-	if _, err := writer.Write(testData); err != nil {
-		b.Fatal(err)
-	}
-	if err := writer.Close(); err != nil {
-		b.Fatal(err)
+	if gozstd := zstd.NewGozstdCompressor(); gozstd.IsLibzstdAvailable() {
+		implementations["Gozstd"] = gozstd
 	}
-	
-	compressedData := compressed.Bytes()
-	
-	b.ResetTimer()
-	b.SetBytes(int64(len(testData)))
-	
-	for i := 0; i < b.N; i++ {
-		reader, err := compressor.NewReader(bytes.NewReader(compressedData))
-		if err != nil {
-			b.Fatal(err)
-		}
-		
-		decompressed, err := io.ReadAll(reader)
-		if err != nil {
-			b.Fatal(err)
-		}
-		
-		if len(decompressed) != len(testData) {
-			b.Fatalf("decompressed size mismatch: %d/%d", len(decompressed), len(testData))
-		}
-		
-		reader.Close()
-	}
-}
-
-// Pure Go benchmarks
-func BenchmarkPureGoCompressionLevel1(b *testing.B) {
-	defer SetupSingleThreadedBenchmark(b)()
-	benchmarkCompression(b, NewPureGoCompressor(), 1)
-}
-
-func BenchmarkPureGoCompressionLevel3(b *testing.B) {
-	defer SetupSingleThreadedBenchmark(b)()
-	benchmarkCompression(b, NewPureGoCompressor(), 3)
-}
-
-func BenchmarkPureGoCompressionLevel11(b *testing.B) {
-	defer SetupSingleThreadedBenchmark(b)()
-	benchmarkCompression(b, NewPureGoCompressor(), 11)
-}
-
-func BenchmarkPureGoDecompressionLevel3(b *testing.B) {
-	defer SetupSingleThreadedBenchmark(b)()
-	benchmarkDecompression(b, NewPureGoCompressor(), 3)
-}
-
-// Gozstd benchmarks (will skip if libzstd not available)
-func BenchmarkGozstdCompressionLevel1(b *testing.B) {
-	defer SetupSingleThreadedBenchmark(b)()
-	compressor := NewGozstdCompressor()
-	if !compressor.IsLibzstdAvailable() {
-		b.Skip("libzstd not available")
-	}
-	benchmarkCompression(b, compressor, 1)
-}
-
-func BenchmarkGozstdCompressionLevel3(b *testing.B) {
-	defer SetupSingleThreadedBenchmark(b)()
-	compressor := NewGozstdCompressor()
-	if !compressor.IsLibzstdAvailable() {
-		b.Skip("libzstd not available")
-	}
-	benchmarkCompression(b, compressor, 3)
-}
-
-func BenchmarkGozstdCompressionLevel11(b *testing.B) {
-	defer SetupSingleThreadedBenchmark(b)()
-	compressor := NewGozstdCompressor()
-	if !compressor.IsLibzstdAvailable() {
-		b.Skip("libzstd not available")
-	}
-	benchmarkCompression(b, compressor, 11)
-}
-
-func BenchmarkGozstdCompressionLevel22(b *testing.B) {
-	defer SetupSingleThreadedBenchmark(b)()
-	compressor := NewGozstdCompressor()
-	if !compressor.IsLibzstdAvailable() {
-		b.Skip("libzstd not available")
-	}
-	benchmarkCompression(b, compressor, 22)
-}
-
-func BenchmarkGozstdDecompressionLevel3(b *testing.B) {
-	defer SetupSingleThreadedBenchmark(b)()
-	compressor := NewGozstdCompressor()
-	if !compressor.IsLibzstdAvailable() {
-		b.Skip("libzstd not available")
-	}
-	benchmarkDecompression(b, compressor, 3)
-}
-
-// Memory usage benchmarks
-func BenchmarkPureGoMemoryUsage(b *testing.B) {
-	defer SetupSingleThreadedBenchmark(b)()
-	b.ReportAllocs()
-	benchmarkCompression(b, NewPureGoCompressor(), 3)
-}
 
-func BenchmarkGozstdMemoryUsage(b *testing.B) {
-	defer SetupSingleThreadedBenchmark(b)()
-	compressor := NewGozstdCompressor()
-	if !compressor.IsLibzstdAvailable() {
-		b.Skip("libzstd not available")
+	h := benchmark.NewHarness(implementations)
+	h.RunAll(b, []int{len(testData)}, []int{1, 3, 11, 22})
+	if _, ok := implementations["Gozstd"]; ok {
+		b.Logf("\n%s", h.CompareResults("PureGo", "Gozstd"))
 	}
-	b.ReportAllocs()
-	benchmarkCompression(b, compressor, 3)
 }
 
 // Compression ratio benchmark
 func TestCompressionRatio(t *testing.T) {
-	defer SetupSingleThreadedTest(t)()
+	zstd.SetupSingleThreadedTest(t)
 	levels := []int{1, 3, 11, 22}
 	
 	for _, level := range levels {
@@ -199,11 +71,11 @@ func TestCompressionRatio(t *testing.T) {
 			if level > 11 {
 				t.Skip("Pure Go only supports up to level 11")
 			}
-			testCompressionRatio(t, NewPureGoCompressor(), level)
+			testCompressionRatio(t, zstd.NewPureGoCompressor(), level)
 		})
 		
 		t.Run(fmt.Sprintf("Gozstd_Level%d", level), func(t *testing.T) {
-			compressor := NewGozstdCompressor()
+			compressor := zstd.NewGozstdCompressor()
 			if !compressor.IsLibzstdAvailable() {
 				t.Skip("libzstd not available")
 			}
@@ -212,7 +84,7 @@ func TestCompressionRatio(t *testing.T) {
 	}
 }
 
-func testCompressionRatio(t *testing.T, compressor Compressor, level int) {
+func testCompressionRatio(t *testing.T, compressor zstd.Compressor, level int) {
 	var compressed bytes.Buffer
 	writer, err := compressor.NewWriter(&compressed, level)
 	if err != nil {
@@ -0,0 +1,180 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package zstd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// These are replaced in tests
+var (
+	// cgroupRoot is where the cgroup hierarchies are mounted
+	cgroupRoot = "/sys/fs/cgroup"
+
+	// procSelfCgroup lists the cgroups of the process
+	procSelfCgroup = "/proc/self/cgroup"
+)
+
+// CGroupCPUQuota returns the number of CPUs the CPU quota of the process's cgroup
+// allows, e.g. 1.5 for a quota of 150ms per 100ms period. The cgroup v2 cpu.max
+// is used if it sets a quota, otherwise the cgroup v1 CFS quota. It returns 0 and
+// a nil error if no quota is set or the files of the cpu controller don't exist,
+// and an error if they can't be read or parsed.
+func CGroupCPUQuota() (float64, error) {
+	quota, _, err := cgroupCPUQuota(cgroupRoot, procSelfCgroup)
+	return quota, err
+}
+
+// cgroupCPULimit returns the number of CPUs the CPU quota of the process's cgroup
+// allows, rounded up. ok is false if there is no quota.
+func cgroupCPULimit(root, procCgroup string) (cpus int, source WorkerCountSource, ok bool) {
+	quota, source, err := cgroupCPUQuota(root, procCgroup)
+	if err != nil || quota == 0 {
+		return 0, 0, false
+	}
+	return int(math.Ceil(quota)), source, true
+}
+
+func cgroupCPUQuota(root, procCgroup string) (float64, WorkerCountSource, error) {
+	v2Path, v1Path, err := parseProcCgroup(procCgroup)
+	if err != nil {
+		return 0, 0, err
+	}
+	if v2Path != "" {
+		quota, err := cgroupV2CPUQuota(root, v2Path)
+		if err != nil || quota > 0 {
+			return quota, WorkerCountSourceCGroupV2, err
+		}
+	}
+	if v1Path != "" {
+		quota, err := cgroupV1CPUQuota(root, v1Path)
+		if err != nil || quota > 0 {
+			return quota, WorkerCountSourceCGroupV1, err
+		}
+	}
+	return 0, 0, nil
+}
+
+// parseProcCgroup returns the cgroup v2 path and the path in the cgroup v1 cpu
+// hierarchy listed in /proc/self/cgroup
+func parseProcCgroup(procCgroup string) (v2Path, v1Path string, _ error) {
+	f, err := os.Open(procCgroup)
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// hierarchy-ID:controller-list:cgroup-path
+		fields := strings.SplitN(scanner.Text(), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		if fields[0] == "0" && fields[1] == "" {
+			v2Path = fields[2]
+			continue
+		}
+		for _, c := range strings.Split(fields[1], ",") {
+			if c == "cpu" {
+				v1Path = fields[2]
+			}
+		}
+	}
+	return v2Path, v1Path, scanner.Err()
+}
+
+// cgroupV2CPUQuota reads cpu.max ("$MAX $PERIOD") of the cgroup. The cgroup
+// namespace may hide the path, so the root cgroup is tried as well.
+func cgroupV2CPUQuota(root, path string) (float64, error) {
+	for _, dir := range []string{filepath.Join(root, path), root} {
+		b, err := readCgroupFile(filepath.Join(dir, "cpu.max"))
+		if err != nil {
+			return 0, err
+		}
+		if b == nil {
+			continue
+		}
+		fields := strings.Fields(string(b))
+		if len(fields) != 2 {
+			return 0, fmt.Errorf("invalid cpu.max %q", b)
+		}
+		if fields[0] == "max" {
+			return 0, nil
+		}
+		return parseQuota(fields[0], fields[1])
+	}
+	return 0, nil
+}
+
+// cgroupV1CPUQuota reads cpu.cfs_quota_us and cpu.cfs_period_us of the cgroup
+func cgroupV1CPUQuota(root, path string) (float64, error) {
+	for _, mount := range []string{"cpu", "cpu,cpuacct", "cpuacct,cpu"} {
+		for _, dir := range []string{filepath.Join(root, mount, path), filepath.Join(root, mount)} {
+			quota, err := readCgroupFile(filepath.Join(dir, "cpu.cfs_quota_us"))
+			if err != nil {
+				return 0, err
+			}
+			if quota == nil {
+				continue
+			}
+			period, err := readCgroupFile(filepath.Join(dir, "cpu.cfs_period_us"))
+			if err != nil {
+				return 0, err
+			}
+			if period == nil {
+				continue
+			}
+			return parseQuota(strings.TrimSpace(string(quota)), strings.TrimSpace(string(period)))
+		}
+	}
+	return 0, nil
+}
+
+// readCgroupFile returns nil and no error if the file doesn't exist
+func readCgroupFile(name string) ([]byte, error) {
+	b, err := os.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return b, err
+}
+
+func parseQuota(quota, period string) (float64, error) {
+	q, err := strconv.ParseInt(quota, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid CPU quota: %w", err)
+	}
+	if q <= 0 { // -1 means no quota in cgroup v1
+		return 0, nil
+	}
+	p, err := strconv.ParseInt(period, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid CPU period: %w", err)
+	}
+	if p <= 0 {
+		return 0, fmt.Errorf("invalid CPU period %d", p)
+	}
+	return float64(q) / float64(p), nil
+}
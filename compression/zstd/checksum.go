@@ -0,0 +1,101 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package zstd
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"sync/atomic"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// ChecksumAlgorithm selects the hash returned by WriteFlushCloser.Checksum
+type ChecksumAlgorithm int32
+
+const (
+	// ChecksumXXHash64 is the 64-bit xxHash of the input, in big-endian byte order
+	ChecksumXXHash64 ChecksumAlgorithm = iota
+	// ChecksumSHA256 is the SHA-256 digest of the input
+	ChecksumSHA256
+)
+
+func (a ChecksumAlgorithm) String() string {
+	switch a {
+	case ChecksumXXHash64:
+		return "xxhash64"
+	case ChecksumSHA256:
+		return "sha256"
+	}
+	return fmt.Sprintf("ChecksumAlgorithm(%d)", int(a))
+}
+
+// configuredChecksum is the algorithm set by SetChecksumAlgorithm
+var configuredChecksum atomic.Int32
+
+// SetChecksumAlgorithm sets the algorithm used by the writers created after the call.
+// The default is ChecksumXXHash64.
+func SetChecksumAlgorithm(a ChecksumAlgorithm) error {
+	if a != ChecksumXXHash64 && a != ChecksumSHA256 {
+		return fmt.Errorf("unknown checksum algorithm %v", a)
+	}
+	configuredChecksum.Store(int32(a))
+	return nil
+}
+
+// PlaintextChecksum keeps the rolling checksum of the plaintext passed to a
+// WriteFlushCloser. Implementations embed it, pass every byte accepted by Write
+// to Update and call ResetChecksum from Reset. The zero value is ready to use.
+type PlaintextChecksum struct {
+	h hash.Hash
+}
+
+func (c *PlaintextChecksum) hash() hash.Hash {
+	if c.h == nil {
+		switch ChecksumAlgorithm(configuredChecksum.Load()) {
+		case ChecksumSHA256:
+			c.h = sha256.New()
+		default:
+			c.h = xxhash.New()
+		}
+	}
+	return c.h
+}
+
+// Update adds p to the checksum
+func (c *PlaintextChecksum) Update(p []byte) {
+	c.hash().Write(p)
+}
+
+// TeeReader returns a reader that adds what it reads from r to the checksum.
+// It is meant for the ReadFrom methods of the wrapped writers.
+func (c *PlaintextChecksum) TeeReader(r io.Reader) io.Reader {
+	return io.TeeReader(r, c.hash())
+}
+
+// Checksum returns the checksum of the bytes added since the creation or the
+// last ResetChecksum
+func (c *PlaintextChecksum) Checksum() []byte {
+	return c.hash().Sum(nil)
+}
+
+// ResetChecksum restarts the checksum from an empty input
+func (c *PlaintextChecksum) ResetChecksum() {
+	c.hash().Reset()
+}
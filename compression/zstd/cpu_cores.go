@@ -17,40 +17,135 @@
 package zstd
 
 import (
+	"fmt"
 	"os"
 	"runtime"
 	"strconv"
+	"sync/atomic"
 
 	"github.com/shirou/gopsutil/v4/cpu"
 )
 
+// WorkerCountSource tells how GetOptimalWorkerCountWithSource determined the worker count
+type WorkerCountSource int
+
+const (
+	// WorkerCountSourceAuto means 75% of the physical CPU cores
+	WorkerCountSourceAuto WorkerCountSource = iota
+	// WorkerCountSourceEnvVar means the ZSTD_WORKERS environment variable
+	WorkerCountSourceEnvVar
+	// WorkerCountSourceConfig means the value passed to SetWorkerCount
+	WorkerCountSourceConfig
+	// WorkerCountSourceCGroupV2 means 75% of the CPUs allowed by the cgroup v2 cpu.max quota
+	WorkerCountSourceCGroupV2
+	// WorkerCountSourceCGroupV1 means 75% of the CPUs allowed by the cgroup v1 CFS quota
+	WorkerCountSourceCGroupV1
+	// WorkerCountSourceFallback means half of the logical CPUs, used when the
+	// physical cores can't be detected
+	WorkerCountSourceFallback
+)
+
+func (s WorkerCountSource) String() string {
+	switch s {
+	case WorkerCountSourceAuto:
+		return "auto"
+	case WorkerCountSourceEnvVar:
+		return "env"
+	case WorkerCountSourceConfig:
+		return "config"
+	case WorkerCountSourceCGroupV2:
+		return "cgroupv2"
+	case WorkerCountSourceCGroupV1:
+		return "cgroupv1"
+	case WorkerCountSourceFallback:
+		return "fallback"
+	}
+	return fmt.Sprintf("WorkerCountSource(%d)", int(s))
+}
+
+var (
+	// configuredWorkers is the worker count set by SetWorkerCount (0 if unset)
+	configuredWorkers atomic.Int32
+
+	// physicalCoreCount is replaced in tests
+	physicalCoreCount = GetPhysicalCoreCount
+)
+
+// SetWorkerCount sets the number of compression workers, overriding ZSTD_WORKERS
+// (e.g. from the zstd_workers config). n <= 0 restores ZSTD_WORKERS and the
+// automatic detection.
+func SetWorkerCount(n int) {
+	if n < 0 {
+		n = 0
+	}
+	configuredWorkers.Store(int32(n))
+}
+
 // GetOptimalWorkerCount returns the optimal number of compression workers
-// based on physical CPU cores. It can be overridden by the ZSTD_WORKERS
-// environment variable.
+// based on physical CPU cores. It can be overridden by SetWorkerCount and the
+// ZSTD_WORKERS environment variable.
 func GetOptimalWorkerCount() int {
-	// Check environment variable first
+	n, _ := GetOptimalWorkerCountWithSource()
+	return n
+}
+
+// GetOptimalWorkerCountWithSource is the same as GetOptimalWorkerCount but also
+// returns how the worker count was determined. In order of precedence it's taken
+// from SetWorkerCount, ZSTD_WORKERS, the CPU quota of the cgroup if it allows
+// fewer CPUs than the physical cores, and the physical cores.
+func GetOptimalWorkerCountWithSource() (int, WorkerCountSource) {
+	if n := configuredWorkers.Load(); n > 0 {
+		return int(n), WorkerCountSourceConfig
+	}
 	if workers := os.Getenv("ZSTD_WORKERS"); workers != "" {
 		if n, err := strconv.Atoi(workers); err == nil && n > 0 {
-			return n
+			return n, WorkerCountSourceEnvVar
 		}
 		// Invalid ZSTD_WORKERS value, fall through to automatic detection
 	}
-	
-	// Try to get physical cores
-	if cores, err := cpu.Counts(false); err == nil && cores > 0 {
-		// Use 75% of physical cores to leave room for other processes
-		workers := cores * 3 / 4
-		if workers < 1 {
-			workers = 1
-		}
-		return workers
+
+	// Use 75% of the available cores to leave room for other processes
+	cores, err := physicalCoreCount()
+	if cpus, source, ok := cgroupCPULimit(cgroupRoot, procSelfCgroup); ok && (err != nil || cpus < cores) {
+		return scaleWorkers(cpus), source
+	}
+	if err == nil {
+		return scaleWorkers(cores), WorkerCountSourceAuto
 	}
-	
+
 	// Fallback to runtime.NumCPU() / 2 (assume hyperthreading)
-	logical := runtime.NumCPU()
-	workers := logical / 2
+	workers := runtime.NumCPU() / 2
+	if workers < 1 {
+		workers = 1
+	}
+	return workers, WorkerCountSourceFallback
+}
+
+func scaleWorkers(cpus int) int {
+	workers := cpus * 3 / 4
 	if workers < 1 {
 		workers = 1
 	}
 	return workers
-}
\ No newline at end of file
+}
+
+// GetPhysicalCoreCount returns the number of physical CPU cores of the host.
+func GetPhysicalCoreCount() (int, error) {
+	return countCores(false)
+}
+
+// GetLogicalCoreCount returns the number of logical CPUs (hardware threads) of the host.
+func GetLogicalCoreCount() (int, error) {
+	return countCores(true)
+}
+
+func countCores(logical bool) (int, error) {
+	cores, err := cpu.Counts(logical)
+	if err != nil {
+		return 0, err
+	}
+	if cores < 1 {
+		return 0, fmt.Errorf("failed to detect CPU cores (logical=%v)", logical)
+	}
+	return cores, nil
+}
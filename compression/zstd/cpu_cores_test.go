@@ -0,0 +1,242 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package zstd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestCoreCounts(t *testing.T) {
+	physical, err := GetPhysicalCoreCount()
+	if err != nil {
+		t.Fatalf("failed to get physical core count: %v", err)
+	}
+	logical, err := GetLogicalCoreCount()
+	if err != nil {
+		t.Fatalf("failed to get logical core count: %v", err)
+	}
+	if physical < 1 {
+		t.Errorf("physical core count should be at least 1, got %d", physical)
+	}
+	if logical < 1 {
+		t.Errorf("logical core count should be at least 1, got %d", logical)
+	}
+	if physical > logical {
+		t.Errorf("physical core count %d exceeds logical core count %d", physical, logical)
+	}
+	t.Logf("physical cores: %d, logical cores: %d", physical, logical)
+}
+
+// writeFiles creates the files under a temporary directory and returns it
+func writeFiles(t *testing.T, files map[string]string) string {
+	root := t.TempDir()
+	for name, contents := range files {
+		p := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestGetOptimalWorkerCountWithSource(t *testing.T) {
+	fallback := runtime.NumCPU() / 2
+	if fallback < 1 {
+		fallback = 1
+	}
+
+	tests := []struct {
+		name       string
+		env        string
+		configured int
+		coresErr   bool
+		files      map[string]string
+		want       int
+		wantSource WorkerCountSource
+	}{
+		{
+			name:       "auto",
+			want:       6,
+			wantSource: WorkerCountSourceAuto,
+		},
+		{
+			name:       "env",
+			env:        "3",
+			want:       3,
+			wantSource: WorkerCountSourceEnvVar,
+		},
+		{
+			name:       "config",
+			env:        "3",
+			configured: 5,
+			want:       5,
+			wantSource: WorkerCountSourceConfig,
+		},
+		{
+			name:       "invalid env",
+			env:        "invalid",
+			want:       6,
+			wantSource: WorkerCountSourceAuto,
+		},
+		{
+			name: "cgroup v2",
+			files: map[string]string{
+				"proc/self/cgroup":      "0::/kubepods/pod1\n",
+				"kubepods/pod1/cpu.max": "250000 100000\n",
+			},
+			want:       2, // 3 CPUs
+			wantSource: WorkerCountSourceCGroupV2,
+		},
+		{
+			name: "cgroup v2 without quota",
+			files: map[string]string{
+				"proc/self/cgroup": "0::/\n",
+				"cpu.max":          "max 100000\n",
+			},
+			want:       6,
+			wantSource: WorkerCountSourceAuto,
+		},
+		{
+			name: "cgroup v1",
+			files: map[string]string{
+				"proc/self/cgroup":                         "12:memory:/docker/abc\n4:cpu,cpuacct:/docker/abc\n",
+				"cpu,cpuacct/docker/abc/cpu.cfs_quota_us":  "400000\n",
+				"cpu,cpuacct/docker/abc/cpu.cfs_period_us": "100000\n",
+			},
+			want:       3,
+			wantSource: WorkerCountSourceCGroupV1,
+		},
+		{
+			name: "cgroup quota above physical cores",
+			files: map[string]string{
+				"proc/self/cgroup": "0::/\n",
+				"cpu.max":          "1600000 100000\n",
+			},
+			want:       6,
+			wantSource: WorkerCountSourceAuto,
+		},
+		{
+			name:       "fallback",
+			coresErr:   true,
+			want:       fallback,
+			wantSource: WorkerCountSourceFallback,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ZSTD_WORKERS", tt.env)
+			SetWorkerCount(tt.configured)
+			defer SetWorkerCount(0)
+
+			root := writeFiles(t, tt.files)
+			origRoot, origProc, origCores := cgroupRoot, procSelfCgroup, physicalCoreCount
+			defer func() { cgroupRoot, procSelfCgroup, physicalCoreCount = origRoot, origProc, origCores }()
+			cgroupRoot, procSelfCgroup = root, filepath.Join(root, "proc/self/cgroup")
+			physicalCoreCount = func() (int, error) {
+				if tt.coresErr {
+					return 0, errors.New("unknown")
+				}
+				return 8, nil
+			}
+
+			n, source := GetOptimalWorkerCountWithSource()
+			if n != tt.want || source != tt.wantSource {
+				t.Errorf("GetOptimalWorkerCountWithSource() = %d, %v; want %d, %v", n, source, tt.want, tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestCGroupCPUQuota(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		want    float64
+		wantErr bool
+	}{
+		{
+			name: "cgroup v2",
+			files: map[string]string{
+				"proc/self/cgroup":      "0::/kubepods/pod1\n",
+				"kubepods/pod1/cpu.max": "150000 100000\n",
+			},
+			want: 1.5,
+		},
+		{
+			name: "cgroup v1",
+			files: map[string]string{
+				"proc/self/cgroup":                         "4:cpu,cpuacct:/docker/abc\n",
+				"cpu,cpuacct/docker/abc/cpu.cfs_quota_us":  "50000\n",
+				"cpu,cpuacct/docker/abc/cpu.cfs_period_us": "100000\n",
+			},
+			want: 0.5,
+		},
+		{
+			name: "cgroup v2 without quota",
+			files: map[string]string{
+				"proc/self/cgroup": "0::/\n",
+				"cpu.max":          "max 100000\n",
+			},
+		},
+		{
+			name: "cgroup v1 without quota",
+			files: map[string]string{
+				"proc/self/cgroup":      "4:cpu:/\n",
+				"cpu/cpu.cfs_quota_us":  "-1\n",
+				"cpu/cpu.cfs_period_us": "100000\n",
+			},
+		},
+		{
+			name: "no cpu controller",
+			files: map[string]string{
+				"proc/self/cgroup": "0::/\n",
+			},
+		},
+		{
+			name:    "missing proc cgroup",
+			wantErr: true,
+		},
+		{
+			name: "invalid cpu.max",
+			files: map[string]string{
+				"proc/self/cgroup": "0::/\n",
+				"cpu.max":          "150000\n",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := writeFiles(t, tt.files)
+			origRoot, origProc := cgroupRoot, procSelfCgroup
+			defer func() { cgroupRoot, procSelfCgroup = origRoot, origProc }()
+			cgroupRoot, procSelfCgroup = root, filepath.Join(root, "proc/self/cgroup")
+
+			quota, err := CGroupCPUQuota()
+			if (err != nil) != tt.wantErr || quota != tt.want {
+				t.Errorf("CGroupCPUQuota() = %v, %v; want %v, error %v", quota, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
@@ -75,10 +75,15 @@ func BenchmarkDecompression(b *testing.B) {
 				}
 
 				compressedData := compressed.Bytes()
+				stats, err := VerifyZstdStreamWithStats(bytes.NewReader(compressedData))
+				if err != nil {
+					b.Fatal(err)
+				}
 
 				// Benchmark decompression
 				benchName := fmt.Sprintf("%s/Size=%s/Level=%d", c.name, formatSize(size), level)
 				b.Run(benchName, func(b *testing.B) {
+					b.Logf("compression ratio %.3f", stats.CompressionRatio)
 					b.SetBytes(int64(len(testData)))
 					b.ResetTimer()
 
@@ -0,0 +1,81 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package zstd
+
+import (
+	"fmt"
+	"io"
+)
+
+const (
+	// MaxDictionarySize is the maximum size of a dictionary accepted by
+	// DictionaryCompressor. It's the default of the zstd command's --maxdict.
+	MaxDictionarySize = 112640
+
+	// minDictionarySize is the smallest dictionary TrainDictionary can be asked for
+	minDictionarySize = 1024
+
+	// minDictionarySamples is the minimum number of non-empty samples needed for
+	// training a dictionary
+	minDictionarySamples = 5
+)
+
+// DictionaryCompressor is implemented by compressors supporting zstd dictionaries.
+// Dictionaries use the zstd dictionary format so a dictionary trained by one
+// implementation can be used by the others.
+type DictionaryCompressor interface {
+	Compressor
+
+	// TrainDictionary builds a dictionary of at most maxSize bytes from samples
+	TrainDictionary(samples [][]byte, maxSize int) ([]byte, error)
+
+	// NewWriterDict creates a new zstd writer compressing with dict
+	NewWriterDict(w io.Writer, level int, dict []byte) (WriteFlushCloser, error)
+
+	// NewReaderDict creates a new zstd reader decompressing with dict
+	NewReaderDict(r io.Reader, dict []byte) (io.ReadCloser, error)
+}
+
+func validateDictionary(dict []byte) error {
+	if len(dict) == 0 {
+		return fmt.Errorf("dictionary is empty")
+	}
+	if len(dict) > MaxDictionarySize {
+		return fmt.Errorf("dictionary size %d exceeds the maximum %d", len(dict), MaxDictionarySize)
+	}
+	return nil
+}
+
+// validateTrainingSamples checks the arguments of TrainDictionary and returns
+// the non-empty samples
+func validateTrainingSamples(samples [][]byte, maxSize int) ([][]byte, error) {
+	if maxSize < minDictionarySize || maxSize > MaxDictionarySize {
+		return nil, fmt.Errorf("invalid dictionary size %d: must be between %d and %d",
+			maxSize, minDictionarySize, MaxDictionarySize)
+	}
+	var nonEmpty [][]byte
+	for _, s := range samples {
+		if len(s) > 0 {
+			nonEmpty = append(nonEmpty, s)
+		}
+	}
+	if len(nonEmpty) < minDictionarySamples {
+		return nil, fmt.Errorf("too few samples for training a dictionary: got %d, need at least %d",
+			len(nonEmpty), minDictionarySamples)
+	}
+	return nonEmpty, nil
+}
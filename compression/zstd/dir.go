@@ -0,0 +1,198 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package zstd
+
+import (
+	"archive/tar"
+	"bufio"
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CompressDirOption configures CompressDir
+type CompressDirOption func(*compressDirOptions)
+
+type compressDirOptions struct {
+	filter func(path string) bool
+}
+
+// WithFilter makes CompressDir archive only the entries for which fn returns true.
+// fn is called with the slash-separated path relative to the source directory. The
+// contents of excluded directories are skipped. It replaces the default filter,
+// which excludes hidden files and directories.
+func WithFilter(fn func(path string) bool) CompressDirOption {
+	return func(o *compressDirOptions) {
+		o.filter = fn
+	}
+}
+
+// isVisible is the default filter of CompressDir
+func isVisible(path string) bool {
+	for _, name := range strings.Split(path, "/") {
+		if strings.HasPrefix(name, ".") {
+			return false
+		}
+	}
+	return true
+}
+
+// CompressDir writes the contents of the directory src as a tar archive compressed
+// at the specified level with the compressor returned by GetCompressor to dst. The
+// archive is created while walking src. Symlinks resolving outside src, also through
+// other symlinks, and sockets are always excluded. dst is removed if the operation
+// fails or ctx is canceled.
+func CompressDir(ctx context.Context, src, dst string, level int, opts ...CompressDirOption) (retErr error) {
+	o := compressDirOptions{filter: isVisible}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	root, err := filepath.Abs(src)
+	if err != nil {
+		return err
+	}
+	// The targets of the symlinks are resolved against the real path of root
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return err
+	}
+	dstPath, err := filepath.Abs(dst)
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if retErr != nil {
+			out.Close()
+			os.Remove(dst)
+		}
+	}()
+
+	bw := bufio.NewWriterSize(out, fileBufferSize)
+	zw, err := GetCompressor().NewWriter(bw, level)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(zw)
+	if err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if path == root || path == dstPath {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if !o.filter(rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		return writeTarEntry(ctx, tw, realRoot, path, rel, d)
+	}); err != nil {
+		zw.Close()
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		zw.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// writeTarEntry adds the file at path to tw as name. Sockets and symlinks resolving
+// outside realRoot, the real path of the walked directory, are skipped.
+func writeTarEntry(ctx context.Context, tw *tar.Writer, realRoot, path, name string, d fs.DirEntry) error {
+	info, err := d.Info()
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket != 0 {
+		return nil // tar has no socket type
+	}
+	var link string
+	if info.Mode()&os.ModeSymlink != 0 {
+		if link, err = os.Readlink(path); err != nil {
+			return err
+		}
+		if inside, err := symlinkInside(realRoot, path, link); err != nil {
+			return err
+		} else if !inside {
+			return nil
+		}
+	}
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	if info.IsDir() {
+		hdr.Name += "/"
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = copyWithContext(ctx, tw, f)
+	return err
+}
+
+// symlinkInside returns whether the symlink at path to link resolves inside
+// realRoot. Dangling symlinks are checked lexically from the real path of their
+// directory.
+func symlinkInside(realRoot, path, link string) (bool, error) {
+	target, err := filepath.EvalSymlinks(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		dir, err := filepath.EvalSymlinks(filepath.Dir(path))
+		if err != nil {
+			return false, err
+		}
+		if target = link; !filepath.IsAbs(target) {
+			target = filepath.Join(dir, target)
+		}
+	} else if err != nil {
+		return false, err
+	}
+	rel, err := filepath.Rel(realRoot, target)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)), nil
+}
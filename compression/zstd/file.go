@@ -0,0 +1,149 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package zstd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// fileBufferSize is the size of the buffers used by CompressFile and DecompressFile
+const fileBufferSize = 64 * 1024
+
+// CompressFile compresses the file src into dst at the specified level with the
+// compressor returned by GetCompressor. See transformFile for details.
+func CompressFile(ctx context.Context, src, dst string, level int) error {
+	return transformFile(ctx, src, dst, func(w io.Writer, r io.Reader) error {
+		zw, err := GetCompressor().NewWriter(w, level)
+		if err != nil {
+			return err
+		}
+		if _, err := copyWithContext(ctx, zw, r); err != nil {
+			zw.Close()
+			return err
+		}
+		return zw.Close()
+	})
+}
+
+// DecompressFile decompresses the zstd file src into dst with the compressor
+// returned by GetCompressor. See transformFile for details.
+func DecompressFile(ctx context.Context, src, dst string) error {
+	return transformFile(ctx, src, dst, func(w io.Writer, r io.Reader) error {
+		_, err := DecompressStream(ctx, r, w)
+		return err
+	})
+}
+
+// DecompressStream decompresses the zstd stream read from src into dst with the
+// compressor returned by GetCompressor and returns the number of decompressed
+// bytes written. Once ctx is done, the copy stops with ctx.Err() and dst keeps
+// the data written so far.
+func DecompressStream(ctx context.Context, src io.Reader, dst io.Writer) (int64, error) {
+	zr, err := GetCompressor().NewReader(src)
+	if err != nil {
+		return 0, err
+	}
+	defer zr.Close()
+	return copyWithContext(ctx, dst, zr)
+}
+
+// transformFile writes the output of fn, reading src, to dst through 64KB buffers.
+// The output is written to a temporary file in the directory of dst, synced and
+// renamed over dst, so dst is left untouched if fn or any I/O fails. dst gets the
+// permissions and modification time of src, and must not be src.
+func transformFile(ctx context.Context, src, dst string, fn func(w io.Writer, r io.Reader) error) (retErr error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	if dstInfo, err := os.Stat(dst); err == nil && os.SameFile(info, dstInfo) {
+		return fmt.Errorf("source and destination are the same file %q", dst)
+	} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	out, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if retErr != nil {
+			out.Close()
+			os.Remove(out.Name())
+		}
+	}()
+
+	bw := bufio.NewWriterSize(out, fileBufferSize)
+	if err := fn(bw, bufio.NewReaderSize(in, fileBufferSize)); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	if err := out.Chmod(info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	// The zero access time leaves it unchanged
+	if err := os.Chtimes(out.Name(), time.Time{}, info.ModTime()); err != nil {
+		return err
+	}
+	return os.Rename(out.Name(), dst)
+}
+
+// copyWithContext is io.Copy through a fileBufferSize buffer that stops with
+// ctx.Err() once ctx is done, checked before each read.
+func copyWithContext(ctx context.Context, dst io.Writer, src io.Reader) (written int64, err error) {
+	buf := make([]byte, fileBufferSize)
+	for {
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+		n, rerr := src.Read(buf)
+		if n > 0 {
+			m, werr := dst.Write(buf[:n])
+			written += int64(m)
+			if werr != nil {
+				return written, werr
+			}
+			if m != n {
+				return written, io.ErrShortWrite
+			}
+		}
+		if rerr == io.EOF {
+			return written, nil
+		} else if rerr != nil {
+			return written, rerr
+		}
+	}
+}
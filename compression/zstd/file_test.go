@@ -0,0 +1,270 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package zstd
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompressFile(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	input := bytes.Repeat([]byte("compress file contents\n"), 20000)
+	if err := os.WriteFile(src, input, 0640); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(src, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	compressed := filepath.Join(dir, "src.zst")
+	if err := CompressFile(context.Background(), src, compressed, 3); err != nil {
+		t.Fatalf("failed to compress: %v", err)
+	}
+	decompressed := filepath.Join(dir, "out")
+	if err := DecompressFile(context.Background(), compressed, decompressed); err != nil {
+		t.Fatalf("failed to decompress: %v", err)
+	}
+
+	got, err := os.ReadFile(decompressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, input) {
+		t.Error("decompressed file differs from the source")
+	}
+	for _, p := range []string{compressed, decompressed} {
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.ModTime().Equal(mtime) {
+			t.Errorf("%s: modification time %v; want %v", filepath.Base(p), info.ModTime(), mtime)
+		}
+		if info.Mode().Perm() != 0640 {
+			t.Errorf("%s: mode %v; want %v", filepath.Base(p), info.Mode().Perm(), os.FileMode(0640))
+		}
+	}
+}
+
+// cancelAfterContext is canceled once Err has been called n times
+type cancelAfterContext struct {
+	context.Context
+	n int
+}
+
+func (c *cancelAfterContext) Err() error {
+	if c.n--; c.n < 0 {
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestCompressFileCancel(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	input := bytes.Repeat([]byte("canceled contents\n"), 4*fileBufferSize/16)
+	if err := os.WriteFile(src, input, 0600); err != nil {
+		t.Fatal(err)
+	}
+	compressed := filepath.Join(dir, "src.zst")
+	if err := CompressFile(context.Background(), src, compressed, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, fn := range map[string]func(ctx context.Context, dst string) error{
+		"compress":   func(ctx context.Context, dst string) error { return CompressFile(ctx, src, dst, 3) },
+		"decompress": func(ctx context.Context, dst string) error { return DecompressFile(ctx, compressed, dst) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			outDir := filepath.Join(dir, name)
+			if err := os.Mkdir(outDir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			dst := filepath.Join(outDir, "out")
+			if err := os.WriteFile(dst, []byte("previous"), 0600); err != nil {
+				t.Fatal(err)
+			}
+			// Canceled after the first buffer fill
+			ctx := &cancelAfterContext{Context: context.Background(), n: 1}
+			if err := fn(ctx, dst); !errors.Is(err, context.Canceled) {
+				t.Fatalf("got %v; want context.Canceled", err)
+			}
+			if got, err := os.ReadFile(dst); err != nil || string(got) != "previous" {
+				t.Errorf("existing file is modified: %q, %v", got, err)
+			}
+			if ents, err := os.ReadDir(outDir); err != nil || len(ents) != 1 {
+				t.Errorf("partial file is left: %v, %v", ents, err)
+			}
+		})
+	}
+
+	if err := CompressFile(context.Background(), src, src, 3); err == nil {
+		t.Error("compressing a file into itself should fail")
+	}
+	if got, err := os.ReadFile(src); err != nil || !bytes.Equal(got, input) {
+		t.Errorf("source is modified: %v", err)
+	}
+}
+
+func TestDecompressStream(t *testing.T) {
+	input := bytes.Repeat([]byte("decompressed stream\n"), 8*fileBufferSize/20)
+	var compressed bytes.Buffer
+	zw, err := GetCompressor().NewWriter(&compressed, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := zw.Write(input); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	n, err := DecompressStream(context.Background(), bytes.NewReader(compressed.Bytes()), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(input)) || !bytes.Equal(out.Bytes(), input) {
+		t.Errorf("decompressed %d bytes (%d in dst); want %d", n, out.Len(), len(input))
+	}
+
+	// Canceled after the first buffer fill
+	out.Reset()
+	ctx := &cancelAfterContext{Context: context.Background(), n: 1}
+	n, err = DecompressStream(ctx, bytes.NewReader(compressed.Bytes()), &out)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v; want context.Canceled", err)
+	}
+	if n == 0 || n >= int64(len(input)) || n != int64(out.Len()) {
+		t.Errorf("canceled after %d bytes with %d bytes in dst; want a partial copy of %d bytes", n, out.Len(), len(input))
+	}
+	if !bytes.Equal(out.Bytes(), input[:out.Len()]) {
+		t.Error("partially written data differs from the input")
+	}
+}
+
+func TestCompressDir(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	files := make(map[string]string)
+	for i := 0; i < 10; i++ {
+		name := fmt.Sprintf("file%d", i)
+		if i >= 5 {
+			name = "sub/" + name
+		}
+		files[name] = strings.Repeat(fmt.Sprintf("contents of %s\n", name), 1000*(i+1))
+	}
+	for name, contents := range files {
+		p := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	outside := filepath.Join(dir, "outside")
+	if err := os.WriteFile(outside, []byte("outside"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for name, target := range map[string]string{
+		"escape":     outside,
+		"sub/escape": "../../outside",
+		"link":       "sub/file5",
+		"sub/up":     "../..",
+		"chain":      "sub/up/outside", // escapes only through sub/up
+	} {
+		if err := os.Symlink(target, filepath.Join(src, filepath.FromSlash(name))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if l, err := net.Listen("unix", filepath.Join(src, "sock")); err == nil {
+		defer l.Close()
+	} else {
+		t.Logf("sockets are not tested: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(src, ".hidden"), []byte("hidden"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	extract := func(opts ...CompressDirOption) map[string]string {
+		compressed := filepath.Join(dir, "src.tar.zst")
+		if err := CompressDir(context.Background(), src, compressed, 3, opts...); err != nil {
+			t.Fatalf("failed to compress: %v", err)
+		}
+		archive := filepath.Join(dir, "src.tar")
+		if err := DecompressFile(context.Background(), compressed, archive); err != nil {
+			t.Fatalf("failed to decompress: %v", err)
+		}
+		f, err := os.Open(archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		got := make(map[string]string)
+		tr := tar.NewReader(f)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			switch hdr.Typeflag {
+			case tar.TypeReg:
+				b, err := io.ReadAll(tr)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got[hdr.Name] = string(b)
+			case tar.TypeSymlink:
+				got[hdr.Name] = "-> " + hdr.Linkname
+			}
+		}
+		return got
+	}
+
+	want := maps.Clone(files)
+	want["link"] = "-> sub/file5"
+	if got := extract(); !reflect.DeepEqual(got, want) {
+		t.Errorf("archived files = %v; want %v", slices.Sorted(maps.Keys(got)), slices.Sorted(maps.Keys(want)))
+	}
+
+	want[".hidden"] = "hidden"
+	delete(want, "sub/file9")
+	got := extract(WithFilter(func(path string) bool { return path != "sub/file9" }))
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("archived files with filter = %v; want %v", slices.Sorted(maps.Keys(got)), slices.Sorted(maps.Keys(want)))
+	}
+}
@@ -0,0 +1,260 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package zstd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+const (
+	frameMagic              = 0xFD2FB528
+	skippableFrameMagic     = 0x184D2A50
+	skippableFrameMagicMask = 0xFFFFFFF0
+
+	// maxBlockSize is the largest size a compressed block decompresses to
+	maxBlockSize = 128 * 1024
+)
+
+// ErrInvalidFrame is returned by CountZstdFrames for a frame with an unknown magic
+// number or a malformed header.
+var ErrInvalidFrame = errors.New("invalid zstd frame")
+
+// ErrFrameNotFound is returned by ReadSkippableFrame if the stream has no skippable
+// frame with the requested id.
+var ErrFrameNotFound = errors.New("zstd skippable frame not found")
+
+// CountZstdFrames returns the number of frames in the zstd stream read from r,
+// including skippable frames. It only parses the frame and block headers and skips
+// the compressed contents without decompressing them.
+func CountZstdFrames(r io.Reader) (int, error) {
+	return walkFrames(r, nil)
+}
+
+// EstimateDecompressedSize returns an upper bound of the decompressed size of the
+// zstd stream src. The bound is exact for frames that record their content size
+// in the header; otherwise each compressed block counts as the block size limit.
+func EstimateDecompressedSize(src []byte) (int, error) {
+	var total int64
+	if _, err := walkFrames(bytes.NewReader(src), func(bound int64) {
+		total += bound
+	}); err != nil {
+		return 0, err
+	}
+	if total > math.MaxInt {
+		return 0, fmt.Errorf("%w: decompressed size %d overflows int", ErrInvalidFrame, total)
+	}
+	return int(total), nil
+}
+
+// ReadSkippableFrame returns the payload of the first skippable frame of the zstd
+// stream r with the magic number 0x184D2A50 + id, so id must be in range 0x0-0xF.
+// Like CountZstdFrames it only parses the headers of the frames before it; their
+// contents are skipped with Seek if r is an io.Seeker.
+func ReadSkippableFrame(r io.Reader, id byte) ([]byte, error) {
+	if id > 0xF {
+		return nil, fmt.Errorf("invalid skippable frame id %#x: must be in range 0x0-0xF", id)
+	}
+	var magic [4]byte
+	for frames := 0; ; frames++ {
+		if _, err := io.ReadFull(r, magic[:]); err == io.EOF {
+			return nil, fmt.Errorf("%w: id %#x", ErrFrameNotFound, id)
+		} else if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		switch m := binary.LittleEndian.Uint32(magic[:]); {
+		case m == frameMagic:
+			if _, _, err := skipFrame(r); err != nil {
+				return nil, err
+			}
+		case m&skippableFrameMagicMask == skippableFrameMagic:
+			var size [4]byte
+			if _, err := io.ReadFull(r, size[:]); err != nil {
+				return nil, unexpectedEOF(err)
+			}
+			n := int64(binary.LittleEndian.Uint32(size[:]))
+			if m == skippableFrameMagic|uint32(id) {
+				// The size is untrusted, so the payload grows as it's read
+				payload, err := io.ReadAll(io.LimitReader(r, n))
+				if err != nil {
+					return nil, err
+				}
+				if int64(len(payload)) < n {
+					return nil, io.ErrUnexpectedEOF
+				}
+				return payload, nil
+			}
+			if err := skip(r, n); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("%w: unknown magic number %#08x at frame %d", ErrInvalidFrame, m, frames)
+		}
+	}
+}
+
+// walkFrames reads the frames of the zstd stream r and calls f, if non-nil, with
+// the decompressed size bound of each frame. It returns the number of frames.
+func walkFrames(r io.Reader, f func(bound int64)) (int, error) {
+	var frames int
+	var magic [4]byte
+	for {
+		if _, err := io.ReadFull(r, magic[:]); err == io.EOF {
+			return frames, nil
+		} else if err != nil {
+			return frames, unexpectedEOF(err)
+		}
+		var bound int64
+		switch m := binary.LittleEndian.Uint32(magic[:]); {
+		case m == frameMagic:
+			var err error
+			if bound, _, err = skipFrame(r); err != nil {
+				return frames, err
+			}
+		case m&skippableFrameMagicMask == skippableFrameMagic:
+			var size [4]byte
+			if _, err := io.ReadFull(r, size[:]); err != nil {
+				return frames, unexpectedEOF(err)
+			}
+			if err := skip(r, int64(binary.LittleEndian.Uint32(size[:]))); err != nil {
+				return frames, err
+			}
+		default:
+			return frames, fmt.Errorf("%w: unknown magic number %#08x at frame %d", ErrInvalidFrame, m, frames)
+		}
+		if f != nil {
+			f(bound)
+		}
+		frames++
+	}
+}
+
+// skipFrame skips a zstd frame following its magic number and returns the bound
+// of its decompressed size and its checksum, nil if the frame has none
+func skipFrame(r io.Reader) (bound int64, checksum []byte, _ error) {
+	var fhd [1]byte
+	if _, err := io.ReadFull(r, fhd[:]); err != nil {
+		return 0, nil, unexpectedEOF(err)
+	}
+	var (
+		fcsFlag       = fhd[0] >> 6
+		singleSegment = fhd[0]&(1<<5) != 0
+		reserved      = fhd[0]&(1<<3) != 0
+		hasChecksum   = fhd[0]&(1<<2) != 0
+		dictIDFlag    = fhd[0] & 3
+	)
+	if reserved {
+		return 0, nil, fmt.Errorf("%w: reserved bit is set in the frame header", ErrInvalidFrame)
+	}
+	var headerSize int64
+	if !singleSegment {
+		headerSize++ // window descriptor
+	}
+	headerSize += [4]int64{0, 1, 2, 4}[dictIDFlag]
+	if err := skip(r, headerSize); err != nil {
+		return 0, nil, err
+	}
+	fcsSize := [4]int{0, 2, 4, 8}[fcsFlag]
+	if fcsFlag == 0 && singleSegment {
+		fcsSize = 1
+	}
+	var fcs [8]byte
+	if _, err := io.ReadFull(r, fcs[:fcsSize]); err != nil {
+		return 0, nil, unexpectedEOF(err)
+	}
+	contentSize := int64(-1)
+	if fcsSize > 0 {
+		contentSize = int64(binary.LittleEndian.Uint64(fcs[:]))
+		if fcsSize == 2 {
+			contentSize += 256
+		}
+		if contentSize < 0 {
+			return 0, nil, fmt.Errorf("%w: frame content size overflows", ErrInvalidFrame)
+		}
+	}
+
+	var bh [3]byte
+	for {
+		if _, err := io.ReadFull(r, bh[:]); err != nil {
+			return 0, nil, unexpectedEOF(err)
+		}
+		h := uint32(bh[0]) | uint32(bh[1])<<8 | uint32(bh[2])<<16
+		last := h&1 != 0
+		size := int64(h >> 3)
+		switch blockType := (h >> 1) & 3; blockType {
+		case 0: // raw
+			bound += size
+		case 1: // RLE
+			bound += size
+			size = 1
+		case 2: // compressed
+			bound += maxBlockSize
+		default:
+			return 0, nil, fmt.Errorf("%w: reserved block type", ErrInvalidFrame)
+		}
+		if err := skip(r, size); err != nil {
+			return 0, nil, err
+		}
+		if last {
+			break
+		}
+	}
+	if hasChecksum {
+		checksum = make([]byte, 4)
+		if _, err := io.ReadFull(r, checksum); err != nil {
+			return 0, nil, unexpectedEOF(err)
+		}
+	}
+	if contentSize >= 0 {
+		return contentSize, checksum, nil
+	}
+	return bound, checksum, nil
+}
+
+// skip discards the next n bytes of r, seeking over them if r is an io.Seeker
+func skip(r io.Reader, n int64) error {
+	if s, ok := r.(io.Seeker); ok {
+		cur, err := s.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		end, err := s.Seek(0, io.SeekEnd)
+		if err != nil {
+			return err
+		}
+		if cur+n > end {
+			return io.ErrUnexpectedEOF
+		}
+		_, err = s.Seek(cur+n, io.SeekStart)
+		return err
+	}
+	if _, err := io.CopyN(io.Discard, r, n); err != nil {
+		return unexpectedEOF(err)
+	}
+	return nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
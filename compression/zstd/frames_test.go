@@ -0,0 +1,295 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package zstd
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"testing"
+)
+
+func TestCountZstdFrames(t *testing.T) {
+	implementations := []Compressor{NewPureGoCompressor(), NewGozstdCompressor()}
+	for _, compressor := range implementations {
+		if _, ok := compressor.(*GozstdCompressor); ok && !compressor.IsLibzstdAvailable() {
+			continue
+		}
+		t.Run(compressor.Name(), func(t *testing.T) {
+			frame := func(i int) []byte {
+				var buf bytes.Buffer
+				w, err := compressor.NewWriter(&buf, 3)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := w.Write(bytes.Repeat([]byte(fmt.Sprintf("frame %d ", i)), 10000)); err != nil {
+					t.Fatal(err)
+				}
+				if err := w.Close(); err != nil {
+					t.Fatal(err)
+				}
+				return buf.Bytes()
+			}
+			skippable := func(payload string) []byte {
+				b := binary.LittleEndian.AppendUint32(nil, skippableFrameMagic|0x7)
+				b = binary.LittleEndian.AppendUint32(b, uint32(len(payload)))
+				return append(b, payload...)
+			}
+
+			var five []byte
+			for i := 0; i < 5; i++ {
+				five = append(five, frame(i)...)
+			}
+			var mixed []byte
+			mixed = append(mixed, frame(0)...)
+			mixed = append(mixed, skippable("metadata")...)
+			mixed = append(mixed, frame(1)...)
+			mixed = append(mixed, skippable("")...)
+
+			for _, tt := range []struct {
+				name   string
+				stream []byte
+				want   int
+			}{
+				{"empty", nil, 0},
+				{"1 frame", frame(0), 1},
+				{"5 frames", five, 5},
+				{"mixed", mixed, 4},
+			} {
+				n, err := CountZstdFrames(bytes.NewReader(tt.stream))
+				if err != nil {
+					t.Errorf("%s: %v", tt.name, err)
+				} else if n != tt.want {
+					t.Errorf("%s: counted %d frames; want %d", tt.name, n, tt.want)
+				}
+			}
+
+			invalid := append(frame(0), "not a zstd frame"...)
+			if n, err := CountZstdFrames(bytes.NewReader(invalid)); !errors.Is(err, ErrInvalidFrame) || n != 1 {
+				t.Errorf("got (%d, %v) for trailing garbage; want (1, %v)", n, err, ErrInvalidFrame)
+			}
+			truncated := five[:len(five)-1]
+			if _, err := CountZstdFrames(bytes.NewReader(truncated)); !errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Errorf("got %v for truncated stream; want %v", err, io.ErrUnexpectedEOF)
+			}
+		})
+	}
+}
+
+func TestEstimateDecompressedSize(t *testing.T) {
+	input := bytes.Repeat([]byte("estimate me "), 50000)
+
+	var streamed bytes.Buffer
+	w, err := NewPureGoCompressor().NewWriter(&streamed, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(input); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	size, err := EstimateDecompressedSize(streamed.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size < len(input) {
+		t.Errorf("estimate %d is below the decompressed size %d", size, len(input))
+	}
+
+	// Frames with the content size in their headers count exactly, skippable
+	// frames count as empty
+	enc, _, err := headerlessCodec(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := enc.EncodeAll([]byte("hello"), nil)
+	src = binary.LittleEndian.AppendUint32(src, skippableFrameMagic)
+	src = binary.LittleEndian.AppendUint32(src, 3)
+	src = append(src, "abc"...)
+	src = enc.EncodeAll(input, src)
+	if size, err := EstimateDecompressedSize(src); err != nil || size != 5+len(input) {
+		t.Errorf("EstimateDecompressedSize = %d, %v; want %d", size, err, 5+len(input))
+	}
+
+	if _, err := EstimateDecompressedSize([]byte("not zstd")); !errors.Is(err, ErrInvalidFrame) {
+		t.Errorf("got %v; want ErrInvalidFrame", err)
+	}
+	if _, err := EstimateDecompressedSize(src[:len(src)-1]); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("got %v; want io.ErrUnexpectedEOF", err)
+	}
+}
+
+func TestVerifyZstdStreamWithStats(t *testing.T) {
+	implementations := []Compressor{NewPureGoCompressor(), NewGozstdCompressor()}
+	for _, compressor := range implementations {
+		if _, ok := compressor.(*GozstdCompressor); ok && !compressor.IsLibzstdAvailable() {
+			continue
+		}
+		t.Run(compressor.Name(), func(t *testing.T) {
+			var stream, input []byte
+			for i := 0; i < 3; i++ {
+				data := bytes.Repeat([]byte(fmt.Sprintf("verify frame %d ", i)), 20000*(i+1))
+				var buf bytes.Buffer
+				w, err := compressor.NewWriter(&buf, 3)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := w.Write(data); err != nil {
+					t.Fatal(err)
+				}
+				if err := w.Close(); err != nil {
+					t.Fatal(err)
+				}
+				stream = append(stream, buf.Bytes()...)
+				input = append(input, data...)
+			}
+			stream = binary.LittleEndian.AppendUint32(stream, skippableFrameMagic)
+			stream = binary.LittleEndian.AppendUint32(stream, 3)
+			stream = append(stream, "abc"...)
+
+			stats, err := VerifyZstdStreamWithStats(bytes.NewReader(stream))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats.TotalDecompressedBytes != int64(len(input)) {
+				t.Errorf("TotalDecompressedBytes = %d; want %d", stats.TotalDecompressedBytes, len(input))
+			}
+			if stats.TotalCompressedBytes != int64(len(stream)) {
+				t.Errorf("TotalCompressedBytes = %d; want %d", stats.TotalCompressedBytes, len(stream))
+			}
+			if stats.FrameCount != 4 || len(stats.FrameStats) != 4 {
+				t.Fatalf("got %d frames (%d stats); want 4", stats.FrameCount, len(stats.FrameStats))
+			}
+			if last := stats.FrameStats[3]; !last.Skippable || last.CompressedSize != 11 || last.DecompressedSize != 0 {
+				t.Errorf("skippable frame stats = %+v", last)
+			}
+			var offset int64
+			for i, f := range stats.FrameStats[:3] {
+				offset += f.CompressedSize
+				if f.HasChecksum != stats.HasChecksum {
+					t.Errorf("frame %d: HasChecksum = %v; stream HasChecksum = %v", i, f.HasChecksum, stats.HasChecksum)
+				}
+				if f.HasChecksum && !bytes.Equal(f.Checksum[:], stream[offset-4:offset]) {
+					t.Errorf("frame %d: checksum %x; want %x", i, f.Checksum, stream[offset-4:offset])
+				}
+			}
+
+			if err := VerifyZstdStream(bytes.NewReader(stream[:len(stream)/2])); !errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Errorf("got %v for truncated stream; want %v", err, io.ErrUnexpectedEOF)
+			}
+			if stats.HasChecksum {
+				corrupted := append([]byte(nil), stream...)
+				corrupted[stats.FrameStats[0].CompressedSize-1] ^= 0xff
+				if err := VerifyZstdStream(bytes.NewReader(corrupted)); err == nil {
+					t.Error("verified a stream with a corrupted checksum")
+				}
+			}
+		})
+	}
+}
+
+func TestStreamStatsCompressionRatio(t *testing.T) {
+	compress := func(data []byte) []byte {
+		var buf bytes.Buffer
+		w, err := NewPureGoCompressor().NewWriter(&buf, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	random := make([]byte, 1<<20)
+	if _, err := rand.Read(random); err != nil {
+		t.Fatal(err)
+	}
+	skippable := binary.LittleEndian.AppendUint32(nil, skippableFrameMagic)
+	skippable = binary.LittleEndian.AppendUint32(skippable, 3)
+	skippable = append(skippable, "abc"...)
+
+	for _, tt := range []struct {
+		name     string
+		stream   []byte
+		min, max float64
+	}{
+		{"repetitive", compress(bytes.Repeat([]byte("ratio "), 100000)), 0, 0.99},
+		{"random", compress(random), 0.9, 1.1},
+		{"empty", nil, 0, 0},
+		{"skippable only", skippable, math.Inf(1), math.Inf(1)},
+	} {
+		stats, err := VerifyZstdStreamWithStats(bytes.NewReader(tt.stream))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if r := stats.CompressionRatio; r < tt.min || r > tt.max {
+			t.Errorf("%s: CompressionRatio = %v; want between %v and %v", tt.name, r, tt.min, tt.max)
+		}
+	}
+}
+
+func TestReadSkippableFrame(t *testing.T) {
+	enc, _, err := headerlessCodec(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	skippable := func(id byte, payload string) []byte {
+		b := binary.LittleEndian.AppendUint32(nil, skippableFrameMagic|uint32(id))
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(payload)))
+		return append(b, payload...)
+	}
+	stream := enc.EncodeAll(bytes.Repeat([]byte("data "), 10000), nil)
+	stream = append(stream, skippable(0x0, "toc")...)
+	stream = append(stream, skippable(0xd, "dictionary")...)
+	stream = enc.EncodeAll([]byte("more data"), stream)
+
+	if payload, err := ReadSkippableFrame(bytes.NewReader(stream), 0xd); err != nil || string(payload) != "dictionary" {
+		t.Errorf("ReadSkippableFrame(0xd) = %q, %v; want %q", payload, err, "dictionary")
+	}
+	if payload, err := ReadSkippableFrame(bytes.NewReader(stream), 0x0); err != nil || string(payload) != "toc" {
+		t.Errorf("ReadSkippableFrame(0x0) = %q, %v; want %q", payload, err, "toc")
+	}
+	// A reader that isn't an io.Seeker reads the skipped frames
+	if payload, err := ReadSkippableFrame(io.MultiReader(bytes.NewReader(stream)), 0xd); err != nil || string(payload) != "dictionary" {
+		t.Errorf("ReadSkippableFrame(0xd) without Seek = %q, %v; want %q", payload, err, "dictionary")
+	}
+	if _, err := ReadSkippableFrame(bytes.NewReader(stream), 0x5); !errors.Is(err, ErrFrameNotFound) {
+		t.Errorf("got %v for a missing frame; want %v", err, ErrFrameNotFound)
+	}
+	if _, err := ReadSkippableFrame(bytes.NewReader(stream[:bytes.Index(stream, []byte("dictionary"))+3]), 0xd); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("got %v for a truncated stream; want %v", err, io.ErrUnexpectedEOF)
+	}
+	// The payload isn't allocated up front from the size in the header
+	huge := binary.LittleEndian.AppendUint32(nil, skippableFrameMagic|0xd)
+	huge = binary.LittleEndian.AppendUint32(huge, math.MaxUint32)
+	huge = append(huge, "short"...)
+	if _, err := ReadSkippableFrame(bytes.NewReader(huge), 0xd); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("got %v for a frame shorter than its size; want %v", err, io.ErrUnexpectedEOF)
+	}
+	if _, err := ReadSkippableFrame(bytes.NewReader(stream), 0x10); err == nil {
+		t.Error("id 0x10 should be rejected")
+	}
+}
@@ -0,0 +1,137 @@
+//go:build cgo && !no_cgo
+// +build cgo,!no_cgo
+
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package zstd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/GrigoryEvko/gozstd"
+)
+
+// TrainDictionary builds a dictionary from samples with libzstd's trainer
+func (g *GozstdCompressor) TrainDictionary(samples [][]byte, maxSize int) ([]byte, error) {
+	if !g.available {
+		return nil, fmt.Errorf("libzstd not available")
+	}
+	samples, err := validateTrainingSamples(samples, maxSize)
+	if err != nil {
+		return nil, err
+	}
+	dict := gozstd.BuildDict(samples, maxSize)
+	if len(dict) == 0 {
+		return nil, fmt.Errorf("failed to train a dictionary from %d samples", len(samples))
+	}
+	return dict, nil
+}
+
+// NewWriterDict creates a new zstd writer compressing with dict
+func (g *GozstdCompressor) NewWriterDict(w io.Writer, level int, dict []byte) (WriteFlushCloser, error) {
+	if !g.available {
+		return nil, fmt.Errorf("libzstd not available")
+	}
+	if err := validateDictionary(dict); err != nil {
+		return nil, err
+	}
+	if level < 0 || level > 22 {
+		return nil, fmt.Errorf("invalid compression level %d: must be between 0 and 22", level)
+	}
+	if level == 0 {
+		level = gozstd.DefaultCompressionLevel
+	}
+	cd, err := gozstd.NewCDictLevel(dict, level)
+	if err != nil {
+		return nil, err
+	}
+	params := &gozstd.WriterParams{
+		CompressionLevel: level,
+		NbWorkers:        GetOptimalWorkerCount(),
+		Dict:             cd,
+	}
+	return &gozstdWriterWrapper{Writer: gozstd.NewWriterParams(w, params), params: *params}, nil
+}
+
+// NewReaderDict creates a new zstd reader decompressing with dict
+func (g *GozstdCompressor) NewReaderDict(r io.Reader, dict []byte) (io.ReadCloser, error) {
+	if !g.available {
+		return nil, fmt.Errorf("libzstd not available")
+	}
+	if err := validateDictionary(dict); err != nil {
+		return nil, err
+	}
+	dd, err := gozstd.NewDDict(dict)
+	if err != nil {
+		return nil, err
+	}
+	return &gozstdReaderWrapper{gozstd.NewReaderDict(r, dd)}, nil
+}
+
+// CompressWithDict compresses src with dict into a single zstd frame in one call,
+// like Compress. A nil dict compresses without a dictionary.
+func (g *GozstdCompressor) CompressWithDict(dict, src []byte, level int) (out []byte, retErr error) {
+	if dict == nil {
+		return g.Compress(src, level)
+	}
+	if !g.available {
+		return nil, fmt.Errorf("libzstd not available")
+	}
+	if err := validateDictionary(dict); err != nil {
+		return nil, err
+	}
+	if level < 0 || level > 22 {
+		return nil, fmt.Errorf("invalid compression level %d: must be between 0 and 22", level)
+	}
+	if level == 0 {
+		level = gozstd.DefaultCompressionLevel
+	}
+	cd, err := gozstd.NewCDictLevel(dict, level)
+	if err != nil {
+		return nil, err
+	}
+	defer cd.Release()
+	// gozstd doesn't report a dictionary libzstd fails to load until it compresses
+	// with it, and then panics
+	defer func() {
+		if r := recover(); r != nil {
+			out, retErr = nil, fmt.Errorf("failed to compress with the dictionary: %v", r)
+		}
+	}()
+	return gozstd.CompressDict(nil, src, cd), nil
+}
+
+// DecompressWithDict decompresses the zstd stream src compressed with dict in one
+// call. A nil dict decompresses a stream compressed without a dictionary.
+func (g *GozstdCompressor) DecompressWithDict(dict, src []byte) ([]byte, error) {
+	if !g.available {
+		return nil, fmt.Errorf("libzstd not available")
+	}
+	if dict == nil {
+		return gozstd.Decompress(nil, src)
+	}
+	if err := validateDictionary(dict); err != nil {
+		return nil, err
+	}
+	dd, err := gozstd.NewDDict(dict)
+	if err != nil {
+		return nil, err
+	}
+	defer dd.Release()
+	return gozstd.DecompressDict(nil, src, dd)
+}
@@ -0,0 +1,141 @@
+//go:build cgo && !no_cgo
+// +build cgo,!no_cgo
+
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package zstd
+
+// The libzstd linked by gozstd is called directly for the parameters, which
+// gozstd doesn't expose. Its headers aren't reachable from this module so the
+// functions are declared here.
+
+/*
+#include <stddef.h>
+
+typedef struct ZSTD_CCtx_s ZSTD_CCtx;
+ZSTD_CCtx* ZSTD_createCCtx(void);
+size_t ZSTD_freeCCtx(ZSTD_CCtx* cctx);
+size_t ZSTD_CCtx_setParameter(ZSTD_CCtx* cctx, int param, int value);
+size_t ZSTD_CCtx_getParameter(const ZSTD_CCtx* cctx, int param, int* value);
+unsigned ZSTD_isError(size_t code);
+const char* ZSTD_getErrorName(size_t code);
+*/
+import "C"
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/GrigoryEvko/gozstd"
+)
+
+// writerParams are the parameters applied to the writers of GozstdCompressor.
+// gozstd.WriterParams has no place for the others.
+var writerParams = map[int]string{
+	ParamCompressionLevel: "compression level",
+	ParamWindowLog:        "window log",
+	ParamNbWorkers:        "number of workers",
+}
+
+// SetDefaultParameter sets the compression parameter param (e.g. ParamWindowLog) of
+// the writers created by NewWriter. libzstd validates value. A compression level
+// is used when NewWriter is called with level 0 and a number of workers replaces
+// the one of GetOptimalWorkerCount. Only the parameters supported by gozstd's
+// writers can be set: the compression level, the window log and the number of
+// workers.
+func (g *GozstdCompressor) SetDefaultParameter(param, value int) error {
+	if !g.available {
+		return fmt.Errorf("libzstd not available")
+	}
+	if _, ok := writerParams[param]; !ok {
+		return fmt.Errorf("parameter %d can't be applied to gozstd writers", param)
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	params := make(map[int]int, len(g.defaultParams)+1)
+	for p, v := range g.defaultParams {
+		params[p] = v
+	}
+	params[param] = value
+	if _, err := scratchParameter(params, param); err != nil {
+		return err
+	}
+	g.defaultParams = params
+	return nil
+}
+
+// GetParameter returns the value of the compression parameter param of a libzstd
+// context with the parameters set by SetDefaultParameter. For the other parameters
+// it's the default of libzstd, where 0 usually means the value is derived from the
+// compression level.
+func (g *GozstdCompressor) GetParameter(param int) (int, error) {
+	if !g.available {
+		return 0, fmt.Errorf("libzstd not available")
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return scratchParameter(g.defaultParams, param)
+}
+
+// scratchParameter sets params on a new libzstd context and returns the value of param
+func scratchParameter(params map[int]int, param int) (int, error) {
+	cctx := C.ZSTD_createCCtx()
+	if cctx == nil {
+		return 0, fmt.Errorf("failed to create libzstd context")
+	}
+	defer C.ZSTD_freeCCtx(cctx)
+
+	// Set in a fixed order so that an invalid parameter is reported consistently
+	keys := make([]int, 0, len(params))
+	for p := range params {
+		keys = append(keys, p)
+	}
+	sort.Ints(keys)
+	for _, p := range keys {
+		if err := zstdError(C.ZSTD_CCtx_setParameter(cctx, C.int(p), C.int(params[p]))); err != nil {
+			return 0, fmt.Errorf("invalid value %d of parameter %d: %w", params[p], p, err)
+		}
+	}
+	var value C.int
+	if err := zstdError(C.ZSTD_CCtx_getParameter(cctx, C.int(param), &value)); err != nil {
+		return 0, fmt.Errorf("failed to get parameter %d: %w", param, err)
+	}
+	return int(value), nil
+}
+
+func zstdError(code C.size_t) error {
+	if C.ZSTD_isError(code) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s", C.GoString(C.ZSTD_getErrorName(code)))
+}
+
+// applyDefaultParameters sets the parameters of SetDefaultParameter to params
+// created for a writer with the compression level level
+func (g *GozstdCompressor) applyDefaultParameters(params *gozstd.WriterParams, level int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if v, ok := g.defaultParams[ParamCompressionLevel]; ok && level == 0 {
+		params.CompressionLevel = v
+	}
+	if v, ok := g.defaultParams[ParamWindowLog]; ok {
+		params.WindowLog = v
+	}
+	if v, ok := g.defaultParams[ParamNbWorkers]; ok {
+		params.NbWorkers = v
+	}
+}
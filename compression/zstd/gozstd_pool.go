@@ -0,0 +1,206 @@
+//go:build cgo && !no_cgo
+// +build cgo,!no_cgo
+
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package zstd
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/GrigoryEvko/gozstd"
+)
+
+// defaultCCtxIdleTimeout is how long the contexts above the preallocated ones stay
+// idle in a CCtxPool before they are released
+const defaultCCtxIdleTimeout = 30 * time.Second
+
+// CCtxPool is a pool of libzstd compression contexts (ZSTD_CCtx) with their
+// buffers. Unlike GozstdCompressor.NewWriter, which allocates a context on the C
+// heap for each writer, the writers of the pool reuse the contexts returned with
+// Put. The pool grows when all contexts are in use and releases the contexts
+// above the preallocated ones once they have been idle for a while.
+type CCtxPool struct {
+	minIdle     int
+	idleTimeout time.Duration
+	allocated   atomic.Int64
+
+	mu     sync.Mutex
+	idle   []*pooledCCtx // the most recently used last
+	shrink *time.Timer
+	closed bool
+}
+
+// pooledCCtx is an idle context of the pool
+type pooledCCtx struct {
+	zw        *gozstd.Writer
+	nbWorkers int
+	lastUsed  time.Time
+}
+
+// NewCCtxPool returns a pool with GetOptimalWorkerCount preallocated contexts.
+func NewCCtxPool() (*CCtxPool, error) {
+	if !NewGozstdCompressor().IsLibzstdAvailable() {
+		return nil, fmt.Errorf("libzstd not available")
+	}
+	p := &CCtxPool{
+		minIdle:     GetOptimalWorkerCount(),
+		idleTimeout: defaultCCtxIdleTimeout,
+	}
+	now := time.Now()
+	for i := 0; i < p.minIdle; i++ {
+		c := p.newCCtx()
+		c.lastUsed = now
+		p.idle = append(p.idle, c)
+	}
+	return p, nil
+}
+
+// newCCtx allocates a context on the C heap
+func (p *CCtxPool) newCCtx() *pooledCCtx {
+	p.allocated.Add(1)
+	workers := GetOptimalWorkerCount()
+	return &pooledCCtx{
+		zw: gozstd.NewWriterParams(io.Discard, &gozstd.WriterParams{
+			CompressionLevel: gozstd.DefaultCompressionLevel,
+			NbWorkers:        workers,
+		}),
+		nbWorkers: workers,
+	}
+}
+
+// Allocated returns the number of contexts allocated by the pool so far,
+// including the released ones.
+func (p *CCtxPool) Allocated() int64 {
+	return p.allocated.Load()
+}
+
+// NewWriter returns a writer compressing to w at level with an idle context of the
+// pool, or with a new one if none is idle. Pass the writer to Put once it is no
+// longer used so that its context is reused.
+func (p *CCtxPool) NewWriter(w io.Writer, level int) (WriteFlushCloser, error) {
+	if level < 0 || level > 22 {
+		return nil, fmt.Errorf("invalid compression level %d: must be between 0 and 22", level)
+	}
+	if level == 0 {
+		level = gozstd.DefaultCompressionLevel
+	}
+	p.mu.Lock()
+	var c *pooledCCtx
+	if n := len(p.idle); n > 0 {
+		c = p.idle[n-1]
+		p.idle[n-1] = nil
+		p.idle = p.idle[:n-1]
+	}
+	p.mu.Unlock()
+	if c == nil {
+		c = p.newCCtx()
+	}
+	params := gozstd.WriterParams{
+		CompressionLevel: level,
+		NbWorkers:        c.nbWorkers,
+	}
+	c.zw.ResetWriterParams(w, &params)
+	return &pooledWriter{
+		gozstdWriterWrapper: &gozstdWriterWrapper{Writer: c.zw, params: params},
+		ctx:                 c,
+	}, nil
+}
+
+// Put returns the context of zw, created by NewWriter, to the pool. zw must not be
+// used after Put.
+func (p *CCtxPool) Put(zw WriteFlushCloser) {
+	pw, ok := zw.(*pooledWriter)
+	if !ok || pw.ctx == nil {
+		return
+	}
+	c := pw.ctx
+	pw.ctx = nil
+	pw.gozstdWriterWrapper = nil
+	// Drop the reference to the destination
+	c.zw.ResetWriterParams(io.Discard, &gozstd.WriterParams{
+		CompressionLevel: gozstd.DefaultCompressionLevel,
+		NbWorkers:        c.nbWorkers,
+	})
+	c.lastUsed = time.Now()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		c.zw.Release()
+		return
+	}
+	p.idle = append(p.idle, c)
+	if len(p.idle) > p.minIdle && p.shrink == nil {
+		p.shrink = time.AfterFunc(p.idleTimeout, p.shrinkIdle)
+	}
+}
+
+// shrinkIdle releases the contexts above the preallocated ones that have been
+// idle for idleTimeout
+func (p *CCtxPool) shrinkIdle() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.shrink = nil
+	if p.closed {
+		return
+	}
+	deadline := time.Now().Add(-p.idleTimeout)
+	// The least recently used contexts come first
+	var n int
+	for n < len(p.idle)-p.minIdle && !p.idle[n].lastUsed.After(deadline) {
+		p.idle[n].zw.Release()
+		n++
+	}
+	p.idle = append(p.idle[:0], p.idle[n:]...)
+	if len(p.idle) > p.minIdle {
+		p.shrink = time.AfterFunc(p.idle[0].lastUsed.Sub(deadline), p.shrinkIdle)
+	}
+}
+
+// Idle returns the number of idle contexts in the pool.
+func (p *CCtxPool) Idle() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.idle)
+}
+
+// Close releases the idle contexts. The contexts returned by Put afterwards are
+// released immediately.
+func (p *CCtxPool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	if p.shrink != nil {
+		p.shrink.Stop()
+		p.shrink = nil
+	}
+	for _, c := range p.idle {
+		c.zw.Release()
+	}
+	p.idle = nil
+}
+
+// pooledWriter is a writer of CCtxPool
+type pooledWriter struct {
+	*gozstdWriterWrapper
+	ctx *pooledCCtx
+}
@@ -0,0 +1,126 @@
+//go:build cgo && !no_cgo
+// +build cgo,!no_cgo
+
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package zstd
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/GrigoryEvko/gozstd"
+)
+
+func TestCCtxPool(t *testing.T) {
+	pool, err := NewCCtxPool()
+	if err != nil {
+		t.Skipf("libzstd not available: %v", err)
+	}
+	defer pool.Close()
+	preallocated := pool.Allocated()
+	if preallocated != int64(GetOptimalWorkerCount()) || pool.Idle() != int(preallocated) {
+		t.Fatalf("preallocated %d contexts (%d idle); want %d", preallocated, pool.Idle(), GetOptimalWorkerCount())
+	}
+
+	const (
+		goroutines   = 16
+		compressions = 10000
+	)
+	input := bytes.Repeat([]byte("pooled compression context "), 100)
+	var (
+		wg       sync.WaitGroup
+		count    atomic.Int64
+		failures atomic.Int64
+	)
+	start := time.Now()
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for count.Add(1) <= compressions {
+				var buf bytes.Buffer
+				zw, err := pool.NewWriter(&buf, 3)
+				if err != nil {
+					failures.Add(1)
+					return
+				}
+				_, err = zw.Write(input)
+				if err == nil {
+					err = zw.Close()
+				}
+				pool.Put(zw)
+				if err != nil {
+					failures.Add(1)
+					return
+				}
+				out, err := gozstd.Decompress(nil, buf.Bytes())
+				if err != nil || !bytes.Equal(out, input) {
+					failures.Add(1)
+					return
+				}
+			}
+		}()
+	}
+	// The allocations stop growing once the pool holds a context per goroutine
+	time.Sleep(100 * time.Millisecond)
+	warm := pool.Allocated()
+	wg.Wait()
+	if n := failures.Load(); n > 0 {
+		t.Fatalf("%d compressions failed", n)
+	}
+	got := pool.Allocated()
+	t.Logf("allocated %d contexts in the first 100ms and %d afterwards (%d compressions in %v)",
+		warm, got-warm, compressions, time.Since(start))
+	if limit := max(preallocated, goroutines); got > limit {
+		t.Errorf("allocated %d contexts for %d goroutines; want at most %d", got, goroutines, limit)
+	}
+}
+
+func TestCCtxPoolShrink(t *testing.T) {
+	pool, err := NewCCtxPool()
+	if err != nil {
+		t.Skipf("libzstd not available: %v", err)
+	}
+	defer pool.Close()
+	pool.idleTimeout = 10 * time.Millisecond
+	preallocated := pool.Allocated()
+
+	// The contexts above the preallocated ones are released once idle
+	const goroutines = 16
+	var writers []WriteFlushCloser
+	for i := 0; i < int(preallocated)+goroutines; i++ {
+		zw, err := pool.NewWriter(io.Discard, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writers = append(writers, zw)
+	}
+	for _, zw := range writers {
+		pool.Put(zw)
+	}
+	for deadline := time.Now().Add(5 * time.Second); pool.Idle() > int(preallocated); {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d contexts are idle; want %d", pool.Idle(), preallocated)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
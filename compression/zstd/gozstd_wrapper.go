@@ -1,5 +1,5 @@
-//go:build cgo
-// +build cgo
+//go:build cgo && !no_cgo
+// +build cgo,!no_cgo
 
 /*
    Copyright The containerd Authors.
@@ -20,8 +20,13 @@
 package zstd
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"runtime"
+	"sync"
 
 	"github.com/GrigoryEvko/gozstd"
 )
@@ -29,13 +34,23 @@ import (
 // GozstdCompressor implements Compressor using the gozstd library (CGO wrapper of libzstd)
 type GozstdCompressor struct {
 	available bool
+
+	mu            sync.Mutex
+	defaultParams map[int]int // set by SetDefaultParameter
 }
 
 // gozstdWriterWrapper wraps gozstd.Writer to implement WriteFlushCloser
 type gozstdWriterWrapper struct {
 	*gozstd.Writer
+	PlaintextChecksum
+	params gozstd.WriterParams
+	closed bool // until Reset
 }
 
+// errWriterClosed is returned by the writes to a closed gozstdWriterWrapper, which
+// gozstd would otherwise compress into a new frame
+var errWriterClosed = errors.New("zstd: write to a closed writer")
+
 // NewGozstdCompressor creates a new gozstd-based compressor
 func NewGozstdCompressor() *GozstdCompressor {
 	// Test if libzstd is actually available by trying to compress
@@ -58,6 +73,9 @@ func (g *GozstdCompressor) NewWriter(w io.Writer, level int) (WriteFlushCloser,
 	if !g.available {
 		return nil, fmt.Errorf("libzstd not available")
 	}
+	if w == nil {
+		return nil, errNilWriter
+	}
 	
 	// Validate compression level
 	if level < 0 || level > 22 {
@@ -65,6 +83,7 @@ func (g *GozstdCompressor) NewWriter(w io.Writer, level int) (WriteFlushCloser,
 	}
 	
 	// Use default level if 0 is specified
+	requested := level
 	if level == 0 {
 		level = gozstd.DefaultCompressionLevel
 	}
@@ -77,9 +96,118 @@ func (g *GozstdCompressor) NewWriter(w io.Writer, level int) (WriteFlushCloser,
 		CompressionLevel: level,
 		NbWorkers:        workers,
 	}
+	g.applyDefaultParameters(params, requested)
 	
 	writer := gozstd.NewWriterParams(w, params)
-	return &gozstdWriterWrapper{writer}, nil
+	return &gozstdWriterWrapper{Writer: writer, params: *params}, nil
+}
+
+// contextWriteChunkSize is the maximum size passed to libzstd in a single call
+// by writers created with NewWriterWithContext. It bounds the time a
+// cancellation waits for an in-flight CGO call.
+const contextWriteChunkSize = 128 * 1024
+
+// NewWriterWithContext is the same as NewWriter but the returned writer stops
+// once ctx is done: subsequent Write, Flush and Reset calls return ctx.Err()
+// without entering CGO, and Close releases the writer without finishing the
+// frame. CGO calls run on a dedicated OS thread and large writes are split so
+// that cancellation is observed between calls.
+func (g *GozstdCompressor) NewWriterWithContext(ctx context.Context, w io.Writer, level int) (WriteFlushCloser, error) {
+	zw, err := g.NewWriter(w, level)
+	if err != nil {
+		return nil, err
+	}
+	cw := &gozstdContextWriter{
+		ctx:   ctx,
+		w:     zw.(*gozstdWriterWrapper),
+		calls: make(chan func()),
+	}
+	go cw.run()
+	return cw, nil
+}
+
+// gozstdContextWriter runs the calls to gozstd.Writer on a locked OS thread
+type gozstdContextWriter struct {
+	ctx    context.Context
+	w      *gozstdWriterWrapper
+	calls  chan func()
+	closed bool
+}
+
+func (cw *gozstdContextWriter) run() {
+	// A thread pinned to a NUMA node stays locked so it exits with this goroutine
+	// instead of being reused by the scheduler with the restricted affinity
+	pinned := false
+	if node, ok := numaNodeFromEnv(); ok {
+		pinned = LockOSThreadToNUMANode(node) == nil
+	}
+	if !pinned {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+	}
+	for f := range cw.calls {
+		f()
+	}
+}
+
+// call runs f on the CGO thread and waits for its completion
+func (cw *gozstdContextWriter) call(f func() error) error {
+	if cw.closed {
+		return fmt.Errorf("writer is already closed")
+	}
+	if err := cw.ctx.Err(); err != nil {
+		return err
+	}
+	errCh := make(chan error, 1)
+	cw.calls <- func() { errCh <- f() }
+	return <-errCh
+}
+
+func (cw *gozstdContextWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > contextWriteChunkSize {
+			chunk = chunk[:contextWriteChunkSize]
+		}
+		var m int
+		err = cw.call(func() (err error) {
+			m, err = cw.w.Write(chunk)
+			return
+		})
+		n += m
+		if err != nil {
+			return n, err
+		}
+		p = p[len(chunk):]
+	}
+	return n, nil
+}
+
+func (cw *gozstdContextWriter) Flush() error {
+	return cw.call(cw.w.Flush)
+}
+
+func (cw *gozstdContextWriter) Reset(dst io.Writer) error {
+	return cw.call(func() error { return cw.w.Reset(dst) })
+}
+
+func (cw *gozstdContextWriter) Checksum() []byte {
+	return cw.w.Checksum()
+}
+
+func (cw *gozstdContextWriter) Close() error {
+	if cw.closed {
+		return nil
+	}
+	err := cw.call(cw.w.Close)
+	if ctxErr := cw.ctx.Err(); ctxErr != nil {
+		// The frame is left unfinished
+		cw.w.Release()
+		err = ctxErr
+	}
+	cw.closed = true
+	close(cw.calls)
+	return err
 }
 
 // NewReader creates a new zstd reader
@@ -87,6 +215,9 @@ func (g *GozstdCompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
 	if !g.available {
 		return nil, fmt.Errorf("libzstd not available")
 	}
+	if r == nil {
+		return nil, errNilReader
+	}
 	reader := gozstd.NewReader(r)
 	return &gozstdReaderWrapper{reader}, nil
 }
@@ -102,12 +233,118 @@ func (r *gozstdReaderWrapper) Close() error {
 	return nil
 }
 
+// Write implements io.Writer and adds the written bytes to the checksum
+func (w *gozstdWriterWrapper) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errWriterClosed
+	}
+	n, err := w.Writer.Write(p)
+	w.Update(p[:n])
+	return n, err
+}
+
+// ReadFrom implements io.ReaderFrom and adds the read bytes to the checksum
+func (w *gozstdWriterWrapper) ReadFrom(r io.Reader) (int64, error) {
+	if w.closed {
+		return 0, errWriterClosed
+	}
+	return w.Writer.ReadFrom(w.TeeReader(r))
+}
+
 // Flush implements the Flush method for WriteFlushCloser
 func (w *gozstdWriterWrapper) Flush() error {
+	if w.closed {
+		return errWriterClosed
+	}
 	// gozstd.Writer has Flush method
 	return w.Writer.Flush()
 }
 
+// Close finishes the frame. Closing a closed writer does nothing.
+func (w *gozstdWriterWrapper) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.Writer.Close()
+}
+
+// Reset implements the Reset method for WriteFlushCloser
+func (w *gozstdWriterWrapper) Reset(dst io.Writer) error {
+	params := w.params
+	w.Writer.ResetWriterParams(dst, &params)
+	w.ResetChecksum()
+	w.closed = false
+	return nil
+}
+
+// Compress compresses src into a single zstd frame in one call, without the
+// allocations of a streaming writer. It is meant for small blobs.
+func (g *GozstdCompressor) Compress(src []byte, level int) ([]byte, error) {
+	if !g.available {
+		return nil, fmt.Errorf("libzstd not available")
+	}
+	if level < 0 || level > 22 {
+		return nil, fmt.Errorf("invalid compression level %d: must be between 0 and 22", level)
+	}
+	if level == 0 {
+		level = gozstd.DefaultCompressionLevel
+	}
+	return gozstd.CompressLevel(nil, src, level), nil
+}
+
+// Decompress decompresses the zstd stream src into dst in one call and returns
+// the number of bytes written. ErrOutputTooSmall is returned if the data doesn't
+// fit in dst. If dst is nil, a buffer of EstimateDecompressedSize(src) bytes is
+// allocated, so only the decompressed size is reported back.
+//
+// If the data may not fit in dst, src is decompressed as a stream so decompression
+// stops after len(dst)+1 bytes.
+func (g *GozstdCompressor) Decompress(src, dst []byte) (int, error) {
+	if !g.available {
+		return 0, fmt.Errorf("libzstd not available")
+	}
+	size, err := EstimateDecompressedSize(src)
+	if err != nil {
+		return 0, err
+	}
+	if dst == nil {
+		dst = make([]byte, size)
+	}
+	if size > len(dst) {
+		return decompressStreamInto(src, dst)
+	}
+	// gozstd appends to dst and only reallocates it when the output doesn't fit
+	out, err := gozstd.Decompress(dst[:0:len(dst)], src)
+	if err != nil {
+		return 0, err
+	}
+	if len(out) > len(dst) || (len(out) > 0 && &out[0] != &dst[0]) {
+		return 0, ErrOutputTooSmall
+	}
+	return len(out), nil
+}
+
+// decompressStreamInto decompresses src into dst with a streaming reader, reading at
+// most one byte past dst to detect that the data doesn't fit
+func decompressStreamInto(src, dst []byte) (int, error) {
+	zr := gozstd.NewReader(bytes.NewReader(src))
+	defer zr.Release()
+	n, err := io.ReadFull(zr, dst)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return n, nil
+	} else if err != nil {
+		return 0, err
+	}
+	var extra [1]byte
+	if m, err := io.ReadFull(zr, extra[:]); m > 0 {
+		return 0, ErrOutputTooSmall
+	} else if err != io.EOF {
+		return 0, err
+	}
+	return n, nil
+}
+
 // Name returns the name of the compressor
 func (g *GozstdCompressor) Name() string {
 	if g.available {
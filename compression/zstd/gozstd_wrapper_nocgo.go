@@ -0,0 +1,142 @@
+//go:build !cgo || no_cgo
+// +build !cgo no_cgo
+
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package zstd
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// errNoLibzstd is returned by GozstdCompressor when built without CGO
+var errNoLibzstd = fmt.Errorf("libzstd not available: built without cgo")
+
+// GozstdCompressor is a stub of the libzstd-based compressor for builds without
+// CGO (CGO_ENABLED=0 or the no_cgo build tag). libzstd is never available.
+type GozstdCompressor struct{}
+
+// NewGozstdCompressor creates a new gozstd-based compressor
+func NewGozstdCompressor() *GozstdCompressor {
+	return &GozstdCompressor{}
+}
+
+// SetDefaultParameter always fails because libzstd is not available
+func (g *GozstdCompressor) SetDefaultParameter(param, value int) error {
+	return errNoLibzstd
+}
+
+// GetParameter always fails because libzstd is not available
+func (g *GozstdCompressor) GetParameter(param int) (int, error) {
+	return 0, errNoLibzstd
+}
+
+// NewWriter always fails because libzstd is not available
+func (g *GozstdCompressor) NewWriter(w io.Writer, level int) (WriteFlushCloser, error) {
+	return nil, errNoLibzstd
+}
+
+// NewWriterWithContext always fails because libzstd is not available
+func (g *GozstdCompressor) NewWriterWithContext(ctx context.Context, w io.Writer, level int) (WriteFlushCloser, error) {
+	return nil, errNoLibzstd
+}
+
+// NewReader always fails because libzstd is not available
+func (g *GozstdCompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return nil, errNoLibzstd
+}
+
+// Compress always fails because libzstd is not available
+func (g *GozstdCompressor) Compress(src []byte, level int) ([]byte, error) {
+	return nil, errNoLibzstd
+}
+
+// Decompress always fails because libzstd is not available
+func (g *GozstdCompressor) Decompress(src, dst []byte) (int, error) {
+	return 0, errNoLibzstd
+}
+
+// TrainDictionary always fails because libzstd is not available
+func (g *GozstdCompressor) TrainDictionary(samples [][]byte, maxSize int) ([]byte, error) {
+	return nil, errNoLibzstd
+}
+
+// NewWriterDict always fails because libzstd is not available
+func (g *GozstdCompressor) NewWriterDict(w io.Writer, level int, dict []byte) (WriteFlushCloser, error) {
+	return nil, errNoLibzstd
+}
+
+// NewReaderDict always fails because libzstd is not available
+func (g *GozstdCompressor) NewReaderDict(r io.Reader, dict []byte) (io.ReadCloser, error) {
+	return nil, errNoLibzstd
+}
+
+// CompressWithDict always fails because libzstd is not available
+func (g *GozstdCompressor) CompressWithDict(dict, src []byte, level int) ([]byte, error) {
+	return nil, errNoLibzstd
+}
+
+// DecompressWithDict always fails because libzstd is not available
+func (g *GozstdCompressor) DecompressWithDict(dict, src []byte) ([]byte, error) {
+	return nil, errNoLibzstd
+}
+
+// Name returns the name of the compressor
+func (g *GozstdCompressor) Name() string {
+	return "gozstd (unavailable)"
+}
+
+// IsLibzstdAvailable always returns false
+func (g *GozstdCompressor) IsLibzstdAvailable() bool {
+	return false
+}
+
+// MaxCompressionLevel returns 0 because libzstd is not available
+func (g *GozstdCompressor) MaxCompressionLevel() int {
+	return 0
+}
+
+// CCtxPool is a stub of the pool of libzstd compression contexts
+type CCtxPool struct{}
+
+// NewCCtxPool always fails because libzstd is not available
+func NewCCtxPool() (*CCtxPool, error) {
+	return nil, errNoLibzstd
+}
+
+// Allocated returns 0 because libzstd is not available
+func (p *CCtxPool) Allocated() int64 {
+	return 0
+}
+
+// NewWriter always fails because libzstd is not available
+func (p *CCtxPool) NewWriter(w io.Writer, level int) (WriteFlushCloser, error) {
+	return nil, errNoLibzstd
+}
+
+// Put does nothing because libzstd is not available
+func (p *CCtxPool) Put(zw WriteFlushCloser) {}
+
+// Idle returns 0 because libzstd is not available
+func (p *CCtxPool) Idle() int {
+	return 0
+}
+
+// Close does nothing because libzstd is not available
+func (p *CCtxPool) Close() {}
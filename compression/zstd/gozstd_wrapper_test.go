@@ -18,13 +18,19 @@ package zstd
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
 	"fmt"
 	"io"
 	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
 )
 
 func TestGozstdCompressor_IsAvailable(t *testing.T) {
-	defer SetupSingleThreadedTest(t)()
+	SetupSingleThreadedTest(t)
 	compressor := NewGozstdCompressor()
 	// This will return false if libzstd is not available or if testing fails
 	// We just verify it returns a boolean without panicking
@@ -32,7 +38,7 @@ func TestGozstdCompressor_IsAvailable(t *testing.T) {
 }
 
 func TestGozstdCompressor_CompressionDecompression(t *testing.T) {
-	defer SetupSingleThreadedTest(t)()
+	SetupSingleThreadedTest(t)
 	compressor := NewGozstdCompressor()
 	
 	// Skip if libzstd is not available
@@ -88,7 +94,7 @@ func TestGozstdCompressor_CompressionDecompression(t *testing.T) {
 }
 
 func TestGozstdCompressor_MaxCompressionLevel(t *testing.T) {
-	defer SetupSingleThreadedTest(t)()
+	SetupSingleThreadedTest(t)
 	compressor := NewGozstdCompressor()
 	maxLevel := compressor.MaxCompressionLevel()
 	
@@ -106,7 +112,7 @@ func TestGozstdCompressor_MaxCompressionLevel(t *testing.T) {
 }
 
 func TestGozstdCompressor_Name(t *testing.T) {
-	defer SetupSingleThreadedTest(t)()
+	SetupSingleThreadedTest(t)
 	compressor := NewGozstdCompressor()
 	name := compressor.Name()
 	
@@ -119,4 +125,287 @@ func TestGozstdCompressor_Name(t *testing.T) {
 			t.Errorf("Expected name 'gozstd (unavailable)', got %q", name)
 		}
 	}
-}
\ No newline at end of file
+}
+
+func TestGozstdCompressor_NewWriterWithContext(t *testing.T) {
+	SetupSingleThreadedTest(t)
+	compressor := NewGozstdCompressor()
+	if !compressor.IsLibzstdAvailable() {
+		t.Skip("libzstd not available, skipping gozstd tests")
+	}
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		testData := bytes.Repeat([]byte("context writer round trip "), 20000)
+		var compressed bytes.Buffer
+		writer, err := compressor.NewWriterWithContext(context.Background(), &compressed, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := writer.Write(testData); err != nil {
+			t.Fatal(err)
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatal(err)
+		}
+		reader, err := compressor.NewReader(&compressed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer reader.Close()
+		decompressed, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decompressed, testData) {
+			t.Error("Decompressed data doesn't match original")
+		}
+	})
+
+	t.Run("Cancel", func(t *testing.T) {
+		if testing.Short() {
+			t.Skip("Skipping 1GB compression in short mode")
+		}
+		block := make([]byte, 64*1024*1024)
+		if _, err := rand.Read(block); err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		writer, err := compressor.NewWriterWithContext(ctx, io.Discard, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		errCh := make(chan error, 1)
+		go func() {
+			for written := 0; written < 1024*1024*1024; written += len(block) {
+				if _, err := writer.Write(block); err != nil {
+					errCh <- err
+					return
+				}
+			}
+			errCh <- nil
+		}()
+
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+		canceled := time.Now()
+		err = <-errCh
+		if elapsed := time.Since(canceled); elapsed > 100*time.Millisecond {
+			t.Errorf("Write returned %v after cancellation; want within 100ms", elapsed)
+		}
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Write returned %v; want context.Canceled", err)
+		}
+		if _, err := writer.Write([]byte("more")); !errors.Is(err, context.Canceled) {
+			t.Errorf("Write after cancellation returned %v; want context.Canceled", err)
+		}
+		if err := writer.Close(); !errors.Is(err, context.Canceled) {
+			t.Errorf("Close after cancellation returned %v; want context.Canceled", err)
+		}
+	})
+}
+
+func TestGozstdCompressor_OneShot(t *testing.T) {
+	SetupSingleThreadedTest(t)
+	compressor := NewGozstdCompressor()
+	if !compressor.IsLibzstdAvailable() {
+		t.Skip("libzstd not available, skipping gozstd tests")
+	}
+
+	input := bytes.Repeat([]byte("one-shot metadata blob;"), 1000)
+
+	var streamed bytes.Buffer
+	w, err := compressor.NewWriter(&streamed, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(input); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	oneShot, err := compressor.Compress(input, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, compressed := range map[string][]byte{"streamed": streamed.Bytes(), "one-shot": oneShot} {
+		t.Run(name, func(t *testing.T) {
+			r, err := compressor.NewReader(bytes.NewReader(compressed))
+			if err != nil {
+				t.Fatal(err)
+			}
+			viaStream, err := io.ReadAll(r)
+			r.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			dst := make([]byte, len(input))
+			n, err := compressor.Decompress(compressed, dst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(dst[:n], viaStream) || !bytes.Equal(viaStream, input) {
+				t.Error("one-shot and streaming decompression don't match the input")
+			}
+
+			if n, err := compressor.Decompress(compressed, nil); err != nil || n != len(input) {
+				t.Errorf("Decompress(nil) = %d, %v; want %d", n, err, len(input))
+			}
+			if n, err := compressor.Decompress(compressed, make([]byte, len(input)+1)); err != nil || n != len(input) {
+				t.Errorf("Decompress into a larger buffer = %d, %v; want %d", n, err, len(input))
+			}
+
+			for _, size := range []int{0, len(input) - 1} {
+				if _, err := compressor.Decompress(compressed, make([]byte, size)); !errors.Is(err, ErrOutputTooSmall) {
+					t.Errorf("Decompress into %d bytes: got %v; want ErrOutputTooSmall", size, err)
+				}
+			}
+		})
+	}
+
+	if _, err := compressor.Compress(input, 23); err == nil {
+		t.Error("expected an error for compression level 23")
+	}
+}
+
+func TestGozstdCompressor_OneShotDict(t *testing.T) {
+	SetupSingleThreadedTest(t)
+	compressor := NewGozstdCompressor()
+	if !compressor.IsLibzstdAvailable() {
+		t.Skip("libzstd not available, skipping gozstd tests")
+	}
+
+	samples := make([][]byte, 100)
+	for i := range samples {
+		samples[i] = []byte(fmt.Sprintf(`{"digest":"sha256:%064d","size":%d,"mediaType":"application/vnd.oci.image.layer.v1.tar+zstd"}`, i*7919, i*4096))
+	}
+	pure := NewPureGoCompressor()
+	dict, err := compressor.TrainDictionary(samples, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var withDict, withoutDict int
+	for i, sample := range samples {
+		compressed, err := compressor.CompressWithDict(dict, sample, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		plain, err := compressor.CompressWithDict(nil, sample, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		withDict += len(compressed)
+		withoutDict += len(plain)
+
+		if got, err := compressor.DecompressWithDict(dict, compressed); err != nil || !bytes.Equal(got, sample) {
+			t.Fatalf("sample %d: DecompressWithDict = %q, %v", i, got, err)
+		}
+		if got, err := compressor.DecompressWithDict(nil, plain); err != nil || !bytes.Equal(got, sample) {
+			t.Fatalf("sample %d: DecompressWithDict(nil) = %q, %v", i, got, err)
+		}
+
+		// The one-shot output is readable by the pure Go implementation with the same
+		// dictionary, and the other way around
+		r, err := pure.NewReaderDict(bytes.NewReader(compressed), dict)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(r)
+		r.Close()
+		if err != nil || !bytes.Equal(got, sample) {
+			t.Fatalf("sample %d: PureGo can't read the one-shot output: %v", i, err)
+		}
+		var buf bytes.Buffer
+		w, err := pure.NewWriterDict(&buf, 3, dict)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(sample); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := compressor.DecompressWithDict(dict, buf.Bytes()); err != nil || !bytes.Equal(got, sample) {
+			t.Fatalf("sample %d: DecompressWithDict can't read the PureGo output: %v", i, err)
+		}
+	}
+	if withDict >= withoutDict {
+		t.Errorf("dictionary didn't improve compression: %d >= %d bytes", withDict, withoutDict)
+	}
+
+	if _, err := compressor.CompressWithDict(dict, samples[0], 23); err == nil {
+		t.Error("expected an error for compression level 23")
+	}
+	// A dictionary with the zstd magic number but malformed entropy tables
+	malformed := append([]byte{0x37, 0xa4, 0x30, 0xec}, bytes.Repeat([]byte{0xff}, 1024)...)
+	if _, err := compressor.CompressWithDict(malformed, samples[0], 3); err == nil {
+		t.Error("expected an error for a malformed dictionary")
+	}
+	oversized := bytes.Repeat([]byte{'x'}, MaxDictionarySize+1)
+	if _, err := compressor.CompressWithDict(oversized, samples[0], 3); err == nil {
+		t.Error("expected an error for an oversized dictionary")
+	}
+	if _, err := compressor.DecompressWithDict(oversized, samples[0]); err == nil {
+		t.Error("expected an error for an oversized dictionary")
+	}
+}
+
+func TestGozstdCompressor_Parameters(t *testing.T) {
+	SetupSingleThreadedTest(t)
+	compressor := NewGozstdCompressor()
+	if !compressor.IsLibzstdAvailable() {
+		if _, err := compressor.GetParameter(ParamWindowLog); err == nil {
+			t.Error("GetParameter should fail without libzstd")
+		}
+		t.Skip("libzstd not available")
+	}
+
+	// Defaults of libzstd
+	if v, err := compressor.GetParameter(ParamCompressionLevel); err != nil || v != 3 {
+		t.Errorf("default compression level = %d, %v; want 3", v, err)
+	}
+	if v, err := compressor.GetParameter(ParamStrategy); err != nil || v != 0 {
+		t.Errorf("default strategy = %d, %v; want 0", v, err)
+	}
+
+	if err := compressor.SetDefaultParameter(ParamWindowLog, 20); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := compressor.GetParameter(ParamWindowLog); err != nil || v != 20 {
+		t.Errorf("window log = %d, %v; want 20", v, err)
+	}
+	if err := compressor.SetDefaultParameter(ParamWindowLog, 40); err == nil {
+		t.Error("out of range window log should be rejected")
+	}
+	if err := compressor.SetDefaultParameter(ParamStrategy, 5); err == nil {
+		t.Error("strategy can't be applied to the writers and should be rejected")
+	}
+	if v, err := compressor.GetParameter(ParamWindowLog); err != nil || v != 20 {
+		t.Errorf("window log after rejected values = %d, %v; want 20", v, err)
+	}
+
+	// The writers use the window log
+	var compressed bytes.Buffer
+	writer, err := compressor.NewWriter(&compressed, 19)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writer.Write(bytes.Repeat([]byte("window log "), 1<<18)); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var header zstd.Header
+	if err := header.Decode(compressed.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if header.WindowSize != 1<<20 {
+		t.Errorf("window size of the frame = %d; want %d", header.WindowSize, 1<<20)
+	}
+}
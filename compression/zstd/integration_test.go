@@ -321,4 +321,62 @@ func TestIntegrationFlushBehavior(t *testing.T) {
 	if !bytes.Equal(decompressed, expected) {
 		t.Error("Decompressed data doesn't match expected")
 	}
-}
\ No newline at end of file
+}
+
+// TestIntegrationWriterReset verifies a single writer can be reused for several
+// streams through repeated Close and Reset calls
+func TestIntegrationWriterReset(t *testing.T) {
+	SetupSingleThreadedTest(t)
+
+	implementations := []struct {
+		name       string
+		compressor Compressor
+	}{
+		{"PureGo", NewPureGoCompressor()},
+		{"Gozstd", NewGozstdCompressor()},
+	}
+
+	for _, impl := range implementations {
+		if !impl.compressor.IsLibzstdAvailable() && impl.name == "Gozstd" {
+			continue
+		}
+
+		t.Run(impl.name, func(t *testing.T) {
+			var compressed bytes.Buffer
+			writer, err := impl.compressor.NewWriter(&compressed, 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i := 0; i < 10; i++ {
+				input := bytes.Repeat([]byte(fmt.Sprintf("payload %d;", i)), (i+1)*100)
+
+				if i > 0 {
+					compressed = bytes.Buffer{}
+					if err := writer.Reset(&compressed); err != nil {
+						t.Fatalf("reset %d: %v", i, err)
+					}
+				}
+				if _, err := writer.Write(input); err != nil {
+					t.Fatalf("write %d: %v", i, err)
+				}
+				if err := writer.Close(); err != nil {
+					t.Fatalf("close %d: %v", i, err)
+				}
+
+				reader, err := impl.compressor.NewReader(bytes.NewReader(compressed.Bytes()))
+				if err != nil {
+					t.Fatal(err)
+				}
+				decompressed, err := io.ReadAll(reader)
+				reader.Close()
+				if err != nil {
+					t.Fatalf("decompress %d: %v", i, err)
+				}
+				if !bytes.Equal(decompressed, input) {
+					t.Errorf("stream %d: decompressed data doesn't match input", i)
+				}
+			}
+		})
+	}
+}
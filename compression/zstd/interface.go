@@ -16,12 +16,35 @@
 
 package zstd
 
-import "io"
+import (
+	"errors"
+	"io"
+)
+
+// ErrOutputTooSmall is returned by one-shot decompression when the destination
+// buffer can't hold the decompressed data
+var ErrOutputTooSmall = errors.New("zstd: output buffer too small")
+
+// errNilWriter and errNilReader are returned by NewWriter and NewReader for a nil
+// destination or source
+var (
+	errNilWriter = errors.New("zstd: nil destination writer")
+	errNilReader = errors.New("zstd: nil source reader")
+)
 
 // WriteFlushCloser is an io.WriteCloser that also supports Flush
 type WriteFlushCloser interface {
 	io.WriteCloser
 	Flush() error
+
+	// Reset discards the writer's state and makes it write to w with the
+	// same parameters it was created with. It is typically called after
+	// Close to reuse the writer for another stream.
+	Reset(w io.Writer) error
+
+	// Checksum returns the checksum of the plaintext passed to Write since the
+	// writer was created or last Reset, as selected by SetChecksumAlgorithm.
+	Checksum() []byte
 }
 
 // Compressor is the interface for zstd compression implementations
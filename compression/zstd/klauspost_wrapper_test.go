@@ -20,11 +20,15 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"testing"
 )
 
 func TestKlauspostCompressor_Properties(t *testing.T) {
-	defer SetupSingleThreadedTest(t)()
+	SetupSingleThreadedTest(t)
 	compressor := NewPureGoCompressor()
 	
 	// Test IsLibzstdAvailable - should always be false
@@ -44,7 +48,7 @@ func TestKlauspostCompressor_Properties(t *testing.T) {
 }
 
 func TestKlauspostCompressor_CompressionDecompression(t *testing.T) {
-	defer SetupSingleThreadedTest(t)()
+	SetupSingleThreadedTest(t)
 	compressor := NewPureGoCompressor()
 	
 	testData := []byte("Hello, World! This is a test of zstd compression using pure Go implementation.")
@@ -91,7 +95,7 @@ func TestKlauspostCompressor_CompressionDecompression(t *testing.T) {
 }
 
 func TestKlauspostCompressor_InvalidLevel(t *testing.T) {
-	defer SetupSingleThreadedTest(t)()
+	SetupSingleThreadedTest(t)
 	compressor := NewPureGoCompressor()
 	
 	// Test that levels beyond 11 work (they should be capped internally)
@@ -102,4 +106,195 @@ func TestKlauspostCompressor_InvalidLevel(t *testing.T) {
 	if err := writer.Close(); err != nil {
 		t.Fatalf("Failed to close writer: %v", err)
 	}
-}
\ No newline at end of file
+}
+
+func TestKlauspostCompressor_ZeroFrameContent(t *testing.T) {
+	for _, emitEmptyFrame := range []bool{false, true} {
+		t.Run(fmt.Sprintf("emitEmptyFrame=%v", emitEmptyFrame), func(t *testing.T) {
+			compressor := NewPureGoCompressor(WithZeroFrameContent(emitEmptyFrame))
+			var compressed bytes.Buffer
+			writer, err := compressor.NewWriter(&compressed, 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := writer.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if !emitEmptyFrame && compressed.Len() != 0 {
+				t.Errorf("empty stream produced %d bytes", compressed.Len())
+			}
+			if emitEmptyFrame && !IsZstdData(compressed.Bytes()) {
+				t.Errorf("empty stream produced no frame: %x", compressed.Bytes())
+			}
+
+			reader, err := compressor.NewReader(bytes.NewReader(compressed.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reader.Close()
+			if n, err := reader.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+				t.Errorf("Read = %d, %v; want 0, io.EOF", n, err)
+			}
+		})
+	}
+}
+
+func TestKlauspostCompressor_HeaderlessFrame(t *testing.T) {
+	SetupSingleThreadedTest(t)
+	compressor := NewPureGoCompressor()
+	testData := bytes.Repeat([]byte("small payload "), 20)
+
+	headerless := make([]byte, 1024)
+	n, err := compressor.CompressHeaderlessFrame(testData, headerless, 3)
+	if err != nil {
+		t.Fatalf("Failed to compress a headerless frame: %v", err)
+	}
+	headerless = headerless[:n]
+
+	// A headerless frame must be smaller than the streaming frame format
+	var frame bytes.Buffer
+	writer, err := compressor.NewWriter(&frame, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writer.Write(testData); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(headerless) >= frame.Len() {
+		t.Errorf("headerless frame (%d bytes) isn't smaller than frame output (%d bytes)", len(headerless), frame.Len())
+	}
+
+	decompressed := make([]byte, len(testData))
+	n, err = compressor.DecompressHeaderlessFrame(headerless, decompressed)
+	if err != nil {
+		t.Fatalf("Failed to decompress a headerless frame: %v", err)
+	}
+	if !bytes.Equal(decompressed[:n], testData) {
+		t.Error("Decompressed data doesn't match original")
+	}
+
+	if _, err := compressor.DecompressHeaderlessFrame(frame.Bytes(), decompressed); err == nil {
+		t.Error("DecompressHeaderlessFrame should fail on frame-format input")
+	}
+	if _, err := compressor.DecompressHeaderlessFrame(headerless, make([]byte, 10)); err == nil {
+		t.Error("DecompressHeaderlessFrame should fail with a too small destination")
+	}
+	if _, err := compressor.CompressHeaderlessFrame(testData, make([]byte, 2), 3); err == nil {
+		t.Error("CompressHeaderlessFrame should fail with a too small destination")
+	}
+	if _, err := compressor.CompressHeaderlessFrame(testData, make([]byte, 1024), -1); err == nil {
+		t.Error("CompressHeaderlessFrame should fail with a negative level")
+	}
+
+	// The level is honored
+	var text bytes.Buffer
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(&text, "line %d: the quick brown fox jumps over the lazy dog %d\n", i, i%17)
+	}
+	size := func(level int) int {
+		n, err := compressor.CompressHeaderlessFrame(text.Bytes(), make([]byte, text.Len()), level)
+		if err != nil {
+			t.Fatalf("level %d: %v", level, err)
+		}
+		return n
+	}
+	if fast, best := size(1), size(11); best >= fast {
+		t.Errorf("level 11 output (%d bytes) isn't smaller than level 1 output (%d bytes)", best, fast)
+	}
+}
+
+// TestKlauspostCompressor_ReproducibleAcrossProcesses verifies that independently
+// started processes produce identical output for the same input, even when one
+// encoder was used for a stream before and the processes use different worker counts.
+func TestKlauspostCompressor_ReproducibleAcrossProcesses(t *testing.T) {
+	if os.Getenv("ZSTD_TEST_COMPRESS_SRC") != "" {
+		t.Skip("running as the helper process")
+	}
+	dir := t.TempDir()
+	src := filepath.Join(dir, "input")
+	data := make([]byte, 4<<20)
+	rnd := rand.New(rand.NewSource(1))
+	for i := range data {
+		if i%5 == 0 {
+			data[i] = byte(rnd.Intn(256))
+		} else {
+			data[i] = byte(i / 4096)
+		}
+	}
+	if err := os.WriteFile(src, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	compress := func(name, workers string, reuse bool) []byte {
+		dst := filepath.Join(dir, name)
+		cmd := exec.Command(os.Args[0], "-test.run=^TestKlauspostCompressor_HelperProcess$")
+		cmd.Env = append(os.Environ(),
+			"ZSTD_TEST_COMPRESS_SRC="+src,
+			"ZSTD_TEST_COMPRESS_DST="+dst,
+			"ZSTD_WORKERS="+workers,
+		)
+		if reuse {
+			cmd.Env = append(cmd.Env, "ZSTD_TEST_COMPRESS_REUSE=1")
+		}
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("helper process failed: %v\n%s", err, out)
+		}
+		b, err := os.ReadFile(dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	want := compress("fresh.zst", "1", false)
+	if got := compress("reused.zst", "4", true); !bytes.Equal(got, want) {
+		t.Errorf("outputs of the processes differ: %d and %d bytes", len(got), len(want))
+	}
+}
+
+// TestKlauspostCompressor_HelperProcess compresses ZSTD_TEST_COMPRESS_SRC into
+// ZSTD_TEST_COMPRESS_DST for TestKlauspostCompressor_ReproducibleAcrossProcesses.
+func TestKlauspostCompressor_HelperProcess(t *testing.T) {
+	src, dst := os.Getenv("ZSTD_TEST_COMPRESS_SRC"), os.Getenv("ZSTD_TEST_COMPRESS_DST")
+	if src == "" {
+		t.Skip("not running as the helper process")
+	}
+	data, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var compressed bytes.Buffer
+	writer, err := NewPureGoCompressor().NewWriter(&compressed, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if os.Getenv("ZSTD_TEST_COMPRESS_REUSE") != "" {
+		// Start from the state left by another stream
+		if _, err := writer.Write(bytes.Repeat([]byte("unrelated stream "), 10000)); err != nil {
+			t.Fatal(err)
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatal(err)
+		}
+		compressed.Reset()
+		if err := writer.Reset(&compressed); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Write in uneven pieces so block boundaries don't follow the writes
+	for p := data; len(p) > 0; {
+		n := min(len(p), 12345)
+		if _, err := writer.Write(p[:n]); err != nil {
+			t.Fatal(err)
+		}
+		p = p[n:]
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dst, compressed.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,147 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package zstd
+
+import (
+	"io"
+	"sync"
+)
+
+// MockCompressor is a Compressor for unit testing callers of this package.
+// It records the calls to NewWriter and NewReader and can be configured to
+// return errors. Data is passed through without compression, so the output of
+// its writers can be read by its readers.
+type MockCompressor struct {
+	mu          sync.Mutex
+	writerCalls int
+	readerCalls int
+	writerErr   error
+	readerErr   error
+	writeErr    error
+}
+
+// NewMockCompressor creates a new MockCompressor
+func NewMockCompressor() *MockCompressor {
+	return &MockCompressor{}
+}
+
+// NewWriter returns a writer passing the data through to w
+func (m *MockCompressor) NewWriter(w io.Writer, level int) (WriteFlushCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.writerCalls++
+	if m.writerErr != nil {
+		return nil, m.writerErr
+	}
+	return &mockWriter{m: m, w: w}, nil
+}
+
+// NewReader returns a reader passing the data through from r
+func (m *MockCompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.readerCalls++
+	if m.readerErr != nil {
+		return nil, m.readerErr
+	}
+	return io.NopCloser(r), nil
+}
+
+// Name returns the name of the compressor implementation
+func (m *MockCompressor) Name() string {
+	return "mock"
+}
+
+// IsLibzstdAvailable returns false for the mock
+func (m *MockCompressor) IsLibzstdAvailable() bool {
+	return false
+}
+
+// MaxCompressionLevel returns the maximum supported compression level
+func (m *MockCompressor) MaxCompressionLevel() int {
+	return 22
+}
+
+// NewWriterCalls returns how many times NewWriter has been called
+func (m *MockCompressor) NewWriterCalls() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.writerCalls
+}
+
+// NewReaderCalls returns how many times NewReader has been called
+func (m *MockCompressor) NewReaderCalls() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.readerCalls
+}
+
+// SetNewWriterError makes the following NewWriter calls fail with err (nil clears it)
+func (m *MockCompressor) SetNewWriterError(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.writerErr = err
+}
+
+// SetNewReaderError makes the following NewReader calls fail with err (nil clears it)
+func (m *MockCompressor) SetNewReaderError(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.readerErr = err
+}
+
+// ForceErrorOnWrite makes the next Write call on any of the writers fail with err
+func (m *MockCompressor) ForceErrorOnWrite(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.writeErr = err
+}
+
+// takeWriteError returns and clears the error set by ForceErrorOnWrite
+func (m *MockCompressor) takeWriteError() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	err := m.writeErr
+	m.writeErr = nil
+	return err
+}
+
+// mockWriter is the no-op WriteFlushCloser returned by MockCompressor
+type mockWriter struct {
+	PlaintextChecksum
+	m *MockCompressor
+	w io.Writer
+}
+
+func (mw *mockWriter) Write(p []byte) (int, error) {
+	if err := mw.m.takeWriteError(); err != nil {
+		return 0, err
+	}
+	n, err := mw.w.Write(p)
+	mw.Update(p[:n])
+	return n, err
+}
+
+func (mw *mockWriter) Flush() error { return nil }
+
+func (mw *mockWriter) Close() error { return nil }
+
+func (mw *mockWriter) Reset(w io.Writer) error {
+	mw.w = w
+	mw.ResetChecksum()
+	return nil
+}
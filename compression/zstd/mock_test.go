@@ -0,0 +1,67 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package zstd
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestMockCompressor(t *testing.T) {
+	m := NewMockCompressor()
+	var buf bytes.Buffer
+	w, err := m.NewWriter(&buf, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeErr := errors.New("write failed")
+	m.ForceErrorOnWrite(writeErr)
+	if _, err := w.Write([]byte("lost")); !errors.Is(err, writeErr) {
+		t.Fatalf("got error %v; want %v", err, writeErr)
+	}
+	if _, err := w.Write([]byte("data")); err != nil {
+		t.Fatalf("only the next write should fail: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := m.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "data" {
+		t.Errorf("read %q; want %q", got, "data")
+	}
+
+	m.SetNewWriterError(writeErr)
+	if _, err := m.NewWriter(&buf, 3); !errors.Is(err, writeErr) {
+		t.Errorf("got error %v; want %v", err, writeErr)
+	}
+	if n := m.NewWriterCalls(); n != 2 {
+		t.Errorf("NewWriterCalls() = %d; want 2", n)
+	}
+	if n := m.NewReaderCalls(); n != 1 {
+		t.Errorf("NewReaderCalls() = %d; want 1", n)
+	}
+}
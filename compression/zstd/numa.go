@@ -0,0 +1,96 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package zstd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// sysfsNodePath is the sysfs directory describing the NUMA nodes of the host
+const sysfsNodePath = "/sys/devices/system/node"
+
+// numaNodeEnv selects the NUMA node that compression threads are pinned to
+const numaNodeEnv = "ZSTD_NUMA_NODE"
+
+// GetNUMALocalWorkerCount returns the recommended number of compression workers
+// for the given NUMA node, that is the number of CPUs on the node. It falls back
+// to GetOptimalWorkerCount if the NUMA topology isn't available.
+func GetNUMALocalWorkerCount(node int) int {
+	cpus, err := numaNodeCPUs(sysfsNodePath, node)
+	if err != nil || len(cpus) == 0 {
+		return GetOptimalWorkerCount()
+	}
+	return len(cpus)
+}
+
+// numaNodeCPUs returns the CPUs of the NUMA node listed in the sysfs tree at root
+func numaNodeCPUs(root string, node int) ([]int, error) {
+	if node < 0 {
+		return nil, fmt.Errorf("invalid NUMA node %d", node)
+	}
+	b, err := os.ReadFile(filepath.Join(root, fmt.Sprintf("node%d", node), "cpulist"))
+	if err != nil {
+		return nil, err
+	}
+	return parseCPUList(string(b))
+}
+
+// parseCPUList parses a kernel CPU list such as "0-3,8-11,16"
+func parseCPUList(s string) ([]int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	var cpus []int
+	for _, r := range strings.Split(s, ",") {
+		first, last, isRange := strings.Cut(r, "-")
+		lo, err := strconv.Atoi(first)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CPU list %q: %w", s, err)
+		}
+		hi := lo
+		if isRange {
+			if hi, err = strconv.Atoi(last); err != nil {
+				return nil, fmt.Errorf("invalid CPU list %q: %w", s, err)
+			}
+		}
+		if lo < 0 || hi < lo {
+			return nil, fmt.Errorf("invalid CPU range %q", r)
+		}
+		for c := lo; c <= hi; c++ {
+			cpus = append(cpus, c)
+		}
+	}
+	return cpus, nil
+}
+
+// numaNodeFromEnv returns the NUMA node specified by ZSTD_NUMA_NODE, if any
+func numaNodeFromEnv() (int, bool) {
+	v := os.Getenv(numaNodeEnv)
+	if v == "" {
+		return 0, false
+	}
+	node, err := strconv.Atoi(v)
+	if err != nil || node < 0 {
+		return 0, false
+	}
+	return node, true
+}
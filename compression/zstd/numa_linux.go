@@ -0,0 +1,50 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package zstd
+
+import (
+	"fmt"
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// LockOSThreadToNUMANode wires the calling goroutine to its OS thread and
+// restricts that thread to the CPUs of the given NUMA node.
+//
+// The affinity stays with the thread, so the caller shouldn't call
+// runtime.UnlockOSThread. The runtime terminates the thread when the goroutine
+// exits while still locked.
+func LockOSThreadToNUMANode(node int) error {
+	cpus, err := numaNodeCPUs(sysfsNodePath, node)
+	if err != nil {
+		return err
+	}
+	if len(cpus) == 0 {
+		return fmt.Errorf("NUMA node %d has no CPUs", node)
+	}
+	var set unix.CPUSet
+	for _, c := range cpus {
+		set.Set(c)
+	}
+	runtime.LockOSThread()
+	if err := unix.SchedSetaffinity(0, &set); err != nil {
+		runtime.UnlockOSThread()
+		return fmt.Errorf("failed to set CPU affinity for NUMA node %d: %w", node, err)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package zstd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestNUMANodeCPUs(t *testing.T) {
+	root := t.TempDir()
+	for node, cpulist := range map[string]string{
+		"node0": "0-3,8-11,16\n",
+		"node1": "4-7,12-15\n",
+		"node2": "\n",
+	} {
+		if err := os.MkdirAll(filepath.Join(root, node), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, node, "cpulist"), []byte(cpulist), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		node int
+		want []int
+	}{
+		{0, []int{0, 1, 2, 3, 8, 9, 10, 11, 16}},
+		{1, []int{4, 5, 6, 7, 12, 13, 14, 15}},
+		{2, nil},
+	}
+	for _, tt := range tests {
+		got, err := numaNodeCPUs(root, tt.node)
+		if err != nil {
+			t.Fatalf("node %d: %v", tt.node, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("node %d: CPUs = %v; want %v", tt.node, got, tt.want)
+		}
+	}
+	if _, err := numaNodeCPUs(root, 3); err == nil {
+		t.Errorf("expected error for missing node")
+	}
+}
+
+func TestParseCPUListInvalid(t *testing.T) {
+	for _, s := range []string{"a", "1-", "3-1", "-1", "0,,1"} {
+		if _, err := parseCPUList(s); err == nil {
+			t.Errorf("parseCPUList(%q) should fail", s)
+		}
+	}
+}
+
+func TestGetNUMALocalWorkerCount(t *testing.T) {
+	if n := GetNUMALocalWorkerCount(-1); n != GetOptimalWorkerCount() {
+		t.Errorf("invalid node: got %d workers; want fallback %d", n, GetOptimalWorkerCount())
+	}
+	cpus, err := numaNodeCPUs(sysfsNodePath, 0)
+	if err != nil || len(cpus) == 0 {
+		t.Skipf("NUMA topology isn't available: %v", err)
+	}
+	if n := GetNUMALocalWorkerCount(0); n != len(cpus) {
+		t.Errorf("node 0: got %d workers; want %d", n, len(cpus))
+	}
+}
@@ -0,0 +1,41 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package zstd
+
+// Compression parameters of libzstd (ZSTD_cParameter), for
+// GozstdCompressor.SetDefaultParameter and GozstdCompressor.GetParameter
+const (
+	ParamCompressionLevel           = 100 // ZSTD_c_compressionLevel
+	ParamWindowLog                  = 101 // ZSTD_c_windowLog
+	ParamHashLog                    = 102 // ZSTD_c_hashLog
+	ParamChainLog                   = 103 // ZSTD_c_chainLog
+	ParamSearchLog                  = 104 // ZSTD_c_searchLog
+	ParamMinMatch                   = 105 // ZSTD_c_minMatch
+	ParamTargetLength               = 106 // ZSTD_c_targetLength
+	ParamStrategy                   = 107 // ZSTD_c_strategy
+	ParamEnableLongDistanceMatching = 160 // ZSTD_c_enableLongDistanceMatching
+	ParamLdmHashLog                 = 161 // ZSTD_c_ldmHashLog
+	ParamLdmMinMatch                = 162 // ZSTD_c_ldmMinMatch
+	ParamLdmBucketSizeLog           = 163 // ZSTD_c_ldmBucketSizeLog
+	ParamLdmHashRateLog             = 164 // ZSTD_c_ldmHashRateLog
+	ParamContentSizeFlag            = 200 // ZSTD_c_contentSizeFlag
+	ParamChecksumFlag               = 201 // ZSTD_c_checksumFlag
+	ParamDictIDFlag                 = 202 // ZSTD_c_dictIDFlag
+	ParamNbWorkers                  = 400 // ZSTD_c_nbWorkers
+	ParamJobSize                    = 401 // ZSTD_c_jobSize
+	ParamOverlapLog                 = 402 // ZSTD_c_overlapLog
+)
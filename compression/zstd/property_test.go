@@ -0,0 +1,97 @@
+//go:build property_tests
+// +build property_tests
+
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package zstd
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"strconv"
+	"testing"
+
+	"pgregory.net/rapid"
+)
+
+// propertyChecks is the number of cases each property test runs unless
+// overridden with -rapid.checks or RAPID_CHECKS
+const propertyChecks = 200
+
+func init() {
+	// Runs before flag.Parse so an explicit -rapid.checks still wins
+	if _, ok := os.LookupEnv("RAPID_CHECKS"); !ok {
+		flag.Set("rapid.checks", strconv.Itoa(propertyChecks))
+	}
+}
+
+// TestCompressionSizeMonotonicity checks that higher compression levels never
+// produce larger output than lower ones on highly repetitive data
+func TestCompressionSizeMonotonicity(t *testing.T) {
+	implementations := []struct {
+		name       string
+		compressor Compressor
+	}{
+		{"PureGo", NewPureGoCompressor()},
+		{"Gozstd", NewGozstdCompressor()},
+	}
+	levels := []int{1, 3, 11}
+
+	for _, impl := range implementations {
+		if !impl.compressor.IsLibzstdAvailable() && impl.name == "Gozstd" {
+			continue
+		}
+
+		t.Run(impl.name, func(t *testing.T) {
+			rapid.Check(t, func(t *rapid.T) {
+				size := rapid.IntRange(1024, 256*1024).Draw(t, "size")
+				fill := rapid.Byte().Draw(t, "fill")
+				pattern := rapid.SliceOfN(rapid.Byte(), 1, 64).Draw(t, "pattern")
+
+				// 80% of the buffer is a single byte, the rest repeats a short
+				// random pattern
+				data := bytes.Repeat([]byte{fill}, size)
+				for i, j := size*8/10, 0; i < size; i, j = i+1, j+1 {
+					data[i] = pattern[j%len(pattern)]
+				}
+
+				sizes := make([]int, len(levels))
+				for i, level := range levels {
+					var buf bytes.Buffer
+					w, err := impl.compressor.NewWriter(&buf, level)
+					if err != nil {
+						t.Fatalf("level %d: %v", level, err)
+					}
+					if _, err := w.Write(data); err != nil {
+						t.Fatalf("level %d: %v", level, err)
+					}
+					if err := w.Close(); err != nil {
+						t.Fatalf("level %d: %v", level, err)
+					}
+					sizes[i] = buf.Len()
+				}
+				for i := 1; i < len(levels); i++ {
+					if sizes[i] > sizes[i-1] {
+						t.Fatalf("level %d output (%d bytes) is larger than level %d output (%d bytes)",
+							levels[i], sizes[i], levels[i-1], sizes[i-1])
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,99 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package zstd
+
+import (
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// dictTablesReserve is the room left for the entropy tables when filling the
+// dictionary content
+const dictTablesReserve = 512
+
+// TrainDictionary builds a dictionary from samples. The dictionary content is
+// taken from the most recent samples and the entropy tables are built from all
+// of them.
+func (p *PureGoCompressor) TrainDictionary(samples [][]byte, maxSize int) ([]byte, error) {
+	samples, err := validateTrainingSamples(samples, maxSize)
+	if err != nil {
+		return nil, err
+	}
+	histSize := maxSize - dictTablesReserve
+	var hist []byte
+	for i := len(samples) - 1; i >= 0 && len(hist) < histSize; i-- {
+		hist = append(append([]byte{}, samples[i]...), hist...)
+	}
+	if len(hist) > histSize {
+		hist = hist[len(hist)-histSize:]
+	}
+	dict, err := zstd.BuildDict(zstd.BuildDictOptions{
+		ID:       dictionaryID(hist),
+		Contents: samples,
+		History:  hist,
+		Offsets:  [3]int{1, 4, 8},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(dict) > maxSize {
+		return nil, fmt.Errorf("trained dictionary size %d exceeds %d", len(dict), maxSize)
+	}
+	return dict, nil
+}
+
+// NewWriterDict creates a new zstd writer compressing with dict
+func (p *PureGoCompressor) NewWriterDict(w io.Writer, level int, dict []byte) (WriteFlushCloser, error) {
+	if err := validateDictionary(dict); err != nil {
+		return nil, err
+	}
+	if level < 0 {
+		return nil, fmt.Errorf("invalid compression level %d: must be non-negative", level)
+	}
+	if level > 11 {
+		level = 11
+	}
+	enc, err := zstd.NewWriter(w,
+		zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)),
+		zstd.WithEncoderConcurrency(GetOptimalWorkerCount()),
+		zstd.WithEncoderDict(dict))
+	if err != nil {
+		return nil, err
+	}
+	return &zstdWriteFlushCloser{Encoder: enc}, nil
+}
+
+// NewReaderDict creates a new zstd reader decompressing with dict
+func (p *PureGoCompressor) NewReaderDict(r io.Reader, dict []byte) (io.ReadCloser, error) {
+	if err := validateDictionary(dict); err != nil {
+		return nil, err
+	}
+	dec, err := zstd.NewReader(r, zstd.WithDecoderDicts(dict))
+	if err != nil {
+		return nil, err
+	}
+	return &zstdReadCloser{dec}, nil
+}
+
+// dictionaryID derives the dictionary ID from its content. IDs below 32768 are
+// reserved by the zstd format.
+func dictionaryID(content []byte) uint32 {
+	return crc32.ChecksumIEEE(content)%(1<<31-32768) + 32768
+}
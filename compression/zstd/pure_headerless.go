@@ -0,0 +1,111 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package zstd
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	headerlessMu       sync.Mutex
+	headerlessEncoders = make(map[zstd.EncoderLevel]*zstd.Encoder)
+	headerlessDecoder  *zstd.Decoder
+)
+
+// headerlessCodec returns the shared encoder of level, writing single-segment frames
+// without checksum, and the shared decoder
+func headerlessCodec(level int) (*zstd.Encoder, *zstd.Decoder, error) {
+	if level < 0 {
+		return nil, nil, fmt.Errorf("invalid compression level %d: must be non-negative", level)
+	}
+	if level > 11 {
+		level = 11 // same as NewWriter
+	}
+	encoderLevel := zstd.EncoderLevelFromZstd(level)
+	headerlessMu.Lock()
+	defer headerlessMu.Unlock()
+	if headerlessDecoder == nil {
+		dec, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+		if err != nil {
+			return nil, nil, err
+		}
+		headerlessDecoder = dec
+	}
+	enc, ok := headerlessEncoders[encoderLevel]
+	if !ok {
+		var err error
+		enc, err = zstd.NewWriter(nil,
+			zstd.WithEncoderLevel(encoderLevel),
+			zstd.WithEncoderCRC(false),
+			zstd.WithSingleSegment(true),
+			zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			return nil, nil, err
+		}
+		headerlessEncoders[encoderLevel] = enc
+	}
+	return enc, headerlessDecoder, nil
+}
+
+// CompressHeaderlessFrame compresses src at level into dst and returns the number of
+// bytes written. The output is a headerless frame: a single-segment zstd frame with
+// its 4-byte magic number stripped and no checksum (not a raw zstd block, which has
+// no frame header at all). It saves those 4 bytes and the 4-byte checksum over the
+// streaming format, which only matters for small payloads. It can only be read by
+// DecompressHeaderlessFrame, not by frame-format readers. Levels are mapped as by
+// NewWriter.
+func (p *PureGoCompressor) CompressHeaderlessFrame(src, dst []byte, level int) (n int, err error) {
+	enc, _, err := headerlessCodec(level)
+	if err != nil {
+		return 0, err
+	}
+	frame := enc.EncodeAll(src, nil)
+	if !IsZstdData(frame) {
+		return 0, fmt.Errorf("unexpected encoder output")
+	}
+	headerless := frame[len(zstdFrameMagic):]
+	if len(headerless) > len(dst) {
+		return 0, fmt.Errorf("destination buffer is too small: %d < %d", len(dst), len(headerless))
+	}
+	return copy(dst, headerless), nil
+}
+
+// DecompressHeaderlessFrame decompresses the headerless frame src written by
+// CompressHeaderlessFrame into dst and returns the number of bytes written.
+// Frame-format input is rejected.
+func (p *PureGoCompressor) DecompressHeaderlessFrame(src, dst []byte) (n int, err error) {
+	if IsZstdData(src) {
+		return 0, fmt.Errorf("input is in zstd frame format, not a headerless frame")
+	}
+	_, dec, err := headerlessCodec(0)
+	if err != nil {
+		return 0, err
+	}
+	frame := make([]byte, 0, len(zstdFrameMagic)+len(src))
+	frame = append(append(frame, zstdFrameMagic...), src...)
+	out, err := dec.DecodeAll(frame, dst[:0])
+	if err != nil {
+		return 0, err
+	}
+	if len(out) > len(dst) {
+		return 0, fmt.Errorf("destination buffer is too small: %d < %d", len(dst), len(out))
+	}
+	return copy(dst, out), nil
+}
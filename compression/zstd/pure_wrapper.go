@@ -24,15 +24,37 @@ import (
 )
 
 // PureGoCompressor implements Compressor using the pure Go klauspost/compress/zstd library
-type PureGoCompressor struct{}
+type PureGoCompressor struct {
+	emitEmptyFrame bool
+}
+
+// PureGoOption configures a PureGoCompressor
+type PureGoOption func(*PureGoCompressor)
+
+// WithZeroFrameContent sets whether a writer closed without any written bytes
+// emits a zstd frame with no content. By default it emits no bytes at all, which
+// NewReader reads as an empty stream. Some consumers expect every stream to hold
+// at least one frame; they need emitEmptyFrame set to true.
+func WithZeroFrameContent(emitEmptyFrame bool) PureGoOption {
+	return func(p *PureGoCompressor) {
+		p.emitEmptyFrame = emitEmptyFrame
+	}
+}
 
 // NewPureGoCompressor creates a new pure Go compressor
-func NewPureGoCompressor() *PureGoCompressor {
-	return &PureGoCompressor{}
+func NewPureGoCompressor(opts ...PureGoOption) *PureGoCompressor {
+	p := &PureGoCompressor{}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
 }
 
 // NewWriter creates a new zstd writer with the specified compression level
 func (p *PureGoCompressor) NewWriter(w io.Writer, level int) (WriteFlushCloser, error) {
+	if w == nil {
+		return nil, errNilWriter
+	}
 	// Validate and cap compression level
 	// Pure Go implementation supports levels 0-11 (mapped from zstd levels)
 	if level < 0 {
@@ -51,16 +73,20 @@ func (p *PureGoCompressor) NewWriter(w io.Writer, level int) (WriteFlushCloser,
 	
 	enc, err := zstd.NewWriter(w, 
 		zstd.WithEncoderLevel(encoderLevel),
-		zstd.WithEncoderConcurrency(workers))
+		zstd.WithEncoderConcurrency(workers),
+		zstd.WithZeroFrames(p.emitEmptyFrame))
 	if err != nil {
 		return nil, err
 	}
 	
-	return enc, nil
+	return &zstdWriteFlushCloser{Encoder: enc}, nil
 }
 
 // NewReader creates a new zstd reader
 func (p *PureGoCompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	if r == nil {
+		return nil, errNilReader
+	}
 	dec, err := zstd.NewReader(r)
 	if err != nil {
 		return nil, err
@@ -90,6 +116,28 @@ func (p *PureGoCompressor) MaxCompressionLevel() int {
 	return 11
 }
 
+// zstdWriteFlushCloser wraps zstd.Encoder to implement WriteFlushCloser
+type zstdWriteFlushCloser struct {
+	*zstd.Encoder
+	PlaintextChecksum
+}
+
+func (z *zstdWriteFlushCloser) Write(p []byte) (int, error) {
+	n, err := z.Encoder.Write(p)
+	z.Update(p[:n])
+	return n, err
+}
+
+func (z *zstdWriteFlushCloser) ReadFrom(r io.Reader) (int64, error) {
+	return z.Encoder.ReadFrom(z.TeeReader(r))
+}
+
+func (z *zstdWriteFlushCloser) Reset(w io.Writer) error {
+	z.Encoder.Reset(w)
+	z.ResetChecksum()
+	return nil
+}
+
 // zstdReadCloser wraps zstd.Decoder to implement io.ReadCloser
 type zstdReadCloser struct {
 	*zstd.Decoder
@@ -0,0 +1,118 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package zstd
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"golang.org/x/time/rate"
+)
+
+// rateLimitBurstFraction is the fraction of a second of the byte rate that the
+// writers of RateLimitedCompressor can write at once
+const rateLimitBurstFraction = 10
+
+// RateLimitedCompressor is a Compressor whose writers pass their input to the
+// writers of inner at a limited rate, so that compression running alongside
+// latency-sensitive workloads doesn't take all the CPU. Its writers share a token
+// bucket refilled with bytesPerSecond tokens per second: each Write acquires a
+// token per byte before passing the data on, waiting for the bucket to refill.
+// The bucket holds a tenth of a second of tokens, so larger writes are passed on
+// in pieces of that size.
+type RateLimitedCompressor struct {
+	inner   Compressor
+	limiter *rate.Limiter
+}
+
+// NewRateLimitedCompressor creates a RateLimitedCompressor limiting the writers of
+// inner to bytesPerSecond bytes per second in total. bytesPerSecond <= 0 means no
+// limit.
+func NewRateLimitedCompressor(inner Compressor, bytesPerSecond float64) *RateLimitedCompressor {
+	limit, burst := rate.Inf, 0
+	if bytesPerSecond > 0 {
+		limit = rate.Limit(bytesPerSecond)
+		burst = max(1, int(bytesPerSecond/rateLimitBurstFraction))
+	}
+	return &RateLimitedCompressor{
+		inner:   inner,
+		limiter: rate.NewLimiter(limit, burst),
+	}
+}
+
+// NewWriter creates a rate limited writer of the inner compressor
+func (c *RateLimitedCompressor) NewWriter(w io.Writer, level int) (WriteFlushCloser, error) {
+	return c.NewWriterWithContext(context.Background(), w, level)
+}
+
+// NewWriterWithContext is the same as NewWriter but the Write calls of the returned
+// writer stop waiting for tokens and return ctx.Err() once ctx is done.
+func (c *RateLimitedCompressor) NewWriterWithContext(ctx context.Context, w io.Writer, level int) (WriteFlushCloser, error) {
+	zw, err := c.inner.NewWriter(w, level)
+	if err != nil {
+		return nil, err
+	}
+	return &rateLimitedWriter{WriteFlushCloser: zw, ctx: ctx, limiter: c.limiter}, nil
+}
+
+// NewReader creates a reader of the inner compressor. Decompression isn't limited.
+func (c *RateLimitedCompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return c.inner.NewReader(r)
+}
+
+// Name returns the name of the inner compressor
+func (c *RateLimitedCompressor) Name() string {
+	return fmt.Sprintf("rate limited %s", c.inner.Name())
+}
+
+// IsLibzstdAvailable returns whether the inner compressor uses libzstd
+func (c *RateLimitedCompressor) IsLibzstdAvailable() bool {
+	return c.inner.IsLibzstdAvailable()
+}
+
+// MaxCompressionLevel returns the maximum level of the inner compressor
+func (c *RateLimitedCompressor) MaxCompressionLevel() int {
+	return c.inner.MaxCompressionLevel()
+}
+
+// rateLimitedWriter acquires a token per byte from limiter before each write
+type rateLimitedWriter struct {
+	WriteFlushCloser
+	ctx     context.Context
+	limiter *rate.Limiter
+}
+
+func (rw *rateLimitedWriter) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 {
+		n := len(p)
+		if burst := rw.limiter.Burst(); rw.limiter.Limit() != rate.Inf && n > burst {
+			n = burst
+		}
+		if err := rw.limiter.WaitN(rw.ctx, n); err != nil {
+			return written, err
+		}
+		nw, err := rw.WriteFlushCloser.Write(p[:n])
+		written += nw
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
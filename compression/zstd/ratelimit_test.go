@@ -0,0 +1,96 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package zstd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestRateLimitedCompressor(t *testing.T) {
+	if testing.Short() {
+		t.Skip("takes 10 seconds")
+	}
+	data := bytes.Repeat([]byte("rate limited "), 10<<20/13)
+	c := NewRateLimitedCompressor(NewPureGoCompressor(), 1<<20)
+
+	var buf bytes.Buffer
+	w, err := c.NewWriter(&buf, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if n, err := w.Write(data); err != nil || n != len(data) {
+		t.Fatalf("Write = %d, %v; want %d", n, err, len(data))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 9*time.Second || elapsed > 11*time.Second {
+		t.Errorf("compressing 10 MB at 1 MB/s took %v; want 9-11s", elapsed)
+	}
+
+	r, err := c.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("decompressed data differs from the input")
+	}
+}
+
+func TestRateLimitedCompressorContext(t *testing.T) {
+	c := NewRateLimitedCompressor(NewMockCompressor(), 1000)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	w, err := c.NewWriterWithContext(ctx, io.Discard, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 1 second of tokens can't be acquired before the deadline. WaitN fails as
+	// soon as it knows, so the error isn't necessarily context.DeadlineExceeded.
+	start := time.Now()
+	if n, err := w.Write(make([]byte, 1000)); err == nil || n >= 1000 {
+		t.Errorf("Write = %d, %v; want an error before writing 1000 bytes", n, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Write returned after %v; want it to stop at the deadline", elapsed)
+	}
+
+	cancel()
+	if _, err := w.Write([]byte("x")); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v after cancellation; want %v", err, context.Canceled)
+	}
+
+	// No limit
+	w, err = NewRateLimitedCompressor(NewMockCompressor(), 0).NewWriter(io.Discard, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := w.Write(make([]byte, 10<<20)); err != nil || n != 10<<20 {
+		t.Errorf("unlimited Write = %d, %v", n, err)
+	}
+}
@@ -0,0 +1,68 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package zstd
+
+import "io"
+
+// CopyWithRecompression decompresses the zstd stream read from src and writes it to dst
+// compressed again at dstLevel, in one pass without buffering the whole stream.
+// The compressor returned by GetCompressor is used for both directions. It returns
+// the number of bytes written to dst.
+func CopyWithRecompression(dst io.Writer, src io.Reader, dstLevel int) (int64, error) {
+	compressor := GetCompressor()
+	zr, err := compressor.NewReader(src)
+	if err != nil {
+		return 0, err
+	}
+	defer zr.Close()
+
+	cw := &countWriter{w: dst}
+	zw, err := compressor.NewWriter(cw, dstLevel)
+	if err != nil {
+		return 0, err
+	}
+
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := io.Copy(pw, zr)
+		pw.CloseWithError(err)
+	}()
+	if _, err := io.Copy(zw, pr); err != nil {
+		pr.CloseWithError(err) // unblock the decompressing goroutine
+		<-done                 // zr must not be closed during zr.Read
+		zw.Close()
+		return cw.n, err
+	}
+	if err := zw.Close(); err != nil {
+		return cw.n, err
+	}
+	return cw.n, nil
+}
+
+// countWriter counts the bytes written to the underlying writer
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,85 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package zstd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestCopyWithRecompression(t *testing.T) {
+	var input bytes.Buffer
+	for i := 0; i < 20000; i++ {
+		fmt.Fprintf(&input, "line %d: the quick brown fox jumps over the lazy dog %d\n", i, i%17)
+	}
+	compressor := GetCompressor()
+	var src bytes.Buffer
+	w, err := compressor.NewWriter(&src, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(input.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	recompress := func(level int) []byte {
+		var dst bytes.Buffer
+		n, err := CopyWithRecompression(&dst, bytes.NewReader(src.Bytes()), level)
+		if err != nil {
+			t.Fatalf("level %d: %v", level, err)
+		}
+		if n != int64(dst.Len()) {
+			t.Errorf("level %d: returned %d bytes; wrote %d", level, n, dst.Len())
+		}
+		return dst.Bytes()
+	}
+
+	out := recompress(3)
+	r, err := compressor.NewReader(bytes.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	decompressed, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decompressed, input.Bytes()) {
+		t.Error("recompressed data doesn't decompress to the original")
+	}
+
+	fast, best := recompress(1), recompress(11)
+	if len(best) >= len(fast) {
+		t.Errorf("level 11 output (%d bytes) isn't smaller than level 1 output (%d bytes)", len(best), len(fast))
+	}
+
+	if _, err := CopyWithRecompression(io.Discard, bytes.NewReader([]byte("not zstd")), 3); err == nil {
+		t.Error("expected an error for invalid input")
+	}
+
+	// the decompressing goroutine must be done before returning on a failure of dst
+	if _, err := CopyWithRecompression(failingWriter{errors.New("dst failure")}, bytes.NewReader(src.Bytes()), 3); err == nil {
+		t.Error("expected an error for failing dst")
+	}
+}
+
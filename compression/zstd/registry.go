@@ -0,0 +1,78 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package zstd
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// zstdFrameMagic is the magic number starting every zstd frame
+var zstdFrameMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// CompressorRegistry holds Compressor implementations by name
+type CompressorRegistry struct {
+	mu          sync.RWMutex
+	compressors map[string]Compressor
+}
+
+// DefaultRegistry is the registry that compression packages register
+// their implementations to
+var DefaultRegistry = NewCompressorRegistry()
+
+// NewCompressorRegistry creates an empty registry
+func NewCompressorRegistry() *CompressorRegistry {
+	return &CompressorRegistry{compressors: make(map[string]Compressor)}
+}
+
+// Register adds c to the registry as name. It fails if name is already registered.
+func (r *CompressorRegistry) Register(name string, c Compressor) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.compressors[name]; ok {
+		return fmt.Errorf("compressor %q is already registered", name)
+	}
+	r.compressors[name] = c
+	return nil
+}
+
+// Get returns the compressor registered as name
+func (r *CompressorRegistry) Get(name string) (Compressor, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c, ok := r.compressors[name]
+	return c, ok
+}
+
+// Names returns the sorted names of all registered compressors
+func (r *CompressorRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.compressors))
+	for name := range r.compressors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsZstdData returns true if b starts with a zstd frame
+func IsZstdData(b []byte) bool {
+	return bytes.HasPrefix(b, zstdFrameMagic)
+}
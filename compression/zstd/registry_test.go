@@ -0,0 +1,63 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package zstd
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCompressorRegistry(t *testing.T) {
+	r := NewCompressorRegistry()
+	c := NewPureGoCompressor()
+	if err := r.Register("klauspost", c); err != nil {
+		t.Fatalf("failed to register: %v", err)
+	}
+	if err := r.Register("klauspost", c); err == nil {
+		t.Errorf("registering the same name twice should fail")
+	}
+	if got, ok := r.Get("klauspost"); !ok || got != c {
+		t.Errorf("Get returned %v, %v", got, ok)
+	}
+	if _, ok := r.Get("unknown"); ok {
+		t.Errorf("Get should fail for unknown names")
+	}
+	if names := r.Names(); len(names) != 1 || names[0] != "klauspost" {
+		t.Errorf("unexpected names %v", names)
+	}
+}
+
+func TestIsZstdData(t *testing.T) {
+	SetupSingleThreadedTest(t)
+	var buf bytes.Buffer
+	w, err := NewPureGoCompressor().NewWriter(&buf, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("test")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !IsZstdData(buf.Bytes()) {
+		t.Errorf("zstd output isn't detected as zstd")
+	}
+	if IsZstdData([]byte("test")) {
+		t.Errorf("plain data is detected as zstd")
+	}
+}
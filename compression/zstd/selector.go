@@ -19,6 +19,8 @@ package zstd
 import (
 	"os"
 	"sync"
+
+	"github.com/containerd/log"
 )
 
 var (
@@ -29,24 +31,31 @@ var (
 // GetCompressor returns the appropriate zstd compressor based on runtime availability
 func GetCompressor() Compressor {
 	once.Do(func() {
-		// Check if user wants to force pure Go implementation
-		if os.Getenv("STARGZ_FORCE_PURE_GO_ZSTD") == "1" {
-			defaultCompressor = NewPureGoCompressor()
-			return
-		}
-
-		// Try gozstd first
-		gozstd := NewGozstdCompressor()
-		if gozstd.IsLibzstdAvailable() {
-			defaultCompressor = gozstd
-		} else {
-			defaultCompressor = NewPureGoCompressor()
-		}
+		defaultCompressor = detectCompressor()
+		workers, source := GetOptimalWorkerCountWithSource()
+		log.L.Debugf("using %s for zstd compression with %d workers (worker count source: %s)",
+			defaultCompressor.Name(), workers, source)
 	})
 	return defaultCompressor
 }
 
+func detectCompressor() Compressor {
+	// Check if user wants to force pure Go implementation
+	if os.Getenv("STARGZ_FORCE_PURE_GO_ZSTD") == "1" {
+		return NewPureGoCompressor()
+	}
+
+	// Try gozstd first
+	gozstd := NewGozstdCompressor()
+	if gozstd.IsLibzstdAvailable() {
+		return gozstd
+	}
+	return NewPureGoCompressor()
+}
+
 // SetCompressor allows overriding the default compressor (mainly for testing)
 func SetCompressor(c Compressor) {
+	// Complete the detection first so it doesn't overwrite c later
+	once.Do(func() {})
 	defaultCompressor = c
 }
\ No newline at end of file
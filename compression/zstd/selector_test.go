@@ -22,7 +22,7 @@ import (
 )
 
 func TestGetCompressor(t *testing.T) {
-	defer SetupSingleThreadedTest(t)()
+	SetupSingleThreadedTest(t)
 	// Test automatic detection
 	compressor := GetCompressor()
 	if compressor == nil {
@@ -41,7 +41,7 @@ func TestGetCompressor(t *testing.T) {
 }
 
 func TestEnvironmentOverride(t *testing.T) {
-	defer SetupSingleThreadedTest(t)()
+	SetupSingleThreadedTest(t)
 	
 	// Test forcing pure Go implementation
 	t.Run("Force pure Go", func(t *testing.T) {
@@ -84,7 +84,7 @@ func TestEnvironmentOverride(t *testing.T) {
 }
 
 func TestCompressionLevelValidation(t *testing.T) {
-	defer SetupSingleThreadedTest(t)()
+	SetupSingleThreadedTest(t)
 	compressor := GetCompressor()
 	maxLevel := compressor.MaxCompressionLevel()
 	
@@ -0,0 +1,196 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package zstd
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+)
+
+const (
+	// defaultStreamChunkSize is the chunk size of NewStreamCompressor for non-positive chunkSize
+	defaultStreamChunkSize = 1 << 20
+
+	// streamCompressionLevel is the compression level of StreamCompressor
+	streamCompressionLevel = 3
+)
+
+var errStreamCompressorClosed = errors.New("zstd: write to closed StreamCompressor")
+
+// StreamCompressor is an io.WriteCloser that splits the written stream into chunks
+// of a fixed size and compresses them in parallel. Each chunk is written to the
+// destination as a self-contained zstd frame, in the order of the stream, so the
+// output is a valid zstd stream that can be decompressed by any zstd reader.
+type StreamCompressor struct {
+	dst        io.Writer
+	chunkSize  int
+	compressor Compressor
+	buf        []byte
+	chunks     int
+
+	jobs    chan *streamChunk
+	pending chan *streamChunk
+	workers sync.WaitGroup
+	written chan struct{}
+
+	mu     sync.Mutex
+	err    error
+	closed bool
+}
+
+// streamChunk is a chunk of the stream being compressed by a worker
+type streamChunk struct {
+	data []byte
+	out  bytes.Buffer
+	err  error
+	done chan struct{}
+}
+
+// NewStreamCompressor returns a StreamCompressor writing to dst. The stream is split
+// at chunkSize boundaries and the chunks are compressed at level 3 by workers
+// goroutines with the compressor returned by GetCompressor. Non-positive chunkSize
+// means 1 MiB and non-positive workers means GetOptimalWorkerCount.
+func NewStreamCompressor(dst io.Writer, chunkSize int, workers int) *StreamCompressor {
+	if chunkSize <= 0 {
+		chunkSize = defaultStreamChunkSize
+	}
+	if workers <= 0 {
+		workers = GetOptimalWorkerCount()
+	}
+	s := &StreamCompressor{
+		dst:        dst,
+		chunkSize:  chunkSize,
+		compressor: GetCompressor(),
+		jobs:       make(chan *streamChunk, workers),
+		// Bounds the number of chunks held in memory
+		pending: make(chan *streamChunk, 2*workers),
+		written: make(chan struct{}),
+	}
+	s.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go s.compressChunks()
+	}
+	go s.writeChunks()
+	return s
+}
+
+// Write buffers p and submits the chunks it completes for compression. It returns
+// the first error that occurred while compressing or writing a previous chunk.
+func (s *StreamCompressor) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	closed, err := s.closed, s.err
+	s.mu.Unlock()
+	if closed {
+		return 0, errStreamCompressorClosed
+	}
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	for len(p) > 0 {
+		if s.buf == nil {
+			s.buf = make([]byte, 0, s.chunkSize)
+		}
+		m := copy(s.buf[len(s.buf):s.chunkSize], p)
+		s.buf = s.buf[:len(s.buf)+m]
+		p = p[m:]
+		n += m
+		if len(s.buf) == s.chunkSize {
+			s.submit()
+		}
+	}
+	return n, nil
+}
+
+// Close compresses the remaining data, waits for all chunks to be written to the
+// destination and stops the workers. It doesn't close the destination.
+func (s *StreamCompressor) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return s.err
+	}
+	s.closed = true
+	s.mu.Unlock()
+
+	// An empty stream is written as an empty frame
+	if len(s.buf) > 0 || s.chunks == 0 {
+		s.submit()
+	}
+	close(s.jobs)
+	close(s.pending)
+	s.workers.Wait()
+	<-s.written
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// submit passes the buffered chunk to the workers and to the goroutine writing
+// the compressed chunks in order
+func (s *StreamCompressor) submit() {
+	c := &streamChunk{data: s.buf, done: make(chan struct{})}
+	s.buf = nil
+	s.chunks++
+	s.pending <- c
+	s.jobs <- c
+}
+
+// compressChunks compresses the chunks received from jobs, each into a frame
+func (s *StreamCompressor) compressChunks() {
+	defer s.workers.Done()
+	var zw WriteFlushCloser
+	for c := range s.jobs {
+		if zw == nil {
+			zw, c.err = s.compressor.NewWriter(&c.out, streamCompressionLevel)
+		} else {
+			c.err = zw.Reset(&c.out)
+		}
+		if c.err == nil {
+			if _, c.err = zw.Write(c.data); c.err == nil {
+				c.err = zw.Close()
+			}
+		}
+		c.data = nil
+		close(c.done)
+	}
+}
+
+// writeChunks writes the compressed chunks to dst in the order they were submitted
+func (s *StreamCompressor) writeChunks() {
+	defer close(s.written)
+	for c := range s.pending {
+		<-c.done
+		s.mu.Lock()
+		failed := s.err != nil
+		s.mu.Unlock()
+		if failed {
+			continue // drain the remaining chunks
+		}
+		err := c.err
+		if err == nil {
+			_, err = s.dst.Write(c.out.Bytes())
+		}
+		if err != nil {
+			s.mu.Lock()
+			s.err = err
+			s.mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,118 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package zstd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func TestStreamCompressor(t *testing.T) {
+	const chunkSize = 64 * 1024
+	for _, size := range []int{0, 1, chunkSize - 1, chunkSize, 10*chunkSize + 123} {
+		t.Run(fmt.Sprintf("Size=%d", size), func(t *testing.T) {
+			data := make([]byte, size)
+			rand.New(rand.NewSource(int64(size))).Read(data[:size/2])
+			copy(data[size/2:], bytes.Repeat([]byte("stream compressor "), size))
+
+			var compressed bytes.Buffer
+			sc := NewStreamCompressor(&compressed, chunkSize, 4)
+			// Uneven writes straddle the chunk boundaries
+			for p := data; len(p) > 0; {
+				n := min(len(p), 1000+rand.Intn(chunkSize))
+				if _, err := sc.Write(p[:n]); err != nil {
+					t.Fatal(err)
+				}
+				p = p[n:]
+			}
+			if err := sc.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := sc.Write([]byte("x")); err == nil {
+				t.Error("write after Close succeeded")
+			}
+
+			frames, err := CountZstdFrames(bytes.NewReader(compressed.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := max(1, (size+chunkSize-1)/chunkSize); frames != want {
+				t.Errorf("got %d frames; want %d", frames, want)
+			}
+			zr, err := GetCompressor().NewReader(&compressed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer zr.Close()
+			got, err := io.ReadAll(zr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("decompressed %d bytes don't match the %d bytes written", len(got), len(data))
+			}
+		})
+	}
+}
+
+type failingWriter struct{ err error }
+
+func (w failingWriter) Write(p []byte) (int, error) { return 0, w.err }
+
+func TestStreamCompressorWriteError(t *testing.T) {
+	wantErr := fmt.Errorf("destination failed")
+	sc := NewStreamCompressor(failingWriter{wantErr}, 1024, 2)
+	data := bytes.Repeat([]byte("a"), 1024)
+	var err error
+	for i := 0; i < 100 && err == nil; i++ {
+		_, err = sc.Write(data)
+	}
+	if closeErr := sc.Close(); closeErr != wantErr {
+		t.Errorf("Close returned %v; want %v", closeErr, wantErr)
+	}
+	if err != nil && err != wantErr {
+		t.Errorf("Write returned %v; want %v", err, wantErr)
+	}
+}
+
+// BenchmarkStreamCompressor compares the throughput of the chunks compressed by a
+// single worker and by 8 workers. The speedup depends on the CPUs available.
+func BenchmarkStreamCompressor(b *testing.B) {
+	data := make([]byte, 100*1024*1024)
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < len(data); i += 4096 {
+		// Half random, half repetitive, so that the chunks are compressible
+		rng.Read(data[i : i+2048])
+	}
+	for _, workers := range []int{1, 8} {
+		b.Run(fmt.Sprintf("Workers=%d", workers), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				sc := NewStreamCompressor(io.Discard, 0, workers)
+				if _, err := sc.Write(data); err != nil {
+					b.Fatal(err)
+				}
+				if err := sc.Close(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
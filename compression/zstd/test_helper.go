@@ -19,57 +19,58 @@ package zstd
 import (
 	"os"
 	"strconv"
+	"sync"
 	"testing"
 )
 
-// SetupSingleThreadedTest ensures tests run with single-threaded compression
-// for deterministic behavior. It returns a cleanup function that should be
-// called with defer.
-func SetupSingleThreadedTest(t *testing.T) func() {
+// SetupSingleThreadedTest sets ZSTD_WORKERS to 1 so that the compressors created
+// by the test run single-threaded and produce deterministic output. The previous
+// value is restored when the test and its subtests complete, through t.Cleanup,
+// so callers don't need to defer anything:
+//
+//	func TestFoo(t *testing.T) {
+//		zstd.SetupSingleThreadedTest(t)
+//		...
+//	}
+//
+// The returned function restores the previous value early; it can be called more
+// than once and makes the registered cleanup a no-op. It must not be used by
+// parallel tests, which would share the environment.
+func SetupSingleThreadedTest(t testing.TB) func() {
 	t.Helper()
-	
-	oldWorkers := os.Getenv("ZSTD_WORKERS")
-	os.Setenv("ZSTD_WORKERS", "1")
-	
-	return func() {
-		if oldWorkers == "" {
-			os.Unsetenv("ZSTD_WORKERS")
-		} else {
-			os.Setenv("ZSTD_WORKERS", oldWorkers)
-		}
-	}
+	return setWorkersEnv(t, "1")
 }
 
 // SetupMultiThreadedTest sets up a specific number of workers for testing.
-// It returns a cleanup function that should be called with defer.
+// The previous value is restored like with SetupSingleThreadedTest.
 func SetupMultiThreadedTest(t *testing.T, workers int) func() {
 	t.Helper()
-	
-	oldWorkers := os.Getenv("ZSTD_WORKERS")
-	os.Setenv("ZSTD_WORKERS", strconv.Itoa(workers))
-	
-	return func() {
-		if oldWorkers == "" {
-			os.Unsetenv("ZSTD_WORKERS")
-		} else {
-			os.Setenv("ZSTD_WORKERS", oldWorkers)
-		}
-	}
+	return setWorkersEnv(t, strconv.Itoa(workers))
 }
 
 // SetupSingleThreadedBenchmark ensures benchmarks run with single-threaded compression
-// for consistent results. It returns a cleanup function that should be called with defer.
+// for consistent results. The previous value is restored like with SetupSingleThreadedTest.
 func SetupSingleThreadedBenchmark(b *testing.B) func() {
 	b.Helper()
-	
-	oldWorkers := os.Getenv("ZSTD_WORKERS")
-	os.Setenv("ZSTD_WORKERS", "1")
-	
-	return func() {
-		if oldWorkers == "" {
-			os.Unsetenv("ZSTD_WORKERS")
-		} else {
-			os.Setenv("ZSTD_WORKERS", oldWorkers)
-		}
+	return setWorkersEnv(b, "1")
+}
+
+// setWorkersEnv sets ZSTD_WORKERS to workers and returns the function restoring its
+// previous value, which is also registered with tb.Cleanup
+func setWorkersEnv(tb testing.TB, workers string) func() {
+	oldWorkers, wasSet := os.LookupEnv("ZSTD_WORKERS")
+	os.Setenv("ZSTD_WORKERS", workers)
+
+	var once sync.Once
+	restore := func() {
+		once.Do(func() {
+			if wasSet {
+				os.Setenv("ZSTD_WORKERS", oldWorkers)
+			} else {
+				os.Unsetenv("ZSTD_WORKERS")
+			}
+		})
 	}
-}
\ No newline at end of file
+	tb.Cleanup(restore)
+	return restore
+}
@@ -0,0 +1,49 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package zstd
+
+import (
+	"os"
+	"testing"
+)
+
+func TestSetupSingleThreadedTest(t *testing.T) {
+	t.Setenv("ZSTD_WORKERS", "8")
+
+	t.Run("cleanup", func(t *testing.T) {
+		SetupSingleThreadedTest(t)
+		if w := os.Getenv("ZSTD_WORKERS"); w != "1" {
+			t.Errorf("ZSTD_WORKERS = %q; want 1", w)
+		}
+	})
+	if w := os.Getenv("ZSTD_WORKERS"); w != "8" {
+		t.Errorf("ZSTD_WORKERS = %q after the test; want 8", w)
+	}
+
+	t.Run("restore", func(t *testing.T) {
+		restore := SetupSingleThreadedTest(t)
+		restore()
+		if w := os.Getenv("ZSTD_WORKERS"); w != "8" {
+			t.Errorf("ZSTD_WORKERS = %q after restore; want 8", w)
+		}
+		// The registered cleanup mustn't undo changes made after restore
+		os.Setenv("ZSTD_WORKERS", "4")
+	})
+	if w := os.Getenv("ZSTD_WORKERS"); w != "4" {
+		t.Errorf("ZSTD_WORKERS = %q; want 4", w)
+	}
+}
@@ -0,0 +1,148 @@
+//go:build zstd_benchmark || zstd_all
+
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package testsuite
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/containerd/stargz-snapshotter/compression/zstd"
+)
+
+// benchmarkRunner is the part of testing.B that BenchmarkAll dispatches
+// through, so the sub-benchmarks can be recorded without running them
+type benchmarkRunner interface {
+	Run(name string, f func(b *testing.B)) bool
+}
+
+// BenchmarkAll runs the suite's compress and decompress benchmarks for all
+// implementations
+func BenchmarkAll(b *testing.B) {
+	NewTestSuite().BenchmarkAll(b, []int{1024, 100 * 1024, 1024 * 1024}, []int{1, 3, 9})
+}
+
+// BenchmarkAll runs compress and decompress benchmarks of every registered
+// implementation for each size and level combination. Sub-benchmarks are named
+// Implementation/SizeXXX/LevelY/Compress and .../Decompress. Levels above an
+// implementation's MaxCompressionLevel are skipped.
+func (s *TestSuite) BenchmarkAll(b *testing.B, sizes []int, levels []int) {
+	s.benchmarkAll(b, sizes, levels)
+}
+
+func (s *TestSuite) benchmarkAll(r benchmarkRunner, sizes []int, levels []int) {
+	for _, impl := range s.implementations {
+		if impl.Skip {
+			continue
+		}
+		for _, size := range sizes {
+			for _, level := range levels {
+				if level > impl.Compressor.MaxCompressionLevel() {
+					continue
+				}
+				impl, size, level := impl, size, level
+				prefix := fmt.Sprintf("%s/Size%s/%s", impl.Name, formatSize(size), formatLevel(level))
+
+				r.Run(prefix+"/Compress", func(b *testing.B) {
+					data := generateCompressibleData(size)
+					b.SetBytes(int64(size))
+					b.ResetTimer()
+
+					for i := 0; i < b.N; i++ {
+						w, err := impl.Compressor.NewWriter(io.Discard, level)
+						if err != nil {
+							b.Fatal(err)
+						}
+						if _, err := w.Write(data); err != nil {
+							b.Fatal(err)
+						}
+						if err := w.Close(); err != nil {
+							b.Fatal(err)
+						}
+					}
+				})
+
+				r.Run(prefix+"/Decompress", func(b *testing.B) {
+					var compressed bytes.Buffer
+					w, err := impl.Compressor.NewWriter(&compressed, level)
+					if err != nil {
+						b.Fatal(err)
+					}
+					if _, err := w.Write(generateCompressibleData(size)); err != nil {
+						b.Fatal(err)
+					}
+					if err := w.Close(); err != nil {
+						b.Fatal(err)
+					}
+					compressedData := compressed.Bytes()
+					b.SetBytes(int64(size))
+					b.ResetTimer()
+
+					for i := 0; i < b.N; i++ {
+						r, err := impl.Compressor.NewReader(bytes.NewReader(compressedData))
+						if err != nil {
+							b.Fatal(err)
+						}
+						if _, err := io.Copy(io.Discard, r); err != nil {
+							b.Fatal(err)
+						}
+						r.Close()
+					}
+				})
+			}
+		}
+	}
+}
+
+// recordingRunner records the names of the sub-benchmarks it's asked to run
+type recordingRunner struct {
+	names []string
+}
+
+func (r *recordingRunner) Run(name string, f func(b *testing.B)) bool {
+	r.names = append(r.names, name)
+	return true
+}
+
+// TestBenchmarkAllDispatch verifies that BenchmarkAll emits one compress and one
+// decompress sub-benchmark per size and level
+func TestBenchmarkAllDispatch(t *testing.T) {
+	s := &TestSuite{implementations: []Implementation{
+		{Name: "PureGo", Compressor: zstd.NewPureGoCompressor()},
+	}}
+
+	var r recordingRunner
+	s.benchmarkAll(&r, []int{1024, 100 * 1024}, []int{3, 22})
+
+	want := []string{
+		"PureGo/Size1KB/Level3/Compress",
+		"PureGo/Size1KB/Level3/Decompress",
+		"PureGo/Size100KB/Level3/Compress",
+		"PureGo/Size100KB/Level3/Decompress",
+	}
+	if len(r.names) != 2*2 {
+		t.Fatalf("got %d sub-benchmarks %v, want %d", len(r.names), r.names, 2*2)
+	}
+	for i, name := range want {
+		if r.names[i] != name {
+			t.Errorf("sub-benchmark %d is %q, want %q", i, r.names[i], name)
+		}
+	}
+}
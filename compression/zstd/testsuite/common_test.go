@@ -17,8 +17,8 @@
 package testsuite
 
 import (
-	"crypto/rand"
 	"fmt"
+	"math/rand"
 
 	"github.com/containerd/stargz-snapshotter/compression/zstd"
 )
@@ -71,7 +71,7 @@ var TestDataPatterns = []struct {
 		Name: "Random",
 		Generator: func(size int) []byte {
 			data := make([]byte, size)
-			rand.Read(data)
+			rand.New(rand.NewSource(int64(size))).Read(data)
 			return data
 		},
 		Sizes:       []int{0, 1, 100, 1024, 65536, 1048576},
@@ -126,4 +126,4 @@ func formatSize(size int) string {
 
 func formatLevel(level int) string {
 	return fmt.Sprintf("Level%d", level)
-}
\ No newline at end of file
+}
@@ -0,0 +1,267 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package testsuite
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+)
+
+const (
+	compatDir      = "testdata/compat"
+	compatManifest = "manifest.json"
+
+	// compatMaxSize bounds the sizes of TestDataPatterns with compat blobs. The blobs
+	// are never removed, so each library update adds a set of them to the repository.
+	compatMaxSize = 1024
+)
+
+// compatModules are the modules whose versions the compat blobs of each
+// implementation are recorded with
+var compatModules = map[string]string{
+	"PureGo": "github.com/klauspost/compress",
+	"Gozstd": "github.com/GrigoryEvko/gozstd",
+}
+
+// compatEntry is a set of blobs in testdata/compat compressed by an implementation
+// with a library version
+type compatEntry struct {
+	Dir            string                `json:"dir"`
+	Implementation string                `json:"implementation"`
+	Version        string                `json:"version"`
+	Reason         string                `json:"reason"`
+	Files          map[string]compatFile `json:"files"`
+}
+
+type compatFile struct {
+	Compressed digest.Digest `json:"compressed"`
+	Plaintext  digest.Digest `json:"plaintext"`
+}
+
+// TestCrossVersion runs the suite's compatibility checks with previous library
+// versions for all implementations
+func TestCrossVersion(t *testing.T) {
+	NewTestSuite().TestCrossVersion(t)
+}
+
+// TestCrossVersion verifies that the blobs under testdata/compat, compressed by
+// previous versions of the libraries, still decompress to their plaintext with
+// every implementation. It also fails if the current version of an implementation
+// compresses the TestDataPatterns differently from its latest set of blobs: after
+// a library update, add a set for the new version with UPDATE_COMPAT=1 and a
+// COMPAT_REASON explaining the change, which is recorded in the manifest. The
+// existing sets must be kept.
+func (s *TestSuite) TestCrossVersion(t *testing.T) {
+	SetupTest(t)
+	manifest, err := readCompatManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, entry := range manifest {
+		for name, file := range entry.Files {
+			blob, err := os.ReadFile(filepath.Join(compatDir, entry.Dir, name))
+			if err != nil {
+				t.Errorf("%s/%s: %v", entry.Dir, name, err)
+				continue
+			}
+			if got := digest.FromBytes(blob); got != file.Compressed {
+				t.Errorf("%s/%s has digest %s; want %s: compat blobs must not be modified", entry.Dir, name, got, file.Compressed)
+				continue
+			}
+			for _, impl := range s.implementations {
+				if impl.Skip {
+					continue
+				}
+				zr, err := impl.Compressor.NewReader(bytes.NewReader(blob))
+				if err != nil {
+					t.Errorf("%s/%s: %s failed to create reader: %v", entry.Dir, name, impl.Name, err)
+					continue
+				}
+				plaintext, err := io.ReadAll(zr)
+				zr.Close()
+				if err != nil {
+					t.Errorf("%s/%s: %s failed to decompress: %v", entry.Dir, name, impl.Name, err)
+				} else if got := digest.FromBytes(plaintext); got != file.Plaintext {
+					t.Errorf("%s/%s: %s decompressed %d bytes with digest %s; want %s", entry.Dir, name, impl.Name, len(plaintext), got, file.Plaintext)
+				}
+			}
+		}
+	}
+
+	update := os.Getenv("UPDATE_COMPAT") == "1"
+	reason := os.Getenv("COMPAT_REASON")
+	if update && reason == "" {
+		t.Fatal("UPDATE_COMPAT=1 requires COMPAT_REASON to explain the change of the compressed output")
+	}
+	var updated bool
+	for _, impl := range s.implementations {
+		if impl.Skip {
+			t.Logf("Skipping %s: %s", impl.Name, impl.SkipReason)
+			continue
+		}
+		current := compatEntry{
+			Implementation: impl.Name,
+			Version:        moduleVersion(compatModules[impl.Name]),
+			Files:          make(map[string]compatFile),
+		}
+		blobs := make(map[string][]byte)
+		for _, pattern := range TestDataPatterns {
+			for _, size := range pattern.Sizes {
+				if size > compatMaxSize {
+					continue
+				}
+				plaintext := pattern.Generator(size)
+				var compressed bytes.Buffer
+				writer, err := impl.Compressor.NewWriter(&compressed, goldenLevel)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := writer.Write(plaintext); err != nil {
+					t.Fatal(err)
+				}
+				if err := writer.Close(); err != nil {
+					t.Fatal(err)
+				}
+				name := fmt.Sprintf("%s-%s.zst", pattern.Name, formatSize(size))
+				blobs[name] = compressed.Bytes()
+				current.Files[name] = compatFile{
+					Compressed: digest.FromBytes(compressed.Bytes()),
+					Plaintext:  digest.FromBytes(plaintext),
+				}
+			}
+		}
+
+		latest := latestCompatEntry(manifest, impl.Name)
+		if latest != nil && latest.Version == current.Version && sameCompatFiles(latest.Files, current.Files) {
+			continue
+		}
+		if !update {
+			if latest == nil {
+				t.Errorf("%s has no compat blobs; add them with UPDATE_COMPAT=1 COMPAT_REASON=...", impl.Name)
+			} else {
+				t.Errorf("%s %s compresses differently from its latest compat blobs (%s, %s); "+
+					"add blobs for it with UPDATE_COMPAT=1 COMPAT_REASON=... explaining the change",
+					impl.Name, current.Version, latest.Dir, latest.Version)
+			}
+			continue
+		}
+
+		current.Reason = reason
+		current.Dir = compatEntryDir(manifest, impl.Name, current.Version)
+		for name, blob := range blobs {
+			path := filepath.Join(compatDir, current.Dir, name)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, blob, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		manifest = append(manifest, current)
+		updated = true
+	}
+	if updated {
+		if err := writeCompatManifest(manifest); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func readCompatManifest() ([]compatEntry, error) {
+	data, err := os.ReadFile(filepath.Join(compatDir, compatManifest))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var manifest []compatEntry
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", compatManifest, err)
+	}
+	return manifest, nil
+}
+
+func writeCompatManifest(manifest []compatEntry) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(compatDir, compatManifest), append(data, '\n'), 0644)
+}
+
+// latestCompatEntry returns the last set of blobs added for implementation
+func latestCompatEntry(manifest []compatEntry, implementation string) *compatEntry {
+	for i := len(manifest) - 1; i >= 0; i-- {
+		if manifest[i].Implementation == implementation {
+			return &manifest[i]
+		}
+	}
+	return nil
+}
+
+func sameCompatFiles(a, b map[string]compatFile) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, f := range a {
+		if b[name] != f {
+			return false
+		}
+	}
+	return true
+}
+
+// compatEntryDir returns a directory name for a new set of blobs that isn't used
+// by the manifest yet
+func compatEntryDir(manifest []compatEntry, implementation, version string) string {
+	base := fmt.Sprintf("%s-%s", implementation, version)
+	dir := base
+	for i := 2; ; i++ {
+		used := false
+		for _, e := range manifest {
+			used = used || e.Dir == dir
+		}
+		if !used {
+			return dir
+		}
+		dir = fmt.Sprintf("%s-%d", base, i)
+	}
+}
+
+// moduleVersion returns the version of the module at path linked into the test
+func moduleVersion(path string) string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range info.Deps {
+			if dep.Path == path {
+				if dep.Replace != nil {
+					dep = dep.Replace
+				}
+				return dep.Version
+			}
+		}
+	}
+	return "unknown"
+}
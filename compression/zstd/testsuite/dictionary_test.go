@@ -0,0 +1,194 @@
+//go:build zstd_unit || zstd_integration || zstd_all
+
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package testsuite
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/containerd/stargz-snapshotter/compression/zstd"
+)
+
+const dictionarySize = 8 * 1024
+
+// TestDictionary runs the suite's dictionary checks for all implementations
+func TestDictionary(t *testing.T) {
+	NewTestSuite().TestDictionary(t)
+}
+
+// TestDictionary verifies that data compressed with a trained dictionary
+// round-trips, that dictionaries work across implementations and that invalid
+// dictionaries and training inputs are rejected.
+func (s *TestSuite) TestDictionary(t *testing.T) {
+	samples := generateJSONSamples(200)
+
+	dictionaries := make(map[string][]byte)
+	for _, impl := range s.implementations {
+		if impl.Skip {
+			t.Logf("Skipping %s: %s", impl.Name, impl.SkipReason)
+			continue
+		}
+		dc, ok := impl.Compressor.(zstd.DictionaryCompressor)
+		if !ok {
+			t.Errorf("%s doesn't support dictionaries", impl.Name)
+			continue
+		}
+
+		t.Run(impl.Name, func(t *testing.T) {
+			dict, err := dc.TrainDictionary(samples, dictionarySize)
+			if err != nil {
+				t.Fatalf("failed to train dictionary: %v", err)
+			}
+			if len(dict) > dictionarySize {
+				t.Errorf("dictionary size %d exceeds %d", len(dict), dictionarySize)
+			}
+			dictionaries[impl.Name] = dict
+
+			var withDict, withoutDict int
+			for i, sample := range samples {
+				compressed := compressWithDict(t, dc, dict, sample)
+				if got := decompressWithDict(t, dc, dict, compressed); !bytes.Equal(got, sample) {
+					t.Fatalf("sample %d: decompressed data doesn't match", i)
+				}
+				withDict += len(compressed)
+				withoutDict += len(compressPlain(t, dc, sample))
+			}
+			t.Logf("compressed %d samples into %d bytes with dictionary, %d bytes without",
+				len(samples), withDict, withoutDict)
+			if withDict >= withoutDict {
+				t.Errorf("dictionary didn't improve compression: %d >= %d", withDict, withoutDict)
+			}
+		})
+
+		t.Run(impl.Name+"/Invalid", func(t *testing.T) {
+			oversized := bytes.Repeat([]byte{'x'}, zstd.MaxDictionarySize+1)
+			for name, dict := range map[string][]byte{"Empty": nil, "Oversized": oversized} {
+				if _, err := dc.NewWriterDict(io.Discard, 3, dict); err == nil {
+					t.Errorf("%s: NewWriterDict should fail", name)
+				}
+				if _, err := dc.NewReaderDict(bytes.NewReader(nil), dict); err == nil {
+					t.Errorf("%s: NewReaderDict should fail", name)
+				}
+			}
+			if _, err := dc.TrainDictionary(samples, zstd.MaxDictionarySize+1); err == nil {
+				t.Errorf("training a dictionary larger than %d bytes should fail", zstd.MaxDictionarySize)
+			}
+			if _, err := dc.TrainDictionary(samples[:2], dictionarySize); err == nil {
+				t.Errorf("training with too few samples should fail")
+			}
+			if _, err := dc.TrainDictionary(make([][]byte, 100), dictionarySize); err == nil {
+				t.Errorf("training with empty samples should fail")
+			}
+		})
+	}
+
+	// A dictionary trained by PureGoCompressor works with GozstdCompressor
+	pureDict, ok := dictionaries["PureGo"]
+	if !ok {
+		return
+	}
+	var pure, native zstd.DictionaryCompressor
+	for _, impl := range s.implementations {
+		if impl.Skip {
+			continue
+		}
+		switch impl.Name {
+		case "PureGo":
+			pure = impl.Compressor.(zstd.DictionaryCompressor)
+		case "Gozstd":
+			native = impl.Compressor.(zstd.DictionaryCompressor)
+		}
+	}
+	if native == nil {
+		t.Log("Skipping cross-implementation dictionary test: libzstd not available")
+		return
+	}
+	t.Run("CrossImplementation", func(t *testing.T) {
+		for i, sample := range samples[:20] {
+			if got := decompressWithDict(t, native, pureDict, compressWithDict(t, native, pureDict, sample)); !bytes.Equal(got, sample) {
+				t.Fatalf("sample %d: Gozstd round-trip with PureGo dictionary failed", i)
+			}
+			if got := decompressWithDict(t, native, pureDict, compressWithDict(t, pure, pureDict, sample)); !bytes.Equal(got, sample) {
+				t.Fatalf("sample %d: PureGo output isn't readable by Gozstd with the same dictionary", i)
+			}
+			if got := decompressWithDict(t, pure, pureDict, compressWithDict(t, native, pureDict, sample)); !bytes.Equal(got, sample) {
+				t.Fatalf("sample %d: Gozstd output isn't readable by PureGo with the same dictionary", i)
+			}
+		}
+	})
+}
+
+func compressWithDict(t *testing.T, c zstd.DictionaryCompressor, dict, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := c.NewWriterDict(&buf, 3, dict)
+	if err != nil {
+		t.Fatalf("failed to create writer: %v", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func decompressWithDict(t *testing.T, c zstd.DictionaryCompressor, dict, data []byte) []byte {
+	t.Helper()
+	r, err := c.NewReaderDict(bytes.NewReader(data), dict)
+	if err != nil {
+		t.Fatalf("failed to create reader: %v", err)
+	}
+	defer r.Close()
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("failed to decompress: %v", err)
+	}
+	return got
+}
+
+func compressPlain(t *testing.T, c zstd.Compressor, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := c.NewWriter(&buf, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// generateJSONSamples returns small JSON documents sharing the same structure
+func generateJSONSamples(n int) [][]byte {
+	samples := make([][]byte, n)
+	for i := range samples {
+		samples[i] = []byte(fmt.Sprintf(
+			`{"id":%d,"name":"user-%d","email":"user-%d@example.com","active":%t,"roles":["reader","writer"],"profile":{"created_at":"2024-01-%02dT10:00:00Z","locale":"en-US","score":%d}}`,
+			i, i, i, i%2 == 0, i%28+1, i*37%1000))
+	}
+	return samples
+}
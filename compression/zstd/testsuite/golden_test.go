@@ -0,0 +1,99 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package testsuite
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const (
+	goldenDir   = "testdata/golden"
+	goldenLevel = 3
+
+	// goldenMaxSize bounds the sizes of TestDataPatterns with golden files so that
+	// the incompressible patterns don't bloat the repository
+	goldenMaxSize = 65536
+)
+
+// TestGoldenOutput runs the suite's golden file checks for all implementations
+func TestGoldenOutput(t *testing.T) {
+	NewTestSuite().TestGoldenOutput(t)
+}
+
+// TestGoldenOutput verifies that each implementation compresses the TestDataPatterns
+// at level 3 with a single worker into exactly the bytes of the files under
+// testdata/golden. A change of the compressed output must be made deliberately by
+// regenerating the files with UPDATE_GOLDEN=1.
+func (s *TestSuite) TestGoldenOutput(t *testing.T) {
+	SetupTest(t)
+	update := os.Getenv("UPDATE_GOLDEN") == "1"
+
+	for _, impl := range s.implementations {
+		if impl.Skip {
+			t.Logf("Skipping %s: %s", impl.Name, impl.SkipReason)
+			continue
+		}
+
+		t.Run(impl.Name, func(t *testing.T) {
+			for _, pattern := range TestDataPatterns {
+				for _, size := range pattern.Sizes {
+					if size > goldenMaxSize {
+						continue
+					}
+					name := fmt.Sprintf("%s-%s.zst", pattern.Name, formatSize(size))
+					t.Run(name, func(t *testing.T) {
+						var compressed bytes.Buffer
+						writer, err := impl.Compressor.NewWriter(&compressed, goldenLevel)
+						if err != nil {
+							t.Fatal(err)
+						}
+						if _, err := writer.Write(pattern.Generator(size)); err != nil {
+							t.Fatal(err)
+						}
+						if err := writer.Close(); err != nil {
+							t.Fatal(err)
+						}
+
+						path := filepath.Join(goldenDir, impl.Name, name)
+						if update {
+							if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+								t.Fatal(err)
+							}
+							if err := os.WriteFile(path, compressed.Bytes(), 0644); err != nil {
+								t.Fatal(err)
+							}
+							return
+						}
+						golden, err := os.ReadFile(path)
+						if err != nil {
+							t.Fatalf("failed to read golden file (regenerate with UPDATE_GOLDEN=1): %v", err)
+						}
+						if !bytes.Equal(compressed.Bytes(), golden) {
+							t.Errorf("compressed output (%d bytes) differs from %s (%d bytes); "+
+								"regenerate it with UPDATE_GOLDEN=1 if the change is intended",
+								compressed.Len(), path, len(golden))
+						}
+					})
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package testsuite
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/containerd/stargz-snapshotter/compression/zstd"
+)
+
+const (
+	// readerAtChunkSize is the size of the data compressed into each frame of the
+	// streams read by TestReaderAt, like the chunks of a zstd:chunked blob
+	readerAtChunkSize = 16 * 1024
+
+	// readerAtReads is the number of random reads per implementation and data pattern
+	readerAtReads = 50
+)
+
+// TestReaderAt runs the suite's random access checks for all implementations
+func TestReaderAt(t *testing.T) {
+	NewTestSuite().TestReaderAt(t)
+}
+
+// TestReaderAt verifies that the frames of a stream compressed in chunks can be
+// decompressed on their own through an io.ReaderAt, as zstd:chunked blobs are read
+// lazily. Reads at random offsets must return the same bytes as the sequential
+// decompression of the whole stream from the same offset.
+func (s *TestSuite) TestReaderAt(t *testing.T) {
+	SetupTest(t)
+
+	for _, impl := range s.implementations {
+		if impl.Skip {
+			t.Logf("Skipping %s: %s", impl.Name, impl.SkipReason)
+			continue
+		}
+
+		t.Run(impl.Name, func(t *testing.T) {
+			for _, pattern := range TestDataPatterns {
+				for _, size := range pattern.Sizes {
+					if size == 0 {
+						continue
+					}
+					t.Run(fmt.Sprintf("%s-%s", pattern.Name, formatSize(size)), func(t *testing.T) {
+						data := pattern.Generator(size)
+						compressed, ra := compressChunks(t, impl.Compressor, data)
+
+						zr, err := impl.Compressor.NewReader(bytes.NewReader(compressed))
+						if err != nil {
+							t.Fatal(err)
+						}
+						sequential, err := io.ReadAll(zr)
+						zr.Close()
+						if err != nil {
+							t.Fatal(err)
+						}
+						if !bytes.Equal(sequential, data) {
+							t.Fatalf("sequential decompression returned %d bytes that don't match the input", len(sequential))
+						}
+
+						rng := rand.New(rand.NewSource(int64(size)))
+						for i := 0; i < readerAtReads; i++ {
+							off := rng.Int63n(int64(size))
+							length := rng.Intn(2*readerAtChunkSize + 1)
+							want := sequential[off:]
+							if len(want) > length {
+								want = want[:length]
+							}
+
+							got := make([]byte, length)
+							n, err := ra.ReadAt(got, off)
+							if n < length && err != io.EOF {
+								t.Fatalf("ReadAt(%d bytes, off=%d) = %d, %v; want io.EOF for a short read", length, off, n, err)
+							} else if n == length && err != nil && err != io.EOF {
+								t.Fatalf("ReadAt(%d bytes, off=%d): %v", length, off, err)
+							}
+							if !bytes.Equal(got[:n], want) {
+								t.Fatalf("ReadAt(%d bytes, off=%d) returned %d bytes that don't match the sequential decompression (%d bytes)",
+									length, off, n, len(want))
+							}
+						}
+					})
+				}
+			}
+		})
+	}
+}
+
+// compressChunks compresses each readerAtChunkSize bytes of data into its own frame
+// and returns the stream with an io.ReaderAt of the decompressed data that reads it.
+func compressChunks(t *testing.T, c zstd.Compressor, data []byte) ([]byte, io.ReaderAt) {
+	t.Helper()
+
+	var compressed bytes.Buffer
+	w, err := c.NewWriter(&compressed, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ra := &frameReaderAt{compressor: c}
+	for off := 0; off < len(data); off += readerAtChunkSize {
+		if off > 0 {
+			if err := w.Reset(&compressed); err != nil {
+				t.Fatal(err)
+			}
+		}
+		start := int64(compressed.Len())
+		end := off + readerAtChunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		if _, err := w.Write(data[off:end]); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		ra.frames = append(ra.frames, chunkFrame{
+			offset:         int64(off),
+			size:           int64(end - off),
+			compressedOff:  start,
+			compressedSize: int64(compressed.Len()) - start,
+		})
+	}
+	ra.r = bytes.NewReader(compressed.Bytes())
+	return compressed.Bytes(), ra
+}
+
+// chunkFrame locates a frame of a stream compressed by compressChunks
+type chunkFrame struct {
+	offset, size                  int64
+	compressedOff, compressedSize int64
+}
+
+// frameReaderAt reads the decompressed data of a stream from r, decompressing only
+// the frames covering each read
+type frameReaderAt struct {
+	compressor zstd.Compressor
+	r          io.ReaderAt
+	frames     []chunkFrame
+}
+
+func (f *frameReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	i := sort.Search(len(f.frames), func(i int) bool {
+		return f.frames[i].offset+f.frames[i].size > off
+	})
+	var n int
+	for ; n < len(p) && i < len(f.frames); i++ {
+		frame := f.frames[i]
+		zr, err := f.compressor.NewReader(io.NewSectionReader(f.r, frame.compressedOff, frame.compressedSize))
+		if err != nil {
+			return n, err
+		}
+		skip := off + int64(n) - frame.offset
+		if _, err := io.CopyN(io.Discard, zr, skip); err != nil {
+			zr.Close()
+			return n, err
+		}
+		want := frame.size - skip
+		if rest := int64(len(p) - n); rest < want {
+			want = rest
+		}
+		m, err := io.ReadFull(zr, p[n:n+int(want)])
+		zr.Close()
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
@@ -505,4 +505,94 @@ func min(a, b int) int {
 		return a
 	}
 	return b
-}
\ No newline at end of file
+}
+
+// TestConcurrentReuse runs the suite's reuse check for all implementations
+func TestConcurrentReuse(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping stress test in short mode")
+	}
+	NewTestSuite().TestConcurrentReuse(t)
+}
+
+// TestConcurrentReuse verifies that writers and readers obtained concurrently from
+// a shared compressor, and reused across round-trips via Reset, never leak data
+// between goroutines. Run it with -race to also catch unsynchronized state.
+func (s *TestSuite) TestConcurrentReuse(t *testing.T) {
+	const (
+		goroutines = 50
+		roundTrips = 200
+		dataSize   = 4 * 1024
+	)
+
+	for _, impl := range s.implementations {
+		if impl.Skip {
+			t.Logf("Skipping %s: %s", impl.Name, impl.SkipReason)
+			continue
+		}
+
+		t.Run(impl.Name, func(t *testing.T) {
+			var wg sync.WaitGroup
+			errCh := make(chan error, goroutines)
+
+			for i := 0; i < goroutines; i++ {
+				wg.Add(1)
+				go func(workerID int) {
+					defer wg.Done()
+
+					rng := rand.New(rand.NewSource(int64(workerID)))
+					var compressed bytes.Buffer
+					w, err := impl.Compressor.NewWriter(&compressed, 3)
+					if err != nil {
+						errCh <- fmt.Errorf("worker %d: compression init failed: %v", workerID, err)
+						return
+					}
+
+					for j := 0; j < roundTrips; j++ {
+						// Tag every input with its owner so that any cross-talk
+						// between goroutines shows up as a mismatch.
+						data := make([]byte, dataSize)
+						rng.Read(data)
+						copy(data, fmt.Sprintf("worker=%d round=%d;", workerID, j))
+
+						compressed.Reset()
+						if err := w.Reset(&compressed); err != nil {
+							errCh <- fmt.Errorf("worker %d round %d: reset failed: %v", workerID, j, err)
+							return
+						}
+						if _, err := w.Write(data); err != nil {
+							errCh <- fmt.Errorf("worker %d round %d: write failed: %v", workerID, j, err)
+							return
+						}
+						if err := w.Close(); err != nil {
+							errCh <- fmt.Errorf("worker %d round %d: close failed: %v", workerID, j, err)
+							return
+						}
+
+						r, err := impl.Compressor.NewReader(bytes.NewReader(compressed.Bytes()))
+						if err != nil {
+							errCh <- fmt.Errorf("worker %d round %d: decompression init failed: %v", workerID, j, err)
+							return
+						}
+						decompressed, err := io.ReadAll(r)
+						r.Close()
+						if err != nil {
+							errCh <- fmt.Errorf("worker %d round %d: read failed: %v", workerID, j, err)
+							return
+						}
+						if !bytes.Equal(data, decompressed) {
+							errCh <- fmt.Errorf("worker %d round %d: output doesn't match its own input", workerID, j)
+							return
+						}
+					}
+				}(i)
+			}
+
+			wg.Wait()
+			close(errCh)
+			for err := range errCh {
+				t.Error(err)
+			}
+		})
+	}
+}
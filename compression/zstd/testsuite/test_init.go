@@ -38,7 +38,9 @@ func TestMain(m *testing.M) {
 }
 
 // SetupTest is a helper that can be used in individual tests that need
-// specific worker configuration.
-func SetupTest(t *testing.T) func() {
+// specific worker configuration. Like zstd.SetupSingleThreadedTest, it restores
+// the previous configuration when the test completes.
+func SetupTest(t testing.TB) func() {
+	t.Helper()
 	return zstd.SetupSingleThreadedTest(t)
 }
\ No newline at end of file
@@ -20,10 +20,14 @@ package testsuite
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
 	"io"
 	"strings"
 	"testing"
 
+	"github.com/cespare/xxhash/v2"
+	"github.com/containerd/stargz-snapshotter/compression/zstd"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -183,6 +187,106 @@ func TestEdgeCases(t *testing.T) {
 	}
 }
 
+// TestEdgeCasesExpanded runs the suite's boundary checks for all implementations
+func TestEdgeCasesExpanded(t *testing.T) {
+	NewTestSuite().TestEdgeCasesExpanded(t)
+}
+
+// zstdBlockSize is the maximum size of a zstd block
+const zstdBlockSize = 128 * 1024
+
+// TestEdgeCasesExpanded covers the boundary conditions TestEdgeCases doesn't:
+// a single byte, data of exactly one block, writing to and closing a closed
+// writer and nil destinations and sources.
+func (s *TestSuite) TestEdgeCasesExpanded(t *testing.T) {
+	for _, impl := range s.implementations {
+		if impl.Skip {
+			t.Logf("Skipping %s: %s", impl.Name, impl.SkipReason)
+			continue
+		}
+
+		t.Run(impl.Name, func(t *testing.T) {
+			roundTrip := func(t *testing.T, data []byte) {
+				var compressed bytes.Buffer
+				writer, err := impl.Compressor.NewWriter(&compressed, 3)
+				require.NoError(t, err)
+				n, err := writer.Write(data)
+				require.NoError(t, err)
+				assert.Equal(t, len(data), n)
+				require.NoError(t, writer.Close())
+
+				reader, err := impl.Compressor.NewReader(&compressed)
+				require.NoError(t, err)
+				defer reader.Close()
+				decompressed, err := io.ReadAll(reader)
+				require.NoError(t, err)
+				assert.Equal(t, data, decompressed)
+			}
+
+			t.Run("OneByte", func(t *testing.T) {
+				roundTrip(t, []byte{0x42})
+			})
+
+			t.Run("BlockBoundary", func(t *testing.T) {
+				for _, pattern := range TestDataPatterns {
+					for _, size := range []int{zstdBlockSize - 1, zstdBlockSize, zstdBlockSize + 1} {
+						t.Run(pattern.Name+"/"+formatSize(size), func(t *testing.T) {
+							roundTrip(t, pattern.Generator(size))
+						})
+					}
+				}
+			})
+
+			t.Run("WriteAfterClose", func(t *testing.T) {
+				writer, err := impl.Compressor.NewWriter(io.Discard, 3)
+				require.NoError(t, err)
+				_, err = writer.Write([]byte("before close"))
+				require.NoError(t, err)
+				require.NoError(t, writer.Close())
+
+				_, err = writer.Write([]byte("after close"))
+				assert.Error(t, err, "Write after Close should fail")
+			})
+
+			t.Run("CloseAfterClose", func(t *testing.T) {
+				var compressed bytes.Buffer
+				writer, err := impl.Compressor.NewWriter(&compressed, 3)
+				require.NoError(t, err)
+				_, err = writer.Write([]byte("closed twice"))
+				require.NoError(t, err)
+				require.NoError(t, writer.Close())
+				size := compressed.Len()
+				assert.NotPanics(t, func() { writer.Close() })
+				assert.Equal(t, size, compressed.Len(), "second Close shouldn't write more data")
+
+				reader, err := impl.Compressor.NewReader(&compressed)
+				require.NoError(t, err)
+				_, err = io.ReadAll(reader)
+				require.NoError(t, err)
+				require.NoError(t, reader.Close())
+				assert.NotPanics(t, func() { reader.Close() })
+			})
+
+			t.Run("NilWriterReader", func(t *testing.T) {
+				var writer zstd.WriteFlushCloser
+				var err error
+				assert.NotPanics(t, func() { writer, err = impl.Compressor.NewWriter(nil, 3) })
+				assert.Error(t, err, "NewWriter(nil) should fail")
+				if writer != nil {
+					writer.Close()
+				}
+
+				var reader io.ReadCloser
+				assert.NotPanics(t, func() { reader, err = impl.Compressor.NewReader(nil) })
+				assert.Error(t, err, "NewReader(nil) should fail")
+				if reader != nil {
+					reader.Close()
+				}
+			})
+		})
+	}
+}
+
 // TestFlushBehavior tests the Flush() method behavior
 func TestFlushBehavior(t *testing.T) {
 	suite := NewTestSuite()
@@ -228,3 +332,65 @@ func TestFlushBehavior(t *testing.T) {
 	}
 }
 
+
+// TestWriterChecksum verifies the writers checksum the plaintext written through
+// both Write and ReadFrom
+func TestWriterChecksum(t *testing.T) {
+	suite := NewTestSuite()
+
+	for _, impl := range suite.implementations {
+		if impl.Skip {
+			continue
+		}
+
+		t.Run(impl.Name, func(t *testing.T) {
+			for _, pattern := range TestDataPatterns {
+				for _, size := range pattern.Sizes {
+					t.Run(pattern.Name+"/"+formatSize(size), func(t *testing.T) {
+						testData := pattern.Generator(size)
+						want := xxhash.Sum64(testData)
+
+						writer, err := impl.Compressor.NewWriter(io.Discard, 3)
+						require.NoError(t, err)
+						_, err = writer.Write(testData)
+						require.NoError(t, err)
+						require.NoError(t, writer.Close())
+						assert.Equal(t, want, binary.BigEndian.Uint64(writer.Checksum()), "Write")
+
+						require.NoError(t, writer.Reset(io.Discard))
+						// Hide bytes.Reader's WriteTo so that io.Copy uses ReadFrom
+						_, err = io.Copy(writer, struct{ io.Reader }{bytes.NewReader(testData)})
+						require.NoError(t, err)
+						require.NoError(t, writer.Close())
+						assert.Equal(t, want, binary.BigEndian.Uint64(writer.Checksum()), "ReadFrom")
+					})
+				}
+			}
+		})
+	}
+}
+
+// TestWriterChecksumSHA256 verifies the algorithm selected by SetChecksumAlgorithm
+func TestWriterChecksumSHA256(t *testing.T) {
+	require.NoError(t, zstd.SetChecksumAlgorithm(zstd.ChecksumSHA256))
+	defer zstd.SetChecksumAlgorithm(zstd.ChecksumXXHash64)
+
+	suite := NewTestSuite()
+	testData := []byte(strings.Repeat("checksum test data ", 1000))
+	want := sha256.Sum256(testData)
+
+	for _, impl := range suite.implementations {
+		if impl.Skip {
+			continue
+		}
+
+		t.Run(impl.Name, func(t *testing.T) {
+			writer, err := impl.Compressor.NewWriter(io.Discard, 3)
+			require.NoError(t, err)
+			_, err = writer.Write(testData)
+			require.NoError(t, err)
+			require.NoError(t, writer.Close())
+			assert.Equal(t, want[:], writer.Checksum())
+		})
+	}
+}
@@ -0,0 +1,193 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package zstd
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// StreamStats describes the frames of a zstd stream verified by VerifyZstdStreamWithStats.
+type StreamStats struct {
+	// FrameCount is the number of frames, including skippable frames.
+	FrameCount int
+
+	// TotalCompressedBytes is the size of the stream.
+	TotalCompressedBytes int64
+
+	// TotalDecompressedBytes is the size of the decompressed contents of the frames.
+	TotalDecompressedBytes int64
+
+	// CompressionRatio is TotalCompressedBytes / TotalDecompressedBytes: 0 for an
+	// empty stream and +Inf for a stream without decompressed contents, e.g. only
+	// skippable frames.
+	CompressionRatio float64
+
+	// HasChecksum is true if the stream has zstd frames and all of them have a checksum.
+	HasChecksum bool
+
+	// FrameStats describes the frames in the order of the stream.
+	FrameStats []FrameStat
+}
+
+// FrameStat describes a frame of a zstd stream.
+type FrameStat struct {
+	// CompressedSize is the size of the frame, including its header.
+	CompressedSize int64
+
+	// DecompressedSize is the size of the decompressed contents. Zero for skippable frames.
+	DecompressedSize int64
+
+	// Checksum is the checksum at the end of the frame: the lower 32 bits of the
+	// XXH64 of the contents. Zero if the frame has no checksum.
+	Checksum [4]byte
+
+	// HasChecksum is true if the frame has a checksum.
+	HasChecksum bool
+
+	// Skippable is true for skippable frames, whose contents aren't zstd data.
+	Skippable bool
+}
+
+// VerifyZstdStream checks the integrity of the zstd stream read from r by
+// decompressing all its frames and verifying their checksums if they have any.
+func VerifyZstdStream(r io.Reader) error {
+	_, err := VerifyZstdStreamWithStats(r)
+	return err
+}
+
+// VerifyZstdStreamWithStats is the same as VerifyZstdStream but also returns the
+// structure of the stream. Each frame is decompressed separately while it's read
+// so the stream isn't buffered in memory.
+func VerifyZstdStreamWithStats(r io.Reader) (StreamStats, error) {
+	dec, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return StreamStats{}, err
+	}
+	defer dec.Close()
+
+	stats := StreamStats{HasChecksum: true}
+	cr := &countReader{r: r}
+	var magic [4]byte
+	var zstdFrames int
+	for {
+		start := cr.n
+		if _, err := io.ReadFull(cr, magic[:]); err == io.EOF {
+			break
+		} else if err != nil {
+			return stats, unexpectedEOF(err)
+		}
+		var fs FrameStat
+		switch m := binary.LittleEndian.Uint32(magic[:]); {
+		case m == frameMagic:
+			n, checksum, err := verifyFrame(dec, magic[:], cr)
+			if err != nil {
+				return stats, fmt.Errorf("frame %d: %w", stats.FrameCount, err)
+			}
+			fs.DecompressedSize = n
+			zstdFrames++
+			if checksum != nil {
+				fs.HasChecksum = true
+				copy(fs.Checksum[:], checksum)
+			} else {
+				stats.HasChecksum = false
+			}
+		case m&skippableFrameMagicMask == skippableFrameMagic:
+			var size [4]byte
+			if _, err := io.ReadFull(cr, size[:]); err != nil {
+				return stats, unexpectedEOF(err)
+			}
+			if err := skip(cr, int64(binary.LittleEndian.Uint32(size[:]))); err != nil {
+				return stats, err
+			}
+			fs.Skippable = true
+		default:
+			return stats, fmt.Errorf("%w: unknown magic number %#08x at frame %d", ErrInvalidFrame, m, stats.FrameCount)
+		}
+		fs.CompressedSize = cr.n - start
+		stats.FrameStats = append(stats.FrameStats, fs)
+		stats.FrameCount++
+		stats.TotalCompressedBytes += fs.CompressedSize
+		stats.TotalDecompressedBytes += fs.DecompressedSize
+	}
+	if zstdFrames == 0 {
+		stats.HasChecksum = false
+	}
+	stats.CompressionRatio = compressionRatio(stats.TotalCompressedBytes, stats.TotalDecompressedBytes)
+	return stats, nil
+}
+
+func compressionRatio(compressed, decompressed int64) float64 {
+	switch {
+	case decompressed > 0:
+		return float64(compressed) / float64(decompressed)
+	case compressed > 0:
+		return math.Inf(1)
+	default:
+		return 0
+	}
+}
+
+// verifyFrame reads the zstd frame following magic from r and decompresses it with
+// dec as it's read. It returns the decompressed size and the checksum of the frame.
+func verifyFrame(dec *zstd.Decoder, magic []byte, r io.Reader) (int64, []byte, error) {
+	pr, pw := io.Pipe()
+	type result struct {
+		n   int64
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		var res result
+		if res.err = dec.Reset(pr); res.err == nil {
+			res.n, res.err = io.Copy(io.Discard, dec)
+		}
+		// Unblocks the frame parser if the decoder fails before the end of the frame
+		pr.CloseWithError(res.err)
+		done <- res
+	}()
+	_, err := pw.Write(magic)
+	var checksum []byte
+	if err == nil {
+		_, checksum, err = skipFrame(io.TeeReader(r, pw))
+	}
+	pw.CloseWithError(err)
+	res := <-done
+	if res.err != nil {
+		return 0, nil, res.err
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	return res.n, checksum, nil
+}
+
+// countReader counts the bytes read from r
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -1,3 +1,6 @@
+//go:build cgo && !no_cgo
+// +build cgo,!no_cgo
+
 /*
    Copyright The containerd Authors.
 
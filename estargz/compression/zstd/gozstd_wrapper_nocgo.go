@@ -0,0 +1,59 @@
+//go:build !cgo || no_cgo
+// +build !cgo no_cgo
+
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package zstd
+
+import (
+	"fmt"
+	"io"
+)
+
+// GozstdCompressor is a stub of the libzstd-based compressor for builds without
+// CGO (CGO_ENABLED=0 or the no_cgo build tag). libzstd is never available.
+type GozstdCompressor struct{}
+
+// NewGozstdCompressor creates a new gozstd-based compressor
+func NewGozstdCompressor() *GozstdCompressor {
+	return &GozstdCompressor{}
+}
+
+// NewWriter always fails because libzstd is not available
+func (g *GozstdCompressor) NewWriter(w io.Writer, level int) (io.WriteCloser, error) {
+	return nil, fmt.Errorf("libzstd not available: built without cgo")
+}
+
+// NewReader always fails because libzstd is not available
+func (g *GozstdCompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return nil, fmt.Errorf("libzstd not available: built without cgo")
+}
+
+// Name returns the name of the compressor implementation
+func (g *GozstdCompressor) Name() string {
+	return "gozstd (unavailable)"
+}
+
+// IsLibzstdAvailable always returns false
+func (g *GozstdCompressor) IsLibzstdAvailable() bool {
+	return false
+}
+
+// MaxCompressionLevel returns 0 because libzstd is not available
+func (g *GozstdCompressor) MaxCompressionLevel() int {
+	return 0
+}
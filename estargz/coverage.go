@@ -0,0 +1,85 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package estargz
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Overlap is a pair of TOC entries whose compressed streams overlap.
+type Overlap struct {
+	First, Second *TOCEntry
+}
+
+// OverlapError is returned by TOCCoverage if the compressed streams of entries
+// overlap, which a writer never produces.
+type OverlapError struct {
+	Overlaps []Overlap
+}
+
+func (e *OverlapError) Error() string {
+	s := make([]string, len(e.Overlaps))
+	for i, o := range e.Overlaps {
+		s[i] = fmt.Sprintf("%q [%d, %d) and %q [%d, %d)",
+			o.First.Name, o.First.Offset, o.First.Offset+o.First.CompressedSize,
+			o.Second.Name, o.Second.Offset, o.Second.Offset+o.Second.CompressedSize)
+	}
+	return fmt.Sprintf("%d overlapping compressed ranges in TOC: %s", len(e.Overlaps), strings.Join(s, ", "))
+}
+
+// TOCCoverage returns the number of bytes of a layer of layerSize bytes covered by
+// the compressed streams of the entries of toc, i.e. the sum of their CompressedSize,
+// and its ratio to layerSize. Entries without a CompressedSize (directories,
+// symlinks, payloads sharing a stream, TOCs of older writers) don't contribute.
+//
+// Even a layer fully indexed by its TOC isn't covered entirely: the tar headers
+// preceding the first payload, the TOC and the footer don't belong to any entry.
+//
+// If streams overlap, the sums are returned with an *OverlapError listing them.
+func TOCCoverage(toc *JTOC, layerSize int64) (covered, total int64, ratio float64, err error) {
+	var streams []*TOCEntry
+	for _, e := range toc.Entries {
+		if e.CompressedSize > 0 {
+			streams = append(streams, e)
+			covered += e.CompressedSize
+		}
+	}
+	total = layerSize
+	if total > 0 {
+		ratio = float64(covered) / float64(total)
+	}
+
+	sort.SliceStable(streams, func(i, j int) bool { return streams[i].Offset < streams[j].Offset })
+	var overlaps []Overlap
+	var last *TOCEntry // the stream ending the furthest so far
+	for _, e := range streams {
+		if last != nil && e.Offset < last.Offset+last.CompressedSize {
+			overlaps = append(overlaps, Overlap{First: last, Second: e})
+		}
+		if last == nil || e.Offset+e.CompressedSize > last.Offset+last.CompressedSize {
+			last = e
+		}
+	}
+	if len(overlaps) > 0 {
+		err = &OverlapError{Overlaps: overlaps}
+	} else if last != nil && last.Offset+last.CompressedSize > layerSize {
+		err = fmt.Errorf("compressed range of %q ends at %d, beyond the layer size %d", last.Name, last.Offset+last.CompressedSize, layerSize)
+	}
+	return covered, total, ratio, err
+}
@@ -0,0 +1,46 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package estargz
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTOCCoverageOverlap(t *testing.T) {
+	overlapping := &JTOC{Entries: []*TOCEntry{
+		{Name: "a", Type: "reg", Offset: 10, CompressedSize: 20},
+		{Name: "b", Type: "reg", Offset: 30, CompressedSize: 10},
+		{Name: "c", Type: "reg", Offset: 35, CompressedSize: 10},
+		{Name: "d", Type: "reg", Offset: 40, CompressedSize: 1},
+	}}
+	covered, _, _, err := TOCCoverage(overlapping, 100)
+	if covered != 41 {
+		t.Errorf("covered = %d; want 41", covered)
+	}
+	var oerr *OverlapError
+	if !errors.As(err, &oerr) {
+		t.Fatalf("got %v; want OverlapError", err)
+	}
+	if len(oerr.Overlaps) != 2 || oerr.Overlaps[0].First.Name != "b" || oerr.Overlaps[0].Second.Name != "c" ||
+		oerr.Overlaps[1].First.Name != "c" || oerr.Overlaps[1].Second.Name != "d" {
+		t.Errorf("overlaps = %v", err)
+	}
+	if _, _, _, err := TOCCoverage(overlapping, 40); err == nil {
+		t.Error("range beyond the layer size isn't reported")
+	}
+}
@@ -27,6 +27,7 @@ import (
 	"bytes"
 	"compress/gzip"
 	"crypto/sha256"
+	_ "crypto/sha512" // for the TOC digests of compressors selecting SHA-384 or SHA-512
 	"errors"
 	"fmt"
 	"hash"
@@ -676,6 +677,19 @@ type Writer struct {
 	MinChunkSize int
 
 	needsOpenGzEntries map[string]struct{}
+
+	// streamEntry is the entry starting the current compressed stream, which gets
+	// its CompressedSize when the stream is closed
+	streamEntry *TOCEntry
+
+	// digestAlgorithm is the algorithm of the Digest and ChunkDigest of the entries,
+	// selected by the compressor if it has a DigestAlgorithm method
+	digestAlgorithm digest.Algorithm
+
+	// hashWorkers is the number of goroutines computing the chunk digests, selected
+	// by the compressor if it has a ConcurrentHashWorkers method. The digests are
+	// computed while compressing if it is at most 1.
+	hashWorkers int
 }
 
 // currentCompressionWriter writes to the current w.gz field, which can
@@ -746,6 +760,14 @@ func NewWriterLevel(w io.Writer, compressionLevel int) *Writer {
 func NewWriterWithCompressor(w io.Writer, c Compressor) *Writer {
 	bw := bufio.NewWriter(w)
 	cw := &countWriter{w: bw}
+	digestAlgorithm := digest.Canonical
+	if a, ok := c.(interface{ DigestAlgorithm() digest.Algorithm }); ok {
+		digestAlgorithm = a.DigestAlgorithm()
+	}
+	var hashWorkers int
+	if h, ok := c.(interface{ ConcurrentHashWorkers() int }); ok {
+		hashWorkers = h.ConcurrentHashWorkers()
+	}
 	return &Writer{
 		bw:                  bw,
 		cw:                  cw,
@@ -753,6 +775,8 @@ func NewWriterWithCompressor(w io.Writer, c Compressor) *Writer {
 		diffHash:            sha256.New(),
 		compressor:          c,
 		uncompressedCounter: &countWriteFlusher{},
+		digestAlgorithm:     digestAlgorithm,
+		hashWorkers:         hashWorkers,
 	}
 }
 
@@ -789,6 +813,10 @@ func (w *Writer) closeGz() error {
 			return err
 		}
 		w.gz = nil
+		if w.streamEntry != nil {
+			w.streamEntry.CompressedSize = w.cw.n - w.streamEntry.Offset
+			w.streamEntry = nil
+		}
 	}
 	return nil
 }
@@ -860,6 +888,9 @@ func (w *Writer) AppendTarLossLess(r io.Reader) error {
 }
 
 func (w *Writer) appendTar(r io.Reader, lossless bool) error {
+	if !w.digestAlgorithm.Available() {
+		return fmt.Errorf("unsupported digest algorithm %q", w.digestAlgorithm)
+	}
 	var src io.Reader
 	br := bufio.NewReader(r)
 	if isGzip(br) {
@@ -879,6 +910,22 @@ func (w *Writer) appendTar(r io.Reader, lossless bool) error {
 	}
 	prevOffset := w.cw.n
 	var prevOffsetUncompressed int64
+
+	// With concurrent hashing, the digests are complete once the hasher is waited
+	// for, before returning and so before the TOC is written
+	var (
+		hasher     *concurrentHasher
+		fileChunks chan<- []byte
+	)
+	if w.hashWorkers > 1 {
+		hasher = newConcurrentHasher(w.digestAlgorithm, w.hashWorkers)
+		defer func() {
+			if fileChunks != nil {
+				close(fileChunks)
+			}
+			hasher.wait()
+		}()
+	}
 	for {
 		h, err := tr.Next()
 		if err == io.EOF {
@@ -970,13 +1017,20 @@ func (w *Writer) appendTar(r io.Reader, lossless bool) error {
 		var payloadDigest digest.Digester
 		if h.Typeflag == tar.TypeReg {
 			regFileEntry = ent
-			payloadDigest = digest.Canonical.Digester()
+			if hasher != nil {
+				fileChunks = hasher.hashFile(ent)
+			} else {
+				payloadDigest = w.digestAlgorithm.Digester()
+			}
 		}
 
 		if h.Typeflag == tar.TypeReg && ent.Size > 0 {
 			var written int64
 			totalSize := ent.Size // save it before we destroy ent
-			tee := io.TeeReader(tr, payloadDigest.Hash())
+			var tee io.Reader = tr
+			if payloadDigest != nil {
+				tee = io.TeeReader(tr, payloadDigest.Hash())
+			}
 			for written < totalSize {
 				chunkSize := int64(w.chunkSize())
 				remain := totalSize - written
@@ -996,6 +1050,7 @@ func (w *Writer) appendTar(r io.Reader, lossless bool) error {
 					}
 					ent.Offset = w.cw.n
 					prevOffset = ent.Offset
+					w.streamEntry = ent
 					prevOffsetUncompressed = w.uncompressedCounter.n
 				} else {
 					ent.Offset = prevOffset
@@ -1003,23 +1058,36 @@ func (w *Writer) appendTar(r io.Reader, lossless bool) error {
 				}
 
 				ent.ChunkOffset = written
-				chunkDigest := digest.Canonical.Digester()
 
 				if err := w.condOpenGz(); err != nil {
 					return err
 				}
 
-				teeChunk := io.TeeReader(tee, chunkDigest.Hash())
 				var out io.Writer
 				if tw != nil {
 					out = tw
 				} else {
 					out = dst
 				}
-				if _, err := io.CopyN(out, teeChunk, chunkSize); err != nil {
-					return fmt.Errorf("error copying %q: %v", h.Name, err)
+				if hasher != nil {
+					// The chunk is hashed from its own buffer after being written
+					data := make([]byte, chunkSize)
+					if _, err := io.ReadFull(tee, data); err != nil {
+						return fmt.Errorf("error copying %q: %v", h.Name, err)
+					}
+					if _, err := out.Write(data); err != nil {
+						return fmt.Errorf("error copying %q: %v", h.Name, err)
+					}
+					hasher.hashChunk(ent, data)
+					fileChunks <- data
+				} else {
+					chunkDigest := w.digestAlgorithm.Digester()
+					teeChunk := io.TeeReader(tee, chunkDigest.Hash())
+					if _, err := io.CopyN(out, teeChunk, chunkSize); err != nil {
+						return fmt.Errorf("error copying %q: %v", h.Name, err)
+					}
+					ent.ChunkDigest = chunkDigest.Digest().String()
 				}
-				ent.ChunkDigest = chunkDigest.Digest().String()
 				w.toc.Entries = append(w.toc.Entries, ent)
 				written += chunkSize
 				ent = &TOCEntry{
@@ -1033,6 +1101,10 @@ func (w *Writer) appendTar(r io.Reader, lossless bool) error {
 		if payloadDigest != nil {
 			regFileEntry.Digest = payloadDigest.Digest().String()
 		}
+		if fileChunks != nil {
+			close(fileChunks)
+			fileChunks = nil
+		}
 		if tw != nil {
 			if err := tw.Flush(); err != nil {
 				return err
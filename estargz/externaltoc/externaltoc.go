@@ -74,7 +74,7 @@ func (gc *GzipCompressor) Writer(w io.Writer) (estargz.WriteFlushCloser, error)
 }
 
 func (gc *GzipCompressor) WriteTOCAndFooter(w io.Writer, off int64, toc *estargz.JTOC, diffHash hash.Hash) (digest.Digest, error) {
-	tocJSON, err := json.MarshalIndent(toc, "", "\t")
+	tocJSON, err := toc.Serialize()
 	if err != nil {
 		return "", err
 	}
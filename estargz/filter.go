@@ -0,0 +1,232 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package estargz
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+)
+
+const (
+	whiteoutPrefix    = ".wh."
+	whiteoutOpaqueDir = whiteoutPrefix + whiteoutPrefix + ".opq"
+)
+
+// Sort sorts the entries of toc by name, comparing the names one path component at a
+// time so that each directory comes before its children and is followed by all its
+// descendants. Whiteouts come after the other entries of their directory. The chunks
+// of a file stay after its entry and entries with the same name keep their order.
+//
+// The TOC written to a layer isn't sorted, as its order follows the layout of the
+// blob (e.g. prioritized files first); the TOCs derived from it are.
+func (toc *JTOC) Sort() {
+	type group struct {
+		name    []string
+		entries []*TOCEntry
+	}
+	var groups []group
+	for _, e := range toc.Entries {
+		if e.Type == "chunk" && len(groups) > 0 {
+			// Chunks follow the entry of their file
+			g := &groups[len(groups)-1]
+			g.entries = append(g.entries, e)
+			continue
+		}
+		groups = append(groups, group{strings.Split(cleanEntryName(e.Name), "/"), []*TOCEntry{e}})
+	}
+	slices.SortStableFunc(groups, func(a, b group) int {
+		return compareEntryNames(a.name, b.name)
+	})
+	toc.Entries = toc.Entries[:0]
+	for _, g := range groups {
+		toc.Entries = append(toc.Entries, g.entries...)
+	}
+}
+
+// compareEntryNames compares the path components a and b of two entry names in the
+// order of JTOC.Sort
+func compareEntryNames(a, b []string) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] == b[i] {
+			continue
+		}
+		if aw, bw := strings.HasPrefix(a[i], whiteoutPrefix), strings.HasPrefix(b[i], whiteoutPrefix); aw != bw {
+			if aw {
+				return 1
+			}
+			return -1
+		}
+		return strings.Compare(a[i], b[i])
+	}
+	return cmp.Compare(len(a), len(b))
+}
+
+// FilterIndex returns a copy of toc that only contains the entries whose Name matches
+// pattern (see path.Match) and the parent directories they need. The chunks of the matched
+// files and the targets of the matched hardlinks are retained as well. The entries are
+// sorted with JTOC.Sort.
+// Whiteouts are retained only if the file they remove matches pattern. Opaque whiteouts
+// are removed as they also hide the files that don't match pattern.
+func FilterIndex(toc *JTOC, pattern string) (*JTOC, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	match := func(name string) bool {
+		ok, _ := path.Match(pattern, name)
+		return ok
+	}
+	keep := make(map[string]bool)
+	for _, e := range toc.Entries {
+		if e.Type == "chunk" {
+			continue
+		}
+		name := cleanEntryName(e.Name)
+		dir, base := path.Split(name)
+		if strings.HasPrefix(base, whiteoutPrefix) {
+			if base != whiteoutOpaqueDir && match(path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix))) {
+				keep[name] = true
+			}
+			continue
+		}
+		if match(name) {
+			keep[name] = true
+			if e.Type == "hardlink" {
+				keep[cleanEntryName(e.LinkName)] = true
+			}
+		}
+	}
+	for _, name := range slices.Collect(maps.Keys(keep)) {
+		for d := parentDir(name); d != ""; d = parentDir(d) {
+			keep[d] = true
+		}
+	}
+
+	filtered := &JTOC{
+		Version:        toc.Version,
+		PrevBlobDigest: toc.PrevBlobDigest,
+		Annotations:    maps.Clone(toc.Annotations),
+	}
+	var keepChunks bool
+	for _, e := range toc.Entries {
+		if e.Type == "chunk" {
+			// Chunks follow the entry of their file
+			if keepChunks {
+				ec := *e
+				filtered.Entries = append(filtered.Entries, &ec)
+			}
+			continue
+		}
+		keepChunks = keep[cleanEntryName(e.Name)]
+		if keepChunks {
+			ec := *e
+			filtered.Entries = append(filtered.Entries, &ec)
+		}
+	}
+	filtered.Sort()
+	return filtered, nil
+}
+
+// DiffIndex returns a TOC of the changes from base to update. It contains the entries
+// of update that aren't in base or whose Type, LinkName or Digest differ (with their
+// chunks, the parent directories they need and the targets of hardlinks) and a whiteout
+// for each entry of base that is missing in update. Only the topmost missing directory
+// is whited out. The entries keep the offsets of update and are sorted with JTOC.Sort.
+func DiffIndex(base, update *JTOC) (*JTOC, error) {
+	if base == nil || update == nil {
+		return nil, fmt.Errorf("both TOCs must be specified")
+	}
+	baseEntries := make(map[string]*TOCEntry)
+	for _, e := range base.Entries {
+		if e.Type != "chunk" {
+			baseEntries[cleanEntryName(e.Name)] = e
+		}
+	}
+	updateEntries := make(map[string]*TOCEntry)
+	keep := make(map[string]bool)
+	for _, e := range update.Entries {
+		if e.Type == "chunk" {
+			continue
+		}
+		name := cleanEntryName(e.Name)
+		updateEntries[name] = e
+		if b, ok := baseEntries[name]; !ok || b.Type != e.Type || b.LinkName != e.LinkName || b.Digest != e.Digest {
+			keep[name] = true
+			if e.Type == "hardlink" {
+				keep[cleanEntryName(e.LinkName)] = true
+			}
+		}
+	}
+	var deleted []string
+	for name := range baseEntries {
+		if _, ok := updateEntries[name]; ok || strings.HasPrefix(path.Base(name), whiteoutPrefix) {
+			continue
+		}
+		if _, ok := baseEntries[parentDir(name)]; ok {
+			if _, ok := updateEntries[parentDir(name)]; !ok {
+				// Removed with the parent directory
+				continue
+			}
+		}
+		deleted = append(deleted, name)
+	}
+	slices.Sort(deleted)
+	for _, name := range slices.Collect(maps.Keys(keep)) {
+		for d := parentDir(name); d != ""; d = parentDir(d) {
+			keep[d] = true
+		}
+	}
+	for _, name := range deleted {
+		for d := parentDir(name); d != ""; d = parentDir(d) {
+			keep[d] = true
+		}
+	}
+
+	diff := &JTOC{
+		Version:     update.Version,
+		Annotations: maps.Clone(update.Annotations),
+	}
+	var keepChunks bool
+	for _, e := range update.Entries {
+		if e.Type == "chunk" {
+			// Chunks follow the entry of their file
+			if keepChunks {
+				ec := *e
+				diff.Entries = append(diff.Entries, &ec)
+			}
+			continue
+		}
+		name := cleanEntryName(e.Name)
+		keepChunks = keep[name] && updateEntries[name] == e
+		if keepChunks {
+			ec := *e
+			diff.Entries = append(diff.Entries, &ec)
+		}
+	}
+	for _, name := range deleted {
+		dir, base := path.Split(name)
+		diff.Entries = append(diff.Entries, &TOCEntry{
+			Name: path.Join(dir, whiteoutPrefix+base),
+			Type: "reg",
+		})
+	}
+	diff.Sort()
+	return diff, nil
+}
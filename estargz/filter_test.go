@@ -0,0 +1,216 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package estargz
+
+import (
+	"io"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFilterIndex(t *testing.T) {
+	tr := buildTar(t, tarOf(
+		dir("usr/"),
+		dir("usr/bin/"),
+		file("usr/bin/sh", "shell"),
+		dir("usr/lib/"),
+		file("usr/lib/libc.so", "0123456789"),
+		file("usr/lib/libc.a", "archive"),
+		link("usr/lib/libsh.so", "usr/bin/sh"),
+		file("usr/lib/.wh.old.so", ""),
+		file("usr/lib/.wh.old.a", ""),
+		file("usr/lib/.wh..wh..opq", ""),
+		dir("usr/lib/x/"),
+		file("usr/lib/x/libz.so", "z"),
+		dir("etc/"),
+		file("etc/passwd", "root"),
+	), "")
+	w := NewWriterWithCompressor(io.Discard, &GzipCompressor{})
+	w.ChunkSize = 4
+	if err := w.AppendTar(tr); err != nil {
+		t.Fatal(err)
+	}
+	toc := w.toc
+	toc.Annotations = map[string]string{"foo": "bar"}
+
+	filtered, err := FilterIndex(toc, "usr/lib/*.so")
+	if err != nil {
+		t.Fatal(err)
+	}
+	type entry struct{ name, typ string }
+	var got []entry
+	for _, e := range filtered.Entries {
+		got = append(got, entry{cleanEntryName(e.Name), e.Type})
+	}
+	want := []entry{
+		{"usr", "dir"},
+		{"usr/bin", "dir"},
+		{"usr/bin/sh", "reg"},
+		{"usr/bin/sh", "chunk"},
+		{"usr/lib", "dir"},
+		{"usr/lib/libc.so", "reg"},
+		{"usr/lib/libc.so", "chunk"},
+		{"usr/lib/libc.so", "chunk"},
+		{"usr/lib/libsh.so", "hardlink"},
+		{"usr/lib/.wh.old.so", "reg"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("filtered entries = %v; want %v", got, want)
+	}
+	if filtered.Version != toc.Version || !reflect.DeepEqual(filtered.Annotations, toc.Annotations) {
+		t.Errorf("filtered TOC doesn't keep the version and annotations")
+	}
+	if len(toc.Entries) <= len(filtered.Entries) {
+		t.Errorf("original TOC was modified")
+	}
+
+	if _, err := FilterIndex(toc, "["); err == nil {
+		t.Errorf("expected an error for a malformed pattern")
+	}
+}
+
+func TestDiffIndex(t *testing.T) {
+	buildTOC := func(entries ...tarEntry) *JTOC {
+		w := NewWriterWithCompressor(io.Discard, &GzipCompressor{})
+		w.ChunkSize = 4
+		if err := w.AppendTar(buildTar(t, tarOf(entries...), "")); err != nil {
+			t.Fatal(err)
+		}
+		return w.toc
+	}
+	base := buildTOC(
+		dir("usr/"),
+		dir("usr/bin/"),
+		file("usr/bin/sh", "shell"),
+		dir("usr/lib/"),
+		file("usr/lib/libc.so", "0123456789"),
+		dir("etc/"),
+		file("etc/passwd", "root"),
+		file("etc/hosts", "localhost"),
+		dir("opt/"),
+		dir("opt/app/"),
+		file("opt/app/bin", "app"),
+	)
+	update := buildTOC(
+		dir("usr/"),
+		dir("usr/bin/"),
+		file("usr/bin/sh", "shell"),
+		dir("usr/lib/"),
+		file("usr/lib/libc.so", "9876543210"),
+		file("usr/lib/libm.so", "math"),
+		dir("etc/"),
+		file("etc/hosts", "localhost"),
+	)
+	update.Annotations = map[string]string{"foo": "bar"}
+
+	diff, err := DiffIndex(base, update)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type entry struct{ name, typ string }
+	var got []entry
+	for _, e := range diff.Entries {
+		got = append(got, entry{cleanEntryName(e.Name), e.Type})
+	}
+	want := []entry{
+		{"etc", "dir"},
+		// Deleted
+		{"etc/.wh.passwd", "reg"},
+		{"usr", "dir"},
+		{"usr/lib", "dir"},
+		// Modified
+		{"usr/lib/libc.so", "reg"},
+		{"usr/lib/libc.so", "chunk"},
+		{"usr/lib/libc.so", "chunk"},
+		// Added
+		{"usr/lib/libm.so", "reg"},
+		// Deleted
+		{".wh.opt", "reg"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("diff entries = %v; want %v", got, want)
+	}
+	if diff.Version != update.Version || !reflect.DeepEqual(diff.Annotations, update.Annotations) {
+		t.Errorf("diff TOC doesn't keep the version and annotations of update")
+	}
+	for _, e := range diff.Entries {
+		if e.Type == "reg" && !strings.HasPrefix(path.Base(e.Name), whiteoutPrefix) && e.Digest == "" {
+			t.Errorf("%s has no digest", e.Name)
+		}
+	}
+
+	if diff, err := DiffIndex(update, update); err != nil || len(diff.Entries) != 0 {
+		t.Errorf("diff of identical TOCs = %v (err: %v); want no entries", diff.Entries, err)
+	}
+}
+
+func TestJTOCSort(t *testing.T) {
+	toc := &JTOC{Entries: []*TOCEntry{
+		{Name: "usr/lib/.wh..wh..opq", Type: "reg"},
+		{Name: "usr/lib/x/", Type: "dir"},
+		{Name: "usr/lib/libc.so", Type: "reg", ChunkOffset: 0},
+		{Name: "usr/lib/libc.so", Type: "chunk", ChunkOffset: 4},
+		{Name: "usr/lib/libc.so", Type: "chunk", ChunkOffset: 8},
+		{Name: "usr/.wh.share", Type: "reg"},
+		{Name: "usr/lib.txt", Type: "reg"},
+		{Name: "usr/", Type: "dir"},
+		{Name: "./", Type: "dir"},
+		{Name: "usr/lib/", Type: "dir"},
+		{Name: "usr/lib/.wh.old.so", Type: "reg"},
+		{Name: "usr/lib/x/libz.so", Type: "reg"},
+		{Name: ".wh.opt", Type: "reg"},
+		{Name: "etc/passwd", Type: "reg"},
+		{Name: "etc/", Type: "dir"},
+		{Name: "usr/lib/libc.so", Type: "symlink"},
+	}}
+	toc.Sort()
+
+	type entry struct {
+		name, typ string
+		offset    int64
+	}
+	var got []entry
+	for _, e := range toc.Entries {
+		got = append(got, entry{cleanEntryName(e.Name), e.Type, e.ChunkOffset})
+	}
+	want := []entry{
+		{"", "dir", 0},
+		{"etc", "dir", 0},
+		{"etc/passwd", "reg", 0},
+		{"usr", "dir", 0},
+		{"usr/lib", "dir", 0},
+		// The chunks follow their file, and entries with the same name keep their order
+		{"usr/lib/libc.so", "reg", 0},
+		{"usr/lib/libc.so", "chunk", 4},
+		{"usr/lib/libc.so", "chunk", 8},
+		{"usr/lib/libc.so", "symlink", 0},
+		{"usr/lib/x", "dir", 0},
+		{"usr/lib/x/libz.so", "reg", 0},
+		// Whiteouts at the end of their directory
+		{"usr/lib/.wh..wh..opq", "reg", 0},
+		{"usr/lib/.wh.old.so", "reg", 0},
+		// The children of usr/lib come before usr/lib.txt
+		{"usr/lib.txt", "reg", 0},
+		{"usr/.wh.share", "reg", 0},
+		{".wh.opt", "reg", 0},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sorted entries = %v; want %v", got, want)
+	}
+}
@@ -10,11 +10,15 @@ require (
 	github.com/containerd/stargz-snapshotter v0.0.0-00010101000000-000000000000
 	github.com/klauspost/compress v1.18.0
 	github.com/opencontainers/go-digest v1.0.0
+	github.com/opencontainers/image-spec v1.1.1
 	github.com/vbatts/tar-split v0.12.1
+	github.com/xeipuuv/gojsonschema v1.2.0
 	golang.org/x/sync v0.16.0
+	golang.org/x/sys v0.34.0
 )
 
 require (
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
 	github.com/ebitengine/purego v0.8.4 // indirect
 	github.com/go-ole/go-ole v1.2.6 // indirect
 	github.com/lufia/plan9stats v0.0.0-20211012122336-39d0f177ccd0 // indirect
@@ -23,8 +27,10 @@ require (
 	github.com/sirupsen/logrus v1.9.3 // indirect
 	github.com/tklauser/go-sysconf v0.3.12 // indirect
 	github.com/tklauser/numcpus v0.6.1 // indirect
+	github.com/xeipuuv/gojsonpointer v0.0.0-20190905194746-02993c407bfb // indirect
+	github.com/xeipuuv/gojsonreference v0.0.0-20180127040603-bd5ef7bd5415 // indirect
 	github.com/yusufpapurcu/wmi v1.2.4 // indirect
-	golang.org/x/sys v0.34.0 // indirect
+	golang.org/x/time v0.9.0 // indirect
 )
 
 replace github.com/containerd/stargz-snapshotter => ../
@@ -0,0 +1,86 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package estargz
+
+import (
+	"sync"
+
+	digest "github.com/opencontainers/go-digest"
+)
+
+// concurrentHasher computes the digests of the chunks and of the regular files
+// appended to a Writer off the goroutine compressing them. The chunk digests are
+// computed by a fixed number of workers; the digest of each file is computed by a
+// goroutine of its own, fed with the chunks of the file in order.
+type concurrentHasher struct {
+	alg    digest.Algorithm
+	chunks chan hashJob
+	wg     sync.WaitGroup
+}
+
+type hashJob struct {
+	ent  *TOCEntry
+	data []byte
+}
+
+// newConcurrentHasher starts workers goroutines computing the chunk digests
+func newConcurrentHasher(alg digest.Algorithm, workers int) *concurrentHasher {
+	h := &concurrentHasher{
+		alg:    alg,
+		chunks: make(chan hashJob, workers),
+	}
+	for i := 0; i < workers; i++ {
+		h.wg.Add(1)
+		go func() {
+			defer h.wg.Done()
+			for job := range h.chunks {
+				job.ent.ChunkDigest = h.alg.FromBytes(job.data).String()
+			}
+		}()
+	}
+	return h
+}
+
+// hashChunk sets the ChunkDigest of ent to the digest of data once a worker is done.
+// data must not be modified afterwards.
+func (h *concurrentHasher) hashChunk(ent *TOCEntry, data []byte) {
+	h.chunks <- hashJob{ent, data}
+}
+
+// hashFile returns the channel receiving the chunks of the regular file of ent in
+// order. The Digest of ent is set once the channel is closed and all the chunks
+// are hashed.
+func (h *concurrentHasher) hashFile(ent *TOCEntry) chan<- []byte {
+	ch := make(chan []byte, cap(h.chunks))
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		d := h.alg.Digester()
+		for b := range ch {
+			d.Hash().Write(b)
+		}
+		ent.Digest = d.Digest().String()
+	}()
+	return ch
+}
+
+// wait stops the workers once they have hashed the queued chunks and waits for the
+// digests of the files whose channels are closed.
+func (h *concurrentHasher) wait() {
+	close(h.chunks)
+	h.wg.Wait()
+}
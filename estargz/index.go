@@ -0,0 +1,58 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package estargz
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// IndexSchemaVersion is the schema version of the standalone TOC JSON written by ExportIndex.
+const IndexSchemaVersion = 1
+
+// exportedIndex is the format of the standalone TOC JSON.
+type exportedIndex struct {
+	SchemaVersion int `json:"schema_version"`
+	*JTOC
+}
+
+// ExportIndex writes toc to w as a standalone pretty-printed JSON (e.g. for auditing
+// the contents of a layer). The JSON has the fields of JTOC and "schema_version".
+func ExportIndex(toc *JTOC, w io.Writer) error {
+	if toc == nil {
+		return fmt.Errorf("TOC must not be nil")
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(exportedIndex{SchemaVersion: IndexSchemaVersion, JTOC: toc})
+}
+
+// ImportIndex parses the standalone TOC JSON written by ExportIndex.
+func ImportIndex(r io.Reader) (*JTOC, error) {
+	var idx exportedIndex
+	if err := json.NewDecoder(r).Decode(&idx); err != nil {
+		return nil, fmt.Errorf("failed to decode TOC JSON: %w", err)
+	}
+	if idx.SchemaVersion != IndexSchemaVersion {
+		return nil, fmt.Errorf("unsupported TOC JSON schema version %d", idx.SchemaVersion)
+	}
+	if idx.JTOC == nil {
+		return nil, fmt.Errorf("TOC JSON has no TOC")
+	}
+	return idx.JTOC, nil
+}
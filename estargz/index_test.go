@@ -0,0 +1,117 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package estargz
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestExportImportIndex(t *testing.T) {
+	tr := buildTar(t, tarOf(
+		dir("foo/"),
+		file("foo/bar.txt", "bar contents", xAttr{"user.test": "value"}),
+		symlink("foo/link", "bar.txt"),
+		link("foo/hardlink", "foo/bar.txt"),
+		fifo("foo/fifo"),
+	), "")
+	w := NewWriterWithCompressor(io.Discard, &GzipCompressor{})
+	w.ChunkSize = 4
+	if err := w.AppendTar(tr); err != nil {
+		t.Fatal(err)
+	}
+	w.toc.Annotations = map[string]string{"foo": "bar"}
+	// Decode the TOC as stored in the blob
+	tocJSON, err := json.Marshal(w.toc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	toc := new(JTOC)
+	if err := json.Unmarshal(tocJSON, toc); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := ExportIndex(toc, &buf); err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &fields); err != nil {
+		t.Fatal(err)
+	}
+	if v := fields["schema_version"]; v != float64(1) {
+		t.Errorf("schema_version = %v; want 1", v)
+	}
+	if !strings.Contains(buf.String(), "\n  \"entries\"") {
+		t.Errorf("exported TOC isn't pretty-printed:\n%s", buf.String())
+	}
+
+	got, err := ImportIndex(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, toc) {
+		t.Errorf("imported TOC = %+v; want %+v", got, toc)
+	}
+
+	for _, in := range []string{`{"version":1,"entries":[]}`, `{"schema_version":2,"version":1}`, `{`} {
+		if _, err := ImportIndex(strings.NewReader(in)); err == nil {
+			t.Errorf("expected an error for %s", in)
+		}
+	}
+}
+
+func TestJTOCSerialize(t *testing.T) {
+	newTOC := func(keys []string) *JTOC {
+		toc := &JTOC{Version: 1, Annotations: make(map[string]string)}
+		ent := &TOCEntry{Name: "file", Type: "reg", Size: 4, Xattrs: make(map[string][]byte)}
+		for _, k := range keys {
+			toc.Annotations["annotation."+k] = k
+			ent.Xattrs["user."+k] = []byte(k)
+		}
+		toc.Entries = append(toc.Entries, &TOCEntry{Name: "dir/", Type: "dir"}, ent)
+		return toc
+	}
+	keys := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	reversed := append([]string(nil), keys...)
+	slices.Reverse(reversed)
+	want, err := newTOC(keys).Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		got, err := newTOC(reversed).Serialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("serializations of equal TOCs differ:\n%s\n%s", got, want)
+		}
+	}
+	var decoded JTOC
+	if err := json.Unmarshal(want, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&decoded, newTOC(keys)) {
+		t.Errorf("decoded TOC %+v; want %+v", decoded, newTOC(keys))
+	}
+}
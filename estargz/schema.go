@@ -0,0 +1,115 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package estargz
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+var (
+	tocSchema     []byte
+	tocSchemaOnce sync.Once
+)
+
+// Schema returns a JSON Schema (draft-07) document describing the TOC JSON.
+// The schema is generated from the struct tags of JTOC and TOCEntry. Fields
+// without "omitempty" are required and allowed values are taken from the
+// "jsonschema" tag (e.g. `jsonschema:"enum=dir|reg"`).
+func (t *JTOC) Schema() []byte {
+	tocSchemaOnce.Do(func() {
+		defs := make(map[string]interface{})
+		root := structSchema(reflect.TypeOf(JTOC{}), defs)
+		root["$schema"] = "http://json-schema.org/draft-07/schema#"
+		root["title"] = "TOC"
+		root["definitions"] = defs
+		b, err := json.MarshalIndent(root, "", "  ")
+		if err != nil {
+			panic(fmt.Sprintf("failed to marshal TOC schema: %v", err))
+		}
+		tocSchema = b
+	})
+	return append([]byte(nil), tocSchema...)
+}
+
+func structSchema(t reflect.Type, defs map[string]interface{}) map[string]interface{} {
+	props := make(map[string]interface{})
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		s := typeSchema(f.Type, defs)
+		if enum, ok := strings.CutPrefix(f.Tag.Get("jsonschema"), "enum="); ok {
+			s["enum"] = strings.Split(enum, "|")
+		}
+		props[name] = s
+		if !strings.Contains(opts, "omitempty") {
+			required = append(required, name)
+		}
+	}
+	s := map[string]interface{}{
+		"type":       "object",
+		"properties": props,
+	}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+func typeSchema(t reflect.Type, defs map[string]interface{}) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return typeSchema(t.Elem(), defs)
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// encoding/json encodes []byte as a base64 string
+			return map[string]interface{}{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem(), defs)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem(), defs)}
+	case reflect.Struct:
+		if _, ok := defs[t.Name()]; !ok {
+			defs[t.Name()] = nil // placeholder for recursive types
+			defs[t.Name()] = structSchema(t, defs)
+		}
+		return map[string]interface{}{"$ref": "#/definitions/" + t.Name()}
+	}
+	return map[string]interface{}{}
+}
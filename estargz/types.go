@@ -24,6 +24,7 @@ package estargz
 
 import (
 	"archive/tar"
+	"encoding/json"
 	"hash"
 	"io"
 	"os"
@@ -96,6 +97,22 @@ const (
 type JTOC struct {
 	Version int         `json:"version"`
 	Entries []*TOCEntry `json:"entries"`
+
+	// PrevBlobDigest is the digest of the preceding blob of a layer split into
+	// multiple blobs. Empty if the layer isn't split or this is the first blob of
+	// the chain.
+	PrevBlobDigest digest.Digest `json:"prevBlobDigest,omitempty"`
+
+	// Annotations contains arbitrary metadata of the blob recorded by the compressor.
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// Serialize returns the JSON encoding of the TOC stored in the layers. The
+// encoding depends only on the contents of the TOC: map keys (annotations,
+// xattrs) are sorted and the TOC has no floating point fields, so two equal TOCs
+// always serialize to the same bytes and so have the same digest.
+func (toc *JTOC) Serialize() ([]byte, error) {
+	return json.MarshalIndent(toc, "", "\t")
 }
 
 // TOCEntry is an entry in the stargz file's TOC (Table of Contents).
@@ -109,7 +126,7 @@ type TOCEntry struct {
 	// The "chunk" type is used for regular file data chunks past the first
 	// TOCEntry; the 2nd chunk and on have only Type ("chunk"), Offset,
 	// ChunkOffset, and ChunkSize populated.
-	Type string `json:"type"`
+	Type string `json:"type" jsonschema:"enum=dir|reg|symlink|hardlink|char|block|fifo|chunk"`
 
 	// Size, for regular files, is the logical size of the file.
 	Size int64 `json:"size,omitempty"`
@@ -191,6 +208,13 @@ type TOCEntry struct {
 	// as "sha256:0123abcd...".
 	ChunkDigest string `json:"chunkDigest,omitempty"`
 
+	// CompressedSize is the size of the compressed stream starting at Offset, for
+	// the "reg" or "chunk" entry whose payload starts that stream (InnerOffset is
+	// zero). The stream also holds the payloads of the entries sharing its Offset
+	// and the tar headers of the following entries. Zero means unknown: it isn't
+	// recorded for the other entries nor by older writers.
+	CompressedSize int64 `json:"compressedSize,omitempty"`
+
 	children map[string]*TOCEntry
 
 	// chunkTopIndex is index of the entry where Offset starts in the blob.
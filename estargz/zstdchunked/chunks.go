@@ -0,0 +1,104 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package zstdchunked
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// ChunkInfo describes a chunk of a regular file in a zstd:chunked layer.
+type ChunkInfo struct {
+	// EntryName is the name of the file the chunk belongs to.
+	EntryName string
+
+	// CompressedOffset and CompressedSize are the byte range of the blob
+	// decompressed for reading the chunk, up to the data of the next chunk.
+	// Small files may share their compressed data with other files.
+	CompressedOffset, CompressedSize int64
+
+	// UncompressedOffset and UncompressedSize are the byte range of the chunk in the file.
+	UncompressedOffset, UncompressedSize int64
+
+	// Digest is the digest of the uncompressed chunk.
+	Digest digest.Digest
+}
+
+// ListChunks returns the chunks of the regular files in the zstd:chunked layer r,
+// in the order of the TOC. Empty files have no chunk.
+//
+// r must also implement Size() int64 (e.g. *io.SectionReader, *bytes.Reader).
+func (zz *Decompressor) ListChunks(r io.ReaderAt) ([]ChunkInfo, error) {
+	_, tocOff, toc, err := zz.openTOC(r)
+	if err != nil {
+		return nil, err
+	}
+	var chunks []ChunkInfo
+	sizes := make(map[string]int64)
+	for _, ent := range toc.Entries {
+		switch ent.Type {
+		case "reg":
+			if ent.Size == 0 {
+				continue
+			}
+			sizes[ent.Name] = ent.Size
+		case "chunk":
+		default:
+			continue
+		}
+		size := ent.ChunkSize
+		if size == 0 {
+			// The last chunk of a file may omit its size
+			fileSize, ok := sizes[ent.Name]
+			if !ok {
+				return nil, fmt.Errorf("chunk of %q at offset %d precedes the file entry", ent.Name, ent.ChunkOffset)
+			}
+			size = fileSize - ent.ChunkOffset
+		}
+		chunks = append(chunks, ChunkInfo{
+			EntryName:          ent.Name,
+			CompressedOffset:   ent.Offset,
+			UncompressedOffset: ent.ChunkOffset,
+			UncompressedSize:   size,
+			Digest:             digest.Digest(ent.ChunkDigest),
+		})
+	}
+
+	// The compressed data of a chunk ends where the data of the next chunk at
+	// another offset, or the dictionary or the TOC, begins
+	end := tocOff
+	if off, _, err := dictionaryPosition(toc); err == nil && off < end {
+		// 8 is the size of the zstd skippable frame header + the frame size
+		end = off - 8
+	} else if err != nil && !errors.Is(err, ErrNoDictionary) {
+		return nil, err
+	}
+	for i := len(chunks) - 1; i >= 0; i-- {
+		c := &chunks[i]
+		if c.CompressedOffset > end {
+			return nil, fmt.Errorf("chunk of %q at offset %d is out of order", c.EntryName, c.UncompressedOffset)
+		}
+		c.CompressedSize = end - c.CompressedOffset
+		if i > 0 && chunks[i-1].CompressedOffset != c.CompressedOffset {
+			end = c.CompressedOffset
+		}
+	}
+	return chunks, nil
+}
@@ -32,6 +32,7 @@ import (
 	compzstd "github.com/containerd/stargz-snapshotter/compression/zstd"
 	"github.com/klauspost/compress/zstd"
 	digest "github.com/opencontainers/go-digest"
+	"github.com/xeipuuv/gojsonschema"
 )
 
 // TestDecompressionWithDifferentImplementations tests that both implementations
@@ -402,4 +403,72 @@ func TestConcurrentDecompression(t *testing.T) {
 			t.Error(err)
 		}
 	}
-}
\ No newline at end of file
+}
+
+// TestTOCSchema validates a TOC produced by the zstd:chunked writer against JTOC.Schema
+func TestTOCSchema(t *testing.T) {
+	var tarBuf bytes.Buffer
+	tw := tar.NewWriter(&tarBuf)
+	for _, f := range []struct {
+		name    string
+		content string
+	}{
+		{"file1.txt", "Hello, World!"},
+		{"dir/file2.txt", "This is a test file for zstd:chunked compression"},
+		{"large.txt", strings.Repeat("Large file content. ", 1000)},
+	} {
+		if err := tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(f.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var blob bytes.Buffer
+	w := estargz.NewWriterWithCompressor(&blob, &Compressor{CompressionLevel: zstd.SpeedDefault})
+	w.ChunkSize = 4096
+	if err := w.AppendTar(&tarBuf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	zz := new(Decompressor)
+	footer := blob.Bytes()[blob.Len()-FooterSize:]
+	_, tocOff, tocSize, err := zz.ParseFooter(footer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tocReader, err := zz.DecompressTOC(bytes.NewReader(blob.Bytes()[tocOff : tocOff+tocSize]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tocReader.Close()
+	tocJSON, err := io.ReadAll(tocReader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schema := gojsonschema.NewBytesLoader(new(estargz.JTOC).Schema())
+	res, err := gojsonschema.Validate(schema, gojsonschema.NewBytesLoader(tocJSON))
+	if err != nil {
+		t.Fatalf("failed to validate TOC: %v", err)
+	}
+	if !res.Valid() {
+		t.Errorf("TOC doesn't match the schema: %v", res.Errors())
+	}
+
+	// An unknown entry type must be rejected
+	res, err = gojsonschema.Validate(schema, gojsonschema.NewStringLoader(`{"version":1,"entries":[{"name":"a","type":"unknown"}]}`))
+	if err != nil {
+		t.Fatalf("failed to validate TOC: %v", err)
+	}
+	if res.Valid() {
+		t.Errorf("TOC with unknown entry type matches the schema")
+	}
+}
@@ -0,0 +1,176 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package zstdchunked
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	compzstd "github.com/containerd/stargz-snapshotter/compression/zstd"
+	"github.com/containerd/stargz-snapshotter/estargz"
+	digest "github.com/opencontainers/go-digest"
+)
+
+// DictionaryFrameID is the id of the skippable frame (magic number 0x184D2A5D) that
+// WithDictionary embeds the dictionary in. 0x0 is used by the TOC and the footer.
+const DictionaryFrameID = 0xD
+
+// DictionaryAnnotation is a TOC annotation that contains the offset and size of the
+// dictionary embedded by WithDictionary as "offset:size". The offset points to the
+// payload of the frame, after its header.
+const DictionaryAnnotation = "io.containers.zstd-chunked/dictionary"
+
+// ErrNoDictionary is returned by ExtractDictionary for a layer without a dictionary.
+var ErrNoDictionary = errors.New("no dictionary in zstd:chunked layer")
+
+// WithDictionary makes zc compress the file contents with the zstd dictionary dict
+// and embed dict in a skippable frame with DictionaryFrameID before the TOC of each
+// blob. The TOC isn't compressed with the dictionary, so that it can be parsed
+// before the dictionary is extracted. The compressor selected in the compression
+// package must be a DictionaryCompressor. zc is returned for convenience.
+func (zc *Compressor) WithDictionary(dict []byte) *Compressor {
+	zc.dict = dict
+	return zc.WithSkippableFrame(DictionaryFrameID, func() []byte { return dict })
+}
+
+// SetDictionary makes the readers of zz decompress with the zstd dictionary dict
+// instead of one embedded in the layer. nil clears it.
+func (zz *Decompressor) SetDictionary(dict []byte) {
+	zz.mu.Lock()
+	defer zz.mu.Unlock()
+	zz.dict = dict
+	zz.layerR, zz.layer = nil, nil
+}
+
+// ExtractDictionary returns the dictionary embedded in the zstd:chunked layer r by
+// Compressor.WithDictionary, or ErrNoDictionary. Only the footer, the TOC and the
+// dictionary frame located by DictionaryAnnotation are read.
+//
+// r must also implement Size() int64 (e.g. *io.SectionReader, *bytes.Reader).
+func (zz *Decompressor) ExtractDictionary(r io.ReaderAt) ([]byte, error) {
+	sr, _, toc, err := zz.openTOC(r)
+	if err != nil {
+		return nil, err
+	}
+	return readDictionary(sr, toc)
+}
+
+// readDictionary reads the dictionary frame located by the DictionaryAnnotation of
+// toc from the blob sr
+func readDictionary(sr *io.SectionReader, toc *estargz.JTOC) ([]byte, error) {
+	off, size, err := dictionaryPosition(toc)
+	if err != nil {
+		return nil, err
+	}
+	if off+size > sr.Size() {
+		return nil, fmt.Errorf("dictionary frame at %d exceeds the blob size %d", off-8, sr.Size())
+	}
+	frame := make([]byte, 8+size)
+	if _, err := sr.ReadAt(frame, off-8); err != nil {
+		return nil, fmt.Errorf("failed to read dictionary frame: %w", err)
+	}
+	if frame[0] != skippableFrameMagic[0]|DictionaryFrameID || !bytes.Equal(frame[1:4], skippableFrameMagic[1:]) ||
+		int64(binary.LittleEndian.Uint32(frame[4:8])) != size {
+		return nil, fmt.Errorf("no dictionary frame at %d", off-8)
+	}
+	return frame[8:], nil
+}
+
+// dictionaryPosition returns the offset and size of the dictionary recorded in the
+// DictionaryAnnotation of toc, or ErrNoDictionary.
+func dictionaryPosition(toc *estargz.JTOC) (off, size int64, err error) {
+	v, ok := toc.Annotations[DictionaryAnnotation]
+	if !ok {
+		return 0, 0, ErrNoDictionary
+	}
+	if _, err := fmt.Sscanf(v, "%d:%d", &off, &size); err != nil || off < 8 || size < 0 {
+		return 0, 0, fmt.Errorf("invalid %q annotation %q", DictionaryAnnotation, v)
+	}
+	return off, size, nil
+}
+
+// openLayer opens the zstd:chunked layer sr and returns it with its TOC. The file
+// contents are decompressed with the dictionary set by SetDictionary, otherwise with
+// the one located by the TOC if any.
+func (zz *Decompressor) openLayer(sr *io.SectionReader) (*estargz.Reader, *estargz.JTOC, error) {
+	d := &dictDecompressor{Decompressor: zz}
+	er, err := estargz.Open(sr, estargz.WithDecompressors(d))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open layer: %w", err)
+	}
+	zz.mu.Lock()
+	d.dict = zz.dict
+	zz.mu.Unlock()
+	if d.dict == nil {
+		d.dict, err = readDictionary(sr, d.toc)
+		if err != nil && !errors.Is(err, ErrNoDictionary) {
+			return nil, nil, err
+		}
+	}
+	return er, d.toc, nil
+}
+
+// dictDecompressor is the Decompressor of a layer opened by openLayer. It records
+// the TOC of the layer and reads with the dictionary of the layer.
+type dictDecompressor struct {
+	*Decompressor
+	toc  *estargz.JTOC
+	dict []byte
+}
+
+func (d *dictDecompressor) ParseTOC(r io.Reader) (*estargz.JTOC, digest.Digest, error) {
+	toc, tocDgst, err := d.Decompressor.ParseTOC(r)
+	if err == nil {
+		d.toc = toc
+	}
+	return toc, tocDgst, err
+}
+
+func (d *dictDecompressor) Reader(r io.Reader) (io.ReadCloser, error) {
+	return newReader(r, d.dict)
+}
+
+// newReader returns a reader of the compressor selected in the compression package,
+// decompressing with dict if it's not nil
+func newReader(r io.Reader, dict []byte) (io.ReadCloser, error) {
+	compressor := compzstd.GetCompressor()
+	if dict == nil {
+		return compressor.NewReader(r)
+	}
+	dc, ok := compressor.(compzstd.DictionaryCompressor)
+	if !ok {
+		return nil, fmt.Errorf("%s doesn't support dictionaries", compressor.Name())
+	}
+	return dc.NewReaderDict(r, dict)
+}
+
+// newWriter returns a writer of the compressor selected in the compression package,
+// compressing with dict if it's not nil
+func newWriter(w io.Writer, level int, dict []byte) (compzstd.WriteFlushCloser, error) {
+	compressor := compzstd.GetCompressor()
+	if dict == nil {
+		return compressor.NewWriter(w, level)
+	}
+	dc, ok := compressor.(compzstd.DictionaryCompressor)
+	if !ok {
+		return nil, fmt.Errorf("%s doesn't support dictionaries", compressor.Name())
+	}
+	return dc.NewWriterDict(w, level, dict)
+}
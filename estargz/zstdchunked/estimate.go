@@ -0,0 +1,73 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package zstdchunked
+
+import "io"
+
+const (
+	// defaultEstimatedRatio is the compression ratio assumed until a frame is compressed
+	defaultEstimatedRatio = 0.5
+
+	// tocEntryEstimate is the estimated compressed size of a TOC entry. Each file
+	// and chunk is compressed into its own frame, so frames count the entries.
+	tocEntryEstimate = 48
+)
+
+// outputEstimate records the sizes of the layer being built by a Compressor.
+type outputEstimate struct {
+	input       int64 // uncompressed bytes passed to the frames
+	frameInput  int64 // uncompressed bytes of the closed frames
+	frameOutput int64 // compressed bytes of the closed frames
+	frames      int64 // number of the closed frames
+	written     int64 // bytes of the finalised blobs
+	closed      bool  // Close has finalised the layer
+}
+
+func (e *outputEstimate) frameClosed(in, out int64) {
+	e.frameInput += in
+	e.frameOutput += out
+	e.frames++
+}
+
+// EstimatedOutputSize returns the estimated size of the layer being built by
+// AppendLayer: the data compressed so far, extrapolated at the compression ratio
+// of the completed frames, plus an estimate of the TOC and the footer. After Close,
+// it returns the exact number of bytes of the layer, including all its blobs if it
+// has been split by SplitAt, until the next AppendLayer.
+func (zc *Compressor) EstimatedOutputSize() int64 {
+	e := &zc.estimate
+	if e.closed {
+		return e.written
+	}
+	ratio := defaultEstimatedRatio
+	if e.frameInput > 0 {
+		ratio = float64(e.frameOutput) / float64(e.frameInput)
+	}
+	return int64(float64(e.input)*ratio) + e.frames*tocEntryEstimate + FooterSize
+}
+
+// countWriter counts the bytes written to w.
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,286 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package zstdchunked
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+)
+
+// ExtractTo extracts the zstd:chunked layer r into the directory dir without
+// mounting it. Regular files, directories, symlinks, hardlinks, fifos and devices
+// are created with the mode, ownership and modification time recorded in the TOC.
+// Ownership is only restored and devices are only created when the caller has the
+// privilege to do so. Fifos and devices are skipped on Windows.
+//
+// r must also implement Size() int64 (e.g. *io.SectionReader, *bytes.Reader).
+func (zz *Decompressor) ExtractTo(ctx context.Context, dir string, r io.ReaderAt) error {
+	sr, err := newSectionReader(r)
+	if err != nil {
+		return err
+	}
+	er, toc, err := zz.openLayer(sr)
+	if err != nil {
+		return err
+	}
+
+	// Directories are finalized after their contents are written because
+	// creating children updates the modification time of the parent.
+	type dirAttr struct {
+		path    string
+		modTime time.Time
+	}
+	var dirs []dirAttr
+	for _, ent := range toc.Entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if ent.Type == "chunk" {
+			continue
+		}
+		name := cleanExtractPath(ent.Name)
+		if name == estargz.PrefetchLandmark || name == estargz.NoPrefetchLandmark {
+			continue
+		}
+		target := filepath.Join(dir, name)
+		if err := mkdirNoSymlink(dir, filepath.Dir(name)); err != nil {
+			return fmt.Errorf("failed to create parent of %q: %w", ent.Name, err)
+		}
+		// ParseTOC doesn't populate the fields implicit in the JSON.
+		modTime, _ := time.Parse(time.RFC3339, ent.ModTime3339)
+		mode := ent.Stat().Mode().Perm() | ent.Stat().Mode()&(os.ModeSetuid|os.ModeSetgid|os.ModeSticky)
+		// Replace whatever the previous entries created at target so that it isn't
+		// followed if it's a symlink.
+		if err := removeExisting(target, ent.Type == "dir"); err != nil {
+			return fmt.Errorf("failed to replace %q: %w", ent.Name, err)
+		}
+		switch ent.Type {
+		case "dir":
+			if name == "." {
+				continue
+			}
+			if err := os.Mkdir(target, mode); err != nil && !os.IsExist(err) {
+				return err
+			}
+			if err := lchown(target, ent.UID, ent.GID); err != nil {
+				return err
+			}
+			if err := os.Chmod(target, mode); err != nil {
+				return err
+			}
+			dirs = append(dirs, dirAttr{target, modTime})
+		case "reg":
+			fr, err := er.OpenFile(ent.Name)
+			if err != nil {
+				return fmt.Errorf("failed to open %q: %w", ent.Name, err)
+			}
+			if err := writeFile(target, fr, mode, ent.UID, ent.GID); err != nil {
+				return fmt.Errorf("failed to extract %q: %w", ent.Name, err)
+			}
+			if err := lchtimes(target, modTime); err != nil {
+				return err
+			}
+		case "symlink":
+			if err := os.Symlink(ent.LinkName, target); err != nil {
+				return err
+			}
+			if err := lchown(target, ent.UID, ent.GID); err != nil {
+				return err
+			}
+		case "hardlink":
+			// The link target must not be reached through a symlink either
+			src, err := pathNoSymlink(dir, cleanExtractPath(ent.LinkName))
+			if err != nil {
+				return fmt.Errorf("invalid link target of %q: %w", ent.Name, err)
+			}
+			if err := os.Link(src, target); err != nil {
+				return err
+			}
+			// attributes are shared with the link target
+		case "char", "block", "fifo":
+			created, err := mknod(target, ent.Type, mode, ent.DevMajor, ent.DevMinor)
+			if err != nil {
+				return fmt.Errorf("failed to create %q: %w", ent.Name, err)
+			} else if !created {
+				continue
+			}
+			if err := lchown(target, ent.UID, ent.GID); err != nil {
+				return err
+			}
+			if err := os.Chmod(target, mode); err != nil {
+				return err
+			}
+			if err := lchtimes(target, modTime); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unsupported type %q of entry %q", ent.Type, ent.Name)
+		}
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := lchtimes(dirs[i].path, dirs[i].modTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openTOC parses the TOC of the zstd:chunked blob r and returns it with its offset.
+func (zz *Decompressor) openTOC(r io.ReaderAt) (*io.SectionReader, int64, *estargz.JTOC, error) {
+	sr, err := newSectionReader(r)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	if sr.Size() < FooterSize {
+		return nil, 0, nil, fmt.Errorf("blob is too small; %d < %d", sr.Size(), FooterSize)
+	}
+	footer := make([]byte, FooterSize)
+	if _, err := sr.ReadAt(footer, sr.Size()-FooterSize); err != nil {
+		return nil, 0, nil, fmt.Errorf("failed to read footer: %w", err)
+	}
+	_, tocOff, tocSize, err := zz.ParseFooter(footer)
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("failed to parse footer: %w", err)
+	}
+	toc, _, err := zz.ParseTOC(io.NewSectionReader(sr, tocOff, tocSize))
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	return sr, tocOff, toc, nil
+}
+
+// newSectionReader returns a reader of the whole blob r.
+// r must implement Size() int64.
+func newSectionReader(r io.ReaderAt) (*io.SectionReader, error) {
+	s, ok := r.(interface{ Size() int64 })
+	if !ok {
+		return nil, fmt.Errorf("size of the blob is unknown")
+	}
+	return io.NewSectionReader(r, 0, s.Size()), nil
+}
+
+// cleanExtractPath returns the path of a TOC entry name relative to the
+// extraction root. Names can't point outside of the root.
+func cleanExtractPath(name string) string {
+	p := path.Clean("/" + name)[1:]
+	if p == "" {
+		return "."
+	}
+	return filepath.FromSlash(p)
+}
+
+// mkdirNoSymlink creates the directory rel under root, refusing to traverse
+// symlinks so that entries can't be written outside of root.
+func mkdirNoSymlink(root, rel string) error {
+	cur := root
+	for _, c := range strings.Split(rel, string(filepath.Separator)) {
+		if c == "." || c == "" {
+			continue
+		}
+		cur = filepath.Join(cur, c)
+		fi, err := os.Lstat(cur)
+		if os.IsNotExist(err) {
+			if err := os.Mkdir(cur, 0755); err != nil {
+				return err
+			}
+			continue
+		} else if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			return fmt.Errorf("%q is not a directory", cur)
+		}
+	}
+	return nil
+}
+
+// pathNoSymlink returns the path of rel under root, refusing to traverse symlinks
+// so that it can't resolve outside of root.
+func pathNoSymlink(root, rel string) (string, error) {
+	cur := root
+	for _, c := range strings.Split(filepath.Dir(rel), string(filepath.Separator)) {
+		if c == "." || c == "" {
+			continue
+		}
+		cur = filepath.Join(cur, c)
+		fi, err := os.Lstat(cur)
+		if err != nil {
+			return "", err
+		}
+		if !fi.IsDir() {
+			return "", fmt.Errorf("%q is not a directory", cur)
+		}
+	}
+	return filepath.Join(root, rel), nil
+}
+
+// removeExisting removes the file at target if any. A directory is kept if keepDir
+// is true.
+func removeExisting(target string, keepDir bool) error {
+	fi, err := os.Lstat(target)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if keepDir && fi.IsDir() {
+		return nil
+	}
+	return os.RemoveAll(target)
+}
+
+// writeFile creates the regular file target with the contents of r. It fails if
+// target exists, so that a symlink at target isn't followed. The ownership and mode
+// are set through the opened file.
+func writeFile(target string, r io.Reader, mode os.FileMode, uid, gid int) error {
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY|oNoFollow, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	// Chown clears the setuid and setgid bits, so it precedes Chmod
+	if err := f.Chown(uid, gid); err != nil && !errors.Is(err, os.ErrPermission) {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(mode); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// lchown changes the ownership of path without following a symlink. It's skipped if
+// the caller doesn't have the privilege to do so.
+func lchown(path string, uid, gid int) error {
+	if err := os.Lchown(path, uid, gid); err != nil && !errors.Is(err, os.ErrPermission) {
+		return err
+	}
+	return nil
+}
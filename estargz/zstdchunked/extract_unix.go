@@ -0,0 +1,56 @@
+//go:build !windows
+// +build !windows
+
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package zstdchunked
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// oNoFollow makes opening a symlink fail
+const oNoFollow = unix.O_NOFOLLOW
+
+// lchtimes sets the access and modification times of path to t without following
+// a symlink.
+func lchtimes(path string, t time.Time) error {
+	ts := unix.NsecToTimespec(t.UnixNano())
+	return unix.UtimesNanoAt(unix.AT_FDCWD, path, []unix.Timespec{ts, ts}, unix.AT_SYMLINK_NOFOLLOW)
+}
+
+// mknod creates the fifo or the character or block device typ at path. It returns
+// false without creating a device if the caller doesn't have the privilege to do so.
+func mknod(path, typ string, mode os.FileMode, major, minor int) (bool, error) {
+	if typ == "fifo" {
+		return true, unix.Mkfifo(path, uint32(mode.Perm()))
+	}
+	kind := uint32(unix.S_IFCHR)
+	if typ == "block" {
+		kind = unix.S_IFBLK
+	}
+	if err := mknodDev(path, kind|uint32(mode.Perm()), unix.Mkdev(uint32(major), uint32(minor))); errors.Is(err, os.ErrPermission) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,36 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package zstdchunked
+
+import (
+	"os"
+	"time"
+)
+
+// oNoFollow is 0 as Windows has no O_NOFOLLOW. O_EXCL still refuses an existing
+// symlink.
+const oNoFollow = 0
+
+// lchtimes sets the access and modification times of path to t.
+func lchtimes(path string, t time.Time) error {
+	return os.Chtimes(path, t, t)
+}
+
+// mknod doesn't create fifos and devices, which Windows doesn't have.
+func mknod(path, typ string, mode os.FileMode, major, minor int) (bool, error) {
+	return false, nil
+}
@@ -0,0 +1,123 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package zstdchunked
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	digest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// ManifestPositionAnnotationV2 is an annotation that contains the positions of the TOCs
+// of a layer split into multiple blobs, as a JSON array of BlobPosition. It's produced
+// only for multi-blob layers. ManifestPositionAnnotation is kept for the first blob.
+const ManifestPositionAnnotationV2 = "io.containers.zstd-chunked.manifest-position.v2"
+
+// BlobPosition is the position of the TOC in a blob of a zstd:chunked layer.
+type BlobPosition struct {
+	// Digest is the digest of the blob. Empty if parsed from ManifestPositionAnnotation.
+	Digest digest.Digest `json:"digest,omitempty"`
+
+	// Offset is the offset of the compressed TOC in the blob.
+	Offset int64 `json:"offset"`
+
+	// Size is the size of the compressed TOC.
+	Size int64 `json:"size"`
+}
+
+// ParseManifestPosition returns the TOC positions recorded in the annotations of a
+// layer. ManifestPositionAnnotationV2 is used if present, otherwise the single blob
+// described by ManifestPositionAnnotation is returned. The version is detected here
+// rather than in ParseFooter, which only receives the footer of a blob.
+func (zz *Decompressor) ParseManifestPosition(annotations map[string]string) ([]BlobPosition, error) {
+	if v, ok := annotations[ManifestPositionAnnotationV2]; ok {
+		return ParseManifestPositionV2(v)
+	}
+	if v, ok := annotations[ManifestPositionAnnotation]; ok {
+		pos, err := ParseManifestPositionV1(v)
+		if err != nil {
+			return nil, err
+		}
+		return []BlobPosition{pos}, nil
+	}
+	return nil, fmt.Errorf("manifest position annotation not found")
+}
+
+// ParseManifestPositionV1 parses the value of ManifestPositionAnnotation
+// ("offset:size:uncompressedSize:manifestType").
+func ParseManifestPositionV1(v string) (BlobPosition, error) {
+	parts := strings.Split(v, ":")
+	if len(parts) != 4 {
+		return BlobPosition{}, fmt.Errorf("invalid manifest position %q", v)
+	}
+	offset, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return BlobPosition{}, fmt.Errorf("invalid manifest offset in %q: %w", v, err)
+	}
+	size, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return BlobPosition{}, fmt.Errorf("invalid manifest size in %q: %w", v, err)
+	}
+	return BlobPosition{Offset: offset, Size: size}, nil
+}
+
+// ParseManifestPositionV2 parses the value of ManifestPositionAnnotationV2.
+func ParseManifestPositionV2(v string) ([]BlobPosition, error) {
+	var positions []BlobPosition
+	if err := json.Unmarshal([]byte(v), &positions); err != nil {
+		return nil, fmt.Errorf("invalid manifest positions: %w", err)
+	}
+	if len(positions) == 0 {
+		return nil, fmt.Errorf("manifest positions are empty")
+	}
+	for i, p := range positions {
+		if err := p.Digest.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid digest of blob %d: %w", i, err)
+		}
+	}
+	return positions, nil
+}
+
+// ManifestAnnotations returns the position and the digest of the compressed TOC recorded
+// in the ManifestPositionAnnotation and ManifestChecksumAnnotation annotations of the
+// layer desc.
+func ManifestAnnotations(desc ocispec.Descriptor) (tocOffset int64, tocSize int64, checksum digest.Digest, err error) {
+	position, ok := desc.Annotations[ManifestPositionAnnotation]
+	if !ok {
+		return 0, 0, "", fmt.Errorf("annotation %q not found", ManifestPositionAnnotation)
+	}
+	pos, err := ParseManifestPositionV1(position)
+	if err != nil {
+		return 0, 0, "", err
+	}
+	if pos.Offset < 0 || pos.Size <= 0 {
+		return 0, 0, "", fmt.Errorf("invalid manifest position %q", position)
+	}
+	v, ok := desc.Annotations[ManifestChecksumAnnotation]
+	if !ok {
+		return 0, 0, "", fmt.Errorf("annotation %q not found", ManifestChecksumAnnotation)
+	}
+	checksum, err = digest.Parse(v)
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("invalid manifest checksum %q: %w", v, err)
+	}
+	return pos.Offset, pos.Size, checksum, nil
+}
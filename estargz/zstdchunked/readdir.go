@@ -0,0 +1,66 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package zstdchunked
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+)
+
+// ReadDir returns the entries of the directory name in the zstd:chunked layer r,
+// sorted by name, without extracting the layer. The information of the entries
+// comes from the TOC. Directories that only exist as parents of deeper entries
+// are listed as directories with mode 0755.
+//
+// r must also implement Size() int64 (e.g. *io.SectionReader, *bytes.Reader).
+func (zz *Decompressor) ReadDir(name string, r io.ReaderAt) ([]fs.DirEntry, error) {
+	sr, err := newSectionReader(r)
+	if err != nil {
+		return nil, err
+	}
+	er, err := estargz.Open(sr, estargz.WithDecompressors(zz))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open layer: %w", err)
+	}
+	dir, ok := er.Lookup(name)
+	if !ok {
+		return nil, fmt.Errorf("directory %q not found", name)
+	}
+	if dir.Type != "dir" {
+		return nil, fmt.Errorf("%q is not a directory", name)
+	}
+	var entries []fs.DirEntry
+	dir.ForeachChild(func(baseName string, ent *estargz.TOCEntry) bool {
+		// Hardlinks are the entries of their targets, which have another name
+		entries = append(entries, fs.FileInfoToDirEntry(namedFileInfo{ent.Stat(), baseName}))
+		return true
+	})
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// namedFileInfo is the information of a file under another name
+type namedFileInfo struct {
+	fs.FileInfo
+	name string
+}
+
+func (fi namedFileInfo) Name() string { return fi.name }
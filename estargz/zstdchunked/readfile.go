@@ -0,0 +1,213 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package zstdchunked
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"runtime"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+	"golang.org/x/sync/errgroup"
+)
+
+// ReadFileAt reads length bytes at offset off of the regular file name in the
+// zstd:chunked layer r. Only the chunks overlapping the range are decompressed,
+// in parallel. The range is truncated at the end of the file.
+//
+// r must also implement Size() int64 (e.g. *io.SectionReader, *bytes.Reader).
+func (zz *Decompressor) ReadFileAt(name string, off, length int64, r io.ReaderAt) ([]byte, error) {
+	if off < 0 || length < 0 {
+		return nil, fmt.Errorf("invalid range (off:%d,length:%d)", off, length)
+	}
+	er, ent, err := zz.openRegularFile(name, r)
+	if err != nil {
+		return nil, err
+	}
+	if off > ent.Size {
+		return nil, fmt.Errorf("offset %d exceeds the size of %q (%d)", off, name, ent.Size)
+	}
+	end := off + length
+	if end > ent.Size {
+		end = ent.Size
+	}
+	buf := make([]byte, end-off)
+	if len(buf) == 0 {
+		return buf, nil
+	}
+	fr, err := er.OpenFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %q: %w", name, err)
+	}
+
+	var eg errgroup.Group
+	eg.SetLimit(runtime.GOMAXPROCS(0))
+	for cur := off; cur < end; {
+		chunk, ok := er.ChunkEntryForOffset(name, cur)
+		if !ok {
+			return nil, fmt.Errorf("no chunk of %q at offset %d", name, cur)
+		}
+		chunkEnd := chunk.ChunkOffset + chunk.ChunkSize
+		if chunkEnd > end {
+			chunkEnd = end
+		}
+		start := cur
+		eg.Go(func() error {
+			// Read within a single chunk so only that chunk gets decompressed.
+			if n, err := fr.ReadAt(buf[start-off:chunkEnd-off], start); int64(n) < chunkEnd-start {
+				if err == nil || err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				return fmt.Errorf("failed to read %q (off:%d,size:%d): %w", name, start, chunkEnd-start, err)
+			}
+			return nil
+		})
+		cur = chunkEnd
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// StreamFile returns a reader of the regular file name in the zstd:chunked layer r.
+// Chunks are read from r and decompressed one at a time as the caller reads, so
+// only a single chunk of the file is held in memory.
+//
+// r must also implement Size() int64 (e.g. *io.SectionReader, *bytes.Reader).
+func (zz *Decompressor) StreamFile(name string, r io.ReaderAt) (io.ReadCloser, error) {
+	er, ent, err := zz.openRegularFile(name, r)
+	if err != nil {
+		return nil, err
+	}
+	fr, err := er.OpenFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %q: %w", name, err)
+	}
+	return &fileStream{er: er, fr: fr, name: name, size: ent.Size}, nil
+}
+
+// openRegularFile opens the zstd:chunked layer r and looks up the regular file name.
+// The layer is opened once and reused while r is the same reader.
+func (zz *Decompressor) openRegularFile(name string, r io.ReaderAt) (*estargz.Reader, *estargz.TOCEntry, error) {
+	er, err := zz.cachedLayer(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	ent, ok := er.Lookup(name)
+	if !ok {
+		return nil, nil, fmt.Errorf("file %q not found", name)
+	}
+	if ent.Type != "reg" {
+		return nil, nil, fmt.Errorf("%q is not a regular file", name)
+	}
+	return er, ent, nil
+}
+
+// cachedLayer returns the layer r opened by openLayer, reusing the one most
+// recently opened if it's from r
+func (zz *Decompressor) cachedLayer(r io.ReaderAt) (*estargz.Reader, error) {
+	// Readers of uncomparable types (e.g. structs with slices) are never reused
+	reusable := r != nil && reflect.TypeOf(r).Comparable()
+	zz.mu.Lock()
+	er := zz.layer
+	if !reusable || zz.layerR != r {
+		er = nil
+	}
+	zz.mu.Unlock()
+	if er != nil {
+		return er, nil
+	}
+	sr, err := newSectionReader(r)
+	if err != nil {
+		return nil, err
+	}
+	er, _, err = zz.openLayer(sr)
+	if err != nil {
+		return nil, err
+	}
+	if reusable {
+		zz.mu.Lock()
+		zz.layerR, zz.layer = r, er
+		zz.mu.Unlock()
+	}
+	return er, nil
+}
+
+// fileStream reads a file sequentially, chunk by chunk.
+type fileStream struct {
+	er   *estargz.Reader
+	fr   io.ReaderAt
+	name string
+	size int64
+
+	off    int64  // offset of the next chunk in the file
+	chunk  []byte // buffer of the current chunk, reused for the next one
+	unread []byte // part of chunk not read yet
+	closed bool
+}
+
+func (s *fileStream) Read(p []byte) (int, error) {
+	if s.closed {
+		return 0, os.ErrClosed
+	}
+	if len(s.unread) == 0 {
+		if s.off >= s.size {
+			return 0, io.EOF
+		}
+		if err := s.nextChunk(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, s.unread)
+	s.unread = s.unread[n:]
+	return n, nil
+}
+
+func (s *fileStream) nextChunk() error {
+	ent, ok := s.er.ChunkEntryForOffset(s.name, s.off)
+	if !ok {
+		return fmt.Errorf("no chunk of %q at offset %d", s.name, s.off)
+	}
+	end := ent.ChunkOffset + ent.ChunkSize
+	if end > s.size {
+		end = s.size
+	}
+	size := int(end - s.off)
+	if cap(s.chunk) < size {
+		s.chunk = make([]byte, size)
+	}
+	s.chunk = s.chunk[:size]
+	// Read within a single chunk so only that chunk gets decompressed.
+	if n, err := s.fr.ReadAt(s.chunk, s.off); n < size {
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return fmt.Errorf("failed to read %q (off:%d,size:%d): %w", s.name, s.off, size, err)
+	}
+	s.unread = s.chunk
+	s.off = end
+	return nil
+}
+
+func (s *fileStream) Close() error {
+	s.closed = true
+	s.chunk, s.unread = nil, nil
+	return nil
+}
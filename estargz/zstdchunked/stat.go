@@ -0,0 +1,106 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package zstdchunked
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"time"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+)
+
+// Stat returns the information of the entry name in the TOC most recently parsed
+// by zz. The entries are indexed by path on the first call after the TOC is parsed
+// so that the following calls don't scan the TOC. Hardlinks are resolved to their
+// targets and parent directories without entries are reported with mode 0755.
+func (zz *Decompressor) Stat(name string) (fs.FileInfo, error) {
+	zz.mu.Lock()
+	defer zz.mu.Unlock()
+	if zz.toc == nil {
+		return nil, fmt.Errorf("no TOC has been parsed")
+	}
+	if zz.index == nil {
+		zz.index = indexTOC(zz.toc)
+	}
+	fi, ok := zz.index[cleanTOCName(name)]
+	if ok && fi.entry.Type == "hardlink" {
+		fi, ok = zz.index[cleanTOCName(fi.entry.LinkName)]
+	}
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return fi, nil
+}
+
+// indexTOC maps the cleaned names of the entries of toc, and their parent
+// directories, to their information
+func indexTOC(toc *estargz.JTOC) map[string]tocFileInfo {
+	index := make(map[string]tocFileInfo, len(toc.Entries))
+	for _, ent := range toc.Entries {
+		if ent.Type == "chunk" {
+			continue
+		}
+		// ParseTOC doesn't populate the fields implicit in the JSON.
+		modTime, _ := time.Parse(time.RFC3339, ent.ModTime3339)
+		name := cleanTOCName(ent.Name)
+		index[name] = tocFileInfo{FileInfo: ent.Stat(), entry: ent, name: name, modTime: modTime}
+		for dir := parentTOCDir(name); ; dir = parentTOCDir(dir) {
+			if _, ok := index[dir]; ok {
+				break
+			}
+			implicit := &estargz.TOCEntry{Name: dir, Type: "dir", Mode: 0755}
+			index[dir] = tocFileInfo{FileInfo: implicit.Stat(), entry: implicit, name: dir}
+			if dir == "" {
+				break
+			}
+		}
+	}
+	return index
+}
+
+// cleanTOCName returns the path of a TOC entry name relative to the root,
+// which is "".
+func cleanTOCName(name string) string {
+	return path.Clean("/" + name)[1:]
+}
+
+func parentTOCDir(name string) string {
+	dir := path.Dir(name)
+	if dir == "." {
+		return ""
+	}
+	return dir
+}
+
+// tocFileInfo is the fs.FileInfo of a TOC entry
+type tocFileInfo struct {
+	fs.FileInfo
+	entry   *estargz.TOCEntry
+	name    string
+	modTime time.Time
+}
+
+func (fi tocFileInfo) Name() string {
+	if fi.name == "" {
+		return "/"
+	}
+	return path.Base(fi.name)
+}
+
+func (fi tocFileInfo) ModTime() time.Time { return fi.modTime }
@@ -24,6 +24,8 @@ import (
 	"fmt"
 	"hash"
 	"io"
+	"math"
+	"sync"
 
 	compzstd "github.com/containerd/stargz-snapshotter/compression/zstd"
 	"github.com/containerd/stargz-snapshotter/estargz"
@@ -38,6 +40,10 @@ const (
 	// ManifestPositionAnnotation is an annotation that contains the offset to the TOC.
 	ManifestPositionAnnotation = "io.containers.zstd-chunked.manifest-position"
 
+	// PriorityFilesAnnotation is a TOC annotation that contains the prioritized files
+	// (see estargz.WithPrioritizedFiles) as a JSON array in the prefetch order.
+	PriorityFilesAnnotation = "io.containers.zstd-chunked/priority-files"
+
 	// FooterSize is the size of the footer
 	FooterSize = 40
 
@@ -50,11 +56,29 @@ var (
 	zstdChunkedFrameMagic = []byte{0x47, 0x6e, 0x55, 0x6c, 0x49, 0x6e, 0x55, 0x78}
 )
 
-type Decompressor struct{}
+type Decompressor struct {
+	mu            sync.Mutex
+	priorityFiles []string
+
+	// toc is the TOC most recently parsed and index its entries for Stat,
+	// built on the first call
+	toc   *estargz.JTOC
+	index map[string]tocFileInfo
+
+	// dict is the dictionary set by SetDictionary
+	dict []byte
+
+	// layer is the layer most recently opened by ReadFileAt or StreamFile from
+	// layerR, reused while they are called with the same reader
+	layerR io.ReaderAt
+	layer  *estargz.Reader
+}
 
 func (zz *Decompressor) Reader(r io.Reader) (io.ReadCloser, error) {
-	compressor := compzstd.GetCompressor()
-	return compressor.NewReader(r)
+	zz.mu.Lock()
+	dict := zz.dict
+	zz.mu.Unlock()
+	return newReader(r, dict)
 }
 
 func (zz *Decompressor) ParseTOC(r io.Reader) (toc *estargz.JTOC, tocDgst digest.Digest, err error) {
@@ -69,9 +93,31 @@ func (zz *Decompressor) ParseTOC(r io.Reader) (toc *estargz.JTOC, tocDgst digest
 	if err := json.NewDecoder(io.TeeReader(zr, dgstr.Hash())).Decode(&toc); err != nil {
 		return nil, "", fmt.Errorf("error decoding TOC JSON: %w", err)
 	}
+	var priorityFiles []string
+	if v, ok := toc.Annotations[PriorityFilesAnnotation]; ok {
+		if err := json.Unmarshal([]byte(v), &priorityFiles); err != nil {
+			return nil, "", fmt.Errorf("invalid %q annotation: %w", PriorityFilesAnnotation, err)
+		}
+	}
+	zz.mu.Lock()
+	zz.priorityFiles = priorityFiles
+	zz.toc, zz.index = toc, nil
+	zz.mu.Unlock()
 	return toc, dgstr.Digest(), nil
 }
 
+// PriorityFiles returns the prioritized files recorded in the TOC most recently
+// parsed by zz, in the prefetch order. Nil if the TOC doesn't record them.
+func (zz *Decompressor) PriorityFiles() []string {
+	zz.mu.Lock()
+	defer zz.mu.Unlock()
+	return append([]string(nil), zz.priorityFiles...)
+}
+
+// ParseFooter parses the footer p of a blob. The footer holds the position of the
+// TOC of its own blob only, so it's the same whether the layer is described by
+// ManifestPositionAnnotation or ManifestPositionAnnotationV2. The annotations aren't
+// available through the estargz.Decompressor interface; see ParseManifestPosition.
 func (zz *Decompressor) ParseFooter(p []byte) (blobPayloadSize, tocOffset, tocSize int64, err error) {
 	offset := binary.LittleEndian.Uint64(p[0:8])
 	compressedLength := binary.LittleEndian.Uint64(p[8:16])
@@ -112,58 +158,315 @@ type Compressor struct {
 	CompressionLevel zstd.EncoderLevel
 	Metadata         map[string]string
 
+	// Output is the destination of the layer built by AppendLayer.
+	Output io.Writer
+
 	// Note: Pool functionality removed as our compression interface handles its own resource management
+
+	layer       *estargz.Writer
+	blob        *blobWriter
+	blobFactory func() (io.WriteCloser, error)
+	prevBlob    digest.Digest
+
+	// skippable frames written before the TOC, in registration order
+	skippableFrames []skippableFrame
+
+	// dict is the dictionary set by WithDictionary
+	dict []byte
+
+	// hashAlgorithm is the algorithm set by WithHashAlgorithm
+	hashAlgorithm digest.Algorithm
+
+	// hashWorkers is the number of goroutines set by WithConcurrentHasher
+	hashWorkers int
+
+	// positions of the TOCs of the blobs finalised so far, and the V1 annotations
+	// of the first one
+	positions     []BlobPosition
+	firstPosition string
+	firstChecksum string
+	lastTOC       BlobPosition
+
+	// sizes of the layer reported by EstimatedOutputSize
+	estimate outputEstimate
 }
 
-func (zc *Compressor) Writer(w io.Writer) (estargz.WriteFlushCloser, error) {
-	compressor := compzstd.GetCompressor()
-	// Convert klauspost encoder level to integer compression level
-	// EncoderLevelFromZstd converts zstd levels to encoder levels, so we need the reverse
-	level := int(zc.CompressionLevel)
-	if zc.CompressionLevel == zstd.SpeedFastest {
-		level = 1
-	} else if zc.CompressionLevel == zstd.SpeedDefault {
-		level = 3
-	} else if zc.CompressionLevel == zstd.SpeedBetterCompression {
-		level = 7
-	} else if zc.CompressionLevel == zstd.SpeedBestCompression {
-		level = 11
+// WithBlobFactory sets fn as the source of the blobs that the layer continues to
+// be written to after SplitAt. zc is returned for convenience.
+func (zc *Compressor) WithBlobFactory(fn func() (io.WriteCloser, error)) *Compressor {
+	zc.blobFactory = fn
+	return zc
+}
+
+// WithHashAlgorithm selects the algorithm of the digests of the regular files and
+// their chunks in the TOC, SHA-256 by default. Writing the layer fails if alg isn't
+// available (e.g. an unknown name). Readers detect the algorithm from the digests.
+// zc is returned for convenience.
+func (zc *Compressor) WithHashAlgorithm(alg digest.Algorithm) *Compressor {
+	zc.hashAlgorithm = alg
+	return zc
+}
+
+// DigestAlgorithm returns the algorithm selected by WithHashAlgorithm. It makes
+// estargz.Writer use it for the digests in the TOC.
+func (zc *Compressor) DigestAlgorithm() digest.Algorithm {
+	if zc.hashAlgorithm == "" {
+		return digest.Canonical
 	}
-	
-	writer, err := compressor.NewWriter(w, level)
+	return zc.hashAlgorithm
+}
+
+// WithConcurrentHasher makes estargz.Writer compute the digests of the chunks on
+// workers goroutines while the next chunks are compressed, instead of on the
+// compressing goroutine. The digest of each file is also computed off it. Each chunk
+// is buffered until hashed, so up to about 2*workers chunks are held in memory.
+// The digests are collected before the TOC is written, so the layer is the same as
+// with serial hashing. workers <= 1 means serial hashing. zc is returned for
+// convenience.
+func (zc *Compressor) WithConcurrentHasher(workers int) *Compressor {
+	zc.hashWorkers = workers
+	return zc
+}
+
+// ConcurrentHashWorkers returns the number of goroutines set by WithConcurrentHasher.
+// It makes estargz.Writer hash the chunks on them.
+func (zc *Compressor) ConcurrentHashWorkers() int {
+	return zc.hashWorkers
+}
+
+// skippableFrame is a frame registered by WithSkippableFrame
+type skippableFrame struct {
+	id byte
+	fn func() []byte
+}
+
+// WithSkippableFrame registers fn to generate the contents of a zstd skippable frame
+// once the data of a blob is written. The frame is placed before the TOC frame with
+// the magic number 0x184D2A50 + id, so id must be in range 0x0-0xF. fn is called
+// each time a blob is finalised; nothing is written if it returns nil. zc is
+// returned for convenience.
+func (zc *Compressor) WithSkippableFrame(id byte, fn func() []byte) *Compressor {
+	zc.skippableFrames = append(zc.skippableFrames, skippableFrame{id, fn})
+	return zc
+}
+
+// AppendLayer appends the entries of the tar stream r to the layer being built
+// into zc.Output, compressing them with zc and extending the in-progress TOC.
+// Call Close after the last layer to write the TOC covering all appended entries.
+func (zc *Compressor) AppendLayer(r io.Reader) error {
+	if zc.layer == nil {
+		if zc.Output == nil {
+			return fmt.Errorf("output of the layer must be specified")
+		}
+		zc.estimate = outputEstimate{}
+		zc.startBlob(zc.Output, nil)
+	}
+	return zc.layer.AppendTar(r)
+}
+
+// SplitAt splits the layer being built by AppendLayer if at least offset bytes
+// have been written to the current blob (so SplitAt(0) always splits). The current
+// blob is finalised with its own TOC and footer, and the following appended
+// entries are written to a new blob obtained from the factory set by
+// WithBlobFactory. Blobs are split only between AppendLayer calls.
+//
+// The TOC of each blob but the first records the digest of the preceding blob as
+// PrevBlobDigest. The first blob is the one written to zc.Output, which the layer
+// descriptor refers to; the following ones are found by their PrevBlobDigest or
+// the ManifestPositionAnnotationV2 annotation.
+func (zc *Compressor) SplitAt(offset int64) error {
+	if zc.layer == nil {
+		return fmt.Errorf("no layer has been appended")
+	}
+	if zc.blobFactory == nil {
+		return fmt.Errorf("blob factory must be specified for splitting the layer")
+	}
+	if zc.blob.n < offset {
+		return nil
+	}
+	if _, err := zc.finishBlob(); err != nil {
+		return err
+	}
+	w, err := zc.blobFactory()
+	if err != nil {
+		return fmt.Errorf("failed to create the next blob: %w", err)
+	}
+	zc.startBlob(w, w)
+	return nil
+}
+
+// Close writes the TOC and footer of the layer built by AppendLayer and returns
+// the digest of the TOC. If the layer has been split by SplitAt, this finalises
+// the main blob. zc can build another layer afterwards.
+func (zc *Compressor) Close() (digest.Digest, error) {
+	if zc.layer == nil {
+		return "", fmt.Errorf("no layer has been appended")
+	}
+	defer func() {
+		zc.layer, zc.blob, zc.prevBlob = nil, nil, ""
+		zc.positions, zc.firstPosition, zc.firstChecksum = nil, "", ""
+	}()
+	tocDgst, err := zc.finishBlob()
+	if err != nil {
+		return "", err
+	}
+	zc.estimate.closed = true
+	if zc.Metadata != nil && len(zc.positions) > 1 {
+		v, err := json.Marshal(zc.positions)
+		if err != nil {
+			return "", err
+		}
+		zc.Metadata[ManifestPositionAnnotationV2] = string(v)
+		// The V1 annotations describe the first blob, for V1 readers
+		zc.Metadata[ManifestPositionAnnotation] = zc.firstPosition
+		zc.Metadata[ManifestChecksumAnnotation] = zc.firstChecksum
+	}
+	return tocDgst, nil
+}
+
+func (zc *Compressor) startBlob(w io.Writer, closer io.Closer) {
+	zc.blob = &blobWriter{w: w, closer: closer, digester: digest.Canonical.Digester()}
+	zc.layer = estargz.NewWriterWithCompressor(zc.blob, zc)
+}
+
+// finishBlob writes the TOC and footer of the current blob and closes it.
+func (zc *Compressor) finishBlob() (digest.Digest, error) {
+	tocDgst, err := zc.layer.Close()
+	if err != nil {
+		return "", err
+	}
+	zc.prevBlob = zc.blob.digester.Digest()
+	zc.estimate.written += zc.blob.n
+	pos := zc.lastTOC
+	pos.Digest = zc.prevBlob
+	if len(zc.positions) == 0 {
+		zc.firstPosition = zc.Metadata[ManifestPositionAnnotation]
+		zc.firstChecksum = zc.Metadata[ManifestChecksumAnnotation]
+	}
+	zc.positions = append(zc.positions, pos)
+	if zc.blob.closer != nil {
+		if err := zc.blob.closer.Close(); err != nil {
+			return "", err
+		}
+	}
+	return tocDgst, nil
+}
+
+// blobWriter counts and digests the bytes written to a blob.
+type blobWriter struct {
+	w        io.Writer
+	closer   io.Closer
+	n        int64
+	digester digest.Digester
+}
+
+func (b *blobWriter) Write(p []byte) (int, error) {
+	n, err := b.w.Write(p)
+	b.n += int64(n)
+	b.digester.Hash().Write(p[:n])
+	return n, err
+}
+
+// Level returns the zstd compression level passed to the compressor selected in the
+// compression package. The klauspost encoder levels map to the zstd levels they
+// approximate; other values of CompressionLevel are used as zstd levels as-is.
+func (zc *Compressor) Level() int {
+	switch zc.CompressionLevel {
+	case zstd.SpeedFastest:
+		return 1
+	case zstd.SpeedDefault:
+		return 3
+	case zstd.SpeedBetterCompression:
+		return 7
+	case zstd.SpeedBestCompression:
+		return 11
+	}
+	return int(zc.CompressionLevel)
+}
+
+func (zc *Compressor) Writer(w io.Writer) (estargz.WriteFlushCloser, error) {
+	cw := &countWriter{w: w}
+	writer, err := newWriter(cw, zc.Level(), zc.dict)
 	if err != nil {
 		return nil, err
 	}
 	// Convert WriteFlushCloser to estargz.WriteFlushCloser
-	return writeFlushCloserAdapter{writer}, nil
+	return &writeFlushCloserAdapter{WriteFlushCloser: writer, estimate: &zc.estimate, out: cw}, nil
 }
 
 // writeFlushCloserAdapter adapts our compression WriteFlushCloser to estargz.WriteFlushCloser
+// and records the sizes of the frame in estimate
 type writeFlushCloserAdapter struct {
 	compzstd.WriteFlushCloser
+	estimate *outputEstimate
+	out      *countWriter
+	in       int64
+}
+
+func (a *writeFlushCloserAdapter) Write(p []byte) (int, error) {
+	n, err := a.WriteFlushCloser.Write(p)
+	a.in += int64(n)
+	a.estimate.input += int64(n)
+	return n, err
+}
+
+func (a *writeFlushCloserAdapter) Close() error {
+	if err := a.WriteFlushCloser.Close(); err != nil {
+		return err
+	}
+	a.estimate.frameClosed(a.in, a.out.n)
+	return nil
 }
 
 func (zc *Compressor) WriteTOCAndFooter(w io.Writer, off int64, toc *estargz.JTOC, diffHash hash.Hash) (digest.Digest, error) {
-	tocJSON, err := json.MarshalIndent(toc, "", "\t")
+	for _, f := range zc.skippableFrames {
+		if f.id > 0xF {
+			return "", fmt.Errorf("invalid skippable frame id %#x: must be in range 0x0-0xF", f.id)
+		}
+		b := f.fn()
+		if b == nil {
+			continue
+		}
+		if uint64(len(b)) > math.MaxUint32 {
+			return "", fmt.Errorf("skippable frame %#x is too large: %d bytes", f.id, len(b))
+		}
+		frame := appendSkippableFrameMagic(b)
+		frame[0] |= f.id
+		n, err := w.Write(frame)
+		if err != nil {
+			return "", err
+		}
+		if f.id == DictionaryFrameID {
+			// Readers locate the dictionary from the TOC instead of scanning the blob
+			if toc.Annotations == nil {
+				toc.Annotations = make(map[string]string)
+			}
+			// 8 is the size of the zstd skippable frame header + the frame size
+			toc.Annotations[DictionaryAnnotation] = fmt.Sprintf("%d:%d", off+8, len(b))
+		}
+		off += int64(n)
+	}
+	if zc.prevBlob != "" {
+		toc.PrevBlobDigest = zc.prevBlob
+	}
+	if files := prioritizedFiles(toc); len(files) > 0 {
+		v, err := json.Marshal(files)
+		if err != nil {
+			return "", err
+		}
+		if toc.Annotations == nil {
+			toc.Annotations = make(map[string]string)
+		}
+		toc.Annotations[PriorityFilesAnnotation] = string(v)
+	}
+	tocJSON, err := toc.Serialize()
 	if err != nil {
 		return "", err
 	}
 	buf := new(bytes.Buffer)
 	
 	compressor := compzstd.GetCompressor()
-	// Convert encoder level to integer
-	level := int(zc.CompressionLevel)
-	if zc.CompressionLevel == zstd.SpeedFastest {
-		level = 1
-	} else if zc.CompressionLevel == zstd.SpeedDefault {
-		level = 3
-	} else if zc.CompressionLevel == zstd.SpeedBetterCompression {
-		level = 7
-	} else if zc.CompressionLevel == zstd.SpeedBestCompression {
-		level = 11
-	}
-	
-	encoder, err := compressor.NewWriter(buf, level)
+	encoder, err := compressor.NewWriter(buf, zc.Level())
 	if err != nil {
 		return "", err
 	}
@@ -184,6 +487,7 @@ func (zc *Compressor) WriteTOCAndFooter(w io.Writer, off int64, toc *estargz.JTO
 		return "", err
 	}
 
+	zc.lastTOC = BlobPosition{Offset: int64(tocOff), Size: int64(len(compressedTOC))}
 	if zc.Metadata != nil {
 		zc.Metadata[ManifestChecksumAnnotation] = digest.FromBytes(compressedTOC).String()
 		zc.Metadata[ManifestPositionAnnotation] = fmt.Sprintf("%d:%d:%d:%d",
@@ -193,6 +497,22 @@ func (zc *Compressor) WriteTOCAndFooter(w io.Writer, off int64, toc *estargz.JTO
 	return digest.FromBytes(tocJSON), err
 }
 
+// prioritizedFiles returns the non-directory entries placed before the prefetch
+// landmark, in their order in the TOC.
+func prioritizedFiles(toc *estargz.JTOC) []string {
+	var files []string
+	for _, e := range toc.Entries {
+		if e.Name == estargz.PrefetchLandmark {
+			return files
+		}
+		if e.Type != "dir" && e.Type != "chunk" {
+			files = append(files, e.Name)
+		}
+	}
+	// No landmark means that no file is prioritized
+	return nil
+}
+
 // zstdFooterBytes returns the 40 bytes footer.
 func zstdFooterBytes(tocOff, tocRawSize, tocCompressedSize uint64) []byte {
 	footer := make([]byte, FooterSize)
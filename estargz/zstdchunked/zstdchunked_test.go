@@ -17,15 +17,30 @@
 package zstdchunked
 
 import (
+	"archive/tar"
 	"bytes"
+	"context"
+	crand "crypto/rand"
 	"crypto/sha256"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
 	"sort"
+	"strings"
 	"testing"
+	"time"
 
+	compzstd "github.com/containerd/stargz-snapshotter/compression/zstd"
 	"github.com/containerd/stargz-snapshotter/estargz"
 	"github.com/klauspost/compress/zstd"
+	digest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 // TestZstdChunked tests zstd:chunked
@@ -35,6 +50,9 @@ func TestZstdChunked(t *testing.T) {
 		zstdControllerWithLevel(zstd.SpeedDefault),
 		zstdControllerWithLevel(zstd.SpeedBetterCompression),
 		// zstdControllerWithLevel(zstd.SpeedBestCompression), // consumes too much memory to pass on CI
+		func() estargz.TestingController {
+			return &zstdController{(&Compressor{CompressionLevel: zstd.SpeedDefault}).WithConcurrentHasher(4), &Decompressor{}}
+		},
 	)
 }
 
@@ -50,6 +68,9 @@ type zstdController struct {
 }
 
 func (zc *zstdController) String() string {
+	if zc.hashWorkers > 0 {
+		return fmt.Sprintf("zstd_compression_level=%v,hash_workers=%d", zc.CompressionLevel, zc.hashWorkers)
+	}
 	return fmt.Sprintf("zstd_compression_level=%v", zc.CompressionLevel)
 }
 
@@ -165,3 +186,1660 @@ func checkZstdChunkedFooter(t *testing.T, off, size, cSize int64) {
 		t.Fatalf("ParseFooter(footerBytes(offset %d)) = size %d; want %d", off, gotSize, cSize)
 	}
 }
+
+// TestAppendLayer tests that a layer built from multiple tar streams has a TOC
+// covering all of them in order.
+func TestAppendLayer(t *testing.T) {
+	layers := [][]string{
+		{"a.txt", "b.txt"},
+		{"c.txt"},
+		{"d.txt", "e.txt", "f.txt"},
+	}
+
+	var blob bytes.Buffer
+	zc := &Compressor{CompressionLevel: zstd.SpeedDefault, Output: &blob}
+	var want []string
+	for i, names := range layers {
+		var tarBuf bytes.Buffer
+		tw := tar.NewWriter(&tarBuf)
+		for _, name := range names {
+			contents := fmt.Sprintf("layer %d: %s", i, name)
+			if err := tw.WriteHeader(&tar.Header{
+				Typeflag: tar.TypeReg,
+				Name:     name,
+				Mode:     0644,
+				Size:     int64(len(contents)),
+			}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tw.Write([]byte(contents)); err != nil {
+				t.Fatal(err)
+			}
+			want = append(want, name)
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := zc.AppendLayer(&tarBuf); err != nil {
+			t.Fatalf("failed to append layer %d: %v", i, err)
+		}
+	}
+	tocDgst, err := zc.Close()
+	if err != nil {
+		t.Fatalf("failed to close layer: %v", err)
+	}
+
+	b := blob.Bytes()
+	d := &Decompressor{}
+	_, tocOff, tocSize, err := d.ParseFooter(b[len(b)-FooterSize:])
+	if err != nil {
+		t.Fatalf("failed to parse footer: %v", err)
+	}
+	toc, gotDgst, err := d.ParseTOC(bytes.NewReader(b[tocOff : tocOff+tocSize]))
+	if err != nil {
+		t.Fatalf("failed to parse TOC: %v", err)
+	}
+	if gotDgst != tocDgst {
+		t.Errorf("TOC digest = %v; want %v", gotDgst, tocDgst)
+	}
+	var got []string
+	for _, e := range toc.Entries {
+		if e.Type == "reg" {
+			got = append(got, e.Name)
+		}
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("TOC entries = %v; want %v", got, want)
+	}
+}
+
+func TestWithSkippableFrame(t *testing.T) {
+	var tarBuf bytes.Buffer
+	tw := tar.NewWriter(&tarBuf)
+	if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "a.txt", Mode: 0644, Size: 4}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write([]byte("data")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var blob bytes.Buffer
+	var called bool
+	payload := []byte("built at 2026-01-01T00:00:00Z")
+	zc := (&Compressor{CompressionLevel: zstd.SpeedDefault, Output: &blob}).
+		WithSkippableFrame(0x3, func() []byte {
+			called = true
+			return payload
+		}).
+		WithSkippableFrame(0x4, func() []byte { return nil })
+	if err := zc.AppendLayer(&tarBuf); err != nil {
+		t.Fatal(err)
+	}
+	if called {
+		t.Fatal("skippable frame is generated before Close")
+	}
+	if _, err := zc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b := blob.Bytes()
+	d := &Decompressor{}
+	_, tocOff, tocSize, err := d.ParseFooter(b[len(b)-FooterSize:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := d.ParseTOC(bytes.NewReader(b[tocOff : tocOff+tocSize])); err != nil {
+		t.Fatalf("failed to parse TOC: %v", err)
+	}
+	// The frame ends right before the header of the TOC frame
+	frameStart := int(tocOff) - 8 - len(payload) - 8
+	if frameStart < 0 {
+		t.Fatalf("no room for the skippable frame before the TOC at %d", tocOff)
+	}
+	frame := b[frameStart : tocOff-8]
+	if want := []byte{0x53, 0x2a, 0x4d, 0x18}; !bytes.Equal(frame[:4], want) {
+		t.Errorf("magic number = %x; want %x", frame[:4], want)
+	}
+	if size := binary.LittleEndian.Uint32(frame[4:8]); size != uint32(len(payload)) {
+		t.Errorf("frame size = %d; want %d", size, len(payload))
+	}
+	if !bytes.Equal(frame[8:], payload) {
+		t.Errorf("frame contents = %q; want %q", frame[8:], payload)
+	}
+	// The frame of 0x4 is omitted
+	if n := bytes.Count(b, []byte{0x54, 0x2a, 0x4d, 0x18}); n != 0 {
+		t.Errorf("found %d frames with id 0x4; want none", n)
+	}
+
+	// The blob is still a valid zstd stream
+	r, err := d.Reader(bytes.NewReader(b[:tocOff-8]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		t.Errorf("failed to decompress the blob: %v", err)
+	}
+
+	zc = (&Compressor{Output: new(bytes.Buffer)}).WithSkippableFrame(0x10, func() []byte { return payload })
+	if err := zc.AppendLayer(bytes.NewReader(tarBuf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := zc.Close(); err == nil {
+		t.Error("expected an error for skippable frame id 0x10")
+	}
+}
+
+// TestSplitAt tests that a layer split into 3 blobs produces individually valid
+// zstd:chunked blobs chained by PrevBlobDigest.
+func TestSplitAt(t *testing.T) {
+	layers := [][]string{
+		{"a.txt", "b.txt"},
+		{"c.txt"},
+		{"d.txt", "e.txt"},
+	}
+
+	var first bytes.Buffer
+	blobs := []*closeBuffer{{Buffer: &first}}
+	zc := (&Compressor{CompressionLevel: zstd.SpeedDefault, Output: &first}).WithBlobFactory(func() (io.WriteCloser, error) {
+		b := &closeBuffer{Buffer: new(bytes.Buffer)}
+		blobs = append(blobs, b)
+		return b, nil
+	})
+	for i, names := range layers {
+		var tarBuf bytes.Buffer
+		tw := tar.NewWriter(&tarBuf)
+		for _, name := range names {
+			contents := fmt.Sprintf("layer %d: %s", i, name)
+			if err := tw.WriteHeader(&tar.Header{
+				Typeflag: tar.TypeReg,
+				Name:     name,
+				Mode:     0644,
+				Size:     int64(len(contents)),
+			}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tw.Write([]byte(contents)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := zc.AppendLayer(&tarBuf); err != nil {
+			t.Fatalf("failed to append layer %d: %v", i, err)
+		}
+		if i < len(layers)-1 {
+			// Large threshold doesn't split
+			if err := zc.SplitAt(1 << 30); err != nil {
+				t.Fatal(err)
+			}
+			if err := zc.SplitAt(0); err != nil {
+				t.Fatalf("failed to split after layer %d: %v", i, err)
+			}
+		}
+	}
+	if _, err := zc.Close(); err != nil {
+		t.Fatalf("failed to close layer: %v", err)
+	}
+	if len(blobs) != len(layers) {
+		t.Fatalf("got %d blobs; want %d", len(blobs), len(layers))
+	}
+
+	d := new(Decompressor)
+	prev := make(map[digest.Digest]digest.Digest) // PrevBlobDigest to the blob recording it
+	for i, blob := range blobs {
+		if i > 0 && !blob.closed {
+			t.Errorf("blob %d isn't closed", i)
+		}
+		b := blob.Bytes()
+		_, tocOff, tocSize, err := d.ParseFooter(b[len(b)-FooterSize:])
+		if err != nil {
+			t.Fatalf("blob %d: failed to parse footer: %v", i, err)
+		}
+		toc, _, err := d.ParseTOC(bytes.NewReader(b[tocOff : tocOff+tocSize]))
+		if err != nil {
+			t.Fatalf("blob %d: failed to parse TOC: %v", i, err)
+		}
+		var wantPrev digest.Digest
+		if i > 0 {
+			wantPrev = digest.FromBytes(blobs[i-1].Bytes())
+		}
+		if toc.PrevBlobDigest != wantPrev {
+			t.Errorf("blob %d: PrevBlobDigest = %q; want %q", i, toc.PrevBlobDigest, wantPrev)
+		}
+		prev[toc.PrevBlobDigest] = digest.FromBytes(b)
+
+		er, err := estargz.Open(io.NewSectionReader(bytes.NewReader(b), 0, int64(len(b))), estargz.WithDecompressors(d))
+		if err != nil {
+			t.Fatalf("blob %d: failed to open: %v", i, err)
+		}
+		for _, name := range layers[i] {
+			fr, err := er.OpenFile(name)
+			if err != nil {
+				t.Fatalf("blob %d: failed to open %q: %v", i, name, err)
+			}
+			got, err := io.ReadAll(io.NewSectionReader(fr, 0, 1<<20))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := fmt.Sprintf("layer %d: %s", i, name); string(got) != want {
+				t.Errorf("blob %d: %q = %q; want %q", i, name, got, want)
+			}
+		}
+		for j, names := range layers {
+			if j == i {
+				continue
+			}
+			if _, ok := er.Lookup(names[0]); ok {
+				t.Errorf("blob %d unexpectedly contains %q", i, names[0])
+			}
+		}
+	}
+
+	// The chain is followed from the descriptor blob, which has no PrevBlobDigest
+	var chain []digest.Digest
+	for cur, ok := prev[""]; ok; cur, ok = prev[cur] {
+		chain = append(chain, cur)
+	}
+	var want []digest.Digest
+	for _, blob := range blobs {
+		want = append(want, digest.FromBytes(blob.Bytes()))
+	}
+	if !reflect.DeepEqual(chain, want) {
+		t.Errorf("chain from the descriptor blob = %v; want %v", chain, want)
+	}
+}
+
+// TestManifestPositionV2 tests that the manifest positions of a two-blob layer are
+// parsed by both the V1 (first blob only) and V2 parsers.
+func TestManifestPositionV2(t *testing.T) {
+	var first, second bytes.Buffer
+	metadata := make(map[string]string)
+	zc := (&Compressor{CompressionLevel: zstd.SpeedDefault, Output: &first, Metadata: metadata}).WithBlobFactory(func() (io.WriteCloser, error) {
+		return &closeBuffer{Buffer: &second}, nil
+	})
+	for i, name := range []string{"a.txt", "b.txt"} {
+		var tarBuf bytes.Buffer
+		tw := tar.NewWriter(&tarBuf)
+		if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0644, Size: int64(len(name))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(name)); err != nil {
+			t.Fatal(err)
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := zc.AppendLayer(&tarBuf); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			if err := zc.SplitAt(0); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if _, err := zc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	d := new(Decompressor)
+	var want []BlobPosition
+	for _, b := range [][]byte{first.Bytes(), second.Bytes()} {
+		_, tocOff, tocSize, err := d.ParseFooter(b[len(b)-FooterSize:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, BlobPosition{Digest: digest.FromBytes(b), Offset: tocOff, Size: tocSize})
+	}
+
+	v1, err := ParseManifestPositionV1(metadata[ManifestPositionAnnotation])
+	if err != nil {
+		t.Fatalf("failed to parse V1 annotation: %v", err)
+	}
+	if v1.Offset != want[0].Offset || v1.Size != want[0].Size {
+		t.Errorf("V1 position = %+v; want the first blob's %+v", v1, want[0])
+	}
+	firstTOC := first.Bytes()[want[0].Offset : want[0].Offset+want[0].Size]
+	if got, want := metadata[ManifestChecksumAnnotation], digest.FromBytes(firstTOC).String(); got != want {
+		t.Errorf("V1 checksum = %s; want the first blob's TOC digest %s", got, want)
+	}
+	v2, err := ParseManifestPositionV2(metadata[ManifestPositionAnnotationV2])
+	if err != nil {
+		t.Fatalf("failed to parse V2 annotation: %v", err)
+	}
+	if !reflect.DeepEqual(v2, want) {
+		t.Errorf("V2 positions = %+v; want %+v", v2, want)
+	}
+
+	// The V2 annotation is preferred when present
+	if got, err := d.ParseManifestPosition(metadata); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseManifestPosition = (%+v, %v); want %+v", got, err, want)
+	}
+	delete(metadata, ManifestPositionAnnotationV2)
+	if got, err := d.ParseManifestPosition(metadata); err != nil || len(got) != 1 || got[0] != v1 {
+		t.Errorf("ParseManifestPosition without V2 = (%+v, %v); want [%+v]", got, err, v1)
+	}
+}
+
+// TestManifestPositionSingleBlob tests that only the V1 annotation is produced for
+// single-blob layers.
+func TestManifestPositionSingleBlob(t *testing.T) {
+	var blob bytes.Buffer
+	metadata := make(map[string]string)
+	zc := &Compressor{CompressionLevel: zstd.SpeedDefault, Output: &blob, Metadata: metadata}
+	var tarBuf bytes.Buffer
+	if err := tar.NewWriter(&tarBuf).Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zc.AppendLayer(&tarBuf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := zc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := metadata[ManifestPositionAnnotationV2]; ok {
+		t.Errorf("%q must not be produced for single-blob layers", ManifestPositionAnnotationV2)
+	}
+	b := blob.Bytes()
+	_, tocOff, _, err := new(Decompressor).ParseFooter(b[len(b)-FooterSize:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	pos, err := ParseManifestPositionV1(metadata[ManifestPositionAnnotation])
+	if err != nil || pos.Offset != tocOff {
+		t.Errorf("V1 position = (%+v, %v); want offset %d", pos, err, tocOff)
+	}
+}
+
+type closeBuffer struct {
+	*bytes.Buffer
+	closed bool
+}
+
+func (b *closeBuffer) Close() error {
+	b.closed = true
+	return nil
+}
+
+// TestExtractTo tests that a layer is extracted to a local directory with its
+// files, directories, symlinks and hardlinks.
+func TestExtractTo(t *testing.T) {
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	var tarBuf bytes.Buffer
+	tw := tar.NewWriter(&tarBuf)
+	for _, h := range []struct {
+		hdr      tar.Header
+		contents string
+	}{
+		{hdr: tar.Header{Typeflag: tar.TypeDir, Name: "dir/", Mode: 0750}},
+		{hdr: tar.Header{Typeflag: tar.TypeReg, Name: "dir/file.txt", Mode: 0640}, contents: "hello"},
+		{hdr: tar.Header{Typeflag: tar.TypeReg, Name: "exec.sh", Mode: 0755}, contents: "#!/bin/sh\n"},
+		{hdr: tar.Header{Typeflag: tar.TypeSymlink, Name: "link", Linkname: "dir/file.txt"}},
+		{hdr: tar.Header{Typeflag: tar.TypeLink, Name: "dir/hardlink", Linkname: "dir/file.txt"}},
+		{hdr: tar.Header{Typeflag: tar.TypeReg, Name: "implicit/parent/file", Mode: 0644}, contents: "x"},
+		{hdr: tar.Header{Typeflag: tar.TypeFifo, Name: "fifo", Mode: 0620}},
+		{hdr: tar.Header{Typeflag: tar.TypeChar, Name: "chardev", Mode: 0600, Devmajor: 1, Devminor: 3}},
+	} {
+		hdr := h.hdr
+		hdr.Size = int64(len(h.contents))
+		hdr.ModTime = modTime
+		if err := tw.WriteHeader(&hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(h.contents)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var blob bytes.Buffer
+	zc := &Compressor{CompressionLevel: zstd.SpeedDefault, Output: &blob}
+	if err := zc.AppendLayer(&tarBuf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := zc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	if err := new(Decompressor).ExtractTo(context.Background(), dir, bytes.NewReader(blob.Bytes())); err != nil {
+		t.Fatalf("failed to extract: %v", err)
+	}
+
+	want := map[string]os.FileMode{
+		"dir":                  os.ModeDir | 0750,
+		"dir/file.txt":         0640,
+		"dir/hardlink":         0640,
+		"exec.sh":              0755,
+		"link":                 os.ModeSymlink,
+		"implicit":             os.ModeDir | 0755,
+		"implicit/parent":      os.ModeDir | 0755,
+		"implicit/parent/file": 0644,
+		"fifo":                 os.ModeNamedPipe | 0620,
+		"chardev":              os.ModeDevice | os.ModeCharDevice | 0600,
+	}
+	if _, err := os.Lstat(filepath.Join(dir, "chardev")); os.IsNotExist(err) {
+		delete(want, "chardev") // without the privilege to create devices
+	}
+	got := map[string]os.FileMode{}
+	if err := fs.WalkDir(os.DirFS(dir), ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || p == "." {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		mode := info.Mode()
+		if mode&os.ModeSymlink != 0 {
+			mode = os.ModeSymlink
+		}
+		got[p] = mode
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("extracted entries = %v; want %v", got, want)
+	}
+
+	if b, err := os.ReadFile(filepath.Join(dir, "dir/file.txt")); err != nil || string(b) != "hello" {
+		t.Errorf("unexpected contents of dir/file.txt: %q (%v)", b, err)
+	}
+	if target, err := os.Readlink(filepath.Join(dir, "link")); err != nil || target != "dir/file.txt" {
+		t.Errorf("unexpected symlink target %q (%v)", target, err)
+	}
+	orgInfo, err := os.Stat(filepath.Join(dir, "dir/file.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	linkInfo, err := os.Stat(filepath.Join(dir, "dir/hardlink"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(orgInfo, linkInfo) {
+		t.Errorf("dir/hardlink isn't a hardlink of dir/file.txt")
+	}
+	if !orgInfo.ModTime().Equal(modTime) {
+		t.Errorf("modtime of dir/file.txt = %v; want %v", orgInfo.ModTime(), modTime)
+	}
+}
+
+func TestExtractToSymlinks(t *testing.T) {
+	outside := t.TempDir()
+	victim := filepath.Join(outside, "victim")
+	if err := os.WriteFile(victim, []byte("original"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	extract := func(t *testing.T, hdrs ...*tar.Header) (string, error) {
+		var tarBuf bytes.Buffer
+		tw := tar.NewWriter(&tarBuf)
+		for _, hdr := range hdrs {
+			if err := tw.WriteHeader(hdr); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tw.Write(bytes.Repeat([]byte("x"), int(hdr.Size))); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		var blob bytes.Buffer
+		zc := &Compressor{CompressionLevel: zstd.SpeedDefault, Output: &blob}
+		if err := zc.AppendLayer(&tarBuf); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := zc.Close(); err != nil {
+			t.Fatal(err)
+		}
+		dir := t.TempDir()
+		return dir, new(Decompressor).ExtractTo(context.Background(), dir, bytes.NewReader(blob.Bytes()))
+	}
+	checkVictim := func(t *testing.T) {
+		fi, err := os.Stat(victim)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b, err := os.ReadFile(victim); err != nil || string(b) != "original" || fi.Mode().Perm() != 0600 {
+			t.Errorf("file outside of the extraction root was modified: %q (%v), mode %v", b, err, fi.Mode())
+		}
+	}
+
+	t.Run("file replacing symlink", func(t *testing.T) {
+		dir, err := extract(t,
+			&tar.Header{Typeflag: tar.TypeSymlink, Name: "a", Linkname: victim},
+			&tar.Header{Typeflag: tar.TypeReg, Name: "a", Mode: 0777, Size: 4},
+		)
+		if err != nil {
+			t.Fatalf("failed to extract: %v", err)
+		}
+		checkVictim(t)
+		fi, err := os.Lstat(filepath.Join(dir, "a"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !fi.Mode().IsRegular() || fi.Size() != 4 {
+			t.Errorf("a = %v (%d bytes); want a regular file of 4 bytes", fi.Mode(), fi.Size())
+		}
+	})
+
+	t.Run("hardlink through symlinked dir", func(t *testing.T) {
+		dir, err := extract(t,
+			&tar.Header{Typeflag: tar.TypeSymlink, Name: "d", Linkname: outside},
+			&tar.Header{Typeflag: tar.TypeLink, Name: "h", Linkname: "d/victim"},
+		)
+		if err == nil {
+			t.Errorf("hardlink to a file outside of the extraction root succeeded")
+		}
+		if _, err := os.Lstat(filepath.Join(dir, "h")); !os.IsNotExist(err) {
+			t.Errorf("h was created: %v", err)
+		}
+		checkVictim(t)
+	})
+}
+
+func TestReadDir(t *testing.T) {
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	var tarBuf bytes.Buffer
+	tw := tar.NewWriter(&tarBuf)
+	for _, h := range []struct {
+		name     string
+		contents string
+	}{
+		{name: "a/b/c.txt", contents: "c"},
+		{name: "a/d.txt", contents: "dd"},
+		{name: "e.txt", contents: "eee"},
+	} {
+		hdr := tar.Header{Typeflag: tar.TypeReg, Name: h.name, Mode: 0640, Size: int64(len(h.contents)), ModTime: modTime}
+		if err := tw.WriteHeader(&hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(h.contents)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var blob bytes.Buffer
+	zc := &Compressor{CompressionLevel: zstd.SpeedDefault, Output: &blob}
+	if err := zc.AppendLayer(&tarBuf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := zc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r := bytes.NewReader(blob.Bytes())
+
+	for dir, want := range map[string][]string{
+		"a":   {"b", "d.txt"},
+		"a/b": {"c.txt"},
+		"":    {"a", "e.txt"},
+	} {
+		entries, err := new(Decompressor).ReadDir(dir, r)
+		if err != nil {
+			t.Fatalf("failed to read %q: %v", dir, err)
+		}
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		if !reflect.DeepEqual(names, want) {
+			t.Errorf("ReadDir(%q) = %v; want %v", dir, names, want)
+		}
+	}
+
+	entries, err := new(Decompressor).ReadDir("a", r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !entries[0].IsDir() || entries[0].Type() != fs.ModeDir {
+		t.Errorf("%q is of type %v; want a directory", entries[0].Name(), entries[0].Type())
+	}
+	info, err := entries[1].Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 2 || info.Mode() != 0640 || !info.ModTime().Equal(modTime) {
+		t.Errorf("%q has size %d, mode %v and modification time %v", info.Name(), info.Size(), info.Mode(), info.ModTime())
+	}
+
+	for _, name := range []string{"e.txt", "unknown"} {
+		if _, err := new(Decompressor).ReadDir(name, r); err == nil {
+			t.Errorf("ReadDir(%q) should fail", name)
+		}
+	}
+}
+
+func TestStat(t *testing.T) {
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	var tarBuf bytes.Buffer
+	tw := tar.NewWriter(&tarBuf)
+	for _, h := range []struct {
+		hdr      tar.Header
+		contents string
+	}{
+		{hdr: tar.Header{Typeflag: tar.TypeDir, Name: "dir/", Mode: 0750}},
+		{hdr: tar.Header{Typeflag: tar.TypeReg, Name: "dir/file.txt", Mode: 0640}, contents: "hello"},
+		{hdr: tar.Header{Typeflag: tar.TypeSymlink, Name: "link", Linkname: "dir/file.txt"}},
+		{hdr: tar.Header{Typeflag: tar.TypeLink, Name: "hardlink", Linkname: "dir/file.txt"}},
+		{hdr: tar.Header{Typeflag: tar.TypeReg, Name: "implicit/file", Mode: 0644}, contents: "x"},
+	} {
+		hdr := h.hdr
+		hdr.Size = int64(len(h.contents))
+		hdr.ModTime = modTime
+		if err := tw.WriteHeader(&hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(h.contents)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var blob bytes.Buffer
+	zc := &Compressor{CompressionLevel: zstd.SpeedDefault, Output: &blob}
+	if err := zc.AppendLayer(&tarBuf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := zc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	zz := new(Decompressor)
+	if _, err := zz.Stat("dir/file.txt"); err == nil {
+		t.Errorf("Stat before parsing a TOC should fail")
+	}
+	if _, _, _, err := zz.openTOC(bytes.NewReader(blob.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		base    string
+		mode    fs.FileMode
+		size    int64
+		modTime time.Time
+	}{
+		{name: "dir", base: "dir", mode: fs.ModeDir | 0750, modTime: modTime},
+		{name: "/dir/file.txt", base: "file.txt", mode: 0640, size: 5, modTime: modTime},
+		{name: "link", base: "link", mode: fs.ModeSymlink, modTime: modTime},
+		{name: "hardlink", base: "file.txt", mode: 0640, size: 5, modTime: modTime},
+		{name: "implicit", base: "implicit", mode: fs.ModeDir | 0755},
+	}
+	for _, tt := range tests {
+		fi, err := zz.Stat(tt.name)
+		if err != nil {
+			t.Errorf("failed to stat %q: %v", tt.name, err)
+			continue
+		}
+		if fi.Name() != tt.base || fi.Mode() != tt.mode || fi.Size() != tt.size || !fi.ModTime().Equal(tt.modTime) {
+			t.Errorf("Stat(%q) = %q, %v, %d, %v; want %q, %v, %d, %v", tt.name,
+				fi.Name(), fi.Mode(), fi.Size(), fi.ModTime(), tt.base, tt.mode, tt.size, tt.modTime)
+		}
+	}
+	if _, err := zz.Stat("unknown"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Stat of an unknown file = %v; want fs.ErrNotExist", err)
+	}
+}
+
+func BenchmarkStat(b *testing.B) {
+	const entries, calls = 50000, 10000
+	toc := &estargz.JTOC{Version: 1}
+	for i := 0; i < entries; i++ {
+		toc.Entries = append(toc.Entries, &estargz.TOCEntry{
+			Name: fmt.Sprintf("dir%d/file%d", i%100, i), Type: "reg", Mode: 0644, Size: int64(i),
+		})
+	}
+	tocJSON, err := toc.Serialize()
+	if err != nil {
+		b.Fatal(err)
+	}
+	enc, err := zstd.NewWriter(nil, zstd.WithZeroFrames(true))
+	if err != nil {
+		b.Fatal(err)
+	}
+	compressed := enc.EncodeAll(tocJSON, nil)
+	zz := new(Decompressor)
+	if _, _, err := zz.ParseTOC(bytes.NewReader(compressed)); err != nil {
+		b.Fatal(err)
+	}
+	names := make([]string, calls)
+	for i := range names {
+		j := i * (entries / calls)
+		names[i] = fmt.Sprintf("dir%d/file%d", j%100, j)
+	}
+	b.ResetTimer()
+	start := time.Now()
+	for n := 0; n < b.N; n++ {
+		for _, name := range names {
+			if _, err := zz.Stat(name); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	if perCalls := time.Since(start) / time.Duration(b.N); perCalls > 50*time.Millisecond {
+		b.Errorf("%d calls of Stat took %v; want less than 50ms", calls, perCalls)
+	}
+}
+
+func TestReadFileAt(t *testing.T) {
+	const chunkSize = 16
+	contents := make([]byte, 100)
+	for i := range contents {
+		contents[i] = byte('a' + i%26)
+	}
+	var tarBuf bytes.Buffer
+	tw := tar.NewWriter(&tarBuf)
+	if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "file", Mode: 0644, Size: int64(len(contents))}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write(contents); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var blob bytes.Buffer
+	w := estargz.NewWriterWithCompressor(&blob, &Compressor{CompressionLevel: zstd.SpeedDefault})
+	w.ChunkSize = chunkSize
+	if err := w.AppendTar(&tarBuf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r := bytes.NewReader(blob.Bytes())
+
+	tests := []struct {
+		name   string
+		off    int64
+		length int64
+	}{
+		{name: "within_chunk", off: 2, length: 10},
+		{name: "span_chunk_boundary", off: 10, length: 20},
+		{name: "span_several_chunks", off: 5, length: 60},
+		{name: "exact_chunk", off: chunkSize, length: chunkSize},
+		{name: "from_chunk_boundary", off: 2 * chunkSize, length: 5},
+		{name: "to_chunk_boundary", off: 3, length: chunkSize - 3},
+		{name: "past_end", off: 90, length: 20},
+		{name: "empty", off: 50, length: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := new(Decompressor).ReadFileAt("file", tt.off, tt.length, r)
+			if err != nil {
+				t.Fatalf("failed to read: %v", err)
+			}
+			end := tt.off + tt.length
+			if end > int64(len(contents)) {
+				end = int64(len(contents))
+			}
+			if want := contents[tt.off:end]; !bytes.Equal(got, want) {
+				t.Errorf("read %q; want %q", got, want)
+			}
+		})
+	}
+
+	if _, err := new(Decompressor).ReadFileAt("unknown", 0, 1, r); err == nil {
+		t.Errorf("reading an unknown file should fail")
+	}
+
+	// The layer is opened once, so the following reads only fetch chunks
+	chunks, err := new(Decompressor).ListChunks(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := chunks[len(chunks)-1]
+	payloadEnd := last.CompressedOffset + last.CompressedSize
+	zz := new(Decompressor)
+	rr := &recordingReaderAt{r: r}
+	if _, err := zz.ReadFileAt("file", 0, 1, rr); err != nil {
+		t.Fatal(err)
+	}
+	rr.ranges = nil
+	got, err := zz.ReadFileAt("file", 2*chunkSize, 5, rr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := contents[2*chunkSize : 2*chunkSize+5]; !bytes.Equal(got, want) {
+		t.Errorf("read %q; want %q", got, want)
+	}
+	for _, rg := range rr.ranges {
+		if rg[0] >= payloadEnd {
+			t.Errorf("reading the layer again read its TOC or footer at %d", rg[0])
+		}
+	}
+	got, err = zz.ReadFileAt("file", 0, 5, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := contents[:5]; !bytes.Equal(got, want) {
+		t.Errorf("read %q from another reader; want %q", got, want)
+	}
+
+	// Chunks decompressing to no data must fail the read rather than returning zeros
+	enc, err := zstd.NewWriter(nil, zstd.WithZeroFrames(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	emptyFrame := enc.EncodeAll(nil, nil)
+	broken := bytes.Clone(blob.Bytes())
+	frames := broken[chunks[2].CompressedOffset:] // the chunks from offset 2*chunkSize and the rest
+	n := copy(frames, emptyFrame)
+	binary.LittleEndian.PutUint32(frames[n:], 0x184D2A50) // pads with a skippable frame
+	binary.LittleEndian.PutUint32(frames[n+4:], uint32(len(frames)-n-8))
+	if _, err := zz.ReadFileAt("file", 0, 1, rr); err != nil {
+		t.Fatal(err)
+	}
+	rr.r = bytes.NewReader(broken) // the opened layer reads the broken chunks
+	if _, err := zz.ReadFileAt("file", 2*chunkSize, 5, rr); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("reading empty chunks = %v; want %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestStreamFile(t *testing.T) {
+	const chunkSize = 1 << 20
+	contents := make([]byte, 10<<20)
+	rand.New(rand.NewSource(1)).Read(contents[:len(contents)/2])
+	var tarBuf bytes.Buffer
+	tw := tar.NewWriter(&tarBuf)
+	if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "file", Mode: 0644, Size: int64(len(contents))}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write(contents); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var blob bytes.Buffer
+	w := estargz.NewWriterWithCompressor(&blob, &Compressor{CompressionLevel: zstd.SpeedDefault})
+	w.ChunkSize = chunkSize
+	if err := w.AppendTar(&tarBuf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	chunks, err := new(Decompressor).ListChunks(bytes.NewReader(blob.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &recordingReaderAt{r: bytes.NewReader(blob.Bytes())}
+	s, err := new(Decompressor).StreamFile("file", r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head := make([]byte, 100)
+	if _, err := io.ReadFull(s, head); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(head, contents[:100]) {
+		t.Errorf("read %q; want %q", head, contents[:100])
+	}
+	var fetched int
+	for _, c := range chunks {
+		if r.overlaps(c.CompressedOffset, c.CompressedOffset+c.CompressedSize) {
+			fetched++
+		}
+	}
+	if fetched > 2 {
+		t.Errorf("reading 100 bytes fetched %d of %d chunks", fetched, len(chunks))
+	}
+
+	rest, err := io.ReadAll(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(append(head, rest...), contents) {
+		t.Errorf("streamed contents don't match")
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Read(head); err == nil {
+		t.Errorf("reading a closed stream should fail")
+	}
+
+	if _, err := new(Decompressor).StreamFile("unknown", r); err == nil {
+		t.Errorf("streaming an unknown file should fail")
+	}
+}
+
+// recordingReaderAt records the byte ranges read from r
+type recordingReaderAt struct {
+	r      *bytes.Reader
+	ranges [][2]int64
+}
+
+func (r *recordingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	r.ranges = append(r.ranges, [2]int64{off, off + int64(len(p))})
+	return r.r.ReadAt(p, off)
+}
+
+func (r *recordingReaderAt) Size() int64 { return r.r.Size() }
+
+func (r *recordingReaderAt) overlaps(start, end int64) bool {
+	for _, rg := range r.ranges {
+		if rg[0] < end && start < rg[1] {
+			return true
+		}
+	}
+	return false
+}
+
+func TestListChunks(t *testing.T) {
+	const chunkSize = 16
+	var tarBuf bytes.Buffer
+	tw := tar.NewWriter(&tarBuf)
+	for _, f := range []struct {
+		hdr      tar.Header
+		contents string
+	}{
+		{hdr: tar.Header{Typeflag: tar.TypeDir, Name: "dir/", Mode: 0755}},
+		{hdr: tar.Header{Typeflag: tar.TypeReg, Name: "dir/large"}, contents: strings.Repeat("0123456789", 10)},
+		{hdr: tar.Header{Typeflag: tar.TypeReg, Name: "dir/small"}, contents: "small"},
+		{hdr: tar.Header{Typeflag: tar.TypeReg, Name: "empty"}},
+		{hdr: tar.Header{Typeflag: tar.TypeSymlink, Name: "symlink", Linkname: "dir/large"}},
+		{hdr: tar.Header{Typeflag: tar.TypeLink, Name: "hardlink", Linkname: "dir/small"}},
+		{hdr: tar.Header{Typeflag: tar.TypeReg, Name: "exact"}, contents: strings.Repeat("x", 2*chunkSize)},
+	} {
+		hdr := f.hdr
+		hdr.Size = int64(len(f.contents))
+		if hdr.Mode == 0 {
+			hdr.Mode = 0644
+		}
+		if err := tw.WriteHeader(&hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(f.contents)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var blob bytes.Buffer
+	w := estargz.NewWriterWithCompressor(&blob, &Compressor{CompressionLevel: zstd.SpeedDefault})
+	w.ChunkSize = chunkSize
+	if err := w.AppendTar(&tarBuf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r := bytes.NewReader(blob.Bytes())
+
+	d := new(Decompressor)
+	chunks, err := d.ListChunks(r)
+	if err != nil {
+		t.Fatalf("failed to list chunks: %v", err)
+	}
+	_, tocOff, _, err := d.ParseFooter(blob.Bytes()[blob.Len()-FooterSize:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, toc, err := d.openTOC(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fileSizes int64
+	for _, e := range toc.Entries {
+		if e.Type == "reg" {
+			fileSizes += e.Size
+		}
+	}
+	var chunkSizes int64
+	for _, c := range chunks {
+		chunkSizes += c.UncompressedSize
+		if c.CompressedOffset <= 0 || c.CompressedSize <= 0 || c.CompressedOffset+c.CompressedSize > tocOff {
+			t.Errorf("chunk %+v is out of the compressed data [0, %d)", c, tocOff)
+		}
+		data, err := d.ReadFileAt(c.EntryName, c.UncompressedOffset, c.UncompressedSize, r)
+		if err != nil {
+			t.Fatalf("failed to read chunk %+v: %v", c, err)
+		}
+		if int64(len(data)) != c.UncompressedSize || digest.FromBytes(data) != c.Digest {
+			t.Errorf("chunk %+v doesn't match the %d bytes of the file", c, len(data))
+		}
+	}
+	if chunkSizes != fileSizes {
+		t.Errorf("chunks have %d bytes; files have %d", chunkSizes, fileSizes)
+	}
+	// 100/16 chunks of dir/large, 1 of dir/small and 2 of exact
+	if want := 7 + 1 + 2; len(chunks) != want {
+		t.Errorf("got %d chunks; want %d: %+v", len(chunks), want, chunks)
+	}
+}
+
+func TestTOCCoverage(t *testing.T) {
+	var tarBuf bytes.Buffer
+	tw := tar.NewWriter(&tarBuf)
+	for _, f := range []struct {
+		hdr      tar.Header
+		contents string
+	}{
+		{hdr: tar.Header{Typeflag: tar.TypeDir, Name: "dir/", Mode: 0755}},
+		{hdr: tar.Header{Typeflag: tar.TypeReg, Name: "dir/large"}, contents: strings.Repeat("large contents ", 1000)},
+		{hdr: tar.Header{Typeflag: tar.TypeReg, Name: "dir/small"}, contents: "small"},
+		{hdr: tar.Header{Typeflag: tar.TypeSymlink, Name: "symlink", Linkname: "dir/large"}},
+		{hdr: tar.Header{Typeflag: tar.TypeReg, Name: "empty"}},
+		{hdr: tar.Header{Typeflag: tar.TypeReg, Name: "last"}, contents: "last"},
+	} {
+		hdr := f.hdr
+		hdr.Size = int64(len(f.contents))
+		if hdr.Mode == 0 {
+			hdr.Mode = 0644
+		}
+		if err := tw.WriteHeader(&hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(f.contents)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var blob bytes.Buffer
+	w := estargz.NewWriterWithCompressor(&blob, &Compressor{CompressionLevel: zstd.SpeedDefault})
+	w.ChunkSize = 4096
+	if err := w.AppendTar(&tarBuf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r := bytes.NewReader(blob.Bytes())
+	d := new(Decompressor)
+	_, tocOff, _, err := d.ParseFooter(blob.Bytes()[blob.Len()-FooterSize:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, toc, err := d.openTOC(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each stream decompresses on its own and they cover the layer from the first
+	// payload to the TOC frame
+	dec, err := zstd.NewReader(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dec.Close()
+	firstOffset := int64(-1)
+	for _, e := range toc.Entries {
+		if e.CompressedSize == 0 {
+			if (e.Type == "reg" || e.Type == "chunk") && e.Offset != 0 && e.InnerOffset == 0 {
+				t.Errorf("%s (%s at %d) has no CompressedSize", e.Name, e.Type, e.ChunkOffset)
+			}
+			continue
+		}
+		if firstOffset < 0 {
+			firstOffset = e.Offset
+		}
+		if _, err := dec.DecodeAll(blob.Bytes()[e.Offset:e.Offset+e.CompressedSize], nil); err != nil {
+			t.Errorf("stream of %s at %d: %v", e.Name, e.Offset, err)
+		}
+	}
+	covered, total, ratio, err := estargz.TOCCoverage(toc, int64(blob.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The TOC starts after the 8 bytes header of its skippable frame
+	if want := tocOff - 8 - firstOffset; covered != want || total != int64(blob.Len()) {
+		t.Errorf("coverage = %d/%d; want %d/%d", covered, total, want, blob.Len())
+	}
+	if want := float64(covered) / float64(total); ratio != want {
+		t.Errorf("ratio = %v; want %v", ratio, want)
+	}
+
+	// A TOC missing the chunks of a file leaves their streams uncovered
+	partial := &estargz.JTOC{Version: toc.Version}
+	var removed int64
+	for _, e := range toc.Entries {
+		if e.Name == "dir/large" {
+			removed += e.CompressedSize
+			continue
+		}
+		partial.Entries = append(partial.Entries, e)
+	}
+	if removed == 0 {
+		t.Fatal("dir/large has no compressed streams")
+	}
+	if pc, _, pr, err := estargz.TOCCoverage(partial, int64(blob.Len())); err != nil || pc != covered-removed || pr >= ratio {
+		t.Errorf("partial coverage = %d (%v), %v; want %d", pc, pr, err, covered-removed)
+	}
+}
+
+func TestEstimatedOutputSize(t *testing.T) {
+	// 10 MB of files of varying size and compressibility
+	rng := rand.New(rand.NewSource(1))
+	var tarBuf bytes.Buffer
+	tw := tar.NewWriter(&tarBuf)
+	var total int
+	for i := 0; total < 10<<20; i++ {
+		data := make([]byte, 1024+rng.Intn(256<<10))
+		for j := 0; j < len(data); j += 1024 {
+			if rng.Intn(2) == 0 {
+				rng.Read(data[j:min(j+1024, len(data))])
+			}
+		}
+		if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: fmt.Sprintf("file%d", i), Mode: 0644, Size: int64(len(data))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		total += len(data)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var blob bytes.Buffer
+	zc := &Compressor{CompressionLevel: zstd.SpeedDefault, Output: &blob}
+	if err := zc.AppendLayer(&tarBuf); err != nil {
+		t.Fatal(err)
+	}
+	estimate := zc.EstimatedOutputSize()
+	if _, err := zc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	actual := int64(blob.Len())
+	if diff := estimate - actual; diff*10 > actual || -diff*10 > actual {
+		t.Errorf("estimated %d bytes; the layer has %d", estimate, actual)
+	}
+	if got := zc.EstimatedOutputSize(); got != actual {
+		t.Errorf("EstimatedOutputSize after Close = %d; want %d", got, actual)
+	}
+}
+
+func TestPriorityFiles(t *testing.T) {
+	var tarBuf bytes.Buffer
+	tw := tar.NewWriter(&tarBuf)
+	for _, name := range []string{"a.txt", "b.txt", "dir/", "dir/c.txt"} {
+		hdr := &tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0644, Size: int64(len(name))}
+		if name[len(name)-1] == '/' {
+			hdr = &tar.Header{Typeflag: tar.TypeDir, Name: name, Mode: 0755}
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			if _, err := tw.Write([]byte(name)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name        string
+		prioritized []string
+		want        []string
+	}{
+		{name: "prioritized", prioritized: []string{"dir/c.txt", "b.txt"}, want: []string{"dir/c.txt", "b.txt"}},
+		{name: "none", want: nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			zc := &zstdController{&Compressor{CompressionLevel: zstd.SpeedDefault}, &Decompressor{}}
+			opts := []estargz.Option{estargz.WithCompression(zc)}
+			if tt.prioritized != nil {
+				opts = append(opts, estargz.WithPrioritizedFiles(tt.prioritized))
+			}
+			rc, err := estargz.Build(io.NewSectionReader(bytes.NewReader(tarBuf.Bytes()), 0, int64(tarBuf.Len())), opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			blob, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			d := new(Decompressor)
+			if _, err := estargz.Open(io.NewSectionReader(bytes.NewReader(blob), 0, int64(len(blob))), estargz.WithDecompressors(d)); err != nil {
+				t.Fatal(err)
+			}
+			if got := d.PriorityFiles(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PriorityFiles() = %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestManifestAnnotations(t *testing.T) {
+	checksum := digest.FromString("toc").String()
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		wantOffset  int64
+		wantSize    int64
+		wantErr     bool
+	}{
+		{
+			name: "valid",
+			annotations: map[string]string{
+				ManifestPositionAnnotation: "100:20:50:1",
+				ManifestChecksumAnnotation: checksum,
+			},
+			wantOffset: 100,
+			wantSize:   20,
+		},
+		{
+			name:    "no annotations",
+			wantErr: true,
+		},
+		{
+			name:        "missing position",
+			annotations: map[string]string{ManifestChecksumAnnotation: checksum},
+			wantErr:     true,
+		},
+		{
+			name:        "missing checksum",
+			annotations: map[string]string{ManifestPositionAnnotation: "100:20:50:1"},
+			wantErr:     true,
+		},
+		{
+			name: "malformed offset",
+			annotations: map[string]string{
+				ManifestPositionAnnotation: "abc:20:50:1",
+				ManifestChecksumAnnotation: checksum,
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative offset",
+			annotations: map[string]string{
+				ManifestPositionAnnotation: "-1:20:50:1",
+				ManifestChecksumAnnotation: checksum,
+			},
+			wantErr: true,
+		},
+		{
+			name: "too few fields",
+			annotations: map[string]string{
+				ManifestPositionAnnotation: "100:20",
+				ManifestChecksumAnnotation: checksum,
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid digest",
+			annotations: map[string]string{
+				ManifestPositionAnnotation: "100:20:50:1",
+				ManifestChecksumAnnotation: "sha256:invalid",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			offset, size, dgst, err := ManifestAnnotations(ocispec.Descriptor{Annotations: tt.annotations})
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if offset != tt.wantOffset || size != tt.wantSize || dgst.String() != checksum {
+				t.Errorf("got (%d, %d, %s); want (%d, %d, %s)", offset, size, dgst, tt.wantOffset, tt.wantSize, checksum)
+			}
+		})
+	}
+
+	// The annotations recorded by the compressor can be parsed back
+	var blob bytes.Buffer
+	zc := &Compressor{CompressionLevel: zstd.SpeedFastest, Output: &blob, Metadata: map[string]string{}}
+	var tarBuf bytes.Buffer
+	if err := tar.NewWriter(&tarBuf).Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zc.AppendLayer(&tarBuf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := zc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	offset, size, dgst, err := ManifestAnnotations(ocispec.Descriptor{Annotations: zc.Metadata})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := digest.FromBytes(blob.Bytes()[offset : offset+size]); got != dgst {
+		t.Errorf("digest of the TOC at %d (%d bytes) = %s; want %s", offset, size, got, dgst)
+	}
+}
+
+func TestDictionary(t *testing.T) {
+	dc, ok := compzstd.GetCompressor().(compzstd.DictionaryCompressor)
+	if !ok {
+		t.Skipf("%s doesn't support dictionaries", compzstd.GetCompressor().Name())
+	}
+	files := make(map[string][]byte)
+	var samples [][]byte
+	for i := 0; i < 200; i++ {
+		b := []byte(fmt.Sprintf(`{"id": %d, "name": "package-%d", "version": "1.%d.0", "license": "Apache-2.0", "description": "sample metadata file"}`, i, i, i%7))
+		files[fmt.Sprintf("meta/%03d.json", i)] = b
+		samples = append(samples, b)
+	}
+	dict, err := dc.TrainDictionary(samples, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tarBuf bytes.Buffer
+	tw := tar.NewWriter(&tarBuf)
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0644, Size: int64(len(files[name]))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(files[name]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var blob bytes.Buffer
+	w := estargz.NewWriterWithCompressor(&blob, (&Compressor{CompressionLevel: zstd.SpeedDefault}).WithDictionary(dict))
+	if err := w.AppendTar(bytes.NewReader(tarBuf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r := bytes.NewReader(blob.Bytes())
+
+	got, err := new(Decompressor).ExtractDictionary(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, dict) {
+		t.Errorf("extracted %d bytes that don't match the %d bytes dictionary", len(got), len(dict))
+	}
+
+	// The contents can't be decompressed without the dictionary
+	chunks, err := new(Decompressor).ListChunks(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The dictionary is located from the TOC without reading the chunks
+	rr := &recordingReaderAt{r: r}
+	if _, err := new(Decompressor).ExtractDictionary(rr); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range chunks {
+		if rr.overlaps(c.CompressedOffset, c.CompressedOffset+c.CompressedSize) {
+			t.Errorf("extracting the dictionary read the chunk at %d", c.CompressedOffset)
+		}
+	}
+	zr, err := compzstd.GetCompressor().NewReader(io.NewSectionReader(r, chunks[0].CompressedOffset, chunks[0].CompressedSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(zr); err == nil {
+		t.Errorf("decompressed a chunk without the dictionary")
+	}
+	zr.Close()
+
+	// The dictionary is extracted from the layer when none is set
+	for _, name := range []string{"meta/000.json", "meta/123.json", "meta/199.json"} {
+		got, err := new(Decompressor).ReadFileAt(name, 0, int64(len(files[name])), r)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", name, err)
+		}
+		if !bytes.Equal(got, files[name]) {
+			t.Errorf("read %q from %s; want %q", got, name, files[name])
+		}
+	}
+	s, err := new(Decompressor).StreamFile("meta/042.json", r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := io.ReadAll(s); err != nil || !bytes.Equal(got, files["meta/042.json"]) {
+		t.Errorf("streamed %q, %v; want %q", got, err, files["meta/042.json"])
+	}
+	s.Close()
+	dir := t.TempDir()
+	if err := new(Decompressor).ExtractTo(context.Background(), dir, r); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.ReadFile(filepath.Join(dir, "meta", "007.json")); err != nil || !bytes.Equal(got, files["meta/007.json"]) {
+		t.Errorf("extracted %q, %v; want %q", got, err, files["meta/007.json"])
+	}
+
+	// A preloaded dictionary is used instead of the embedded one
+	zz := new(Decompressor)
+	zz.SetDictionary([]byte("not a dictionary"))
+	if _, err := zz.ReadFileAt("meta/000.json", 0, 1, r); err == nil {
+		t.Errorf("read a file with a wrong preloaded dictionary")
+	}
+
+	var plain bytes.Buffer
+	w = estargz.NewWriterWithCompressor(&plain, &Compressor{CompressionLevel: zstd.SpeedDefault})
+	if err := w.AppendTar(bytes.NewReader(tarBuf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// Without a dictionary, only the footer and the TOC are read
+	plainChunks, err := new(Decompressor).ListChunks(bytes.NewReader(plain.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr := &recordingReaderAt{r: bytes.NewReader(plain.Bytes())}
+	if _, err := new(Decompressor).ExtractDictionary(pr); !errors.Is(err, ErrNoDictionary) {
+		t.Errorf("got %v for a layer without dictionary; want %v", err, ErrNoDictionary)
+	}
+	if _, err := new(Decompressor).ReadFileAt("meta/000.json", 0, int64(len(files["meta/000.json"])), pr); err != nil {
+		t.Fatal(err)
+	}
+	var fetched int
+	for _, c := range plainChunks {
+		if pr.overlaps(c.CompressedOffset, c.CompressedOffset+c.CompressedSize) {
+			fetched++
+		}
+	}
+	if fetched != 1 {
+		t.Errorf("reading a file of a layer without dictionary fetched %d of %d chunks; want 1", fetched, len(plainChunks))
+	}
+}
+
+func TestHashAlgorithm(t *testing.T) {
+	contents := map[string]string{
+		"large": strings.Repeat("chunked contents ", 1000),
+		"small": "small",
+	}
+	var tarBuf bytes.Buffer
+	tw := tar.NewWriter(&tarBuf)
+	for _, name := range []string{"large", "small"} {
+		if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0644, Size: int64(len(contents[name]))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(contents[name])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, alg := range []digest.Algorithm{"", digest.SHA256, digest.SHA512} {
+		t.Run(fmt.Sprintf("alg=%q", alg), func(t *testing.T) {
+			want := alg
+			if want == "" {
+				want = digest.SHA256
+			}
+			var blob bytes.Buffer
+			w := estargz.NewWriterWithCompressor(&blob, (&Compressor{CompressionLevel: zstd.SpeedDefault}).WithHashAlgorithm(alg))
+			w.ChunkSize = 4096
+			if err := w.AppendTar(bytes.NewReader(tarBuf.Bytes())); err != nil {
+				t.Fatal(err)
+			}
+			tocDgst, err := w.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := estargz.Open(io.NewSectionReader(bytes.NewReader(blob.Bytes()), 0, int64(blob.Len())), estargz.WithDecompressors(new(Decompressor)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			ev, err := r.VerifyTOC(tocDgst)
+			if err != nil {
+				t.Fatalf("failed to verify the TOC: %v", err)
+			}
+			for name, data := range contents {
+				e, ok := r.Lookup(name)
+				if !ok {
+					t.Fatalf("%s not found", name)
+				}
+				if e.Digest != want.FromString(data).String() {
+					t.Errorf("%s: Digest = %s; want the %s of the contents", name, e.Digest, want)
+				}
+				for off := int64(0); off < e.Size; {
+					ce, ok := r.ChunkEntryForOffset(name, off)
+					if !ok {
+						t.Fatalf("%s: chunk at %d not found", name, off)
+					}
+					if d, err := digest.Parse(ce.ChunkDigest); err != nil || d.Algorithm() != want {
+						t.Errorf("%s: ChunkDigest %q isn't a %s digest", name, ce.ChunkDigest, want)
+					}
+					v, err := ev.Verifier(ce)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if _, err := io.WriteString(v, data[off:off+ce.ChunkSize]); err != nil {
+						t.Fatal(err)
+					}
+					if !v.Verified() {
+						t.Errorf("%s: chunk at %d isn't verified", name, off)
+					}
+					off += ce.ChunkSize
+				}
+			}
+		})
+	}
+
+	w := estargz.NewWriterWithCompressor(io.Discard, new(Compressor).WithHashAlgorithm("sha1"))
+	if err := w.AppendTar(bytes.NewReader(tarBuf.Bytes())); err == nil {
+		t.Error("expected an error for an unavailable hash algorithm")
+	}
+}
+
+func TestConcurrentHasher(t *testing.T) {
+	var tarBuf bytes.Buffer
+	tw := tar.NewWriter(&tarBuf)
+	for i := 0; i < 10; i++ {
+		data := strings.Repeat(fmt.Sprintf("file %d ", i), 1000*i)
+		if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: fmt.Sprintf("file%d", i), Mode: 0644, Size: int64(len(data))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	build := func(workers int) (blob []byte, tocDgst digest.Digest) {
+		var buf bytes.Buffer
+		w := estargz.NewWriterWithCompressor(&buf, (&Compressor{CompressionLevel: zstd.SpeedDefault}).WithConcurrentHasher(workers))
+		w.ChunkSize = 4096
+		if err := w.AppendTar(bytes.NewReader(tarBuf.Bytes())); err != nil {
+			t.Fatal(err)
+		}
+		tocDgst, err := w.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes(), tocDgst
+	}
+	serial, serialTOC := build(0)
+	for _, workers := range []int{1, 2, 4} {
+		blob, tocDgst := build(workers)
+		if tocDgst != serialTOC || !bytes.Equal(blob, serial) {
+			t.Errorf("workers=%d: layer differs from the one built with serial hashing", workers)
+		}
+	}
+
+	// The digests are verified like the serial ones
+	blob, tocDgst := build(4)
+	r, err := estargz.Open(io.NewSectionReader(bytes.NewReader(blob), 0, int64(len(blob))), estargz.WithDecompressors(new(Decompressor)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.VerifyTOC(tocDgst); err != nil {
+		t.Errorf("failed to verify the TOC: %v", err)
+	}
+}
+
+// BenchmarkConcurrentHasher compares serial and concurrent chunk hashing for a
+// layer of 100 files of 10 MiB of incompressible data. The layer is streamed to
+// avoid holding 1 GB in memory.
+func BenchmarkConcurrentHasher(b *testing.B) {
+	const (
+		files    = 100
+		fileSize = 10 << 20
+	)
+	data := make([]byte, fileSize)
+	if _, err := crand.Read(data); err != nil {
+		b.Fatal(err)
+	}
+	layer := func() io.Reader {
+		pr, pw := io.Pipe()
+		go func() {
+			tw := tar.NewWriter(pw)
+			for i := 0; i < files; i++ {
+				if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: fmt.Sprintf("file%d", i), Mode: 0644, Size: fileSize}); err != nil {
+					pw.CloseWithError(err)
+					return
+				}
+				if _, err := tw.Write(data); err != nil {
+					pw.CloseWithError(err)
+					return
+				}
+			}
+			pw.CloseWithError(tw.Close())
+		}()
+		return pr
+	}
+
+	for _, workers := range []int{0, 4} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			b.SetBytes(files * fileSize)
+			for i := 0; i < b.N; i++ {
+				w := estargz.NewWriterWithCompressor(io.Discard, (&Compressor{CompressionLevel: zstd.SpeedFastest}).WithConcurrentHasher(workers))
+				if err := w.AppendTar(layer()); err != nil {
+					b.Fatal(err)
+				}
+				if _, err := w.Close(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
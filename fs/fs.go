@@ -38,6 +38,7 @@ package fs
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os/exec"
 	"strconv"
@@ -88,6 +89,7 @@ type options struct {
 	metricsLogLevel         *log.Level
 	overlayOpaqueType       layer.OverlayOpaqueType
 	additionalDecompressors func(context.Context, source.RegistryHosts, reference.Spec, ocispec.Descriptor) []metadata.Decompressor
+	preloadOnMount          bool
 }
 
 func WithGetSources(s source.GetSources) Option {
@@ -129,6 +131,14 @@ func WithAdditionalDecompressors(d func(context.Context, source.RegistryHosts, r
 	}
 }
 
+// WithPreloadOnMount makes Mount start fetching the priority files of the layer in
+// the background, without waiting for the first read. Preloading stops on Unmount.
+func WithPreloadOnMount(preload bool) Option {
+	return func(opts *options) {
+		opts.preloadOnMount = preload
+	}
+}
+
 func NewFilesystem(root string, cfg config.Config, opts ...Option) (_ snapshot.FileSystem, err error) {
 	var fsOpts options
 	for _, o := range opts {
@@ -196,6 +206,8 @@ func NewFilesystem(root string, cfg config.Config, opts ...Option) (_ snapshot.F
 		metricsController:     metricsCtr,
 		attrTimeout:           attrTimeout,
 		entryTimeout:          entryTimeout,
+		preloadOnMount:        fsOpts.preloadOnMount,
+		preloadCancels:        make(map[string]context.CancelFunc),
 	}, nil
 }
 
@@ -214,6 +226,8 @@ type filesystem struct {
 	metricsController     *layermetrics.Controller
 	attrTimeout           time.Duration
 	entryTimeout          time.Duration
+	preloadOnMount        bool
+	preloadCancels        map[string]context.CancelFunc // guarded by layerMu
 }
 
 func (fs *filesystem) Mount(ctx context.Context, mountpoint string, labels map[string]string) (retErr error) {
@@ -367,7 +381,31 @@ func (fs *filesystem) Mount(ctx context.Context, mountpoint string, labels map[s
 	}
 
 	go server.Serve()
-	return server.WaitMount()
+	if err := server.WaitMount(); err != nil {
+		return err
+	}
+	if fs.preloadOnMount {
+		fs.preload(ctx, mountpoint, l)
+	}
+	return nil
+}
+
+// preload fetches the priority files of the layer mounted at mountpoint in the
+// background until it completes or the layer is unmounted.
+func (fs *filesystem) preload(ctx context.Context, mountpoint string, l layer.Layer) {
+	// Avoids to get canceled by client.
+	ctx, cancel := context.WithCancel(log.WithLogger(context.Background(), log.G(ctx)))
+	fs.layerMu.Lock()
+	fs.preloadCancels[mountpoint] = cancel
+	fs.layerMu.Unlock()
+	go func() {
+		defer cancel()
+		if err := layer.PreloadMount(ctx, l); err != nil && !errors.Is(err, context.Canceled) {
+			log.G(ctx).WithError(err).Warn("failed to preload priority files")
+			return
+		}
+		log.G(ctx).Debug("completed to preload priority files")
+	}()
 }
 
 func (fs *filesystem) Check(ctx context.Context, mountpoint string, labels map[string]string) error {
@@ -450,6 +488,10 @@ func (fs *filesystem) Unmount(ctx context.Context, mountpoint string) error {
 		fs.layerMu.Unlock()
 		return fmt.Errorf("specified path %q isn't a mountpoint", mountpoint)
 	}
+	if cancel, ok := fs.preloadCancels[mountpoint]; ok {
+		cancel() // stops preloading the layer
+		delete(fs.preloadCancels, mountpoint)
+	}
 	delete(fs.layer, mountpoint)      // unregisters the corresponding layer
 	if err := l.Close(); err != nil { // Cleanup associated resources
 		log.G(ctx).WithError(err).Warn("failed to release resources of the layer")
@@ -77,6 +77,10 @@ func (l *breakableLayer) Prefetch(prefetchSize int64) error             { return
 func (l *breakableLayer) ReadAt([]byte, int64, ...remote.Option) (int, error) {
 	return 0, fmt.Errorf("fail")
 }
+func (l *breakableLayer) PrefetchFiles(context.Context, []string) error {
+	return fmt.Errorf("fail")
+}
+func (l *breakableLayer) PriorityFiles() []string          { return nil }
 func (l *breakableLayer) WaitForPrefetchCompletion() error { return fmt.Errorf("fail") }
 func (l *breakableLayer) BackgroundFetch() error           { return fmt.Errorf("fail") }
 func (l *breakableLayer) Check() error {
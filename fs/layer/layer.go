@@ -97,6 +97,14 @@ type Layer interface {
 	// the range indicated by these files is respected.
 	Prefetch(prefetchSize int64) error
 
+	// PrefetchFiles fetches and caches the chunks of the specified files. Paths that
+	// don't exist in the layer or aren't regular files are ignored.
+	PrefetchFiles(ctx context.Context, paths []string) error
+
+	// PriorityFiles returns the prioritized files recorded in the TOC of this layer, in the
+	// prefetch order. Nil if the TOC doesn't record them.
+	PriorityFiles() []string
+
 	// ReadAt reads this layer.
 	ReadAt([]byte, int64, ...remote.Option) (int, error)
 
@@ -316,7 +324,8 @@ func (r *Resolver) Resolve(ctx context.Context, hosts source.RegistryHosts, refs
 		},
 	}
 
-	additionalDecompressors := []metadata.Decompressor{new(zstdchunked.Decompressor)}
+	zstdDecompressor := new(zstdchunked.Decompressor)
+	additionalDecompressors := []metadata.Decompressor{zstdDecompressor}
 	if r.additionalDecompressors != nil {
 		additionalDecompressors = append(additionalDecompressors, r.additionalDecompressors(ctx, hosts, refspec, desc)...)
 	}
@@ -336,6 +345,7 @@ func (r *Resolver) Resolve(ctx context.Context, hosts source.RegistryHosts, refs
 		mergeBufferSize:  r.config.MergeBufferSize,
 		mergeWorkerCount: r.config.MergeWorkerCount,
 	})
+	l.priorityFiles = zstdDecompressor.PriorityFiles()
 	r.layerCacheMu.Lock()
 	cachedL, done2, added := r.layerCache.Add(name, l)
 	r.layerCacheMu.Unlock()
@@ -417,6 +427,8 @@ type layer struct {
 	prefetchSize   int64
 	prefetchSizeMu sync.Mutex
 
+	priorityFiles []string
+
 	r reader.Reader
 
 	closed   bool
@@ -550,6 +562,51 @@ func (l *layer) prefetch(ctx context.Context, prefetchSize int64) error {
 	return nil
 }
 
+func (l *layer) PrefetchFiles(ctx context.Context, paths []string) error {
+	if l.isClosed() {
+		return fmt.Errorf("layer is already closed")
+	}
+	mr := l.verifiableReader.Metadata()
+	offsets := make(map[int64]struct{})
+	for _, p := range paths {
+		id, err := lookup(mr, p)
+		if err != nil {
+			continue // unknown path
+		}
+		attr, err := mr.GetAttr(id)
+		if err != nil || !attr.Mode.IsRegular() {
+			continue
+		}
+		offset, err := mr.GetOffset(id)
+		if err != nil {
+			return fmt.Errorf("failed to get offset of %q: %w", p, err)
+		}
+		offsets[offset] = struct{}{}
+	}
+	if len(offsets) == 0 {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	l.resolver.backgroundTaskManager.DoPrioritizedTask()
+	defer l.resolver.backgroundTaskManager.DonePrioritizedTask()
+
+	// Files sharing a compressed stream have the same offset so they are cached together.
+	if err := l.verifiableReader.Cache(reader.WithFilter(func(offset int64) bool {
+		_, ok := offsets[offset]
+		return ok
+	})); err != nil {
+		return fmt.Errorf("failed to cache files: %w", err)
+	}
+	return nil
+}
+
+func (l *layer) PriorityFiles() []string {
+	return l.priorityFiles
+}
+
 func (l *layer) WaitForPrefetchCompletion() error {
 	if l.isClosed() {
 		return fmt.Errorf("layer is already closed")
@@ -23,10 +23,24 @@
 package layer
 
 import (
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/containerd/stargz-snapshotter/cache"
+	"github.com/containerd/stargz-snapshotter/estargz"
+	"github.com/containerd/stargz-snapshotter/fs/reader"
+	"github.com/containerd/stargz-snapshotter/metadata"
 	memorymetadata "github.com/containerd/stargz-snapshotter/metadata/memory"
+	"github.com/containerd/stargz-snapshotter/task"
+	tutil "github.com/containerd/stargz-snapshotter/util/testutil"
+	fusefs "github.com/hanwen/go-fuse/v2/fs"
+	"github.com/klauspost/compress/zstd"
+	digest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 func TestLayer(t *testing.T) {
@@ -59,3 +73,161 @@ func TestWaiter(t *testing.T) {
 		t.Errorf("wait time is too short: %v; want %v", doneTime.Sub(startTime), waitTime)
 	}
 }
+
+func TestPreloadMount(t *testing.T) {
+	l, ra := newPreloadLayer(t, 0)
+	if got := l.PriorityFiles(); len(got) != 1 || got[0] != "foo/bar.txt" {
+		t.Fatalf("priority files %v; want [foo/bar.txt]", got)
+	}
+
+	if err := PreloadMount(context.Background(), l); err != nil {
+		t.Fatalf("failed to preload: %v", err)
+	}
+	root := preloadRootNode(t, l)
+	ra.reads.Store(0)
+	if data := readFile(t, root, "foo/bar.txt", int64(len(sampleData1)), 0); string(data) != sampleData1 {
+		t.Errorf("unexpected contents of priority file: %q", data)
+	}
+	if n := ra.reads.Load(); n != 0 {
+		t.Errorf("priority file is read from the blob %d times after preloading; want 0", n)
+	}
+	readFile(t, root, "baz.txt", int64(len(sampleData2)), 0)
+	if ra.reads.Load() == 0 {
+		t.Errorf("non-priority file is preloaded")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	l, _ = newPreloadLayer(t, 0)
+	if err := PreloadMount(ctx, l); !errors.Is(err, context.Canceled) {
+		t.Errorf("preload with canceled context: got %v; want context.Canceled", err)
+	}
+}
+
+// BenchmarkPreloadMount measures the latency of opening and reading a priority file
+// through FUSE nodes on a fresh mount, with and without preloading its chunks.
+func BenchmarkPreloadMount(b *testing.B) {
+	for _, preload := range []bool{false, true} {
+		name := "without-preload"
+		if preload {
+			name = "with-preload"
+		}
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				l, _ := newPreloadLayer(b, time.Millisecond)
+				if preload {
+					if err := PreloadMount(context.Background(), l); err != nil {
+						b.Fatalf("failed to preload: %v", err)
+					}
+				}
+				root := preloadRootNode(b, l)
+				b.StartTimer()
+
+				readFile(b, root, "foo/bar.txt", int64(len(sampleData1)), 0)
+			}
+		})
+	}
+}
+
+// BenchmarkPrefetchFiles measures the latency of opening and reading a file through
+// FUSE nodes with each blob read delayed by 1ms, with and without warming it with
+// PrefetchFiles first. The prefetched file is served from the cache: it reads the
+// blob 0 times per op, so it doesn't wait for the network at all.
+func BenchmarkPrefetchFiles(b *testing.B) {
+	for _, prefetch := range []bool{false, true} {
+		name := "without-prefetch"
+		if prefetch {
+			name = "with-prefetch"
+		}
+		b.Run(name, func(b *testing.B) {
+			var reads int64
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				l, ra := newPreloadLayer(b, time.Millisecond)
+				if prefetch {
+					if err := l.PrefetchFiles(context.Background(), []string{"baz.txt"}); err != nil {
+						b.Fatalf("failed to prefetch files: %v", err)
+					}
+				}
+				root := preloadRootNode(b, l)
+				ra.reads.Store(0)
+				b.StartTimer()
+
+				readFile(b, root, "baz.txt", int64(len(sampleData2)), 0)
+				reads += ra.reads.Load()
+			}
+			b.ReportMetric(float64(reads)/float64(b.N), "blob-reads/op")
+			if prefetch && reads != 0 {
+				b.Errorf("prefetched file was read from the blob %d times; want 0", reads)
+			}
+		})
+	}
+}
+
+// countingReaderAt counts the reads of a blob and delays them by delay to simulate
+// fetching from a registry.
+type countingReaderAt struct {
+	r     io.ReaderAt
+	delay time.Duration
+	reads atomic.Int64
+}
+
+func (c *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	c.reads.Add(1)
+	time.Sleep(c.delay)
+	return c.r.ReadAt(p, off)
+}
+
+// newPreloadLayer returns a verified zstd:chunked layer whose TOC records
+// "foo/bar.txt" as a priority file, with the blob reads going through the returned
+// countingReaderAt.
+func newPreloadLayer(tb testing.TB, delay time.Duration) (Layer, *countingReaderAt) {
+	cl := tutil.ZstdCompressionWithLevel(zstd.SpeedFastest)()
+	sr, dgst, err := tutil.BuildEStargz([]tutil.TarEntry{
+		tutil.Dir("foo/"),
+		tutil.File("foo/bar.txt", sampleData1),
+		tutil.File("baz.txt", sampleData2),
+	}, tutil.WithEStargzOptions(
+		estargz.WithChunkSize(sampleChunkSize),
+		estargz.WithCompression(cl),
+		estargz.WithPrioritizedFiles([]string{"foo/bar.txt"}),
+	))
+	if err != nil {
+		tb.Fatalf("failed to build eStargz: %v", err)
+	}
+	ra := &countingReaderAt{r: sr, delay: delay}
+	mr, err := memorymetadata.NewReader(io.NewSectionReader(ra, 0, sr.Size()), metadata.WithDecompressors(cl))
+	if err != nil {
+		tb.Fatalf("failed to create metadata reader: %v", err)
+	}
+	tb.Cleanup(func() { mr.Close() })
+	vr, err := reader.NewReader(mr, cache.NewMemoryCache(), digest.FromString(""))
+	if err != nil {
+		tb.Fatalf("failed to create reader: %v", err)
+	}
+	l := newLayer(
+		&Resolver{
+			prefetchTimeout:       time.Second,
+			backgroundTaskManager: task.NewBackgroundTaskManager(10, 5*time.Second),
+		},
+		ocispec.Descriptor{Digest: testStateLayerDigest},
+		&blobRef{&sampleBlob{r: sr}, func(bool) {}},
+		vr,
+		passThroughConfig{},
+	)
+	l.priorityFiles = cl.(interface{ PriorityFiles() []string }).PriorityFiles()
+	if err := l.Verify(dgst); err != nil {
+		tb.Fatalf("failed to verify reader: %v", err)
+	}
+	return &layerRef{l, func(bool) {}}, ra
+}
+
+func preloadRootNode(tb testing.TB, l Layer) *node {
+	root, err := l.RootNode(0)
+	if err != nil {
+		tb.Fatalf("failed to get root node: %v", err)
+	}
+	fusefs.NewNodeFS(root, &fusefs.Options{}) // initializes root node
+	return root.(*node)
+}
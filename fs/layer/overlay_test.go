@@ -0,0 +1,212 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package layer
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/containerd/containerd/v2/pkg/testutil"
+	"github.com/containerd/stargz-snapshotter/cache"
+	"github.com/containerd/stargz-snapshotter/estargz"
+	"github.com/containerd/stargz-snapshotter/fs/reader"
+	"github.com/containerd/stargz-snapshotter/metadata"
+	memorymetadata "github.com/containerd/stargz-snapshotter/metadata/memory"
+	tutil "github.com/containerd/stargz-snapshotter/util/testutil"
+	fusefs "github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	digest "github.com/opencontainers/go-digest"
+	"golang.org/x/sys/unix"
+)
+
+// lockedBuffer is a bytes.Buffer safe for the concurrent writes of the FUSE server's logger
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// TestFuseMountWithOverlay mounts a layer over FUSE as the lower directory of an
+// overlayfs, writes to the overlayfs like a container does and checks that the
+// reads of the layer still return its contents. Writes go to the upper directory
+// so FUSE write-back caching can't apply; the test also checks that the FUSE init
+// handshake doesn't enable it behind the snapshotter's back.
+func TestFuseMountWithOverlay(t *testing.T) {
+	testutil.RequiresRoot(t)
+
+	files := map[string]string{
+		"a":     strings.Repeat("0123456789", 1000),
+		"dir/b": strings.Repeat("abcdefghij", 500),
+		"dir/c": "c",
+	}
+	cl := srcCompressions["zstd-fastest"]()
+	sr, tocDgst, err := tutil.BuildEStargz([]tutil.TarEntry{
+		tutil.File("a", files["a"]),
+		tutil.Dir("dir/"),
+		tutil.File("dir/b", files["dir/b"]),
+		tutil.File("dir/c", files["dir/c"]),
+	}, tutil.WithEStargzOptions(estargz.WithChunkSize(1000), estargz.WithCompression(cl)))
+	if err != nil {
+		t.Fatalf("failed to build sample eStargz: %v", err)
+	}
+	mr, err := memorymetadata.NewReader(sr, metadata.WithDecompressors(cl))
+	if err != nil {
+		t.Fatalf("failed to create metadata reader: %v", err)
+	}
+	defer mr.Close()
+	vr, err := reader.NewReader(mr, cache.NewMemoryCache(), digest.FromString(""))
+	if err != nil {
+		t.Fatalf("failed to create reader: %v", err)
+	}
+	rr, err := vr.VerifyTOC(tocDgst)
+	if err != nil {
+		t.Fatalf("failed to verify reader: %v", err)
+	}
+	root, err := newNode(testStateLayerDigest, rr, &testBlobState{10, 5}, 100, OverlayOpaqueAll, passThroughConfig{})
+	if err != nil {
+		t.Fatalf("failed to get root node: %v", err)
+	}
+
+	dir := t.TempDir()
+	lower, upper, work, merged := filepath.Join(dir, "lower"), filepath.Join(dir, "upper"), filepath.Join(dir, "work"), filepath.Join(dir, "merged")
+	for _, d := range []string{lower, upper, work, merged} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The same options as the snapshotter's mounts, with the debug log of the
+	// FUSE requests captured
+	var fuseLog lockedBuffer
+	server, err := fuse.NewServer(fusefs.NewNodeFS(root, &fusefs.Options{NullPermissions: true}), lower, &fuse.MountOptions{
+		AllowOther:  true,
+		FsName:      "stargz",
+		DirectMount: true,
+		Debug:       true,
+		Logger:      log.New(&fuseLog, "", 0),
+	})
+	if err != nil {
+		t.Fatalf("failed to mount FUSE: %v", err)
+	}
+	go server.Serve()
+	defer server.Unmount()
+	if err := server.WaitMount(); err != nil {
+		t.Fatalf("failed to wait for FUSE mount: %v", err)
+	}
+	if server.KernelSettings().Flags64()&fuse.CAP_WRITEBACK_CACHE == 0 {
+		t.Logf("kernel doesn't offer FUSE_WRITEBACK_CACHE")
+	}
+	if reply := initReply(fuseLog.String()); reply == "" {
+		t.Errorf("INIT reply isn't in the FUSE log:\n%s", fuseLog.String())
+	} else if strings.Contains(reply, "WRITEBACK_CACHE") {
+		t.Errorf("FUSE_WRITEBACK_CACHE is enabled for the read-only layer: %s", reply)
+	}
+
+	if err := unix.Mount("overlay", merged, "overlay", 0,
+		fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s", lower, upper, work)); err != nil {
+		t.Fatalf("failed to mount overlayfs: %v", err)
+	}
+	defer unix.Unmount(merged, 0)
+
+	// A container overwrites part of a file of the layer, which copies it up, and
+	// creates another one next to the layer's files
+	f, err := os.OpenFile(filepath.Join(merged, "a"), os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte("written"), 5000); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(merged, "dir", "new"), []byte("new file"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	written := files["a"][:5000] + "written" + files["a"][5007:]
+	for _, tt := range []struct {
+		path, want string
+	}{
+		{filepath.Join(merged, "a"), written},
+		{filepath.Join(merged, "dir", "b"), files["dir/b"]},
+		{filepath.Join(merged, "dir", "c"), files["dir/c"]},
+		{filepath.Join(merged, "dir", "new"), "new file"},
+		{filepath.Join(upper, "a"), written},
+		// The layer itself is unchanged
+		{filepath.Join(lower, "a"), files["a"]},
+		{filepath.Join(lower, "dir", "b"), files["dir/b"]},
+	} {
+		if got, err := os.ReadFile(tt.path); err != nil {
+			t.Errorf("failed to read %s: %v", tt.path, err)
+		} else if string(got) != tt.want {
+			t.Errorf("%s has %d bytes that don't match the expected %d bytes", tt.path, len(got), len(tt.want))
+		}
+	}
+	if _, err := os.Stat(filepath.Join(lower, "dir", "new")); !os.IsNotExist(err) {
+		t.Errorf("file created in the overlayfs exists in the layer: %v", err)
+	}
+
+	// Reads spanning chunks of the layer through the overlayfs
+	bf, err := os.Open(filepath.Join(merged, "dir", "b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bf.Close()
+	for _, off := range []int64{0, 999, 1000, 2500, 4990} {
+		buf := make([]byte, 10)
+		n, err := bf.ReadAt(buf, off)
+		if err != nil {
+			t.Fatalf("failed to read dir/b at %d: %v", off, err)
+		}
+		if want := files["dir/b"][off : off+int64(n)]; string(buf[:n]) != want {
+			t.Errorf("dir/b at %d = %q; want %q", off, buf[:n], want)
+		}
+	}
+}
+
+// initReply returns the reply to the FUSE INIT request in the debug log of a server
+func initReply(fuseLog string) string {
+	var id string
+	for _, line := range strings.Split(fuseLog, "\n") {
+		if id == "" {
+			if fields := strings.Fields(line); len(fields) > 2 && fields[0] == "rx" && fields[2] == "INIT" {
+				id = fields[1]
+			}
+		} else if strings.HasPrefix(line, "tx "+id) {
+			return line
+		}
+	}
+	return ""
+}
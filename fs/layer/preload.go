@@ -0,0 +1,50 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package layer
+
+import (
+	"context"
+
+	compzstd "github.com/containerd/stargz-snapshotter/compression/zstd"
+	"golang.org/x/sync/errgroup"
+)
+
+// PreloadMount fetches and caches the chunks of the priority files of the layer, as
+// recorded in its TOC, without waiting for them to be read through FUSE. Files are
+// fetched by up to compzstd.GetOptimalWorkerCount() goroutines. It returns once all
+// files are cached, one of them fails or ctx is done.
+func PreloadMount(ctx context.Context, l Layer) error {
+	files := l.PriorityFiles()
+	if len(files) == 0 {
+		return nil
+	}
+	eg, egCtx := errgroup.WithContext(ctx)
+	eg.SetLimit(compzstd.GetOptimalWorkerCount())
+	for _, p := range files {
+		if egCtx.Err() != nil {
+			break
+		}
+		p := p
+		eg.Go(func() error {
+			return l.PrefetchFiles(egCtx, []string{p})
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
@@ -110,6 +110,7 @@ func TestSuiteLayer(t *testing.T, store metadata.Store) {
 		},
 	} {
 		testPrefetch(t, store, lc)
+		testPrefetchFiles(t, store, lc)
 		testNodeRead(t, store, lc)
 		testNodes(t, store, lc)
 	}
@@ -314,6 +315,86 @@ func testPrefetch(t *testing.T, factory metadata.Store, lc layerConfig) {
 	}
 }
 
+func testPrefetchFiles(t *testing.T, factory metadata.Store, lc layerConfig) {
+	in := []tutil.TarEntry{
+		tutil.Dir("foo/"),
+		tutil.File("foo/bar.txt", sampleData1),
+		tutil.File("baz.txt", sampleData2),
+		tutil.Symlink("link", "baz.txt"),
+	}
+	for srcCompressionName, srcCompression := range srcCompressions {
+		cl := srcCompression()
+		t.Run("testPrefetchFiles-"+srcCompressionName+"-"+lc.name, func(t *testing.T) {
+			sr, dgst, err := tutil.BuildEStargz(in,
+				tutil.WithEStargzOptions(
+					estargz.WithChunkSize(sampleChunkSize),
+					estargz.WithCompression(cl),
+				))
+			if err != nil {
+				t.Fatalf("failed to build eStargz: %v", err)
+			}
+			blob := newBlob(t, sr)
+			mcache := cache.NewMemoryCache()
+			mr, err := factory(sr, metadata.WithDecompressors(cl))
+			if err != nil {
+				t.Fatalf("failed to create metadata reader: %v", err)
+			}
+			defer mr.Close()
+			vr, err := reader.NewReader(mr, mcache, digest.FromString(""))
+			if err != nil {
+				t.Fatalf("failed to create reader: %v", err)
+			}
+			l := newLayer(
+				&Resolver{
+					prefetchTimeout:       time.Second,
+					backgroundTaskManager: task.NewBackgroundTaskManager(10, 5*time.Second),
+				},
+				ocispec.Descriptor{Digest: testStateLayerDigest},
+				&blobRef{blob, func(bool) {}},
+				vr,
+				lc.passThroughConfig,
+			)
+			if err := l.Verify(dgst); err != nil {
+				t.Fatalf("failed to verify reader: %v", err)
+			}
+
+			// Unknown paths and non-regular files are ignored
+			if err := l.PrefetchFiles(context.Background(), []string{"foo/", "link", "unknown"}); err != nil {
+				t.Fatalf("failed to prefetch files: %v", err)
+			}
+			if cLen := len(mcache.(*cache.MemoryCache).Membuf); cLen != 0 {
+				t.Fatalf("number of chunks in the cache %d; want 0", cLen)
+			}
+
+			if err := l.PrefetchFiles(context.Background(), []string{"foo/bar.txt"}); err != nil {
+				t.Fatalf("failed to prefetch files: %v", err)
+			}
+			if cLen, wantNum := len(mcache.(*cache.MemoryCache).Membuf), chunkNum(sampleData1); cLen != wantNum {
+				t.Fatalf("number of chunks in the cache %d; want %d", cLen, wantNum)
+			}
+			id, err := lookup(l.r.Metadata(), "foo/bar.txt")
+			if err != nil {
+				t.Fatalf("failed to lookup file: %v", err)
+			}
+			f, err := l.r.OpenFile(id)
+			if err != nil {
+				t.Fatalf("failed to open file: %v", err)
+			}
+			blob.readCalled = false
+			data, err := io.ReadAll(io.NewSectionReader(f, 0, int64(len(sampleData1))))
+			if err != nil {
+				t.Fatalf("failed to read file: %v", err)
+			}
+			if string(data) != sampleData1 {
+				t.Errorf("unexpected contents of prefetched file")
+			}
+			if blob.readCalled {
+				t.Errorf("chunks of prefetched file aren't cached")
+			}
+		})
+	}
+}
+
 func lookup(r metadata.Reader, name string) (uint32, error) {
 	name = strings.TrimPrefix(path.Clean("/"+name), "/")
 	if name == "" {
@@ -958,7 +1039,7 @@ func hasNodeXattrs(entry, name, value string) check {
 	}
 }
 
-func hasEntry(t *testing.T, name string, ents fusefs.DirStream) (fuse.DirEntry, bool) {
+func hasEntry(t testing.TB, name string, ents fusefs.DirStream) (fuse.DirEntry, bool) {
 	for ents.HasNext() {
 		de, errno := ents.Next()
 		if errno != 0 {
@@ -1069,7 +1150,7 @@ func hasStateFile(t *testing.T, id string) check {
 
 // getDirentAndNode gets dirent and node at the specified path at once and makes
 // sure that the both of them exist.
-func getDirentAndNode(t *testing.T, root *node, path string) (ent fuse.DirEntry, n *fusefs.Inode, err error) {
+func getDirentAndNode(t testing.TB, root *node, path string) (ent fuse.DirEntry, n *fusefs.Inode, err error) {
 	dir, base := filepath.Split(filepath.Clean(path))
 
 	// get the target's parent directory.
@@ -1189,7 +1270,7 @@ func hasFileContentsOffset(name string, off int64, contents string, fromCache bo
 	}
 }
 
-func readFile(t *testing.T, root *node, filename string, size, off int64) []byte {
+func readFile(t testing.TB, root *node, filename string, size, off int64) []byte {
 	_, n, err := getDirentAndNode(t, root, filename)
 	if err != nil {
 		t.Fatalf("failed to get node %q: %v", filename, err)
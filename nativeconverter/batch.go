@@ -0,0 +1,325 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package nativeconverter
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"sync"
+
+	"github.com/containerd/containerd/v2/core/content"
+	"github.com/containerd/containerd/v2/core/images/converter"
+	"github.com/containerd/containerd/v2/plugins/content/local"
+	"github.com/containerd/errdefs"
+	"github.com/containerd/log"
+	"github.com/containerd/platforms"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// DryRunAnnotation is set to "true" on the descriptors returned by BatchConvert
+// in dry-run mode. Their blobs don't exist in the content store.
+const DryRunAnnotation = "io.containerd.stargz.v1.dry-run"
+
+// WithDryRun makes BatchConvert convert the images without modifying the content
+// store, for estimating the size of the converted images. The descriptors in the
+// report have the sizes of the converted blobs, which are discarded. Each layer is
+// written to a temporary directory until its conversion is done; only the manifests
+// and the configs are kept there until BatchConvert returns.
+func WithDryRun() ConvertOption {
+	return func(o *convertOptions) {
+		o.dryRun = true
+	}
+}
+
+// LayerReport describes the conversion of a layer.
+type LayerReport struct {
+	Original  ocispec.Descriptor
+	Converted ocispec.Descriptor
+}
+
+// ConversionReport is the result of BatchConvert.
+type ConversionReport struct {
+	// DryRun is true if the images were converted with WithDryRun.
+	DryRun bool
+
+	// Images are the descriptors of the converted images in the order passed to
+	// BatchConvert. Images that didn't need conversion are returned as is.
+	Images []ocispec.Descriptor
+
+	// Layers are the layers that were converted, in the order their conversions finished.
+	Layers []LayerReport
+
+	// OriginalSize and ConvertedSize are the total sizes of Layers before and
+	// after the conversion.
+	OriginalSize  int64
+	ConvertedSize int64
+}
+
+// BatchConvert converts the images (manifests or indexes) with the function
+// specified by WithLayerConvertFunc, wrapped with the hooks specified by opts, and
+// reports the converted layers and their sizes.
+func BatchConvert(ctx context.Context, cs content.Store, imgs []ocispec.Descriptor, opts ...ConvertOption) (*ConversionReport, error) {
+	var o convertOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.layerConvert == nil {
+		return nil, fmt.Errorf("layer convert func must be specified with WithLayerConvertFunc")
+	}
+	var upper *dryRunStore
+	if o.dryRun {
+		dir, err := os.MkdirTemp("", "stargz-dry-run")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(dir)
+		// The labels record the uncompressed digests of the discarded layers
+		scratch, err := local.NewLabeledStore(dir, &memoryLabelStore{labels: make(map[digest.Digest]map[string]string)})
+		if err != nil {
+			return nil, err
+		}
+		upper = &dryRunStore{Store: scratch, discarded: make(map[digest.Digest]content.Info)}
+		cs = &overlayStore{Store: cs, upper: upper}
+	}
+
+	var mu sync.Mutex
+	layerConvert := func(ctx context.Context, cs content.Store, desc ocispec.Descriptor) (*ocispec.Descriptor, error) {
+		if !o.dryRun {
+			return o.layerConvert(ctx, cs, desc)
+		}
+		// Records the blobs written by the conversion (the converted layer and
+		// e.g. the uncompressed one) for discarding them once it's done
+		written := &rollbackStore{Store: cs, ctx: ctx}
+		upper.begin()
+		newDesc, err := o.layerConvert(ctx, written, desc)
+		upper.end(ctx, written.committed)
+		if err != nil || newDesc == nil {
+			return newDesc, err
+		}
+		return markDryRun(*newDesc), nil
+	}
+	report := &ConversionReport{DryRun: o.dryRun}
+	reportLayer := func(ctx context.Context, cs content.Store, desc ocispec.Descriptor) (*ocispec.Descriptor, error) {
+		newDesc, err := layerConvert(ctx, cs, desc)
+		if err != nil || newDesc == nil {
+			return newDesc, err
+		}
+		mu.Lock()
+		report.Layers = append(report.Layers, LayerReport{Original: desc, Converted: *newDesc})
+		report.OriginalSize += desc.Size
+		report.ConvertedSize += newDesc.Size
+		mu.Unlock()
+		return newDesc, nil
+	}
+	const docker2oci = false
+	cf := converter.DefaultIndexConvertFunc(LayerConvertFunc(reportLayer, opts...), docker2oci, platforms.All)
+	for _, img := range imgs {
+		newDesc, err := cf(ctx, cs, img)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert image %s: %w", img.Digest, err)
+		}
+		if newDesc == nil {
+			report.Images = append(report.Images, img)
+			continue
+		}
+		if o.dryRun {
+			newDesc = markDryRun(*newDesc)
+		}
+		report.Images = append(report.Images, *newDesc)
+	}
+	return report, nil
+}
+
+// markDryRun returns a copy of desc with DryRunAnnotation
+func markDryRun(desc ocispec.Descriptor) *ocispec.Descriptor {
+	d := copyDescriptor(&desc)
+	if d.Annotations == nil {
+		d.Annotations = make(map[string]string, 1)
+	}
+	d.Annotations[DryRunAnnotation] = "true"
+	return d
+}
+
+// dryRunStore is the store written by a dry run. The blobs of the layers are deleted
+// once they're converted, but their info (e.g. the uncompressed digest label) is
+// kept for converting the manifests referencing them.
+type dryRunStore struct {
+	content.Store
+
+	mu        sync.Mutex
+	active    int             // number of running layer conversions
+	pending   []digest.Digest // blobs of the finished conversions to discard
+	discarded map[digest.Digest]content.Info
+}
+
+// begin is called before converting a layer
+func (s *dryRunStore) begin() {
+	s.mu.Lock()
+	s.active++
+	s.mu.Unlock()
+}
+
+// end is called after converting a layer with the blobs written by the conversion.
+// They're discarded once no conversion is running, as concurrent conversions may
+// share them (e.g. the uncompressed blob of a layer referenced by two manifests).
+func (s *dryRunStore) end(ctx context.Context, dgsts []digest.Digest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.active--
+	s.pending = append(s.pending, dgsts...)
+	if s.active > 0 {
+		return
+	}
+	for _, dgst := range s.pending {
+		info, err := s.Store.Info(ctx, dgst)
+		if err != nil {
+			continue
+		}
+		if err := s.Store.Delete(ctx, dgst); err != nil {
+			log.G(ctx).WithError(err).Warnf("failed to discard blob %s of dry run", dgst)
+			continue
+		}
+		s.discarded[dgst] = info
+	}
+	s.pending = nil
+}
+
+func (s *dryRunStore) Info(ctx context.Context, dgst digest.Digest) (content.Info, error) {
+	s.mu.Lock()
+	info, ok := s.discarded[dgst]
+	s.mu.Unlock()
+	if ok {
+		return info, nil
+	}
+	return s.Store.Info(ctx, dgst)
+}
+
+// Update doesn't change the info of the discarded blobs
+func (s *dryRunStore) Update(ctx context.Context, info content.Info, fieldpaths ...string) (content.Info, error) {
+	s.mu.Lock()
+	discarded, ok := s.discarded[info.Digest]
+	s.mu.Unlock()
+	if ok {
+		return discarded, nil
+	}
+	return s.Store.Update(ctx, info, fieldpaths...)
+}
+
+// memoryLabelStore is a local.LabelStore keeping the labels in memory
+type memoryLabelStore struct {
+	mu     sync.Mutex
+	labels map[digest.Digest]map[string]string
+}
+
+func (s *memoryLabelStore) Get(dgst digest.Digest) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return maps.Clone(s.labels[dgst]), nil
+}
+
+func (s *memoryLabelStore) Set(dgst digest.Digest, labels map[string]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.labels[dgst] = maps.Clone(labels)
+	return nil
+}
+
+func (s *memoryLabelStore) Update(dgst digest.Digest, update map[string]string) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	labels := s.labels[dgst]
+	if labels == nil {
+		labels = make(map[string]string)
+		s.labels[dgst] = labels
+	}
+	for k, v := range update {
+		if v == "" {
+			delete(labels, k)
+		} else {
+			labels[k] = v
+		}
+	}
+	return maps.Clone(labels), nil
+}
+
+// overlayStore reads from the embedded store and upper but writes only to upper,
+// so that the embedded store isn't modified.
+type overlayStore struct {
+	content.Store
+	upper content.Store
+}
+
+func (s *overlayStore) Info(ctx context.Context, dgst digest.Digest) (content.Info, error) {
+	info, err := s.upper.Info(ctx, dgst)
+	if errdefs.IsNotFound(err) {
+		return s.Store.Info(ctx, dgst)
+	}
+	return info, err
+}
+
+func (s *overlayStore) ReaderAt(ctx context.Context, desc ocispec.Descriptor) (content.ReaderAt, error) {
+	ra, err := s.upper.ReaderAt(ctx, desc)
+	if errdefs.IsNotFound(err) {
+		return s.Store.ReaderAt(ctx, desc)
+	}
+	return ra, err
+}
+
+// Update changes only the blobs in upper. The labels of the other blobs are
+// returned unchanged.
+func (s *overlayStore) Update(ctx context.Context, info content.Info, fieldpaths ...string) (content.Info, error) {
+	newInfo, err := s.upper.Update(ctx, info, fieldpaths...)
+	if errdefs.IsNotFound(err) {
+		return s.Store.Info(ctx, info.Digest)
+	}
+	return newInfo, err
+}
+
+func (s *overlayStore) Walk(ctx context.Context, fn content.WalkFunc, filters ...string) error {
+	if err := s.upper.Walk(ctx, fn, filters...); err != nil {
+		return err
+	}
+	return s.Store.Walk(ctx, func(info content.Info) error {
+		if _, err := s.upper.Info(ctx, info.Digest); err == nil {
+			return nil
+		}
+		return fn(info)
+	}, filters...)
+}
+
+func (s *overlayStore) Delete(ctx context.Context, dgst digest.Digest) error {
+	return s.upper.Delete(ctx, dgst)
+}
+
+func (s *overlayStore) Writer(ctx context.Context, opts ...content.WriterOpt) (content.Writer, error) {
+	return s.upper.Writer(ctx, opts...)
+}
+
+func (s *overlayStore) Status(ctx context.Context, ref string) (content.Status, error) {
+	return s.upper.Status(ctx, ref)
+}
+
+func (s *overlayStore) ListStatuses(ctx context.Context, filters ...string) ([]content.Status, error) {
+	return s.upper.ListStatuses(ctx, filters...)
+}
+
+func (s *overlayStore) Abort(ctx context.Context, ref string) error {
+	return s.upper.Abort(ctx, ref)
+}
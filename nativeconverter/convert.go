@@ -0,0 +1,184 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package nativeconverter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/containerd/containerd/v2/core/content"
+	"github.com/containerd/containerd/v2/core/images"
+	"github.com/containerd/containerd/v2/core/images/converter"
+	"github.com/containerd/platforms"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/semaphore"
+)
+
+// VerifyFunc checks the input layer desc stored in cs before it is converted.
+type VerifyFunc func(ctx context.Context, desc ocispec.Descriptor, cs content.Store) error
+
+// ConvertOption configures LayerConvertFunc, ConvertManifestList and BatchConvert.
+type ConvertOption func(o *convertOptions)
+
+// PostConvertFunc is called with the descriptor of a successfully converted layer.
+type PostConvertFunc func(ctx context.Context, newDesc ocispec.Descriptor) error
+
+type convertOptions struct {
+	verify       VerifyFunc
+	postConvert  PostConvertFunc
+	layerConvert converter.ConvertFunc
+	dryRun       bool
+	timeout      time.Duration
+	limit        *semaphore.Weighted
+	tracer       trace.Tracer
+}
+
+// WithVerifyFunc makes the converter call fn before each layer conversion begins.
+// If fn returns an error, the layer isn't converted and the error is returned.
+// If fn is nil, VerifyDigest is used.
+func WithVerifyFunc(fn VerifyFunc) ConvertOption {
+	return func(o *convertOptions) {
+		if fn == nil {
+			fn = VerifyDigest
+		}
+		o.verify = fn
+	}
+}
+
+// WithPostConvertFunc makes the converter call fn after each successful layer
+// conversion (e.g. for signing the result). If fn returns an error, the error is
+// returned instead of the new descriptor so the converted image isn't committed.
+// fn isn't called for layers that didn't need conversion.
+func WithPostConvertFunc(fn PostConvertFunc) ConvertOption {
+	return func(o *convertOptions) {
+		o.postConvert = fn
+	}
+}
+
+// WithLayerConvertFunc specifies the function that ConvertManifestList and
+// BatchConvert use to convert each layer (e.g. zstdchunked.LayerConvertFunc).
+// LayerConvertFunc ignores it.
+func WithLayerConvertFunc(fn converter.ConvertFunc) ConvertOption {
+	return func(o *convertOptions) {
+		o.layerConvert = fn
+	}
+}
+
+// WithMaxParallelConversions limits the number of layers converted at once to n by
+// the converters using the returned option, which share the limit. The conversions
+// exceeding the limit wait for a running one to finish or for their context to be
+// done. n <= 0 means no limit.
+func WithMaxParallelConversions(n int) ConvertOption {
+	var limit *semaphore.Weighted
+	if n > 0 {
+		limit = semaphore.NewWeighted(int64(n))
+	}
+	return func(o *convertOptions) {
+		o.limit = limit
+	}
+}
+
+// LayerConvertFunc wraps inner (e.g. zstdchunked.LayerConvertFunc) with the hooks
+// specified by opts.
+func LayerConvertFunc(inner converter.ConvertFunc, opts ...ConvertOption) converter.ConvertFunc {
+	var o convertOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	convert := inner
+	if o.timeout > 0 {
+		convert = func(ctx context.Context, cs content.Store, desc ocispec.Descriptor) (*ocispec.Descriptor, error) {
+			return convertWithTimeout(ctx, cs, desc, inner, o.timeout)
+		}
+	}
+	if o.tracer != nil {
+		convert = traceLayerConvert(o.tracer, convert)
+	}
+	return func(ctx context.Context, cs content.Store, desc ocispec.Descriptor) (*ocispec.Descriptor, error) {
+		if o.limit != nil {
+			if err := o.limit.Acquire(ctx, 1); err != nil {
+				return nil, err
+			}
+			defer o.limit.Release(1)
+		}
+		if o.verify != nil {
+			if err := o.verify(ctx, desc, cs); err != nil {
+				return nil, fmt.Errorf("failed to verify layer %s: %w", desc.Digest, err)
+			}
+		}
+		newDesc, err := convert(ctx, cs, desc)
+		if err != nil {
+			return nil, err
+		}
+		if newDesc != nil && o.postConvert != nil {
+			if err := o.postConvert(ctx, *newDesc); err != nil {
+				return nil, fmt.Errorf("post-convert hook failed for layer %s: %w", newDesc.Digest, err)
+			}
+		}
+		return newDesc, nil
+	}
+}
+
+// ConvertManifestList converts the layers of all platforms of the image index (or Docker
+// manifest list) index and returns the descriptor of the new index referencing the
+// converted manifests. The platforms and their layers are converted concurrently with
+// the function specified by WithLayerConvertFunc, wrapped with the hooks specified by
+// opts. The platforms and the annotations of the index entries are preserved.
+// It returns nil if no layer needed conversion.
+func ConvertManifestList(ctx context.Context, cs content.Store, index ocispec.Descriptor, opts ...ConvertOption) (*ocispec.Descriptor, error) {
+	if !images.IsIndexType(index.MediaType) {
+		return nil, fmt.Errorf("%s is not an image index: %q", index.Digest, index.MediaType)
+	}
+	var o convertOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.layerConvert == nil {
+		return nil, fmt.Errorf("layer convert func must be specified with WithLayerConvertFunc")
+	}
+	const docker2oci = false
+	cf := converter.DefaultIndexConvertFunc(LayerConvertFunc(o.layerConvert, opts...), docker2oci, platforms.All)
+	return cf(ctx, cs, index)
+}
+
+// VerifyDigest reads the content of desc from cs and checks that it matches the
+// digest and the size recorded in desc.
+func VerifyDigest(ctx context.Context, desc ocispec.Descriptor, cs content.Store) error {
+	if err := desc.Digest.Validate(); err != nil {
+		return err
+	}
+	ra, err := cs.ReaderAt(ctx, desc)
+	if err != nil {
+		return err
+	}
+	defer ra.Close()
+	verifier := desc.Digest.Verifier()
+	n, err := io.Copy(verifier, content.NewReader(ra))
+	if err != nil {
+		return err
+	}
+	if n != desc.Size {
+		return fmt.Errorf("size mismatch: got %d, want %d", n, desc.Size)
+	}
+	if !verifier.Verified() {
+		return fmt.Errorf("digest mismatch for %s", desc.Digest)
+	}
+	return nil
+}
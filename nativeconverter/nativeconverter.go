@@ -14,5 +14,77 @@
    limitations under the License.
 */
 
-// Package nativeconverter requires this empty file to pass golangci-lint
+// Package nativeconverter provides helpers shared by the native layer converters.
 package nativeconverter
+
+import (
+	"context"
+	"maps"
+	"sync"
+
+	"github.com/containerd/containerd/v2/core/content"
+	"github.com/containerd/containerd/v2/core/images/converter"
+	"github.com/golang/groupcache/lru"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"golang.org/x/sync/singleflight"
+)
+
+// dedupCacheSize is the maximum number of conversion results remembered by LayerDeduplicate.
+const dedupCacheSize = 256
+
+// LayerDeduplicate wraps inner so that each input layer digest is converted only once.
+// Subsequent calls for the same digest return the cached result. Concurrent calls
+// for the same digest wait for the in-flight conversion, which runs detached from
+// the cancellation of the caller that started it; each caller stops waiting when its
+// own ctx is done. Failed conversions aren't cached. Up to 256 results are kept with
+// LRU eviction.
+//
+// The returned function assumes all conversions use the same content store.
+func LayerDeduplicate(inner converter.ConvertFunc) converter.ConvertFunc {
+	var (
+		mu    sync.Mutex
+		cache = lru.New(dedupCacheSize)
+		group singleflight.Group
+	)
+	return func(ctx context.Context, cs content.Store, desc ocispec.Descriptor) (*ocispec.Descriptor, error) {
+		key := desc.Digest.String()
+		mu.Lock()
+		v, ok := cache.Get(key)
+		mu.Unlock()
+		if ok {
+			return copyDescriptor(v.(*ocispec.Descriptor)), nil
+		}
+		// The shared conversion doesn't stop when the caller that started it is
+		// canceled, as the other callers still wait for it.
+		ch := group.DoChan(key, func() (interface{}, error) {
+			newDesc, err := inner(context.WithoutCancel(ctx), cs, desc)
+			if err != nil {
+				return nil, err
+			}
+			mu.Lock()
+			cache.Add(key, newDesc)
+			mu.Unlock()
+			return newDesc, nil
+		})
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case res := <-ch:
+			if res.Err != nil {
+				return nil, res.Err
+			}
+			return copyDescriptor(res.Val.(*ocispec.Descriptor)), nil
+		}
+	}
+}
+
+// copyDescriptor returns a copy of desc so callers can't modify the cached result.
+// nil means the layer didn't need conversion and is returned as is.
+func copyDescriptor(desc *ocispec.Descriptor) *ocispec.Descriptor {
+	if desc == nil {
+		return nil
+	}
+	d := *desc
+	d.Annotations = maps.Clone(desc.Annotations)
+	return &d
+}
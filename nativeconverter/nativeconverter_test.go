@@ -0,0 +1,612 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package nativeconverter
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/containerd/containerd/v2/core/content"
+	"github.com/containerd/containerd/v2/core/images/converter/uncompress"
+	"github.com/containerd/containerd/v2/plugins/content/local"
+	"github.com/containerd/errdefs"
+	"github.com/containerd/stargz-snapshotter/nativeconverter/zstdchunked"
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestLayerDeduplicate(t *testing.T) {
+	var calls int64
+	inner := func(ctx context.Context, cs content.Store, desc ocispec.Descriptor) (*ocispec.Descriptor, error) {
+		atomic.AddInt64(&calls, 1)
+		return &ocispec.Descriptor{
+			Digest:      digest.FromString("converted-" + desc.Digest.String()),
+			Annotations: map[string]string{"source": desc.Digest.String()},
+		}, nil
+	}
+	convert := LayerDeduplicate(inner)
+
+	var digests []digest.Digest
+	for i := 0; i < 5; i++ {
+		digests = append(digests, digest.FromString(fmt.Sprintf("layer-%d", i)))
+	}
+	for i := 0; i < 100; i++ {
+		in := digests[i%len(digests)]
+		out, err := convert(context.Background(), nil, ocispec.Descriptor{Digest: in})
+		if err != nil {
+			t.Fatalf("failed to convert: %v", err)
+		}
+		if out.Digest != digest.FromString("converted-"+in.String()) || out.Annotations["source"] != in.String() {
+			t.Fatalf("unexpected result for %v: %+v", in, out)
+		}
+		out.Annotations["source"] = "modified"
+	}
+	if calls != 5 {
+		t.Errorf("inner convert func called %d times; want 5", calls)
+	}
+}
+
+func TestLayerDeduplicateCancel(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	inner := func(ctx context.Context, cs content.Store, desc ocispec.Descriptor) (*ocispec.Descriptor, error) {
+		close(started)
+		<-release
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return &ocispec.Descriptor{Digest: digest.FromString("converted")}, nil
+	}
+	convert := LayerDeduplicate(inner)
+	desc := ocispec.Descriptor{Digest: digest.FromString("layer")}
+
+	// The first caller is canceled while the second one waits for the conversion
+	ctx, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := convert(ctx, nil, desc)
+		firstErr <- err
+	}()
+	<-started
+	second := make(chan error, 1)
+	go func() {
+		out, err := convert(context.Background(), nil, desc)
+		if err == nil && out.Digest != digest.FromString("converted") {
+			err = fmt.Errorf("unexpected result %+v", out)
+		}
+		second <- err
+	}()
+	cancel()
+	if err := <-firstErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled caller got %v; want %v", err, context.Canceled)
+	}
+	close(release)
+	if err := <-second; err != nil {
+		t.Errorf("waiting caller failed: %v", err)
+	}
+}
+
+func TestLayerConvertFuncVerify(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	cs, err := local.NewStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("layer contents")
+	desc := ocispec.Descriptor{
+		MediaType: ocispec.MediaTypeImageLayer,
+		Digest:    digest.FromBytes(data),
+		Size:      int64(len(data)),
+	}
+	if err := content.WriteBlob(ctx, cs, "layer", bytes.NewReader(data), desc); err != nil {
+		t.Fatal(err)
+	}
+
+	var calls int64
+	inner := func(ctx context.Context, cs content.Store, desc ocispec.Descriptor) (*ocispec.Descriptor, error) {
+		atomic.AddInt64(&calls, 1)
+		return &desc, nil
+	}
+
+	// A failing verify func must prevent the conversion
+	verifyErr := errors.New("always fails")
+	convert := LayerConvertFunc(inner, WithVerifyFunc(func(context.Context, ocispec.Descriptor, content.Store) error {
+		return verifyErr
+	}))
+	if _, err := convert(ctx, cs, desc); !errors.Is(err, verifyErr) {
+		t.Errorf("got error %v; want %v", err, verifyErr)
+	}
+	if calls != 0 {
+		t.Fatalf("layer was converted %d times despite verification failure", calls)
+	}
+
+	// The default verify func accepts intact content
+	convert = LayerConvertFunc(inner, WithVerifyFunc(nil))
+	if _, err := convert(ctx, cs, desc); err != nil {
+		t.Fatalf("failed to convert intact layer: %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("layer was converted %d times; want 1", calls)
+	}
+
+	// ... and rejects corrupted content
+	blobPath := filepath.Join(root, "blobs", desc.Digest.Algorithm().String(), desc.Digest.Encoded())
+	if err := os.WriteFile(blobPath, []byte("corrupt contents"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := convert(ctx, cs, desc); err == nil {
+		t.Errorf("corrupted layer must not be converted")
+	}
+	if calls != 1 {
+		t.Errorf("corrupted layer was converted")
+	}
+}
+
+func TestLayerConvertFuncPostConvert(t *testing.T) {
+	ctx := context.Background()
+	var (
+		convertErr error
+		recorded   []digest.Digest
+	)
+	inner := func(ctx context.Context, cs content.Store, desc ocispec.Descriptor) (*ocispec.Descriptor, error) {
+		if convertErr != nil {
+			return nil, convertErr
+		}
+		return &ocispec.Descriptor{Digest: digest.FromString("converted-" + desc.Digest.String())}, nil
+	}
+	var hookErr error
+	convert := LayerConvertFunc(inner, WithPostConvertFunc(func(ctx context.Context, newDesc ocispec.Descriptor) error {
+		recorded = append(recorded, newDesc.Digest)
+		return hookErr
+	}))
+
+	in := ocispec.Descriptor{Digest: digest.FromString("layer")}
+	out, err := convert(ctx, nil, in)
+	if err != nil {
+		t.Fatalf("failed to convert: %v", err)
+	}
+	if len(recorded) != 1 || recorded[0] != out.Digest {
+		t.Fatalf("post-convert func got %v; want exactly [%v]", recorded, out.Digest)
+	}
+
+	// Not called when the conversion fails
+	convertErr = errors.New("conversion failed")
+	if _, err := convert(ctx, nil, in); !errors.Is(err, convertErr) {
+		t.Fatalf("got error %v; want %v", err, convertErr)
+	}
+	if len(recorded) != 1 {
+		t.Fatalf("post-convert func called for failed conversion")
+	}
+
+	// The hook's error is returned instead of the converted descriptor
+	convertErr = nil
+	hookErr = errors.New("signing failed")
+	if out, err := convert(ctx, nil, in); !errors.Is(err, hookErr) || out != nil {
+		t.Errorf("got (%v, %v); want (nil, %v)", out, err, hookErr)
+	}
+	if len(recorded) != 2 {
+		t.Errorf("post-convert func called %d times; want 2", len(recorded))
+	}
+}
+
+func TestConvertManifestList(t *testing.T) {
+	ctx := context.Background()
+	cs, err := local.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeBlob := func(mediaType string, b []byte) ocispec.Descriptor {
+		desc := ocispec.Descriptor{MediaType: mediaType, Digest: digest.FromBytes(b), Size: int64(len(b))}
+		if err := content.WriteBlob(ctx, cs, desc.Digest.String(), bytes.NewReader(b), desc); err != nil {
+			t.Fatal(err)
+		}
+		return desc
+	}
+	writeJSON := func(mediaType string, v interface{}) ocispec.Descriptor {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return writeBlob(mediaType, b)
+	}
+
+	// Multi-arch hello image with two platforms
+	index := ocispec.Index{Versioned: specs.Versioned{SchemaVersion: 2}, MediaType: ocispec.MediaTypeImageIndex}
+	for _, p := range []ocispec.Platform{{OS: "linux", Architecture: "amd64"}, {OS: "linux", Architecture: "arm64"}} {
+		var tarBuf bytes.Buffer
+		tw := tar.NewWriter(&tarBuf)
+		hello := "hello from " + p.Architecture
+		if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "hello", Mode: 0755, Size: int64(len(hello))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(hello)); err != nil {
+			t.Fatal(err)
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		var gzBuf bytes.Buffer
+		zw := gzip.NewWriter(&gzBuf)
+		if _, err := zw.Write(tarBuf.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		layer := writeBlob(ocispec.MediaTypeImageLayerGzip, gzBuf.Bytes())
+		config := writeJSON(ocispec.MediaTypeImageConfig, ocispec.Image{
+			Platform: p,
+			RootFS:   ocispec.RootFS{Type: "layers", DiffIDs: []digest.Digest{digest.FromBytes(tarBuf.Bytes())}},
+		})
+		manifest := writeJSON(ocispec.MediaTypeImageManifest, ocispec.Manifest{
+			Versioned: specs.Versioned{SchemaVersion: 2},
+			MediaType: ocispec.MediaTypeImageManifest,
+			Config:    config,
+			Layers:    []ocispec.Descriptor{layer},
+		})
+		platform := p
+		manifest.Platform = &platform
+		manifest.Annotations = map[string]string{"test.platform": p.Architecture}
+		index.Manifests = append(index.Manifests, manifest)
+	}
+	indexDesc := writeJSON(ocispec.MediaTypeImageIndex, index)
+
+	var converted int64
+	inner := func(ctx context.Context, cs content.Store, desc ocispec.Descriptor) (*ocispec.Descriptor, error) {
+		atomic.AddInt64(&converted, 1)
+		return uncompress.LayerConvertFunc(ctx, cs, desc)
+	}
+	newDesc, err := ConvertManifestList(ctx, cs, indexDesc, WithLayerConvertFunc(inner))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newDesc == nil || newDesc.Digest == indexDesc.Digest {
+		t.Fatalf("index wasn't converted: %v", newDesc)
+	}
+	if converted != 2 {
+		t.Errorf("converted %d layers; want 2", converted)
+	}
+
+	b, err := content.ReadBlob(ctx, cs, *newDesc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var newIndex ocispec.Index
+	if err := json.Unmarshal(b, &newIndex); err != nil {
+		t.Fatal(err)
+	}
+	if len(newIndex.Manifests) != len(index.Manifests) {
+		t.Fatalf("converted index has %d platforms; want %d", len(newIndex.Manifests), len(index.Manifests))
+	}
+	for i, m := range newIndex.Manifests {
+		orig := index.Manifests[i]
+		if m.Digest == orig.Digest {
+			t.Errorf("manifest of %s wasn't converted", orig.Platform.Architecture)
+		}
+		if !reflect.DeepEqual(m.Platform, orig.Platform) || !reflect.DeepEqual(m.Annotations, orig.Annotations) {
+			t.Errorf("manifest %d: got platform %v and annotations %v; want %v and %v",
+				i, m.Platform, m.Annotations, orig.Platform, orig.Annotations)
+		}
+		mb, err := content.ReadBlob(ctx, cs, m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var manifest ocispec.Manifest
+		if err := json.Unmarshal(mb, &manifest); err != nil {
+			t.Fatal(err)
+		}
+		if mt := manifest.Layers[0].MediaType; mt != ocispec.MediaTypeImageLayer {
+			t.Errorf("manifest %d: layer media type = %q; want %q", i, mt, ocispec.MediaTypeImageLayer)
+		}
+	}
+
+	if _, err := ConvertManifestList(ctx, cs, index.Manifests[0], WithLayerConvertFunc(inner)); err == nil {
+		t.Errorf("expected an error for a non-index descriptor")
+	}
+	if _, err := ConvertManifestList(ctx, cs, indexDesc); err == nil {
+		t.Errorf("expected an error without a layer convert func")
+	}
+}
+
+func TestBatchConvertDryRun(t *testing.T) {
+	ctx := context.Background()
+	cs, err := local.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var imgs []ocispec.Descriptor
+	for i := 0; i < 3; i++ {
+		imgs = append(imgs, writeTestImage(t, cs, i))
+	}
+	before := storeContents(t, cs)
+
+	layerConvert := WithLayerConvertFunc(zstdchunked.LayerConvertFunc())
+	// The converted layers are discarded once converted but their info is kept
+	var dryRunStore atomic.Value
+	recordStore := WithLayerConvertFunc(func(ctx context.Context, cs content.Store, desc ocispec.Descriptor) (*ocispec.Descriptor, error) {
+		dryRunStore.Store(cs)
+		return zstdchunked.LayerConvertFunc()(ctx, cs, desc)
+	})
+	checkDiscarded := WithPostConvertFunc(func(ctx context.Context, desc ocispec.Descriptor) error {
+		cs := dryRunStore.Load().(content.Store)
+		if _, err := cs.ReaderAt(ctx, desc); !errdefs.IsNotFound(err) {
+			return fmt.Errorf("converted layer %s is kept in the dry run (err: %v)", desc.Digest, err)
+		}
+		if _, err := cs.Info(ctx, desc.Digest); err != nil {
+			return fmt.Errorf("info of converted layer %s isn't kept: %w", desc.Digest, err)
+		}
+		return nil
+	})
+	dryRun, err := BatchConvert(ctx, cs, imgs, recordStore, checkDiscarded, WithDryRun())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after := storeContents(t, cs); !reflect.DeepEqual(before, after) {
+		t.Errorf("dry run modified the content store:\nbefore: %v\nafter: %v", before, after)
+	}
+	if statuses, err := cs.ListStatuses(ctx); err != nil || len(statuses) != 0 {
+		t.Errorf("dry run left ingests %v (err: %v)", statuses, err)
+	}
+	if !dryRun.DryRun || len(dryRun.Images) != len(imgs) || len(dryRun.Layers) != len(imgs) {
+		t.Fatalf("unexpected dry-run report: %+v", dryRun)
+	}
+	for _, desc := range dryRun.Images {
+		if desc.Annotations[DryRunAnnotation] != "true" {
+			t.Errorf("image %s isn't marked as dry run: %v", desc.Digest, desc.Annotations)
+		}
+	}
+	for _, l := range dryRun.Layers {
+		if l.Converted.Annotations[DryRunAnnotation] != "true" {
+			t.Errorf("layer %s isn't marked as dry run: %v", l.Converted.Digest, l.Converted.Annotations)
+		}
+	}
+
+	converted, err := BatchConvert(ctx, cs, imgs, layerConvert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if converted.DryRun || len(converted.Layers) != len(dryRun.Layers) {
+		t.Fatalf("unexpected report: %+v", converted)
+	}
+	want := make(map[digest.Digest]int64)
+	for _, l := range converted.Layers {
+		if _, ok := l.Converted.Annotations[DryRunAnnotation]; ok {
+			t.Errorf("layer %s is marked as dry run", l.Converted.Digest)
+		}
+		if _, err := cs.Info(ctx, l.Converted.Digest); err != nil {
+			t.Errorf("converted layer %s isn't stored: %v", l.Converted.Digest, err)
+		}
+		want[l.Original.Digest] = l.Converted.Size
+	}
+	for _, l := range dryRun.Layers {
+		if diff := l.Converted.Size - want[l.Original.Digest]; diff*100 > want[l.Original.Digest] || -diff*100 > want[l.Original.Digest] {
+			t.Errorf("layer %s: estimated %d bytes; converted to %d", l.Original.Digest, l.Converted.Size, want[l.Original.Digest])
+		}
+	}
+	if dryRun.OriginalSize != converted.OriginalSize {
+		t.Errorf("dry run original size = %d; want %d", dryRun.OriginalSize, converted.OriginalSize)
+	}
+}
+
+func TestLayerConvertFuncTimeout(t *testing.T) {
+	ctx := context.Background()
+	cs, err := local.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := content.ReadBlob(ctx, cs, writeTestImage(t, cs, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest ocispec.Manifest
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	before := storeContents(t, cs)
+
+	convert := LayerConvertFunc(zstdchunked.LayerConvertFunc(), WithTimeout(50*time.Millisecond))
+	start := time.Now()
+	_, err = convert(ctx, &slowStore{Store: cs, delay: 20 * time.Millisecond}, manifest.Layers[0])
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got error %v; want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("conversion took %v after the timeout", elapsed)
+	}
+	if after := storeContents(t, cs); !reflect.DeepEqual(before, after) {
+		t.Errorf("timed out conversion modified the content store:\nbefore: %v\nafter: %v", before, after)
+	}
+	if statuses, err := cs.ListStatuses(ctx); err != nil || len(statuses) != 0 {
+		t.Errorf("timed out conversion left ingests %v (err: %v)", statuses, err)
+	}
+}
+
+func TestLayerConvertFuncTracer(t *testing.T) {
+	ctx := context.Background()
+	cs, err := local.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := content.ReadBlob(ctx, cs, writeTestImage(t, cs, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest ocispec.Manifest
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	layer := manifest.Layers[0]
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	defer tp.Shutdown(ctx)
+
+	convert := LayerConvertFunc(zstdchunked.LayerConvertFunc(), WithTracer(tp.Tracer("test")))
+	newDesc, err := convert(ctx, cs, layer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	finished := time.Now()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans; want 1", len(spans))
+	}
+	span := spans[0]
+	if d := finished.Sub(span.EndTime); d < 0 || d > 100*time.Millisecond {
+		t.Errorf("span ended %v before the conversion finished; want within 100ms", d)
+	}
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+	for key, want := range map[attribute.Key]attribute.Value{
+		AttrLayerDigest:           attribute.StringValue(layer.Digest.String()),
+		AttrLayerOriginalSize:     attribute.Int64Value(layer.Size),
+		AttrLayerConvertedSize:    attribute.Int64Value(newDesc.Size),
+		AttrLayerCompressionLevel: attribute.IntValue(3),
+	} {
+		if got, ok := attrs[key]; !ok || got != want {
+			t.Errorf("%s = %v; want %v", key, got.Emit(), want.Emit())
+		}
+	}
+	if d, ok := attrs[AttrLayerDurationMS]; !ok || d.AsInt64() < 0 || d.AsInt64() > span.EndTime.Sub(span.StartTime).Milliseconds() {
+		t.Errorf("%s = %v; want the duration of the span", AttrLayerDurationMS, d.Emit())
+	}
+	if impl := attrs[AttrLayerImplementation].AsString(); impl == "" {
+		t.Errorf("%s isn't set", AttrLayerImplementation)
+	}
+
+	// Failed conversions are recorded in the span
+	exporter.Reset()
+	convertErr := errors.New("conversion failed")
+	convert = LayerConvertFunc(func(context.Context, content.Store, ocispec.Descriptor) (*ocispec.Descriptor, error) {
+		return nil, convertErr
+	}, WithTracer(tp.Tracer("test")))
+	if _, err := convert(ctx, cs, layer); !errors.Is(err, convertErr) {
+		t.Fatalf("got error %v; want %v", err, convertErr)
+	}
+	if spans := exporter.GetSpans(); len(spans) != 1 || spans[0].Status.Code != codes.Error || len(spans[0].Events) != 1 {
+		t.Errorf("failed conversion wasn't recorded in the span: %+v", spans)
+	}
+}
+
+// slowStore is a content store whose writers sleep for delay on each write
+type slowStore struct {
+	content.Store
+	delay time.Duration
+}
+
+func (s *slowStore) Writer(ctx context.Context, opts ...content.WriterOpt) (content.Writer, error) {
+	w, err := s.Store.Writer(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &slowWriter{Writer: w, delay: s.delay}, nil
+}
+
+type slowWriter struct {
+	content.Writer
+	delay time.Duration
+}
+
+func (w *slowWriter) Write(p []byte) (int, error) {
+	time.Sleep(w.delay)
+	return w.Writer.Write(p)
+}
+
+// writeTestImage stores a single-layer image with gzip-compressed contents
+// depending on n and returns the descriptor of its manifest.
+func writeTestImage(t *testing.T, cs content.Store, n int) ocispec.Descriptor {
+	ctx := context.Background()
+	writeBlob := func(mediaType string, b []byte) ocispec.Descriptor {
+		desc := ocispec.Descriptor{MediaType: mediaType, Digest: digest.FromBytes(b), Size: int64(len(b))}
+		if err := content.WriteBlob(ctx, cs, desc.Digest.String(), bytes.NewReader(b), desc); err != nil {
+			t.Fatal(err)
+		}
+		return desc
+	}
+	writeJSON := func(mediaType string, v interface{}) ocispec.Descriptor {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return writeBlob(mediaType, b)
+	}
+
+	var tarBuf bytes.Buffer
+	tw := tar.NewWriter(&tarBuf)
+	for i := 0; i <= n; i++ {
+		data := bytes.Repeat([]byte(fmt.Sprintf("image %d file %d\n", n, i)), 10000*(i+1))
+		if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: fmt.Sprintf("file%d", i), Mode: 0644, Size: int64(len(data))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var gzBuf bytes.Buffer
+	zw := gzip.NewWriter(&gzBuf)
+	if _, err := zw.Write(tarBuf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	layer := writeBlob(ocispec.MediaTypeImageLayerGzip, gzBuf.Bytes())
+	config := writeJSON(ocispec.MediaTypeImageConfig, ocispec.Image{
+		Platform: ocispec.Platform{OS: "linux", Architecture: "amd64"},
+		RootFS:   ocispec.RootFS{Type: "layers", DiffIDs: []digest.Digest{digest.FromBytes(tarBuf.Bytes())}},
+	})
+	return writeJSON(ocispec.MediaTypeImageManifest, ocispec.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ocispec.MediaTypeImageManifest,
+		Config:    config,
+		Layers:    []ocispec.Descriptor{layer},
+	})
+}
+
+// storeContents returns the labels of the blobs in cs
+func storeContents(t *testing.T, cs content.Store) map[digest.Digest]map[string]string {
+	contents := make(map[digest.Digest]map[string]string)
+	if err := cs.Walk(context.Background(), func(info content.Info) error {
+		contents[info.Digest] = info.Labels
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return contents
+}
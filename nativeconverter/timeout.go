@@ -0,0 +1,133 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package nativeconverter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/containerd/containerd/v2/core/content"
+	"github.com/containerd/containerd/v2/core/images/converter"
+	"github.com/containerd/errdefs"
+	"github.com/containerd/log"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// WithTimeout makes the converter abandon each layer conversion that takes longer
+// than timeout. The writes of the abandoned conversion are rolled back: its ingests
+// are aborted and the blobs it added to the content store (e.g. the uncompressed
+// layer) are deleted. Zero means no timeout.
+func WithTimeout(timeout time.Duration) ConvertOption {
+	return func(o *convertOptions) {
+		o.timeout = timeout
+	}
+}
+
+// rollbackStore records the writes made through it so that they can be rolled back.
+// Its writers fail once ctx is done even if the converter doesn't check ctx.
+type rollbackStore struct {
+	content.Store
+	ctx context.Context
+
+	mu        sync.Mutex
+	refs      []string
+	committed []digest.Digest
+}
+
+func (s *rollbackStore) Writer(ctx context.Context, opts ...content.WriterOpt) (content.Writer, error) {
+	var wOpts content.WriterOpts
+	for _, opt := range opts {
+		if err := opt(&wOpts); err != nil {
+			return nil, err
+		}
+	}
+	w, err := s.Store.Writer(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.refs = append(s.refs, wOpts.Ref)
+	s.mu.Unlock()
+	return &rollbackWriter{Writer: w, s: s}, nil
+}
+
+// rollback aborts the ingests that haven't been committed and deletes the blobs
+// that have been newly committed
+func (s *rollbackStore) rollback(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ref := range s.refs {
+		if err := s.Store.Abort(ctx, ref); err != nil && !errdefs.IsNotFound(err) {
+			log.G(ctx).WithError(err).Warnf("failed to abort ingest %q", ref)
+		}
+	}
+	for _, dgst := range s.committed {
+		if err := s.Store.Delete(ctx, dgst); err != nil && !errdefs.IsNotFound(err) {
+			log.G(ctx).WithError(err).Warnf("failed to delete blob %s", dgst)
+		}
+	}
+	s.refs, s.committed = nil, nil
+}
+
+// rollbackWriter is a content.Writer of rollbackStore. It fails with the error of
+// the store's context once the context is done.
+type rollbackWriter struct {
+	content.Writer
+	s *rollbackStore
+}
+
+func (w *rollbackWriter) Write(p []byte) (int, error) {
+	if err := w.s.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return w.Writer.Write(p)
+}
+
+func (w *rollbackWriter) Commit(ctx context.Context, size int64, expected digest.Digest, opts ...content.Opt) error {
+	if err := w.s.ctx.Err(); err != nil {
+		return err
+	}
+	if err := w.Writer.Commit(ctx, size, expected, opts...); err != nil {
+		// AlreadyExists means that the blob already existed before the conversion
+		return err
+	}
+	w.s.mu.Lock()
+	w.s.committed = append(w.s.committed, w.Writer.Digest())
+	w.s.mu.Unlock()
+	return nil
+}
+
+// convertWithTimeout calls inner with a context that is canceled after timeout and
+// rolls back the writes to cs if the timeout fires.
+func convertWithTimeout(ctx context.Context, cs content.Store, desc ocispec.Descriptor, inner converter.ConvertFunc, timeout time.Duration) (*ocispec.Descriptor, error) {
+	tctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	s := &rollbackStore{Store: cs, ctx: tctx}
+	newDesc, err := inner(tctx, s, desc)
+	if err == nil {
+		return newDesc, nil
+	}
+	if errors.Is(tctx.Err(), context.DeadlineExceeded) {
+		s.rollback(context.WithoutCancel(ctx))
+		return nil, fmt.Errorf("conversion of layer %s timed out after %v: %w", desc.Digest, timeout, context.DeadlineExceeded)
+	}
+	return nil, err
+}
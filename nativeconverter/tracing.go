@@ -0,0 +1,78 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package nativeconverter
+
+import (
+	"context"
+	"time"
+
+	"github.com/containerd/containerd/v2/core/content"
+	"github.com/containerd/containerd/v2/core/images/converter"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Attributes of the spans created by the converters using WithTracer. The layer
+// converters add AttrLayerCompressionLevel and AttrLayerImplementation to the span
+// in their context (e.g. zstdchunked.LayerConvertFunc).
+const (
+	AttrLayerDigest           = attribute.Key("layer.digest")
+	AttrLayerOriginalSize     = attribute.Key("layer.original_size")
+	AttrLayerConvertedSize    = attribute.Key("layer.converted_size")
+	AttrLayerDurationMS       = attribute.Key("layer.duration_ms")
+	AttrLayerCompressionLevel = attribute.Key("layer.compression_level")
+	AttrLayerImplementation   = attribute.Key("layer.implementation")
+)
+
+// layerSpanName is the name of the span of each layer conversion
+const layerSpanName = "nativeconverter.ConvertLayer"
+
+// WithTracer makes the converter create a span with t for each layer conversion, as
+// a child of the span in the context of the conversion. The span ends when the
+// converted layer has been written, and records the error if the conversion fails.
+// Layers that don't need conversion have no layer.converted_size attribute.
+func WithTracer(t trace.Tracer) ConvertOption {
+	return func(o *convertOptions) {
+		o.tracer = t
+	}
+}
+
+// traceLayerConvert wraps inner to run each conversion in a span created by tracer
+func traceLayerConvert(tracer trace.Tracer, inner converter.ConvertFunc) converter.ConvertFunc {
+	return func(ctx context.Context, cs content.Store, desc ocispec.Descriptor) (*ocispec.Descriptor, error) {
+		start := time.Now()
+		ctx, span := tracer.Start(ctx, layerSpanName, trace.WithAttributes(
+			AttrLayerDigest.String(desc.Digest.String()),
+			AttrLayerOriginalSize.Int64(desc.Size),
+		))
+		defer span.End()
+
+		newDesc, err := inner(ctx, cs, desc)
+		span.SetAttributes(AttrLayerDurationMS.Int64(time.Since(start).Milliseconds()))
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return nil, err
+		}
+		if newDesc != nil {
+			span.SetAttributes(AttrLayerConvertedSize.Int64(newDesc.Size))
+		}
+		return newDesc, nil
+	}
+}
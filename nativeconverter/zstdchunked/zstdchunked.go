@@ -29,14 +29,31 @@ import (
 	"github.com/containerd/containerd/v2/pkg/labels"
 	"github.com/containerd/errdefs"
 	"github.com/containerd/log"
+	compzstd "github.com/containerd/stargz-snapshotter/compression/zstd"
 	"github.com/containerd/stargz-snapshotter/estargz"
 	"github.com/containerd/stargz-snapshotter/estargz/zstdchunked"
 	"github.com/containerd/stargz-snapshotter/util/ioutils"
 	"github.com/klauspost/compress/zstd"
 	"github.com/opencontainers/go-digest"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// ErrLevelUnavailable is returned by the ConvertFunc of LayerConvertFuncWithCompressionLevel
+// when the compression level exceeds the maximum level of the compressor selected in the
+// compression package, e.g. level 22 without libzstd. Callers can retry with a level up to
+// MaxAvailable.
+type ErrLevelUnavailable struct {
+	Level          int
+	MaxAvailable   int
+	Implementation string
+}
+
+func (e ErrLevelUnavailable) Error() string {
+	return fmt.Sprintf("zstd compression level %d is unavailable with %s (maximum %d)", e.Level, e.Implementation, e.MaxAvailable)
+}
+
 type zstdCompression struct {
 	*zstdchunked.Decompressor
 	*zstdchunked.Compressor
@@ -92,12 +109,31 @@ func LayerConvertWithLayerOptsFuncWithCompressionLevel(compressionLevel zstd.Enc
 // conjunction with WithDockerToOCI().
 // See LayerConvertFunc for more details. The difference between this function and
 // LayerConvertFunc is that this allows configuring the compression level.
+//
+// The klauspost encoder levels map to the zstd levels they approximate and other values
+// are used as zstd levels. Layers fail to convert with ErrLevelUnavailable if the level
+// exceeds MaxCompressionLevel of the compressor selected in the compression package.
 func LayerConvertFuncWithCompressionLevel(compressionLevel zstd.EncoderLevel, opts ...estargz.Option) converter.ConvertFunc {
 	return func(ctx context.Context, cs content.Store, desc ocispec.Descriptor) (*ocispec.Descriptor, error) {
 		if !images.IsLayerType(desc.MediaType) {
 			// No conversion. No need to return an error here.
 			return nil, nil
 		}
+		zc := &zstdchunked.Compressor{CompressionLevel: compressionLevel}
+		compressor := compzstd.GetCompressor()
+		// Same keys as nativeconverter.AttrLayerCompressionLevel and AttrLayerImplementation,
+		// which can't be imported because nativeconverter's tests import this package
+		trace.SpanFromContext(ctx).SetAttributes(
+			attribute.Int("layer.compression_level", zc.Level()),
+			attribute.String("layer.implementation", compressor.Name()),
+		)
+		if zc.Level() > compressor.MaxCompressionLevel() {
+			return nil, ErrLevelUnavailable{
+				Level:          zc.Level(),
+				MaxAvailable:   compressor.MaxCompressionLevel(),
+				Implementation: compressor.Name(),
+			}
+		}
 		uncompressedDesc := &desc
 		// We need to uncompress the archive first
 		if !uncompress.IsUncompressedType(desc.MediaType) {
@@ -128,12 +164,10 @@ func LayerConvertFuncWithCompressionLevel(compressionLevel zstd.EncoderLevel, op
 		defer uncompressedReaderAt.Close()
 		uncompressedSR := io.NewSectionReader(uncompressedReaderAt, 0, uncompressedDesc.Size)
 		metadata := make(map[string]string)
+		zc.Metadata = metadata
 		opts = append(opts, estargz.WithCompression(&zstdCompression{
 			new(zstdchunked.Decompressor),
-			&zstdchunked.Compressor{
-				CompressionLevel: compressionLevel,
-				Metadata:         metadata,
-			},
+			zc,
 		}))
 		blob, err := estargz.Build(uncompressedSR, append(opts, estargz.WithContext(ctx))...)
 		if err != nil {
@@ -206,6 +240,9 @@ func LayerConvertFuncWithCompressionLevel(compressionLevel zstd.EncoderLevel, op
 		if p, ok := metadata[zstdchunked.ManifestPositionAnnotation]; ok {
 			newDesc.Annotations[zstdchunked.ManifestPositionAnnotation] = p
 		}
+		if p, ok := metadata[zstdchunked.ManifestPositionAnnotationV2]; ok {
+			newDesc.Annotations[zstdchunked.ManifestPositionAnnotationV2] = p
+		}
 		return &newDesc, nil
 	}
 }
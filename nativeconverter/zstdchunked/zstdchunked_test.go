@@ -17,20 +17,27 @@
 package zstdchunked
 
 import (
+	"archive/tar"
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"testing"
 
 	"runtime/debug"
 
+	"github.com/containerd/containerd/v2/core/content"
 	"github.com/containerd/containerd/v2/core/images"
 	"github.com/containerd/containerd/v2/core/images/converter"
+	"github.com/containerd/containerd/v2/plugins/content/local"
 	"github.com/containerd/platforms"
+	compzstd "github.com/containerd/stargz-snapshotter/compression/zstd"
 	"github.com/containerd/stargz-snapshotter/estargz"
 	"github.com/containerd/stargz-snapshotter/estargz/zstdchunked"
 	"github.com/containerd/stargz-snapshotter/util/testutil"
 	"github.com/klauspost/compress/zstd"
+	"github.com/opencontainers/go-digest"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
@@ -185,3 +192,93 @@ func TestCompressionImplementationEnvVar(t *testing.T) {
 		})
 	}
 }
+
+// TestLayerConvertFuncWithMockCompressor tests that the conversion compresses
+// the layer with the compressor selected in the compression package.
+func TestLayerConvertFuncWithMockCompressor(t *testing.T) {
+	orig := compzstd.GetCompressor()
+	defer compzstd.SetCompressor(orig)
+	mock := compzstd.NewMockCompressor()
+	compzstd.SetCompressor(mock)
+
+	ctx := context.Background()
+	cs, desc := newHelloLayer(ctx, t)
+
+	newDesc, err := LayerConvertFunc()(ctx, cs, desc)
+	if err != nil {
+		t.Fatalf("failed to convert: %v", err)
+	}
+	if mock.NewWriterCalls() == 0 {
+		t.Errorf("layer wasn't compressed with the selected compressor")
+	}
+	if newDesc.MediaType != ocispec.MediaTypeImageLayerZstd {
+		t.Errorf("media type = %q; want %q", newDesc.MediaType, ocispec.MediaTypeImageLayerZstd)
+	}
+
+	// Errors of the compressor are surfaced by the conversion
+	writeErr := errors.New("write failed")
+	mock.ForceErrorOnWrite(writeErr)
+	if _, err := LayerConvertFunc()(ctx, cs, desc); err == nil {
+		t.Errorf("conversion should fail when compression fails")
+	}
+	newWriterErr := errors.New("no writer")
+	mock.SetNewWriterError(newWriterErr)
+	if _, err := LayerConvertFunc()(ctx, cs, desc); !errors.Is(err, newWriterErr) {
+		t.Errorf("got error %v; want %v", err, newWriterErr)
+	}
+}
+
+// TestLayerConvertFuncLevelUnavailable tests that a level above the maximum of the
+// selected compressor fails the conversion instead of being lowered.
+func TestLayerConvertFuncLevelUnavailable(t *testing.T) {
+	orig := compzstd.GetCompressor()
+	defer compzstd.SetCompressor(orig)
+	pureGo := compzstd.NewPureGoCompressor()
+	compzstd.SetCompressor(pureGo)
+
+	ctx := context.Background()
+	cs, desc := newHelloLayer(ctx, t)
+
+	_, err := LayerConvertFuncWithCompressionLevel(zstd.EncoderLevel(22))(ctx, cs, desc)
+	var levelErr ErrLevelUnavailable
+	if !errors.As(err, &levelErr) {
+		t.Fatalf("got error %v; want ErrLevelUnavailable", err)
+	}
+	want := ErrLevelUnavailable{Level: 22, MaxAvailable: pureGo.MaxCompressionLevel(), Implementation: pureGo.Name()}
+	if levelErr != want {
+		t.Errorf("got %+v; want %+v", levelErr, want)
+	}
+
+	if _, err := LayerConvertFuncWithCompressionLevel(zstd.EncoderLevel(pureGo.MaxCompressionLevel()))(ctx, cs, desc); err != nil {
+		t.Errorf("failed to convert with the maximum level: %v", err)
+	}
+}
+
+// newHelloLayer writes an uncompressed layer with a single file to a new content store
+func newHelloLayer(ctx context.Context, t *testing.T) (content.Store, ocispec.Descriptor) {
+	cs, err := local.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tarBuf bytes.Buffer
+	tw := tar.NewWriter(&tarBuf)
+	contents := "hello"
+	if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "hello", Mode: 0644, Size: int64(len(contents))}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write([]byte(contents)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	desc := ocispec.Descriptor{
+		MediaType: ocispec.MediaTypeImageLayer,
+		Digest:    digest.FromBytes(tarBuf.Bytes()),
+		Size:      int64(tarBuf.Len()),
+	}
+	if err := content.WriteBlob(ctx, cs, "layer", bytes.NewReader(tarBuf.Bytes()), desc); err != nil {
+		t.Fatal(err)
+	}
+	return cs, desc
+}
@@ -17,14 +17,49 @@
 package service
 
 import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	compzstd "github.com/containerd/stargz-snapshotter/compression/zstd"
 	"github.com/containerd/stargz-snapshotter/fs/config"
+	"github.com/containerd/stargz-snapshotter/nativeconverter"
+	"github.com/containerd/stargz-snapshotter/service/keychain/kubeconfig"
 	"github.com/containerd/stargz-snapshotter/service/resolver"
+	"github.com/containerd/stargz-snapshotter/snapshot"
+	digest "github.com/opencontainers/go-digest"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
+// defaultMaxParallelConversions is used when Config.MaxParallelConversions is zero.
+const defaultMaxParallelConversions = 4
+
+// maxZstdWorkers is the largest CompressionConfig.ZstdWorkers accepted by Validate.
+const maxZstdWorkers = 256
+
+// ConfigVersion is the version of the configuration format understood by this build.
+const ConfigVersion = "v1"
+
+// UnsupportedVersionError is returned by Config.Validate when the configuration is
+// written for a format version this build doesn't understand.
+type UnsupportedVersionError struct {
+	Got       string
+	Supported string
+}
+
+func (e *UnsupportedVersionError) Error() string {
+	return fmt.Sprintf("unsupported config version %q: this build supports %q", e.Got, e.Supported)
+}
+
 // Config is configuration for stargz snapshotter service.
 type Config struct {
 	config.Config
 
+	// Version is the version of the configuration format. Empty means ConfigVersion.
+	// Builds reject versions they don't know instead of ignoring the unknown fields.
+	Version string `toml:"version" json:"version"`
+
 	// KubeconfigKeychainConfig is config for kubeconfig-based keychain.
 	KubeconfigKeychainConfig `toml:"kubeconfig_keychain" json:"kubeconfig_keychain"`
 
@@ -39,6 +74,38 @@ type Config struct {
 
 	// CompressionConfig is config for compression settings.
 	CompressionConfig `toml:"compression" json:"compression"`
+
+	// CacheConfig is config for the in-memory manifest cache.
+	CacheConfig `toml:"cache" json:"cache"`
+
+	// NetworkConfig is config for the gRPC listener.
+	NetworkConfig `toml:"network" json:"network"`
+
+	// HealthCheckConfig is config for the liveness and readiness probes.
+	HealthCheckConfig `toml:"health_check" json:"health_check"`
+
+	// SecurityConfig is config for hardening the snapshotter process.
+	SecurityConfig `toml:"security" json:"security"`
+
+	// LogLevel is the logging level: "debug", "info", "warn" or "error". It can be
+	// changed at runtime via LogLevelPath on the HealthCheckConfig address.
+	LogLevel string `toml:"log_level" json:"log_level"`
+
+	// StorageBackend selects the content store driver of the image conversions (see
+	// NewConverter): "containerd" (default). "s3" and "gcs" are reserved but not
+	// implemented yet.
+	StorageBackend string `toml:"storage_backend" json:"storage_backend"`
+
+	// StorageBackendConfig is backend-specific parameters passed to the selected StorageBackend.
+	StorageBackendConfig map[string]string `toml:"storage_backend_config" json:"storage_backend_config"`
+
+	// ConversionTimeout limits each layer conversion (see nativeconverter.WithTimeout).
+	// The partially written blob of a timed out conversion is removed. Zero means no timeout.
+	ConversionTimeout time.Duration `toml:"conversion_timeout" json:"conversion_timeout"`
+
+	// MaxParallelConversions is the maximum number of layers converted at once (default: 4).
+	// Each in-flight conversion buffers a compressed layer.
+	MaxParallelConversions int `toml:"max_parallel_conversions" json:"max_parallel_conversions"`
 }
 
 // KubeconfigKeychainConfig is config for kubeconfig-based keychain.
@@ -49,6 +116,12 @@ type KubeconfigKeychainConfig struct {
 	// KubeconfigPath is the path to kubeconfig which can be used to sync
 	// secrets on the cluster into this snapshotter.
 	KubeconfigPath string `toml:"kubeconfig_path" json:"kubeconfig_path"`
+
+	// NamespaceScope restricts the secrets used by the keychain: "pod" uses only the
+	// secrets in the namespace of the pod pulling the image (known through the CRI
+	// keychain) and a namespace name uses only the secrets of that namespace.
+	// Empty uses the secrets of all namespaces.
+	NamespaceScope string `toml:"namespace_scope" json:"namespace_scope"`
 }
 
 // CRIKeychainConfig is config for CRI-based keychain.
@@ -69,10 +142,26 @@ type ResolverConfig resolver.Config
 // SnapshotterConfig is snapshotter-related config.
 type SnapshotterConfig struct {
 	// AllowInvalidMountsOnRestart allows that there are snapshot mounts that cannot access to the
-	// data source when restarting the snapshotter.
+	// data source when restarting the snapshotter. Those snapshots are logged in warnings with
+	// the reasons of the failures and listed by the /debug/invalid-mounts endpoint. If this is
+	// false, the snapshotter fails to start with an error listing them.
 	// NOTE: User needs to manually remove the snapshots from containerd's metadata store using
 	//       ctr (e.g. `ctr snapshot rm`).
 	AllowInvalidMountsOnRestart bool `toml:"allow_invalid_mounts_on_restart" json:"allow_invalid_mounts_on_restart"`
+
+	// FuseWriteBack requests FUSE write-back caching mode.
+	// NOTE: This is currently rejected by Validate. Stargz layers are mounted read-only (writes
+	//       go to the overlayfs upper directory, not to FUSE) and go-fuse doesn't negotiate
+	//       the kernel's writeback cache capability.
+	FuseWriteBack bool `toml:"fuse_write_back" json:"fuse_write_back"`
+
+	// PreloadOnMount starts fetching the priority files of a layer, as recorded in its
+	// TOC, in the background as soon as the layer is mounted instead of on the first read.
+	PreloadOnMount bool `toml:"preload_on_mount" json:"preload_on_mount"`
+
+	// GCPolicy evicts the committed snapshots that no other snapshot is based on and
+	// that their creator labelled with snapshot.EvictableLabel. Disabled by default.
+	GCPolicy snapshot.GCPolicy `toml:"gc_policy" json:"gc_policy"`
 }
 
 // CompressionConfig is config for compression settings.
@@ -81,4 +170,139 @@ type CompressionConfig struct {
 	ZstdImplementation string `toml:"zstd_implementation" json:"zstd_implementation"`
 	// ZstdChunkedCompressionLevel default compression level for zstd:chunked (1-22)
 	ZstdChunkedCompressionLevel int `toml:"zstd_chunked_compression_level" json:"zstd_chunked_compression_level"`
+	// ZstdChunkedHashAlgorithm is the algorithm of the file and chunk digests in the TOCs of
+	// zstd:chunked layers: "sha256" (default), "sha384" or "sha512"
+	ZstdChunkedHashAlgorithm string `toml:"zstd_chunked_hash_algorithm" json:"zstd_chunked_hash_algorithm"`
+	// ZstdWorkers is the number of zstd compression workers (up to 256). It takes precedence
+	// over the ZSTD_WORKERS environment variable. 0 (default) uses ZSTD_WORKERS if set and
+	// otherwise detects it from the CPUs available to the snapshotter.
+	ZstdWorkers int `toml:"zstd_workers" json:"zstd_workers"`
+}
+
+// Validate checks that the configuration can be satisfied by this build of the snapshotter.
+func (c *Config) Validate() error {
+	if c.Version != "" && c.Version != ConfigVersion {
+		return &UnsupportedVersionError{Got: c.Version, Supported: ConfigVersion}
+	}
+	if err := validateLogLevel(c.LogLevel); err != nil {
+		return err
+	}
+	if err := c.HealthCheckConfig.validate(); err != nil {
+		return err
+	}
+	if err := validateStorageBackend(c.StorageBackend); err != nil {
+		return err
+	}
+	if err := c.CacheConfig.validate(); err != nil {
+		return err
+	}
+	if err := c.NetworkConfig.validate(); err != nil {
+		return err
+	}
+	if err := c.SecurityConfig.validate(); err != nil {
+		return err
+	}
+	if err := c.validateNamespaceScope(); err != nil {
+		return err
+	}
+	if c.ResolverConfig.DNSOverTLS && c.ResolverConfig.DNSOverTLSServer == "" {
+		return fmt.Errorf("resolver.dns_over_tls requires resolver.dns_over_tls_server")
+	}
+	if c.ResolverConfig.RequestTimeout < 0 {
+		return fmt.Errorf("invalid resolver.request_timeout %v: must not be negative", c.ResolverConfig.RequestTimeout)
+	}
+	if proxy := c.ResolverConfig.HTTPProxy; proxy != "" {
+		if u, err := url.Parse(proxy); err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5") {
+			return fmt.Errorf("invalid resolver.http_proxy %q: must be a http, https or socks5 URL", proxy)
+		}
+	}
+	if c.ResolverConfig.MaxConcurrentRequests < 0 {
+		return fmt.Errorf("invalid resolver.max_concurrent_requests %d: must not be negative", c.ResolverConfig.MaxConcurrentRequests)
+	}
+	if c.ResolverConfig.MaxRedirects < 0 {
+		return fmt.Errorf("invalid resolver.max_redirects %d: must not be negative", c.ResolverConfig.MaxRedirects)
+	}
+	if c.ResolverConfig.CircuitBreakerThreshold < 0 || c.ResolverConfig.CircuitBreakerCooldown < 0 {
+		return fmt.Errorf("invalid resolver.circuit_breaker_threshold or circuit_breaker_cooldown: must not be negative")
+	}
+	if c.ConversionTimeout < 0 {
+		return fmt.Errorf("invalid conversion_timeout %v: must not be negative", c.ConversionTimeout)
+	}
+	if c.MaxParallelConversions < 0 {
+		return fmt.Errorf("invalid max_parallel_conversions %d: must not be negative", c.MaxParallelConversions)
+	}
+	if c.FuseWriteBack {
+		return fmt.Errorf("fuse_write_back is not supported: stargz layers are read-only FUSE mounts")
+	}
+	if c.GCPolicy.MaxAge < 0 || c.GCPolicy.GCInterval < 0 {
+		return fmt.Errorf("invalid snapshotter.gc_policy: max_age and gc_interval must not be negative")
+	}
+	if c.ZstdWorkers < 0 || c.ZstdWorkers > maxZstdWorkers {
+		return fmt.Errorf("invalid zstd_workers %d: must be in range 0-%d", c.ZstdWorkers, maxZstdWorkers)
+	}
+	compressor, err := GetCompressorFromConfig(c.CompressionConfig)
+	if err != nil {
+		return err
+	}
+	if level := c.ZstdChunkedCompressionLevel; level < 0 || level > compressor.MaxCompressionLevel() {
+		return fmt.Errorf("invalid zstd_chunked_compression_level %d: %s supports levels up to %d",
+			level, compressor.Name(), compressor.MaxCompressionLevel())
+	}
+	if alg := c.ZstdChunkedHashAlgorithm; alg != "" && !digest.Algorithm(alg).Available() {
+		return fmt.Errorf("invalid zstd_chunked_hash_algorithm %q: must be sha256, sha384 or sha512", alg)
+	}
+	return nil
+}
+
+// ConvertOptions returns the options making the layer conversions of nativeconverter
+// follow ConversionTimeout and MaxParallelConversions. The conversions using the
+// returned options share the MaxParallelConversions limit.
+func (c *Config) ConvertOptions() []nativeconverter.ConvertOption {
+	maxParallel := c.MaxParallelConversions
+	if maxParallel == 0 {
+		maxParallel = defaultMaxParallelConversions
+	}
+	return []nativeconverter.ConvertOption{
+		nativeconverter.WithTimeout(c.ConversionTimeout),
+		nativeconverter.WithMaxParallelConversions(maxParallel),
+	}
+}
+
+func (c *Config) validateNamespaceScope() error {
+	switch scope := c.NamespaceScope; scope {
+	case "":
+		return nil
+	case kubeconfig.NamespaceScopePod:
+		if !c.CRIKeychainConfig.EnableKeychain {
+			return fmt.Errorf("kubeconfig_keychain.namespace_scope %q requires cri_keychain.enable_keychain", scope)
+		}
+		return nil
+	default:
+		if errs := validation.IsDNS1123Label(scope); len(errs) > 0 {
+			return fmt.Errorf("invalid kubeconfig_keychain.namespace_scope %q: %s", scope, strings.Join(errs, "; "))
+		}
+		return nil
+	}
+}
+
+// GetCompressorFromConfig returns the zstd compressor selected by ZstdImplementation.
+// An empty value or "auto" selects the implementation detected at runtime.
+// ZstdWorkers is applied with compzstd.SetWorkerCount before the compressor is
+// initialized, which logs the worker count.
+func GetCompressorFromConfig(cfg CompressionConfig) (compzstd.Compressor, error) {
+	compzstd.SetWorkerCount(cfg.ZstdWorkers)
+	switch cfg.ZstdImplementation {
+	case "", "auto":
+		return compzstd.GetCompressor(), nil
+	case "klauspost":
+		return compzstd.NewPureGoCompressor(), nil
+	case "gozstd":
+		compressor := compzstd.NewGozstdCompressor()
+		if !compressor.IsLibzstdAvailable() {
+			return nil, fmt.Errorf("zstd_implementation %q is requested but libzstd is not available", cfg.ZstdImplementation)
+		}
+		return compressor, nil
+	default:
+		return nil, fmt.Errorf("unknown zstd_implementation %q", cfg.ZstdImplementation)
+	}
 }
@@ -0,0 +1,607 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/containerd/containerd/v2/core/content"
+	compzstd "github.com/containerd/stargz-snapshotter/compression/zstd"
+	"github.com/containerd/stargz-snapshotter/nativeconverter"
+	"github.com/containerd/stargz-snapshotter/service/resolver"
+	"github.com/containerd/stargz-snapshotter/snapshot"
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestValidateCompressionConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     CompressionConfig
+		wantErr bool
+	}{
+		{
+			name: "default",
+			cfg:  CompressionConfig{},
+		},
+		{
+			name: "klauspost within range",
+			cfg:  CompressionConfig{ZstdImplementation: "klauspost", ZstdChunkedCompressionLevel: 11},
+		},
+		{
+			name:    "klauspost beyond max level",
+			cfg:     CompressionConfig{ZstdImplementation: "klauspost", ZstdChunkedCompressionLevel: 15},
+			wantErr: true,
+		},
+		{
+			name:    "negative level",
+			cfg:     CompressionConfig{ZstdChunkedCompressionLevel: -1},
+			wantErr: true,
+		},
+		{
+			name: "worker count",
+			cfg:  CompressionConfig{ZstdWorkers: 4},
+		},
+		{
+			name:    "negative worker count",
+			cfg:     CompressionConfig{ZstdWorkers: -1},
+			wantErr: true,
+		},
+		{
+			name: "maximum worker count",
+			cfg:  CompressionConfig{ZstdWorkers: 256},
+		},
+		{
+			name:    "worker count beyond max",
+			cfg:     CompressionConfig{ZstdWorkers: 257},
+			wantErr: true,
+		},
+		{
+			name:    "unknown implementation",
+			cfg:     CompressionConfig{ZstdImplementation: "foo"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{CompressionConfig: tt.cfg}
+			err := cfg.Validate()
+			if tt.wantErr && err == nil {
+				t.Errorf("expected validation error for %+v", tt.cfg)
+			} else if !tt.wantErr && err != nil {
+				t.Errorf("unexpected validation error for %+v: %v", tt.cfg, err)
+			}
+		})
+	}
+}
+
+func TestZstdWorkers(t *testing.T) {
+	t.Setenv("ZSTD_WORKERS", "5")
+	defer compzstd.SetWorkerCount(0)
+
+	// The worker count of the config overrides ZSTD_WORKERS
+	cfg := Config{CompressionConfig: CompressionConfig{ZstdWorkers: 3}}
+	if _, err := GetCompressorFromConfig(cfg.CompressionConfig); err != nil {
+		t.Fatal(err)
+	}
+	if n, source := compzstd.GetOptimalWorkerCountWithSource(); n != 3 || source != compzstd.WorkerCountSourceConfig {
+		t.Errorf("got %d workers from %v; want 3 from the config", n, source)
+	}
+
+	// Unset falls back to ZSTD_WORKERS
+	cfg.ZstdWorkers = 0
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if n := compzstd.GetOptimalWorkerCount(); n != 5 {
+		t.Errorf("got %d workers; want 5 from ZSTD_WORKERS", n)
+	}
+}
+
+func TestValidateStorageBackend(t *testing.T) {
+	for _, backend := range []string{"", StorageBackendContainerd} {
+		cfg := Config{StorageBackend: backend}
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("unexpected validation error for storage backend %q: %v", backend, err)
+		}
+	}
+	// The placeholder backends aren't usable yet
+	for _, backend := range []string{StorageBackendS3, StorageBackendGCS, "foo"} {
+		cfg := Config{StorageBackend: backend}
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("expected validation error for storage backend %q", backend)
+		}
+	}
+}
+
+func TestPlaceholderStorageBackends(t *testing.T) {
+	for _, backend := range []string{StorageBackendS3, StorageBackendGCS} {
+		store, err := NewContentStore(t.TempDir(), &Config{StorageBackend: backend})
+		if err != nil {
+			t.Fatalf("failed to create %q store: %v", backend, err)
+		}
+		if err := store.Walk(context.Background(), nil); !errors.Is(err, ErrNotImplemented) {
+			t.Errorf("%q store: expected ErrNotImplemented; got %v", backend, err)
+		}
+	}
+}
+
+func TestConverter(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	conv, err := NewConverter(root, &Config{ConversionTimeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs := conv.ContentStore()
+	writeBlob := func(mediaType string, p []byte) ocispec.Descriptor {
+		desc := ocispec.Descriptor{MediaType: mediaType, Digest: digest.FromBytes(p), Size: int64(len(p))}
+		if err := content.WriteBlob(ctx, cs, desc.Digest.String(), bytes.NewReader(p), desc); err != nil {
+			t.Fatal(err)
+		}
+		return desc
+	}
+	layer := writeBlob(ocispec.MediaTypeImageLayerGzip, []byte("layer"))
+	config := writeBlob(ocispec.MediaTypeImageConfig, []byte("{}"))
+	manifest, err := json.Marshal(ocispec.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ocispec.MediaTypeImageManifest,
+		Config:    config,
+		Layers:    []ocispec.Descriptor{layer},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := writeBlob(ocispec.MediaTypeImageManifest, manifest)
+	if _, err := os.Stat(filepath.Join(root, "content", "blobs", "sha256", img.Digest.Encoded())); err != nil {
+		t.Errorf("the blobs must be stored under the root: %v", err)
+	}
+
+	// The conversions follow ConversionTimeout
+	slow := func(ctx context.Context, cs content.Store, desc ocispec.Descriptor) (*ocispec.Descriptor, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	if _, err := conv.Convert(ctx, []ocispec.Descriptor{img}, nativeconverter.WithLayerConvertFunc(slow)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v; want context.DeadlineExceeded", err)
+	}
+}
+
+func TestValidateFuseWriteBack(t *testing.T) {
+	cfg := Config{SnapshotterConfig: SnapshotterConfig{FuseWriteBack: true}}
+	if err := cfg.Validate(); err == nil {
+		t.Errorf("expected validation error for fuse_write_back")
+	}
+}
+
+func TestValidateCacheConfig(t *testing.T) {
+	valid := Config{CacheConfig: CacheConfig{MaxEntries: 10, TTL: time.Minute, WarmPaths: []string{"ghcr.io/stargz-containers/alpine:3.15.3-org"}}}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("unexpected validation error: %v", err)
+	}
+	for _, cfg := range []CacheConfig{
+		{MaxEntries: -1},
+		{TTL: -time.Second},
+		{WarmPaths: []string{"ghcr.io/stargz-containers/*"}},
+	} {
+		c := Config{CacheConfig: cfg}
+		if err := c.Validate(); err == nil {
+			t.Errorf("expected validation error for %+v", cfg)
+		}
+	}
+}
+
+func TestValidateLogLevel(t *testing.T) {
+	for _, level := range []string{"", "debug", "info", "warn", "error"} {
+		cfg := Config{LogLevel: level}
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("unexpected validation error for log level %q: %v", level, err)
+		}
+	}
+	cfg := Config{LogLevel: "trace"}
+	if err := cfg.Validate(); err == nil {
+		t.Errorf("expected validation error for unsupported log level")
+	}
+}
+
+func TestValidateRequestTimeout(t *testing.T) {
+	valid := Config{ResolverConfig: ResolverConfig{RequestTimeout: 10 * time.Second}}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("unexpected validation error: %v", err)
+	}
+	cfg := Config{ResolverConfig: ResolverConfig{RequestTimeout: -time.Second}}
+	if err := cfg.Validate(); err == nil {
+		t.Errorf("expected validation error for negative request_timeout")
+	}
+}
+
+func TestValidateMaxConcurrentRequests(t *testing.T) {
+	valid := Config{ResolverConfig: ResolverConfig{MaxConcurrentRequests: 8}}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("unexpected validation error: %v", err)
+	}
+	cfg := Config{ResolverConfig: ResolverConfig{MaxConcurrentRequests: -1}}
+	if err := cfg.Validate(); err == nil {
+		t.Errorf("expected validation error for negative max_concurrent_requests")
+	}
+}
+
+func TestValidateZstdChunkedHashAlgorithm(t *testing.T) {
+	for _, alg := range []string{"", "sha256", "sha512"} {
+		cfg := Config{CompressionConfig: CompressionConfig{ZstdChunkedHashAlgorithm: alg}}
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("%q: unexpected validation error: %v", alg, err)
+		}
+	}
+	cfg := Config{CompressionConfig: CompressionConfig{ZstdChunkedHashAlgorithm: "md5"}}
+	if err := cfg.Validate(); err == nil {
+		t.Errorf("expected validation error for zstd_chunked_hash_algorithm md5")
+	}
+}
+
+func TestValidateMaxRedirects(t *testing.T) {
+	valid := Config{ResolverConfig: ResolverConfig{MaxRedirects: 3}}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("unexpected validation error: %v", err)
+	}
+	cfg := Config{ResolverConfig: ResolverConfig{MaxRedirects: -1}}
+	if err := cfg.Validate(); err == nil {
+		t.Errorf("expected validation error for negative max_redirects")
+	}
+}
+
+func TestValidateCircuitBreaker(t *testing.T) {
+	valid := Config{ResolverConfig: ResolverConfig{CircuitBreakerThreshold: 5, CircuitBreakerCooldown: time.Minute}}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("unexpected validation error: %v", err)
+	}
+	for _, cfg := range []Config{
+		{ResolverConfig: ResolverConfig{CircuitBreakerThreshold: -1}},
+		{ResolverConfig: ResolverConfig{CircuitBreakerThreshold: 5, CircuitBreakerCooldown: -time.Second}},
+	} {
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("expected validation error for %+v", cfg.ResolverConfig)
+		}
+	}
+}
+
+func TestValidateNamespaceScope(t *testing.T) {
+	for _, cfg := range []Config{
+		{KubeconfigKeychainConfig: KubeconfigKeychainConfig{NamespaceScope: "tenant-a"}},
+		{
+			KubeconfigKeychainConfig: KubeconfigKeychainConfig{NamespaceScope: "pod"},
+			CRIKeychainConfig:        CRIKeychainConfig{EnableKeychain: true},
+		},
+	} {
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("namespace_scope %q: unexpected validation error: %v", cfg.NamespaceScope, err)
+		}
+	}
+	for _, scope := range []string{"pod", "Not_A_Namespace"} {
+		cfg := Config{KubeconfigKeychainConfig: KubeconfigKeychainConfig{NamespaceScope: scope}}
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("expected validation error for namespace_scope %q", scope)
+		}
+	}
+}
+
+func TestValidateConversionTimeout(t *testing.T) {
+	for _, tc := range []struct {
+		timeout time.Duration
+		wantErr bool
+	}{
+		{0, false},
+		{10 * time.Minute, false},
+		{-time.Second, true},
+	} {
+		cfg := Config{ConversionTimeout: tc.timeout}
+		if err := cfg.Validate(); (err != nil) != tc.wantErr {
+			t.Errorf("conversion_timeout %v: got error %v; wantErr %v", tc.timeout, err, tc.wantErr)
+		}
+	}
+}
+
+func TestConvertOptionsMaxParallelConversions(t *testing.T) {
+	cfg := Config{MaxParallelConversions: 2}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	var running, maxRunning atomic.Int32
+	mockConvert := func(ctx context.Context, cs content.Store, desc ocispec.Descriptor) (*ocispec.Descriptor, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			m := maxRunning.Load()
+			if n <= m || maxRunning.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		return &desc, nil
+	}
+	convert := nativeconverter.LayerConvertFunc(mockConvert, cfg.ConvertOptions()...)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := convert(context.Background(), nil, ocispec.Descriptor{}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := maxRunning.Load(); got != 2 {
+		t.Errorf("%d conversions ran concurrently; want 2", got)
+	}
+
+	// Waiting for a slot respects the context
+	started, block := make(chan struct{}), make(chan struct{})
+	blocked := nativeconverter.LayerConvertFunc(func(ctx context.Context, cs content.Store, desc ocispec.Descriptor) (*ocispec.Descriptor, error) {
+		started <- struct{}{}
+		<-block
+		return &desc, nil
+	}, cfg.ConvertOptions()...)
+	errs := make(chan error, 3)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := blocked(context.Background(), nil, ocispec.Descriptor{})
+			errs <- err
+		}()
+		<-started
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		_, err := blocked(ctx, nil, ocispec.Descriptor{})
+		errs <- err
+	}()
+	cancel()
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v; want context.Canceled for the conversion waiting for a slot", err)
+	}
+	close(block)
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("running conversion failed: %v", err)
+		}
+	}
+}
+
+func TestValidateHTTPProxy(t *testing.T) {
+	for _, tc := range []struct {
+		proxy   string
+		wantErr bool
+	}{
+		{"", false},
+		{"http://proxy.example.com:3128", false},
+		{"socks5://127.0.0.1:1080", false},
+		{"proxy.example.com:3128", true},
+		{"ftp://proxy.example.com", true},
+		{"http://", true},
+	} {
+		cfg := Config{ResolverConfig: ResolverConfig{HTTPProxy: tc.proxy, NoProxy: "example.com"}}
+		if err := cfg.Validate(); (err != nil) != tc.wantErr {
+			t.Errorf("http_proxy %q: got error %v; wantErr %v", tc.proxy, err, tc.wantErr)
+		}
+	}
+}
+
+func TestValidateMaxParallelConversions(t *testing.T) {
+	cfg := Config{MaxParallelConversions: -1}
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected validation error for negative max_parallel_conversions")
+	}
+}
+
+func TestValidateGCPolicy(t *testing.T) {
+	valid := Config{SnapshotterConfig: SnapshotterConfig{GCPolicy: snapshot.GCPolicy{MaxAge: time.Hour, GCInterval: time.Minute}}}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("unexpected validation error: %v", err)
+	}
+	for _, policy := range []snapshot.GCPolicy{{MaxAge: -time.Hour}, {GCInterval: -time.Minute}} {
+		cfg := Config{SnapshotterConfig: SnapshotterConfig{GCPolicy: policy}}
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("expected validation error for gc_policy %+v", policy)
+		}
+	}
+}
+
+func TestValidateVersion(t *testing.T) {
+	for _, v := range []string{"", ConfigVersion} {
+		cfg := Config{Version: v}
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("version %q: unexpected validation error: %v", v, err)
+		}
+	}
+	cfg := Config{Version: "v2"}
+	var verr *UnsupportedVersionError
+	if err := cfg.Validate(); !errors.As(err, &verr) {
+		t.Fatalf("got %v; want UnsupportedVersionError", err)
+	}
+	if verr.Got != "v2" || verr.Supported != ConfigVersion {
+		t.Errorf("got %+v; want Got v2 and Supported %q", verr, ConfigVersion)
+	}
+}
+
+func TestConfigMerge(t *testing.T) {
+	base := Config{
+		ResolverConfig: ResolverConfig{Host: map[string]resolver.HostConfig{
+			"docker.io": {Mirrors: []resolver.MirrorConfig{{Host: "mirror1"}}},
+			"ghcr.io":   {Mirrors: []resolver.MirrorConfig{{Host: "mirror2"}}},
+		}},
+		CacheConfig:          CacheConfig{MaxEntries: 10, TTL: time.Minute},
+		StorageBackendConfig: map[string]string{"bucket": "base", "region": "us"},
+		LogLevel:             "info",
+	}
+	override := Config{
+		ResolverConfig: ResolverConfig{Host: map[string]resolver.HostConfig{
+			"docker.io": {Mirrors: []resolver.MirrorConfig{{Host: "mirror3", Insecure: true}}},
+		}},
+		CacheConfig:          CacheConfig{TTL: time.Hour},
+		StorageBackendConfig: map[string]string{"bucket": "prod"},
+	}
+	want := Config{
+		ResolverConfig: ResolverConfig{Host: map[string]resolver.HostConfig{
+			"docker.io": {Mirrors: []resolver.MirrorConfig{{Host: "mirror1"}, {Host: "mirror3", Insecure: true}}},
+			"ghcr.io":   {Mirrors: []resolver.MirrorConfig{{Host: "mirror2"}}},
+		}},
+		CacheConfig:          CacheConfig{MaxEntries: 10, TTL: time.Hour},
+		StorageBackendConfig: map[string]string{"bucket": "prod", "region": "us"},
+		LogLevel:             "info",
+	}
+	got := base.Merge(override)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("merged config = %+v; want %+v", got, want)
+	}
+	// The inputs aren't modified
+	got.StorageBackendConfig["bucket"] = "modified"
+	got.ResolverConfig.Host["docker.io"].Mirrors[0].Host = "modified"
+	if base.StorageBackendConfig["bucket"] != "base" || base.ResolverConfig.Host["docker.io"].Mirrors[0].Host != "mirror1" {
+		t.Errorf("merge modified the base config")
+	}
+	if len(base.ResolverConfig.Host["docker.io"].Mirrors) != 1 {
+		t.Errorf("merge modified the mirrors of the base config")
+	}
+
+	// Every field is set by a non-zero override
+	full := Config{}
+	fillNonZero(t, reflect.ValueOf(&full).Elem(), "Config")
+	for _, tt := range []struct {
+		name        string
+		base, other Config
+		want        Config
+	}{
+		{name: "zero base", base: Config{}, other: full, want: full},
+		{name: "zero override", base: full, other: Config{}, want: full},
+	} {
+		if got := tt.base.Merge(tt.other); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: merged config = %+v; want %+v", tt.name, got, tt.want)
+		}
+	}
+	doubled := full.Merge(full)
+	if n := len(doubled.CacheConfig.WarmPaths); n != 2*len(full.CacheConfig.WarmPaths) {
+		t.Errorf("slices must be appended: got %d warm paths", n)
+	}
+	// A pointer set to the zero value overrides the base
+	follow, noFollow := true, false
+	followBase := Config{ResolverConfig: ResolverConfig{FollowRedirects: &follow}}
+	merged := followBase.Merge(Config{ResolverConfig: ResolverConfig{FollowRedirects: &noFollow}})
+	if f := merged.ResolverConfig.FollowRedirects; f == nil || *f {
+		t.Errorf("follow_redirects = false must override true")
+	}
+}
+
+func TestConfigApplyEnv(t *testing.T) {
+	t.Setenv("STARGZ_COMPRESSION_ZSTD_CHUNKED_COMPRESSION_LEVEL", "5")
+	t.Setenv("STARGZ_COMPRESSION_ZSTD_IMPLEMENTATION", "klauspost")
+	t.Setenv("STARGZ_NOPREFETCH", "true")
+	t.Setenv("STARGZ_SNAPSHOTTER_GC_POLICY_MAX_AGE", "1h")
+	t.Setenv("STARGZ_CONVERSION_TIMEOUT", "30s")
+	t.Setenv("STARGZ_RESOLVER_NO_PROXY", "localhost,10.0.0.0/8")
+	t.Setenv("STARGZ_RESOLVER_FOLLOW_REDIRECTS", "false")
+	t.Setenv("STARGZ_CACHE_WARM_PATHS", "/a, /b")
+
+	base := Config{
+		MaxParallelConversions: 2,
+		StorageBackendConfig:   map[string]string{"bucket": "base"},
+	}
+	got, err := base.ApplyEnv()
+	if err != nil {
+		t.Fatalf("failed to apply env: %v", err)
+	}
+	want := base
+	want.ZstdChunkedCompressionLevel = 5
+	want.ZstdImplementation = "klauspost"
+	want.NoPrefetch = true
+	want.GCPolicy.MaxAge = time.Hour
+	want.ConversionTimeout = 30 * time.Second
+	want.ResolverConfig.NoProxy = "localhost,10.0.0.0/8"
+	want.ResolverConfig.FollowRedirects = new(bool)
+	want.CacheConfig.WarmPaths = []string{"/a", "/b"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("config = %+v; want %+v", got, want)
+	}
+	if base.ZstdChunkedCompressionLevel != 0 || base.NoPrefetch {
+		t.Errorf("ApplyEnv modified the config")
+	}
+
+	for name, value := range map[string]string{
+		"STARGZ_MAX_PARALLEL_CONVERSIONS": "many",
+		"STARGZ_STORAGE_BACKEND_CONFIG":   "bucket=env",
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, value)
+			if _, err := base.ApplyEnv(); err == nil || !strings.Contains(err.Error(), name) {
+				t.Errorf("%s=%q must fail; got %v", name, value, err)
+			}
+		})
+	}
+}
+
+// fillNonZero sets all exported fields reachable from v to non-zero values
+func fillNonZero(t *testing.T, v reflect.Value, path string) {
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if f := v.Type().Field(i); f.IsExported() {
+				fillNonZero(t, v.Field(i), path+"."+f.Name)
+			}
+		}
+	case reflect.Slice:
+		e := reflect.New(v.Type().Elem()).Elem()
+		fillNonZero(t, e, path+"[]")
+		v.Set(reflect.Append(reflect.MakeSlice(v.Type(), 0, 1), e))
+	case reflect.Map:
+		k := reflect.New(v.Type().Key()).Elem()
+		fillNonZero(t, k, path+"{key}")
+		e := reflect.New(v.Type().Elem()).Elem()
+		fillNonZero(t, e, path+"{}")
+		v.Set(reflect.MakeMap(v.Type()))
+		v.SetMapIndex(k, e)
+	case reflect.String:
+		v.SetString(path)
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(int64(len(path)))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(uint64(len(path)))
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(float64(len(path)))
+	case reflect.Interface:
+		v.Set(reflect.ValueOf(path))
+	case reflect.Pointer:
+		p := reflect.New(v.Type().Elem())
+		fillNonZero(t, p.Elem(), path)
+		v.Set(p)
+	default:
+		t.Fatalf("%s: unsupported kind %v; update Config.Merge and this test", path, v.Kind())
+	}
+}
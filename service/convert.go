@@ -0,0 +1,57 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/containerd/containerd/v2/core/content"
+	"github.com/containerd/stargz-snapshotter/nativeconverter"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Converter converts the images stored in the content store selected by
+// StorageBackend, following ConversionTimeout and MaxParallelConversions.
+type Converter struct {
+	cs   content.Store
+	opts []nativeconverter.ConvertOption
+}
+
+// NewConverter returns the Converter of config. The content store is created under
+// root as by NewContentStore. All conversions of the Converter share the
+// MaxParallelConversions limit.
+func NewConverter(root string, config *Config) (*Converter, error) {
+	cs, err := NewContentStore(root, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create content store: %w", err)
+	}
+	return &Converter{cs: cs, opts: config.ConvertOptions()}, nil
+}
+
+// ContentStore returns the content store where the images are read and the
+// converted blobs are written.
+func (c *Converter) ContentStore() content.Store {
+	return c.cs
+}
+
+// Convert converts imgs with nativeconverter.BatchConvert. opts must specify the
+// layer convert func (see nativeconverter.WithLayerConvertFunc) and are applied
+// after the options of the config.
+func (c *Converter) Convert(ctx context.Context, imgs []ocispec.Descriptor, opts ...nativeconverter.ConvertOption) (*nativeconverter.ConversionReport, error) {
+	return nativeconverter.BatchConvert(ctx, c.cs, imgs, append(append([]nativeconverter.ConvertOption{}, c.opts...), opts...)...)
+}
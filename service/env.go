@@ -0,0 +1,151 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package service
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envPrefix is the prefix of the environment variables read by Config.ApplyEnv
+const envPrefix = "STARGZ"
+
+// ApplyEnv returns c overridden by the environment variables named after the TOML
+// keys of its fields: STARGZ_ followed by the path of the key in capitals, with the
+// components separated by underscores. For example STARGZ_COMPRESSION_ZSTD_IMPLEMENTATION
+// sets zstd_implementation of the [compression] section. c isn't modified.
+//
+//   - Fields without a toml tag aren't overlayable. The fields of embedded structs
+//     without a tag are at the level of the struct embedding them, like in TOML.
+//   - Durations are parsed by time.ParseDuration and string slices are comma-separated.
+//   - Maps (e.g. the resolver hosts) can't be set from the environment.
+//
+// An error is returned if a variable can't be parsed or sets a map.
+func (c Config) ApplyEnv() (Config, error) {
+	v := reflect.ValueOf(&c).Elem()
+	if err := applyEnv(v, envPrefix); err != nil {
+		return Config{}, err
+	}
+	return c, nil
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// applyEnv sets the fields of the struct v from the environment variables prefixed by prefix
+func applyEnv(v reflect.Value, prefix string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		key, _, _ := strings.Cut(f.Tag.Get("toml"), ",")
+		if key == "-" {
+			continue
+		}
+		fv := v.Field(i)
+		if key == "" {
+			if f.Anonymous && fv.Kind() == reflect.Struct {
+				if err := applyEnv(fv, prefix); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		name := prefix + "_" + strings.ToUpper(key)
+		if fv.Kind() == reflect.Struct {
+			if err := applyEnv(fv, name); err != nil {
+				return err
+			}
+			continue
+		}
+		s, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setFromEnv(fv, s); err != nil {
+			return fmt.Errorf("invalid environment variable %s=%q: %w", name, s, err)
+		}
+	}
+	return nil
+}
+
+// setFromEnv parses s into v
+func setFromEnv(v reflect.Value, s string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Pointer:
+		p := reflect.New(v.Type().Elem())
+		if err := setFromEnv(p.Elem(), s); err != nil {
+			return err
+		}
+		v.Set(p)
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %v", v.Type())
+		}
+		var elems []string
+		if s != "" {
+			elems = strings.Split(s, ",")
+		}
+		sl := reflect.MakeSlice(v.Type(), len(elems), len(elems))
+		for i, e := range elems {
+			sl.Index(i).SetString(strings.TrimSpace(e))
+		}
+		v.Set(sl)
+	default:
+		return fmt.Errorf("unsupported type %v", v.Type())
+	}
+	return nil
+}
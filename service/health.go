@@ -0,0 +1,160 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package service
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/containerd/log"
+)
+
+const (
+	defaultLivenessPath  = "/livez"
+	defaultReadinessPath = "/readyz"
+)
+
+// HealthCheckConfig is config for the liveness and readiness probe endpoints.
+type HealthCheckConfig struct {
+	// Address is the TCP address to serve the probes on. The probes are disabled if empty.
+	Address string `toml:"address" json:"address"`
+
+	// LivenessPath is the HTTP path of the liveness probe (default: "/livez").
+	LivenessPath string `toml:"liveness_path" json:"liveness_path"`
+
+	// ReadinessPath is the HTTP path of the readiness probe (default: "/readyz").
+	ReadinessPath string `toml:"readiness_path" json:"readiness_path"`
+
+	// StartupDelay is the minimum duration after startup before reporting ready.
+	StartupDelay time.Duration `toml:"startup_delay" json:"startup_delay"`
+
+	// CheckInterval is the interval of the periodic readiness check once the
+	// snapshotter is ready. Zero disables the periodic check.
+	CheckInterval time.Duration `toml:"check_interval" json:"check_interval"`
+}
+
+// HealthChecker serves liveness and readiness probes. Readiness is reported only
+// after SetReady is called, StartupDelay has passed and the latest periodic
+// check succeeded.
+type HealthChecker struct {
+	config  HealthCheckConfig
+	started time.Time
+
+	mu       sync.Mutex
+	ready    bool
+	checkErr error
+}
+
+// validate returns an error if the endpoint paths are invalid or collide, which
+// would make Handler panic
+func (c HealthCheckConfig) validate() error {
+	paths := map[string]string{LogLevelPath: "the log level endpoint"}
+	for _, ep := range []struct{ name, path string }{
+		{"liveness_path", cmp.Or(c.LivenessPath, defaultLivenessPath)},
+		{"readiness_path", cmp.Or(c.ReadinessPath, defaultReadinessPath)},
+	} {
+		if !strings.HasPrefix(ep.path, "/") {
+			return fmt.Errorf("invalid health_check.%s %q: must start with \"/\"", ep.name, ep.path)
+		}
+		if other, ok := paths[ep.path]; ok {
+			return fmt.Errorf("invalid health_check.%s %q: already used by %s", ep.name, ep.path, other)
+		}
+		paths[ep.path] = "health_check." + ep.name
+	}
+	return nil
+}
+
+// NewHealthChecker creates a new HealthChecker. The startup delay counts from this call.
+func NewHealthChecker(config HealthCheckConfig) *HealthChecker {
+	if config.LivenessPath == "" {
+		config.LivenessPath = defaultLivenessPath
+	}
+	if config.ReadinessPath == "" {
+		config.ReadinessPath = defaultReadinessPath
+	}
+	return &HealthChecker{config: config, started: time.Now()}
+}
+
+// SetReady marks the snapshotter as ready (e.g. its metadata store has been loaded).
+// If check is non-nil and CheckInterval is set, check runs periodically until ctx
+// is done and readiness follows its result.
+func (h *HealthChecker) SetReady(ctx context.Context, check func(context.Context) error) {
+	h.mu.Lock()
+	h.ready = true
+	h.mu.Unlock()
+	if check == nil || h.config.CheckInterval <= 0 {
+		return
+	}
+	go func() {
+		t := time.NewTicker(h.config.CheckInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+			err := check(ctx)
+			if err != nil {
+				log.G(ctx).WithError(err).Warn("readiness check failed")
+			}
+			h.mu.Lock()
+			h.checkErr = err
+			h.mu.Unlock()
+		}
+	}()
+}
+
+// Handler returns the HTTP handler serving the probe endpoints and the log level
+// endpoint (LogLevelPath).
+func (h *HealthChecker) Handler() http.Handler {
+	m := http.NewServeMux()
+	m.HandleFunc(h.config.LivenessPath, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintln(w, "ok")
+	})
+	m.HandleFunc(h.config.ReadinessPath, func(w http.ResponseWriter, r *http.Request) {
+		if err := h.readiness(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintln(w, "ok")
+	})
+	m.HandleFunc(LogLevelPath, logLevelHandler)
+	return m
+}
+
+func (h *HealthChecker) readiness() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.ready {
+		return fmt.Errorf("snapshotter is starting")
+	}
+	if time.Since(h.started) < h.config.StartupDelay {
+		return fmt.Errorf("snapshotter is in startup delay")
+	}
+	if h.checkErr != nil {
+		return fmt.Errorf("readiness check failed: %w", h.checkErr)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package service
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/containerd/log"
+)
+
+func TestHealthCheck(t *testing.T) {
+	h := NewHealthChecker(HealthCheckConfig{})
+	srv := httptest.NewServer(h.Handler())
+	defer srv.Close()
+
+	check := func(path string, want int) {
+		t.Helper()
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatalf("failed to get %q: %v", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("%q: status = %d; want %d", path, resp.StatusCode, want)
+		}
+	}
+
+	check("/livez", http.StatusOK)
+	check("/readyz", http.StatusServiceUnavailable)
+
+	// Simulate that the metadata store has been loaded
+	h.SetReady(context.Background(), nil)
+
+	check("/livez", http.StatusOK)
+	check("/readyz", http.StatusOK)
+}
+
+func TestValidateHealthCheckPaths(t *testing.T) {
+	for _, tt := range []struct {
+		config HealthCheckConfig
+		valid  bool
+	}{
+		{config: HealthCheckConfig{}, valid: true},
+		{config: HealthCheckConfig{LivenessPath: "/healthz", ReadinessPath: "/ready"}, valid: true},
+		{config: HealthCheckConfig{LivenessPath: "/healthz", ReadinessPath: "/healthz"}},
+		{config: HealthCheckConfig{ReadinessPath: defaultLivenessPath}},
+		{config: HealthCheckConfig{LivenessPath: LogLevelPath}},
+		{config: HealthCheckConfig{ReadinessPath: "readyz"}},
+	} {
+		cfg := Config{HealthCheckConfig: tt.config}
+		if err := cfg.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate(%+v) = %v; want valid=%v", tt.config, err, tt.valid)
+		}
+		if tt.valid {
+			NewHealthChecker(tt.config).Handler() // must not panic
+		}
+	}
+}
+
+func TestLogLevelEndpoint(t *testing.T) {
+	orig := log.GetLevel()
+	origOut := log.L.Logger.Out
+	defer func() {
+		log.L.Logger.SetLevel(orig)
+		log.L.Logger.SetOutput(origOut)
+	}()
+	var buf bytes.Buffer
+	log.L.Logger.SetOutput(&buf)
+	if err := log.SetLevel("info"); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(NewHealthChecker(HealthCheckConfig{}).Handler())
+	defer srv.Close()
+	put := func(body string) int {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodPut, srv.URL+LogLevelPath, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	log.G(context.Background()).Debug("hidden debug message")
+	if code := put(`{"level": "debug"}`); code != http.StatusNoContent {
+		t.Fatalf("status = %d; want %d", code, http.StatusNoContent)
+	}
+	log.G(context.Background()).Debug("visible debug message")
+	if out := buf.String(); strings.Contains(out, "hidden debug message") || !strings.Contains(out, "visible debug message") {
+		t.Errorf("unexpected log output after changing level to debug: %q", out)
+	}
+
+	if code := put(`{"level": "verbose"}`); code != http.StatusBadRequest {
+		t.Errorf("invalid level: status = %d; want %d", code, http.StatusBadRequest)
+	}
+	if log.GetLevel() != log.DebugLevel {
+		t.Errorf("invalid request changed the level to %v", log.GetLevel())
+	}
+	resp, err := http.Get(srv.URL + LogLevelPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET: status = %d; want %d", resp.StatusCode, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,50 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/containerd/stargz-snapshotter/snapshot"
+)
+
+// InvalidMountsPath is the HTTP path of the debug endpoint listing the remote
+// snapshots that couldn't be mounted on restart.
+const InvalidMountsPath = "/debug/invalid-mounts"
+
+// InvalidMountsHandler returns the HTTP handler of InvalidMountsPath. It returns
+// the snapshot.InvalidMount list of l as JSON for a GET request.
+func InvalidMountsHandler(l snapshot.InvalidMountLister) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		invalid, err := l.ListInvalidMounts(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if invalid == nil {
+			invalid = []snapshot.InvalidMount{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(invalid)
+	})
+}
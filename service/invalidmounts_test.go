@@ -0,0 +1,113 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/containerd/containerd/v2/core/snapshots"
+	"github.com/containerd/errdefs"
+	"github.com/containerd/stargz-snapshotter/snapshot"
+)
+
+const targetSnapshotLabel = "containerd.io/snapshot.ref"
+
+// contentFs "mounts" the layers whose data is in content without mounting anything
+type contentFs struct {
+	content map[string]bool // target snapshot names of the stored layers
+}
+
+func (fs *contentFs) Mount(ctx context.Context, mountpoint string, labels map[string]string) error {
+	if target := labels[targetSnapshotLabel]; !fs.content[target] {
+		return fmt.Errorf("data of layer %q: %w", target, errdefs.ErrNotFound)
+	}
+	return nil
+}
+
+func (fs *contentFs) Check(ctx context.Context, mountpoint string, labels map[string]string) error {
+	return nil
+}
+
+func (fs *contentFs) Unmount(ctx context.Context, mountpoint string) error {
+	return nil
+}
+
+func TestInvalidMountsEndpoint(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	fs := &contentFs{content: map[string]bool{"layer0": true, "layer1": true, "layer2": true}}
+	sn, err := snapshot.NewSnapshotter(ctx, root, fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parent string
+	for i := 0; i < 3; i++ {
+		target := fmt.Sprintf("layer%d", i)
+		labels := map[string]string{targetSnapshotLabel: target}
+		if _, err := sn.Prepare(ctx, fmt.Sprintf("extract-%d", i), parent, snapshots.WithLabels(labels)); !errdefs.IsAlreadyExists(err) {
+			t.Fatalf("failed to prepare remote snapshot %s: %v", target, err)
+		}
+		parent = target
+	}
+	if err := sn.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The data of the middle layer is lost while the snapshotter is down
+	delete(fs.content, "layer1")
+	sn, err = snapshot.NewSnapshotter(ctx, root, fs, snapshot.AllowInvalidMountsOnRestart)
+	if err != nil {
+		t.Fatalf("failed to restart the snapshotter: %v", err)
+	}
+	defer sn.Close()
+
+	srv := httptest.NewServer(InvalidMountsHandler(sn.(snapshot.InvalidMountLister)))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + InvalidMountsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d; want %d", resp.StatusCode, http.StatusOK)
+	}
+	var invalid []snapshot.InvalidMount
+	if err := json.NewDecoder(resp.Body).Decode(&invalid); err != nil {
+		t.Fatal(err)
+	}
+	if len(invalid) != 1 || invalid[0].SnapshotID != "layer1" || invalid[0].ParentID != "layer0" {
+		t.Fatalf("invalid mounts = %+v; want layer1 with parent layer0", invalid)
+	}
+	if !strings.Contains(invalid[0].Reason, errdefs.ErrNotFound.Error()) {
+		t.Errorf("reason = %q; want %q", invalid[0].Reason, errdefs.ErrNotFound)
+	}
+
+	resp, err = http.Post(srv.URL+InvalidMountsPath, "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST: status = %d; want %d", resp.StatusCode, http.StatusMethodNotAllowed)
+	}
+}
@@ -54,6 +54,67 @@ func NewCRIKeychain(ctx context.Context, connectCRI func() (runtime.ImageService
 	return server.credentials, server
 }
 
+// podNamespaceAnnotation is the sandbox annotation with the namespace of the pod
+const podNamespaceAnnotation = "io.kubernetes.pod.namespace"
+
+var (
+	// pullingNamespaces counts the pulls in progress of each image by the namespace
+	// of the pod pulling it
+	pullingNamespaces   = make(map[string]map[string]int)
+	pullingNamespacesMu sync.Mutex
+)
+
+// PodNamespace returns the namespace of the pod pulling refspec through the CRI image
+// service returned by NewCRIKeychain, while the pull is in progress. It returns false
+// if refspec isn't being pulled through CRI, the pull request didn't specify the pod
+// or pods of several namespaces are pulling it. The snapshotter records it for the
+// layers prepared by the pull as they can be shared by the pods of other namespaces
+// pulling the image later.
+func PodNamespace(refspec reference.Spec) (string, bool) {
+	pullingNamespacesMu.Lock()
+	defer pullingNamespacesMu.Unlock()
+	namespaces := pullingNamespaces[refspec.String()]
+	if len(namespaces) != 1 {
+		return "", false
+	}
+	for ns := range namespaces {
+		return ns, true
+	}
+	return "", false
+}
+
+// startPull records a pull of ref by a pod in namespace until the returned function
+// is called
+func startPull(ref, namespace string) (done func()) {
+	if namespace == "" {
+		return func() {}
+	}
+	pullingNamespacesMu.Lock()
+	defer pullingNamespacesMu.Unlock()
+	if pullingNamespaces[ref] == nil {
+		pullingNamespaces[ref] = make(map[string]int)
+	}
+	pullingNamespaces[ref][namespace]++
+	return func() {
+		pullingNamespacesMu.Lock()
+		defer pullingNamespacesMu.Unlock()
+		if pullingNamespaces[ref][namespace]--; pullingNamespaces[ref][namespace] == 0 {
+			delete(pullingNamespaces[ref], namespace)
+		}
+		if len(pullingNamespaces[ref]) == 0 {
+			delete(pullingNamespaces, ref)
+		}
+	}
+}
+
+// sandboxNamespace returns the pod namespace in sandbox config
+func sandboxNamespace(cfg *runtime.PodSandboxConfig) string {
+	if ns := cfg.GetMetadata().GetNamespace(); ns != "" {
+		return ns
+	}
+	return cfg.GetAnnotations()[podNamespaceAnnotation]
+}
+
 type instrumentedService struct {
 	cri   runtime.ImageServiceClient
 	criMu sync.Mutex
@@ -110,6 +171,8 @@ func (in *instrumentedService) PullImage(ctx context.Context, r *runtime.PullIma
 	in.configMu.Lock()
 	in.config[refspec.String()] = r.GetAuth()
 	in.configMu.Unlock()
+	done := startPull(refspec.String(), sandboxNamespace(r.GetSandboxConfig()))
+	defer done()
 	return cri.PullImage(ctx, r)
 }
 
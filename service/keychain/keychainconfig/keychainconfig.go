@@ -36,18 +36,30 @@ type Config struct {
 	EnableKubeKeychain         bool
 	EnableCRIKeychain          bool
 	KubeconfigPath             string
+	KubeconfigNamespaceScope   string
 	DefaultImageServiceAddress string
 	ImageServicePath           string
 }
 
-func ConfigKeychain(ctx context.Context, rpc *grpc.Server, config *Config) ([]resolver.Credential, error) {
+// ConfigKeychain returns the keychains of config. The kubeconfig keychain with
+// NamespaceScopePod is returned as the PodCredential.
+func ConfigKeychain(ctx context.Context, rpc *grpc.Server, config *Config) ([]resolver.Credential, []resolver.PodCredential, error) {
 	credsFuncs := []resolver.Credential{dockerconfig.NewDockerconfigKeychain(ctx)}
+	var podCredsFuncs []resolver.PodCredential
 	if config.EnableKubeKeychain {
 		var opts []kubeconfig.Option
 		if kcp := config.KubeconfigPath; kcp != "" {
 			opts = append(opts, kubeconfig.WithKubeconfigPath(kcp))
 		}
-		credsFuncs = append(credsFuncs, kubeconfig.NewKubeconfigKeychain(ctx, opts...))
+		switch scope := config.KubeconfigNamespaceScope; scope {
+		case kubeconfig.NamespaceScopePod:
+			podCredsFuncs = append(podCredsFuncs, kubeconfig.NewKubeconfigPodKeychain(ctx, opts...))
+		case "":
+			credsFuncs = append(credsFuncs, kubeconfig.NewKubeconfigKeychain(ctx, opts...))
+		default:
+			opts = append(opts, kubeconfig.WithNamespaceScope(scope))
+			credsFuncs = append(credsFuncs, kubeconfig.NewKubeconfigKeychain(ctx, opts...))
+		}
 	}
 	if config.EnableCRIKeychain {
 		// connects to the backend CRI service (defaults to containerd socket)
@@ -67,7 +79,7 @@ func ConfigKeychain(ctx context.Context, rpc *grpc.Server, config *Config) ([]re
 		credsFuncs = append(credsFuncs, f)
 	}
 
-	return credsFuncs, nil
+	return credsFuncs, podCredsFuncs, nil
 }
 
 func newCRIConn(criAddr string) (*grpc.ClientConn, error) {
@@ -42,8 +42,13 @@ import (
 
 const dockerconfigSelector = "type=" + string(corev1.SecretTypeDockerConfigJson)
 
+// NamespaceScopePod restricts the secrets used for an image to the namespace of the
+// pod pulling it (see NewKubeconfigPodKeychain).
+const NamespaceScopePod = "pod"
+
 type options struct {
 	kubeconfigPath string
+	namespaceScope string
 }
 
 type Option func(*options)
@@ -54,6 +59,17 @@ func WithKubeconfigPath(path string) Option {
 	}
 }
 
+// WithNamespaceScope restricts the secrets used by the keychain. With
+// NamespaceScopePod the keychain returned by NewKubeconfigKeychain uses no secret, as
+// the pod pulling the image is unknown; NewKubeconfigPodKeychain must be used instead.
+// Other non-empty values only sync the secrets of that namespace. Empty uses the
+// secrets of all namespaces.
+func WithNamespaceScope(scope string) Option {
+	return func(opts *options) {
+		opts.namespaceScope = scope
+	}
+}
+
 // NewKubeconfigKeychain provides a keychain which can sync its contents with
 // kubernetes API server by fetching all `kubernetes.io/dockerconfigjson`
 // secrets in the cluster with provided kubeconfig. It's OK that config provides
@@ -70,13 +86,35 @@ func NewKubeconfigKeychain(ctx context.Context, opts ...Option) resolver.Credent
 	for _, o := range opts {
 		o(&kcOpts)
 	}
-	kc := newKeychain(ctx, kcOpts.kubeconfigPath)
+	kc := newKeychain(ctx, kcOpts)
 	return kc.credentials
 }
 
-func newKeychain(ctx context.Context, kubeconfigPath string) *keychain {
+// NewKubeconfigPodKeychain is the same as NewKubeconfigKeychain but returns the
+// keychains of the images pulled by the pods of a namespace, which use only the
+// secrets in that namespace. The secrets of all namespaces are synced unless
+// WithNamespaceScope specifies one.
+func NewKubeconfigPodKeychain(ctx context.Context, opts ...Option) resolver.PodCredential {
+	var kcOpts options
+	for _, o := range opts {
+		o(&kcOpts)
+	}
+	kc := newKeychain(ctx, kcOpts)
+	return func(namespace string) resolver.Credential {
+		return func(host string, refspec reference.Spec) (string, string, error) {
+			if namespace == "" {
+				return "", "", nil // the pod is unknown
+			}
+			return kc.credentialsIn(namespace, host)
+		}
+	}
+}
+
+func newKeychain(ctx context.Context, kcOpts options) *keychain {
+	kubeconfigPath := kcOpts.kubeconfigPath
 	kc := &keychain{
-		config: make(map[string]*dcfile.ConfigFile),
+		config:         make(map[string]*dcfile.ConfigFile),
+		namespaceScope: kcOpts.namespaceScope,
 	}
 	ctx = log.WithLogger(ctx, log.G(ctx).WithField("kubeconfig", kubeconfigPath))
 	go func() {
@@ -129,6 +167,9 @@ type keychain struct {
 	config   map[string]*dcfile.ConfigFile
 	configMu sync.Mutex
 
+	// namespaceScope is set by WithNamespaceScope
+	namespaceScope string
+
 	// the following entries are used for syncing secrets with API server.
 	// these fields are lazily filled after kubeconfig file is provided.
 	queue    *workqueue.Typed[string]
@@ -136,13 +177,27 @@ type keychain struct {
 }
 
 func (kc *keychain) credentials(host string, refspec reference.Spec) (string, string, error) {
+	if kc.namespaceScope == NamespaceScopePod {
+		return "", "", nil // the pod is unknown
+	}
+	return kc.credentialsIn(kc.namespaceScope, host)
+}
+
+// credentialsIn returns the credentials of host in the secrets of namespace, or of
+// all namespaces if it's empty
+func (kc *keychain) credentialsIn(namespace, host string) (string, string, error) {
 	if host == "docker.io" || host == "registry-1.docker.io" {
 		// Creds of "docker.io" is stored keyed by "https://index.docker.io/v1/".
 		host = "https://index.docker.io/v1/"
 	}
 	kc.configMu.Lock()
 	defer kc.configMu.Unlock()
-	for _, cfg := range kc.config {
+	for key, cfg := range kc.config {
+		if namespace != "" {
+			if ns, _, err := cache.SplitMetaNamespaceKey(key); err != nil || ns != namespace {
+				continue
+			}
+		}
 		if acfg, err := cfg.GetAuthConfig(host); err == nil {
 			if acfg.IdentityToken != "" {
 				return "", acfg.IdentityToken, nil
@@ -160,17 +215,22 @@ func (kc *keychain) startSyncSecrets(ctx context.Context, client kubernetes.Inte
 	defer utilruntime.HandleCrash()
 
 	// get informed on `kubernetes.io/dockerconfigjson` secrets in all namespaces
+	// unless the keychain is restricted to a namespace
+	namespace := metav1.NamespaceAll
+	if kc.namespaceScope != NamespaceScopePod {
+		namespace = kc.namespaceScope
+	}
 	informer := cache.NewSharedIndexInformer(
 		&cache.ListWatch{
 			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
 				// TODO: support legacy image secret `kubernetes.io/dockercfg`
 				options.FieldSelector = dockerconfigSelector
-				return client.CoreV1().Secrets(metav1.NamespaceAll).List(ctx, options)
+				return client.CoreV1().Secrets(namespace).List(ctx, options)
 			},
 			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
 				// TODO: support legacy image secret `kubernetes.io/dockercfg`
 				options.FieldSelector = dockerconfigSelector
-				return client.CoreV1().Secrets(metav1.NamespaceAll).Watch(ctx, options)
+				return client.CoreV1().Secrets(namespace).Watch(ctx, options)
 			},
 		},
 		&corev1.Secret{},
@@ -0,0 +1,120 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package kubeconfig
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/containerd/containerd/v2/pkg/reference"
+	dcfile "github.com/docker/cli/cli/config/configfile"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestNamespaceScope(t *testing.T) {
+	const host = "registry.example.com"
+	var secrets []corev1.Secret
+	for _, ns := range []string{"tenant-a", "tenant-b"} {
+		auth := base64.StdEncoding.EncodeToString([]byte(ns + ":secret-" + ns))
+		secrets = append(secrets, corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "pull-secret", Namespace: ns},
+			Type:       corev1.SecretTypeDockerConfigJson,
+			Data: map[string][]byte{
+				corev1.DockerConfigJsonKey: []byte(fmt.Sprintf(`{"auths":{%q:{"auth":%q}}}`, host, auth)),
+			},
+		})
+	}
+	ref, err := reference.Parse(host + "/app:latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		scope      string
+		wantSynced int
+		// want is the user of the credentials used for the pods in each namespace
+		// ("" for an unknown pod)
+		want map[string]string
+	}{
+		{
+			name:       "namespace",
+			scope:      "tenant-a",
+			wantSynced: 1,
+			want:       map[string]string{"": "tenant-a", "tenant-a": "tenant-a", "tenant-b": ""},
+		},
+		{
+			name:       "pod",
+			scope:      NamespaceScopePod,
+			wantSynced: 2,
+			want:       map[string]string{"": "", "tenant-a": "tenant-a", "tenant-b": "tenant-b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			client := fake.NewClientset(&secrets[0], &secrets[1])
+			kc := &keychain{
+				config:         make(map[string]*dcfile.ConfigFile),
+				namespaceScope: tt.scope,
+			}
+			go kc.startSyncSecrets(ctx, client)
+			waitForSync(t, kc, tt.wantSynced)
+			for ns, want := range tt.want {
+				var user string
+				var err error
+				if ns == "" {
+					user, _, err = kc.credentials(host, ref)
+				} else {
+					user, _, err = kc.credentialsIn(ns, host)
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if user != want {
+					t.Errorf("pod in %q: got credentials of %q; want %q", ns, user, want)
+				}
+			}
+		})
+	}
+}
+
+// waitForSync waits until kc has synced n secrets and checks it doesn't sync more
+func waitForSync(t *testing.T, kc *keychain, n int) {
+	synced := func() int {
+		kc.configMu.Lock()
+		defer kc.configMu.Unlock()
+		return len(kc.config)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for synced() < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("synced %d secrets; want %d", synced(), n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if got := synced(); got != n {
+		t.Fatalf("synced %d secrets; want %d", got, n)
+	}
+}
@@ -0,0 +1,70 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/containerd/log"
+)
+
+// LogLevelPath is the HTTP path for changing the log level at runtime.
+const LogLevelPath = "/log/level"
+
+type logLevelRequest struct {
+	Level string `json:"level"`
+}
+
+func validateLogLevel(level string) error {
+	switch level {
+	case "", "debug", "info", "warn", "error":
+		return nil
+	default:
+		return fmt.Errorf("invalid log_level %q: must be one of debug, info, warn, error", level)
+	}
+}
+
+// logLevelHandler changes the level of the default logger to the one given
+// by a PUT request with a JSON body like {"level": "debug"}.
+func logLevelHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		w.Header().Set("Allow", http.MethodPut)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req logLevelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if req.Level == "" {
+		http.Error(w, "level must be specified", http.StatusBadRequest)
+		return
+	}
+	if err := validateLogLevel(req.Level); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := log.SetLevel(req.Level); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.L.Infof("log level is changed to %q", req.Level)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,99 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/containerd/containerd/v2/core/remotes/docker"
+	"github.com/containerd/containerd/v2/pkg/reference"
+	"github.com/containerd/log"
+	"github.com/containerd/stargz-snapshotter/fs/source"
+)
+
+// CacheConfig is config for the in-memory manifest cache.
+type CacheConfig struct {
+	// MaxEntries is the maximum number of manifests kept in memory (default: 256).
+	MaxEntries int `toml:"max_entries" json:"max_entries"`
+
+	// TTL is the duration a cached manifest is served without asking the registry.
+	// Zero means that cached manifests are always revalidated using their ETag.
+	TTL time.Duration `toml:"ttl" json:"ttl"`
+
+	// WarmPaths lists references of images (e.g. "ghcr.io/org/app:latest") whose
+	// manifests are resolved at startup. Glob patterns aren't supported because
+	// registries can't be listed.
+	WarmPaths []string `toml:"warm_paths" json:"warm_paths"`
+}
+
+func (c CacheConfig) validate() error {
+	if c.MaxEntries < 0 {
+		return fmt.Errorf("invalid cache max_entries %d", c.MaxEntries)
+	}
+	if c.TTL < 0 {
+		return fmt.Errorf("invalid cache ttl %v", c.TTL)
+	}
+	for _, ref := range c.WarmPaths {
+		if strings.ContainsAny(ref, "*?[") {
+			return fmt.Errorf("invalid cache warm_paths entry %q: glob patterns aren't supported", ref)
+		}
+		if _, err := reference.Parse(ref); err != nil {
+			return fmt.Errorf("invalid cache warm_paths entry %q: %w", ref, err)
+		}
+	}
+	return nil
+}
+
+// warmManifestCache resolves the manifests of refs so that they are cached.
+func warmManifestCache(ctx context.Context, hosts source.RegistryHosts, refs []string) {
+	for _, ref := range refs {
+		if err := fetchManifest(ctx, hosts, ref); err != nil {
+			log.G(ctx).WithError(err).Warnf("failed to warm manifest cache for %q", ref)
+		}
+	}
+}
+
+func fetchManifest(ctx context.Context, hosts source.RegistryHosts, ref string) error {
+	refspec, err := reference.Parse(ref)
+	if err != nil {
+		return err
+	}
+	r := docker.NewResolver(docker.ResolverOptions{
+		Hosts: func(string) ([]docker.RegistryHost, error) {
+			return hosts(refspec)
+		},
+	})
+	name, desc, err := r.Resolve(ctx, refspec.String())
+	if err != nil {
+		return fmt.Errorf("failed to resolve: %w", err)
+	}
+	f, err := r.Fetcher(ctx, name)
+	if err != nil {
+		return err
+	}
+	rc, err := f.Fetch(ctx, desc)
+	if err != nil {
+		return fmt.Errorf("failed to fetch manifest: %w", err)
+	}
+	defer rc.Close()
+	_, err = io.Copy(io.Discard, rc)
+	return err
+}
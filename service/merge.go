@@ -0,0 +1,100 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package service
+
+import (
+	"reflect"
+)
+
+// Merge returns c overridden by other, for layering environment-specific configs on
+// top of a base config. c and other aren't modified.
+//
+//   - Zero values (e.g. "", 0, false, nil) in other are treated as not set and don't
+//     override c. So a boolean can be enabled but not disabled by other.
+//   - Slices (e.g. the mirrors of a host) are appended to the ones of c.
+//   - Maps (e.g. the resolver hosts, storage_backend_config) are merged key by key.
+//     The values of the keys in both maps are merged recursively.
+func (c Config) Merge(other Config) Config {
+	var merged Config
+	dst := reflect.ValueOf(&merged).Elem()
+	mergeValue(dst, reflect.ValueOf(c))
+	mergeValue(dst, reflect.ValueOf(other))
+	return merged
+}
+
+// mergeValue merges src into dst. The merged slices, maps and pointers are copied
+// so dst never shares them with src.
+func mergeValue(dst, src reflect.Value) {
+	switch src.Kind() {
+	case reflect.Struct:
+		for i := 0; i < src.NumField(); i++ {
+			if src.Type().Field(i).IsExported() {
+				mergeValue(dst.Field(i), src.Field(i))
+			}
+		}
+	case reflect.Slice:
+		if src.Len() == 0 {
+			return
+		}
+		s := reflect.MakeSlice(src.Type(), 0, dst.Len()+src.Len())
+		s = reflect.AppendSlice(s, dst)
+		for i := 0; i < src.Len(); i++ {
+			v := reflect.New(src.Type().Elem()).Elem()
+			mergeValue(v, src.Index(i))
+			s = reflect.Append(s, v)
+		}
+		dst.Set(s)
+	case reflect.Map:
+		if src.Len() == 0 {
+			return
+		}
+		if dst.IsNil() {
+			dst.Set(reflect.MakeMapWithSize(src.Type(), src.Len()))
+		}
+		iter := src.MapRange()
+		for iter.Next() {
+			// Map elements aren't addressable so merge into a copy
+			v := reflect.New(src.Type().Elem()).Elem()
+			if cur := dst.MapIndex(iter.Key()); cur.IsValid() {
+				v.Set(cur)
+			}
+			mergeValue(v, iter.Value())
+			dst.SetMapIndex(iter.Key(), v)
+		}
+	case reflect.Pointer:
+		if src.IsNil() {
+			return
+		}
+		p := reflect.New(src.Type().Elem())
+		if k := src.Elem().Kind(); k != reflect.Struct && k != reflect.Slice && k != reflect.Map {
+			// A set pointer overrides dst even if it points to the zero value, e.g. a *bool
+			// set to false
+			p.Elem().Set(src.Elem())
+			dst.Set(p)
+			return
+		}
+		if !dst.IsNil() {
+			p.Elem().Set(dst.Elem())
+		}
+		mergeValue(p.Elem(), src.Elem())
+		dst.Set(p)
+	default:
+		if !src.IsZero() {
+			dst.Set(src)
+		}
+	}
+}
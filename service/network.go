@@ -0,0 +1,102 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package service
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
+)
+
+// NetworkConfig is config for the snapshotter's gRPC listener.
+type NetworkConfig struct {
+	// SocketPath is the path to the unix socket of the gRPC server.
+	// The "-address" flag takes precedence when specified.
+	SocketPath string `toml:"socket_path" json:"socket_path"`
+
+	// TLSCertFile and TLSKeyFile enable TLS on the gRPC server when both are set.
+	TLSCertFile string `toml:"tls_cert_file" json:"tls_cert_file"`
+	TLSKeyFile  string `toml:"tls_key_file" json:"tls_key_file"`
+
+	// TLSCAFile enables mutual TLS. Clients must present a certificate signed by this CA.
+	TLSCAFile string `toml:"tls_ca_file" json:"tls_ca_file"`
+
+	// MaxConnAge is the maximum age of a connection before the server closes it. Zero means no limit.
+	MaxConnAge time.Duration `toml:"max_conn_age" json:"max_conn_age"`
+}
+
+func (c NetworkConfig) validate() error {
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		return fmt.Errorf("tls_cert_file and tls_key_file must be specified together")
+	}
+	if c.TLSCAFile != "" && c.TLSCertFile == "" {
+		return fmt.Errorf("tls_ca_file requires tls_cert_file and tls_key_file")
+	}
+	if c.MaxConnAge < 0 {
+		return fmt.Errorf("invalid max_conn_age %v", c.MaxConnAge)
+	}
+	return nil
+}
+
+// GRPCServerOptions returns the options of the gRPC server configured by NetworkConfig.
+func (c NetworkConfig) GRPCServerOptions() ([]grpc.ServerOption, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	var opts []grpc.ServerOption
+	if c.TLSCertFile != "" {
+		tlsConfig, err := c.serverTLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	if c.MaxConnAge > 0 {
+		opts = append(opts, grpc.KeepaliveParams(keepalive.ServerParameters{MaxConnectionAge: c.MaxConnAge}))
+	}
+	return opts, nil
+}
+
+func (c NetworkConfig) serverTLSConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(c.TLSCertFile, c.TLSKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS key pair: %w", err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if c.TLSCAFile != "" {
+		ca, err := os.ReadFile(c.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read TLS CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate found in %q", c.TLSCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig, nil
+}
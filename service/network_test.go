@@ -0,0 +1,153 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package service
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestGRPCMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey := newTestCert(t, nil, nil, true)
+	serverCert, serverKey := newTestCert(t, ca, caKey, false)
+	clientCert, clientKey := newTestCert(t, ca, caKey, false)
+	cfg := NetworkConfig{
+		TLSCertFile: writePEM(t, dir, "server.crt", "CERTIFICATE", serverCert.Raw),
+		TLSKeyFile:  writeKey(t, dir, "server.key", serverKey),
+		TLSCAFile:   writePEM(t, dir, "ca.crt", "CERTIFICATE", ca.Raw),
+	}
+
+	opts, err := cfg.GRPCServerOptions()
+	if err != nil {
+		t.Fatalf("failed to get server options: %v", err)
+	}
+	srv := grpc.NewServer(opts...)
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(l)
+	defer srv.Stop()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	check := func(clientCerts []tls.Certificate) error {
+		conn, err := grpc.NewClient(l.Addr().String(), grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
+			RootCAs:      roots,
+			Certificates: clientCerts,
+			ServerName:   "localhost",
+		})))
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, err = healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+		return err
+	}
+
+	if err := check(nil); err == nil {
+		t.Errorf("client without certificate must be rejected")
+	}
+	if err := check([]tls.Certificate{{Certificate: [][]byte{clientCert.Raw}, PrivateKey: clientKey}}); err != nil {
+		t.Errorf("client with certificate signed by the CA must be accepted: %v", err)
+	}
+}
+
+func TestValidateNetworkConfig(t *testing.T) {
+	for _, cfg := range []NetworkConfig{
+		{TLSCertFile: "cert"},
+		{TLSKeyFile: "key"},
+		{TLSCAFile: "ca"},
+		{MaxConnAge: -time.Second},
+	} {
+		c := Config{NetworkConfig: cfg}
+		if err := c.Validate(); err == nil {
+			t.Errorf("expected validation error for %+v", cfg)
+		}
+	}
+}
+
+func newTestCert(t *testing.T, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, isCA bool) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if isCA {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func writeKey(t *testing.T, dir, name string, key *ecdsa.PrivateKey) string {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writePEM(t, dir, name, "EC PRIVATE KEY", der)
+}
+
+func writePEM(t *testing.T, dir, name, typ string, der []byte) string {
+	p := filepath.Join(dir, name)
+	if err := os.WriteFile(p, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
@@ -22,6 +22,7 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"slices"
 	"time"
 
 	"github.com/containerd/containerd/v2/defaults"
@@ -31,6 +32,7 @@ import (
 	"github.com/containerd/platforms"
 	"github.com/containerd/plugin"
 	"github.com/containerd/plugin/registry"
+	"github.com/containerd/stargz-snapshotter/fs/source"
 	"github.com/containerd/stargz-snapshotter/service"
 	"github.com/containerd/stargz-snapshotter/service/keychain/cri"
 	"github.com/containerd/stargz-snapshotter/service/keychain/dockerconfig"
@@ -78,12 +80,21 @@ func RegisterPlugin() {
 
 			// Configure keychain
 			credsFuncs := []resolver.Credential{dockerconfig.NewDockerconfigKeychain(ctx)}
+			var podCreds resolver.PodCredential
 			if config.KubeconfigKeychainConfig.EnableKeychain {
 				var opts []kubeconfig.Option
 				if kcp := config.KubeconfigPath; kcp != "" {
 					opts = append(opts, kubeconfig.WithKubeconfigPath(kcp))
 				}
-				credsFuncs = append(credsFuncs, kubeconfig.NewKubeconfigKeychain(ctx, opts...))
+				switch scope := config.NamespaceScope; scope {
+				case kubeconfig.NamespaceScopePod:
+					podCreds = kubeconfig.NewKubeconfigPodKeychain(ctx, opts...)
+				case "":
+					credsFuncs = append(credsFuncs, kubeconfig.NewKubeconfigKeychain(ctx, opts...))
+				default:
+					opts = append(opts, kubeconfig.WithNamespaceScope(scope))
+					credsFuncs = append(credsFuncs, kubeconfig.NewKubeconfigKeychain(ctx, opts...))
+				}
 			}
 			if addr := config.CRIKeychainImageServicePath; config.CRIKeychainConfig.EnableKeychain && addr != "" {
 				// connects to the backend CRI service (defaults to containerd socket)
@@ -128,8 +139,15 @@ func RegisterPlugin() {
 
 			// TODO(ktock): print warn if old configuration is specified.
 			// TODO(ktock): should we respect old configuration?
-			return service.NewStargzSnapshotterService(ctx, root, &config.Config,
-				service.WithCustomRegistryHosts(resolver.RegistryHostsFromCRIConfig(ctx, config.Registry, credsFuncs...)))
+			sOpts := []service.Option{
+				service.WithCustomRegistryHosts(resolver.RegistryHostsFromCRIConfig(ctx, config.Registry, credsFuncs...)),
+			}
+			if podCreds != nil {
+				sOpts = append(sOpts, service.WithCustomPodRegistryHosts(func(namespace string) source.RegistryHosts {
+					return resolver.RegistryHostsFromCRIConfig(ctx, config.Registry, append(slices.Clone(credsFuncs), podCreds(namespace))...)
+				}))
+			}
+			return service.NewStargzSnapshotterService(ctx, root, &config.Config, sOpts...)
 		},
 	})
 }
@@ -0,0 +1,77 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package service
+
+import (
+	"sync"
+
+	"github.com/containerd/containerd/v2/pkg/reference"
+	"github.com/containerd/stargz-snapshotter/fs/source"
+	"github.com/containerd/stargz-snapshotter/service/keychain/cri"
+)
+
+// podNamespaceLabel is a label of the remote snapshots recording the namespace of
+// the pod that pulled the layer through the CRI keychain. The layer is always
+// fetched with the credentials of that namespace, even if the pods of other
+// namespaces use it later.
+const podNamespaceLabel = "containerd.io/snapshot/remote/stargz.pod-namespace"
+
+// podNamespaceLabels returns the podNamespaceLabel of the remote snapshot prepared
+// with labels, if the pull of its image by a pod is in progress.
+func podNamespaceLabels(labels map[string]string) map[string]string {
+	refStr, ok := labels[targetRefLabel]
+	if !ok {
+		return nil
+	}
+	refspec, err := reference.Parse(refStr)
+	if err != nil {
+		return nil
+	}
+	ns, ok := cri.PodNamespace(refspec)
+	if !ok {
+		return nil
+	}
+	return map[string]string{podNamespaceLabel: ns}
+}
+
+// podNamespaceSources makes the sources returned by getSources use the registry
+// hosts of the namespace recorded in podNamespaceLabel, if any.
+func podNamespaceSources(getSources source.GetSources, podHosts func(namespace string) source.RegistryHosts) source.GetSources {
+	var mu sync.Mutex
+	hosts := make(map[string]source.RegistryHosts)
+	return func(labels map[string]string) ([]source.Source, error) {
+		src, err := getSources(labels)
+		if err != nil {
+			return nil, err
+		}
+		ns, ok := labels[podNamespaceLabel]
+		if !ok || ns == "" {
+			return src, nil
+		}
+		mu.Lock()
+		h, ok := hosts[ns]
+		if !ok {
+			h = podHosts(ns)
+			hosts[ns] = h
+		}
+		mu.Unlock()
+		for i := range src {
+			src[i].Hosts = h
+		}
+		return src, nil
+	}
+}
@@ -0,0 +1,67 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package service
+
+import (
+	"testing"
+
+	"github.com/containerd/containerd/v2/core/remotes/docker"
+	"github.com/containerd/containerd/v2/pkg/reference"
+	"github.com/containerd/stargz-snapshotter/fs/source"
+)
+
+func TestPodNamespaceSources(t *testing.T) {
+	hostsOf := func(name string) source.RegistryHosts {
+		return func(reference.Spec) ([]docker.RegistryHost, error) {
+			return []docker.RegistryHost{{Host: name}}, nil
+		}
+	}
+	getSources := func(labels map[string]string) ([]source.Source, error) {
+		return []source.Source{{Hosts: hostsOf("default")}}, nil
+	}
+	built := make(map[string]int)
+	podHosts := func(namespace string) source.RegistryHosts {
+		built[namespace]++
+		return hostsOf(namespace)
+	}
+	f := podNamespaceSources(getSources, podHosts)
+
+	for _, tt := range []struct {
+		labels map[string]string
+		want   string
+	}{
+		{labels: map[string]string{}, want: "default"},
+		{labels: map[string]string{podNamespaceLabel: "ns1"}, want: "ns1"},
+		{labels: map[string]string{podNamespaceLabel: "ns2"}, want: "ns2"},
+		{labels: map[string]string{podNamespaceLabel: "ns1"}, want: "ns1"},
+	} {
+		src, err := f(tt.labels)
+		if err != nil {
+			t.Fatalf("failed to get sources of %v: %v", tt.labels, err)
+		}
+		hosts, err := src[0].Hosts(reference.Spec{})
+		if err != nil {
+			t.Fatalf("failed to get hosts of %v: %v", tt.labels, err)
+		}
+		if got := hosts[0].Host; got != tt.want {
+			t.Errorf("hosts of %v = %q; want %q", tt.labels, got, tt.want)
+		}
+	}
+	if built["ns1"] != 1 || built["ns2"] != 1 {
+		t.Errorf("hosts of each namespace must be built once; got %v", built)
+	}
+}
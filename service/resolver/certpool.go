@@ -0,0 +1,105 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package resolver
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// caCertPool is the system certificate pool extended with the CA certificates in a
+// PEM file. The file is read again on each new connection so that replacing it takes
+// effect without restarting the snapshotter.
+type caCertPool struct {
+	path string
+
+	mu   sync.Mutex
+	pem  []byte
+	pool *x509.CertPool
+}
+
+func newCACertPool(path string) *caCertPool {
+	return &caCertPool{path: path}
+}
+
+// get returns the certificate pool for the current contents of the file.
+func (c *caCertPool) get() (*x509.CertPool, error) {
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pool != nil && bytes.Equal(data, c.pem) {
+		return c.pool, nil
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no CA certificate found in %q", c.path)
+	}
+	c.pem, c.pool = data, pool
+	return pool, nil
+}
+
+// tlsConfig returns the TLS config of http.Transport verifying the servers against
+// the current pool. It's used for the connections through proxies too, unlike a
+// DialTLSContext function. The default verification is skipped as its roots are
+// fixed in the config; VerifyConnection does the same with the current pool.
+func (c *caCertPool) tlsConfig(base *tls.Config) *tls.Config {
+	var cfg *tls.Config
+	if base != nil {
+		cfg = base.Clone()
+	} else {
+		cfg = &tls.Config{}
+	}
+	cfg.InsecureSkipVerify = true
+	cfg.VerifyConnection = c.verifyConnection
+	return cfg
+}
+
+// verifyConnection verifies the certificate chain of the server of cs against the
+// current pool
+func (c *caCertPool) verifyConnection(cs tls.ConnectionState) error {
+	roots, err := c.get()
+	if err != nil {
+		return err
+	}
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("no certificate presented by the server")
+	}
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		DNSName:       cs.ServerName,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	if _, err := cs.PeerCertificates[0].Verify(opts); err != nil {
+		// The same error as the default verification, which isn't retried
+		return &tls.CertificateVerificationError{UnverifiedCertificates: cs.PeerCertificates, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package resolver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/containerd/containerd/v2/pkg/reference"
+)
+
+func TestCustomCACert(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0) // rejected handshakes are expected
+	srv.StartTLS()
+	defer srv.Close()
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := reference.Parse(u.Host + "/test:latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPath := filepath.Join(t.TempDir(), "ca.pem")
+	writeCert := func(der []byte) {
+		if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hosts, err := RegistryHostsFromConfig(Config{CustomCACertPath: certPath})(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func() error {
+		resp, err := hosts[0].Client.Get(srv.URL + "/v2/")
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+
+	// The server isn't trusted with an unrelated CA
+	writeCert(selfSignedCert(t))
+	if err := get(); err == nil {
+		t.Fatal("connection succeeded without the server certificate")
+	}
+
+	// Replacing the file is picked up by the next connection
+	writeCert(srv.Certificate().Raw)
+	if err := get(); err != nil {
+		t.Fatalf("connection failed with the server certificate: %v", err)
+	}
+}
+
+func TestCustomCACertThroughProxy(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	// The proxy tunnels the CONNECT requests to srv whatever their host
+	var tunneled atomic.Int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			http.Error(w, "unexpected method "+r.Method, http.StatusMethodNotAllowed)
+			return
+		}
+		tunneled.Add(1)
+		upstream, err := net.Dial("tcp", srv.Listener.Addr().String())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer upstream.Close()
+		w.WriteHeader(http.StatusOK)
+		conn, _, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		go io.Copy(upstream, conn)
+		io.Copy(conn, upstream)
+	}))
+	defer proxy.Close()
+	ref, err := reference.Parse("registry.example.com/test:latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPath := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	hosts, err := RegistryHostsFromConfig(Config{CustomCACertPath: certPath, HTTPProxy: proxy.URL})(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := hosts[0].Client.Get("https://registry.example.com/v2/")
+	if err != nil {
+		t.Fatalf("connection through the proxy failed with the server certificate: %v", err)
+	}
+	resp.Body.Close()
+	if n := tunneled.Load(); n != 1 {
+		t.Errorf("proxy tunneled %d connections; want 1", n)
+	}
+}
+
+func TestCustomCACertReload(t *testing.T) {
+	certPath := filepath.Join(t.TempDir(), "ca.pem")
+	pool := newCACertPool(certPath)
+	if _, err := pool.get(); err == nil {
+		t.Fatal("expected an error for a missing file")
+	}
+	if err := os.WriteFile(certPath, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pool.get(); err == nil {
+		t.Fatal("expected an error for a file without certificates")
+	}
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: selfSignedCert(t)}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	p1, err := pool.get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p2, err := pool.get(); err != nil || p2 != p1 {
+		t.Errorf("pool is rebuilt although the file didn't change")
+	}
+}
+
+func selfSignedCert(t *testing.T) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "unrelated CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
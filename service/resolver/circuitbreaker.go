@@ -0,0 +1,253 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package resolver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ErrCircuitOpen is returned for the requests to a registry while its circuit is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitState is the state of the circuit of a registry. The values are the ones
+// of the circuit_breaker_state metric.
+type CircuitState int
+
+const (
+	// CircuitClosed lets the requests through.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen rejects the requests until the cooldown elapses.
+	CircuitOpen
+	// CircuitHalfOpen lets one request through to probe the registry.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("CircuitState(%d)", int(s))
+}
+
+// CircuitBreaker stops sending requests to a registry for a cooldown after threshold
+// consecutive failures. Then a single request probes the registry and closes the
+// circuit if it succeeds or opens it again otherwise. Each registry has its own circuit.
+type CircuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	state *prometheus.GaugeVec
+	trips *prometheus.CounterVec
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+type circuit struct {
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// NewCircuitBreaker returns a CircuitBreaker opening the circuits after threshold
+// consecutive failures for cooldown. Its metrics are registered to reg unless reg is
+// nil:
+//
+//   - stargz_circuit_breaker_state{registry, state}: the state of the circuit
+//     (0=closed, 1=open, 2=half-open)
+//   - stargz_circuit_breaker_trips_total{registry}: the number of times the circuit opened
+func NewCircuitBreaker(threshold int, cooldown time.Duration, reg prometheus.Registerer) (*CircuitBreaker, error) {
+	if threshold <= 0 {
+		return nil, fmt.Errorf("invalid circuit breaker threshold %d", threshold)
+	}
+	cb := &CircuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+		state: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "stargz",
+			Name:      "circuit_breaker_state",
+			Help:      "The state of the circuit breaker of the registry (0=closed, 1=open, 2=half-open).",
+		}, []string{"registry", "state"}),
+		trips: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "stargz",
+			Name:      "circuit_breaker_trips_total",
+			Help:      "The number of times the circuit breaker of the registry opened.",
+		}, []string{"registry"}),
+		circuits: make(map[string]*circuit),
+	}
+	if reg != nil {
+		if err := reg.Register(cb.state); err != nil {
+			return nil, err
+		}
+		if err := reg.Register(cb.trips); err != nil {
+			reg.Unregister(cb.state)
+			return nil, err
+		}
+	}
+	return cb, nil
+}
+
+var (
+	sharedCircuitBreakersMu sync.Mutex
+	sharedCircuitBreakers   = make(map[[2]int64]*CircuitBreaker)
+)
+
+// sharedCircuitBreaker returns the CircuitBreaker used by all the RegistryHosts with
+// the same threshold and cooldown (e.g. of each pod namespace), so the circuits of a
+// registry are shared. The metrics of the first one are registered to
+// prometheus.DefaultRegisterer.
+func sharedCircuitBreaker(threshold int, cooldown time.Duration) (*CircuitBreaker, error) {
+	if cooldown == 0 {
+		cooldown = defaultCircuitBreakerCooldown
+	}
+	sharedCircuitBreakersMu.Lock()
+	defer sharedCircuitBreakersMu.Unlock()
+	key := [2]int64{int64(threshold), int64(cooldown)}
+	if cb, ok := sharedCircuitBreakers[key]; ok {
+		return cb, nil
+	}
+	var reg prometheus.Registerer
+	if len(sharedCircuitBreakers) == 0 {
+		reg = prometheus.DefaultRegisterer
+	}
+	cb, err := NewCircuitBreaker(threshold, cooldown, reg)
+	if err != nil {
+		return nil, err
+	}
+	sharedCircuitBreakers[key] = cb
+	return cb, nil
+}
+
+// Allow returns ErrCircuitOpen if a request to registry must not be sent. Otherwise the
+// result of the request must be reported with Success or Failure.
+func (cb *CircuitBreaker) Allow(registry string) error {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	c := cb.get(registry)
+	if c.state == CircuitOpen && cb.now().Sub(c.openedAt) >= cb.cooldown {
+		cb.setState(registry, c, CircuitHalfOpen)
+	}
+	switch {
+	case c.state == CircuitOpen, c.state == CircuitHalfOpen && c.probing:
+		return fmt.Errorf("%w for %s", ErrCircuitOpen, registry)
+	case c.state == CircuitHalfOpen:
+		c.probing = true
+	}
+	return nil
+}
+
+// Success reports a successful request to registry, which closes its circuit.
+func (cb *CircuitBreaker) Success(registry string) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	c := cb.get(registry)
+	c.failures = 0
+	c.probing = false
+	cb.setState(registry, c, CircuitClosed)
+}
+
+// Failure reports a failed request to registry. The circuit opens after threshold
+// consecutive failures or if the probe of a half-open circuit fails.
+func (cb *CircuitBreaker) Failure(registry string) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	c := cb.get(registry)
+	c.failures++
+	c.probing = false
+	if c.state == CircuitHalfOpen || (c.state == CircuitClosed && c.failures >= cb.threshold) {
+		c.openedAt = cb.now()
+		cb.setState(registry, c, CircuitOpen)
+		cb.trips.WithLabelValues(registry).Inc()
+	}
+}
+
+// release reports a request to registry whose result tells nothing about the
+// registry. A half-open circuit lets another request probe it.
+func (cb *CircuitBreaker) release(registry string) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.get(registry).probing = false
+}
+
+// State returns the state of the circuit of registry.
+func (cb *CircuitBreaker) State(registry string) CircuitState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.get(registry).state
+}
+
+// Transport returns rt failing fast with ErrCircuitOpen while the circuit of registry
+// is open. Errors and 5xx responses of rt count as failures, unless the context of
+// the request is done (e.g. canceled by the caller).
+func (cb *CircuitBreaker) Transport(registry string, rt http.RoundTripper) http.RoundTripper {
+	return &circuitTransport{rt: rt, cb: cb, registry: registry}
+}
+
+func (cb *CircuitBreaker) get(registry string) *circuit {
+	c, ok := cb.circuits[registry]
+	if !ok {
+		c = &circuit{}
+		cb.circuits[registry] = c
+		cb.state.WithLabelValues(registry, c.state.String()).Set(float64(c.state))
+	}
+	return c
+}
+
+// setState changes the state of c, replacing its circuit_breaker_state series
+func (cb *CircuitBreaker) setState(registry string, c *circuit, s CircuitState) {
+	if c.state == s {
+		return
+	}
+	cb.state.DeleteLabelValues(registry, c.state.String())
+	c.state = s
+	cb.state.WithLabelValues(registry, s.String()).Set(float64(s))
+}
+
+type circuitTransport struct {
+	rt       http.RoundTripper
+	cb       *CircuitBreaker
+	registry string
+}
+
+func (t *circuitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.cb.Allow(t.registry); err != nil {
+		return nil, err
+	}
+	resp, err := t.rt.RoundTrip(req)
+	if req.Context().Err() != nil {
+		t.cb.release(t.registry)
+	} else if err != nil || resp.StatusCode >= http.StatusInternalServerError {
+		t.cb.Failure(t.registry)
+	} else {
+		t.cb.Success(t.registry)
+	}
+	return resp, err
+}
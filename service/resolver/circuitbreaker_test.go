@@ -0,0 +1,202 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package resolver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/containerd/containerd/v2/pkg/reference"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCircuitBreakerMetrics(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	reg := prometheus.NewPedanticRegistry()
+	cb, err := NewCircuitBreaker(3, time.Minute, reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	cb.now = func() time.Time { return now }
+	client := &http.Client{Transport: cb.Transport("registry.example.com", http.DefaultTransport)}
+	get := func() error {
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+	compare := func(state string, trips int) {
+		t.Helper()
+		value := map[string]string{"closed": "0", "open": "1", "half-open": "2"}[state]
+		want := `
+# HELP stargz_circuit_breaker_state The state of the circuit breaker of the registry (0=closed, 1=open, 2=half-open).
+# TYPE stargz_circuit_breaker_state gauge
+stargz_circuit_breaker_state{registry="registry.example.com",state="` + state + `"} ` + value + `
+`
+		if trips > 0 {
+			want += `# HELP stargz_circuit_breaker_trips_total The number of times the circuit breaker of the registry opened.
+# TYPE stargz_circuit_breaker_trips_total counter
+stargz_circuit_breaker_trips_total{registry="registry.example.com"} ` + strconv.Itoa(trips) + `
+`
+		}
+		if err := testutil.CollectAndCompare(reg, strings.NewReader(want)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := get(); err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		if i < 2 {
+			compare("closed", 0)
+		}
+	}
+	compare("open", 1)
+	if err := get(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("got %v while the circuit is open; want %v", err, ErrCircuitOpen)
+	}
+
+	// The failed probe after the cooldown opens the circuit again
+	now = now.Add(time.Minute)
+	if cb.State("registry.example.com") != CircuitOpen {
+		t.Errorf("state = %v before the probe; want %v", cb.State("registry.example.com"), CircuitOpen)
+	}
+	if err := get(); err != nil {
+		t.Fatal(err)
+	}
+	compare("open", 2)
+
+	now = now.Add(time.Minute)
+	if err := cb.Allow("registry.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	compare("half-open", 2)
+	if err := cb.Allow("registry.example.com"); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("got %v during the probe; want %v", err, ErrCircuitOpen)
+	}
+	failing.Store(false)
+	cb.Success("registry.example.com")
+	compare("closed", 2)
+	if err := get(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewCircuitBreaker(3, time.Minute, reg); err == nil {
+		t.Error("registered the metrics twice")
+	}
+}
+
+func TestCircuitBreakerCanceled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	cb, err := NewCircuitBreaker(1, time.Minute, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: cb.Transport("registry.example.com", http.DefaultTransport)}
+	get := func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+	if err := get(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v; want %v", err, context.DeadlineExceeded)
+	}
+	if s := cb.State("registry.example.com"); s != CircuitClosed {
+		t.Errorf("state = %v after a canceled request; want %v", s, CircuitClosed)
+	}
+
+	// A canceled probe lets another request probe the registry
+	cb.Failure("registry.example.com")
+	now := time.Now().Add(time.Minute)
+	cb.now = func() time.Time { return now }
+	if err := get(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v for the probe; want %v", err, context.DeadlineExceeded)
+	}
+	if err := cb.Allow("registry.example.com"); err != nil {
+		t.Errorf("got %v after a canceled probe; want another probe", err)
+	}
+}
+
+func TestRegistryHostsCircuitBreaker(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusNotImplemented) // not retried
+	}))
+	defer srv.Close()
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := reference.Parse(u.Host + "/test:latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Config{CircuitBreakerThreshold: 2, CircuitBreakerCooldown: time.Hour}
+	for i := 0; i < 3; i++ {
+		// The circuits are shared by the RegistryHosts of the same config
+		hosts, err := RegistryHostsFromConfig(cfg)(ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := hosts[0].Client.Get(srv.URL + "/v2/test/blobs/sha256:0")
+		if i < 2 {
+			if err != nil {
+				t.Fatalf("request %d: %v", i, err)
+			}
+			resp.Body.Close()
+		} else if !errors.Is(err, ErrCircuitOpen) {
+			t.Errorf("got %v after %d failures; want %v", err, i, ErrCircuitOpen)
+		}
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("registry got %d requests; want 2", n)
+	}
+}
@@ -0,0 +1,79 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package resolver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+)
+
+// dialer resolves the hostname of the address and dials the resolved addresses one
+// by one until a connection is established.
+type dialer struct {
+	lookup func(ctx context.Context, host string) ([]string, error)
+	dial   func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	// preferIPv6 makes the dialer try the IPv6 addresses before the IPv4 ones.
+	// Otherwise the addresses are tried in the order returned by lookup.
+	preferIPv6 bool
+}
+
+func (d *dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := d.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if d.preferIPv6 {
+		addrs = sortIPv6First(addrs)
+	}
+	var errs []error
+	for _, a := range addrs {
+		conn, err := d.dial(ctx, network, net.JoinHostPort(a, port))
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err)
+	}
+	return nil, errors.Join(errs...)
+}
+
+// sortIPv6First returns a copy of addrs with the IPv6 addresses moved to the
+// front. The order within each family is kept.
+func sortIPv6First(addrs []string) []string {
+	sorted := slices.Clone(addrs)
+	slices.SortStableFunc(sorted, func(a, b string) int {
+		switch a6, b6 := isIPv6(a), isIPv6(b); {
+		case a6 && !b6:
+			return -1
+		case !a6 && b6:
+			return 1
+		}
+		return 0
+	})
+	return sorted
+}
+
+func isIPv6(addr string) bool {
+	ip := net.ParseIP(addr)
+	return ip != nil && ip.To4() == nil
+}
@@ -0,0 +1,103 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package resolver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/containerd/containerd/v2/pkg/reference"
+)
+
+func TestDialerIPv6Preference(t *testing.T) {
+	// Fake DNS response with both A and AAAA records
+	lookup := func(ctx context.Context, host string) ([]string, error) {
+		if host != "registry.test" {
+			return nil, errors.New("unknown host")
+		}
+		return []string{"192.0.2.1", "2001:db8::1", "192.0.2.2", "2001:db8::2"}, nil
+	}
+	for _, tt := range []struct {
+		preferIPv6 bool
+		want       []string
+	}{
+		{
+			preferIPv6: false,
+			want:       []string{"192.0.2.1:443", "[2001:db8::1]:443", "192.0.2.2:443", "[2001:db8::2]:443"},
+		},
+		{
+			preferIPv6: true,
+			want:       []string{"[2001:db8::1]:443", "[2001:db8::2]:443", "192.0.2.1:443", "192.0.2.2:443"},
+		},
+	} {
+		var attempts []string
+		d := &dialer{
+			lookup: lookup,
+			dial: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				attempts = append(attempts, addr)
+				return nil, errors.New("unreachable")
+			},
+			preferIPv6: tt.preferIPv6,
+		}
+		if _, err := d.DialContext(context.Background(), "tcp", "registry.test:443"); err == nil {
+			t.Fatalf("dial must fail")
+		}
+		if !reflect.DeepEqual(attempts, tt.want) {
+			t.Errorf("preferIPv6=%v: attempted %v; want %v", tt.preferIPv6, attempts, tt.want)
+		}
+	}
+}
+
+func TestRegistryHostsIPv6Preference(t *testing.T) {
+	// The IPv4-only registry is still reachable after trying IPv6 first
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, port, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := net.JoinHostPort("localhost", port)
+	ref, err := reference.Parse(host + "/test:latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts, err := RegistryHostsFromConfig(Config{IPv6Preference: true})(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := hosts[0].Client.Get("http://" + host + "/v2/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if body, _ := io.ReadAll(resp.Body); string(body) != "ok" {
+		t.Errorf("body = %q; want %q", body, "ok")
+	}
+}
@@ -0,0 +1,129 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package resolver
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const defaultDNSOverTLSPort = "853"
+
+// dotResolver resolves hostnames by querying a DNS over TLS server. Answers are
+// cached according to their TTL.
+type dotResolver struct {
+	server string
+	client *dns.Client
+	dialer net.Dialer
+
+	mu    sync.Mutex
+	cache map[string]dotCacheEntry
+}
+
+type dotCacheEntry struct {
+	addrs   []string
+	expires time.Time
+}
+
+// newDoTResolver creates a resolver querying server ("host" or "host:port").
+// If tlsConfig is nil, the server certificate is verified with the system roots.
+func newDoTResolver(server string, tlsConfig *tls.Config) (*dotResolver, error) {
+	if server == "" {
+		return nil, fmt.Errorf("DNS over TLS server must be specified")
+	}
+	host, _, err := net.SplitHostPort(server)
+	if err != nil {
+		host = server
+		server = net.JoinHostPort(server, defaultDNSOverTLSPort)
+	}
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+	}
+	return &dotResolver{
+		server: server,
+		client: &dns.Client{Net: "tcp-tls", TLSConfig: tlsConfig},
+		cache:  make(map[string]dotCacheEntry),
+	}, nil
+}
+
+// DialContext dials addr after resolving its hostname with DNS over TLS.
+func (r *dotResolver) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return (&dialer{lookup: r.lookup, dial: r.dialer.DialContext}).DialContext(ctx, network, addr)
+}
+
+func (r *dotResolver) lookup(ctx context.Context, host string) ([]string, error) {
+	if net.ParseIP(host) != nil {
+		return []string{host}, nil
+	}
+	r.mu.Lock()
+	e, ok := r.cache[host]
+	r.mu.Unlock()
+	if ok && time.Now().Before(e.expires) {
+		return e.addrs, nil
+	}
+
+	var (
+		addrs  []string
+		minTTL uint32
+		errs   []error
+	)
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		m := new(dns.Msg)
+		m.SetQuestion(dns.Fqdn(host), qtype)
+		resp, _, err := r.client.ExchangeContext(ctx, m, r.server)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if resp.Rcode != dns.RcodeSuccess {
+			errs = append(errs, fmt.Errorf("DNS query for %q failed: %s", host, dns.RcodeToString[resp.Rcode]))
+			continue
+		}
+		for _, rr := range resp.Answer {
+			var ip net.IP
+			switch a := rr.(type) {
+			case *dns.A:
+				ip = a.A
+			case *dns.AAAA:
+				ip = a.AAAA
+			default:
+				continue
+			}
+			addrs = append(addrs, ip.String())
+			if ttl := rr.Header().Ttl; minTTL == 0 || ttl < minTTL {
+				minTTL = ttl
+			}
+		}
+	}
+	if len(addrs) == 0 {
+		if len(errs) > 0 {
+			return nil, errors.Join(errs...)
+		}
+		return nil, fmt.Errorf("no address found for %q", host)
+	}
+	r.mu.Lock()
+	r.cache[host] = dotCacheEntry{addrs: addrs, expires: time.Now().Add(time.Duration(minTTL) * time.Second)}
+	r.mu.Unlock()
+	return addrs, nil
+}
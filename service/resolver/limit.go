@@ -0,0 +1,88 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package resolver
+
+import (
+	"io"
+	"net/http"
+	"sync"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// hostLimiter keeps the semaphore limiting the concurrent requests to each registry host.
+type hostLimiter struct {
+	max  int64
+	mu   sync.Mutex
+	sems map[string]*semaphore.Weighted
+}
+
+func newHostLimiter(max int) *hostLimiter {
+	return &hostLimiter{max: int64(max), sems: make(map[string]*semaphore.Weighted)}
+}
+
+func (l *hostLimiter) get(host string) *semaphore.Weighted {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	sem, ok := l.sems[host]
+	if !ok {
+		sem = semaphore.NewWeighted(l.max)
+		l.sems[host] = sem
+	}
+	return sem
+}
+
+// limitTransport holds a slot of sem from sending each request until its response
+// body is closed or read to the end.
+type limitTransport struct {
+	rt  http.RoundTripper
+	sem *semaphore.Weighted
+}
+
+func (t *limitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.sem.Acquire(req.Context(), 1); err != nil {
+		return nil, err
+	}
+	resp, err := t.rt.RoundTrip(req)
+	if err != nil {
+		t.sem.Release(1)
+		return nil, err
+	}
+	resp.Body = &releaseBody{ReadCloser: resp.Body, release: func() { t.sem.Release(1) }}
+	return resp, nil
+}
+
+// releaseBody calls release once when the response body is closed or reaches EOF.
+type releaseBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releaseBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.once.Do(b.release)
+	}
+	return n, err
+}
+
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
@@ -0,0 +1,166 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package resolver
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/groupcache/lru"
+	digest "github.com/opencontainers/go-digest"
+)
+
+const (
+	// defaultManifestCacheEntries is the default maximum number of cached manifests.
+	defaultManifestCacheEntries = 256
+
+	// maxETagBodySize is the maximum size of a manifest kept in the cache.
+	maxETagBodySize = 4 * 1024 * 1024
+)
+
+// ManifestCache is an in-memory LRU cache of manifests fetched from registries.
+// Cached manifests are served without contacting the registry until their TTL
+// expires. After that, they are revalidated with "If-None-Match" using their ETag.
+// Manifests are cached separately for each credentials they're fetched with.
+type ManifestCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries *lru.Cache
+}
+
+type etagEntry struct {
+	etag    string
+	header  http.Header
+	body    []byte
+	fetched time.Time
+}
+
+// NewManifestCache creates a cache of up to maxEntries manifests (256 if maxEntries <= 0).
+// ttl is the duration a manifest is served without revalidation. Zero means that
+// manifests are always revalidated.
+func NewManifestCache(maxEntries int, ttl time.Duration) *ManifestCache {
+	if maxEntries <= 0 {
+		maxEntries = defaultManifestCacheEntries
+	}
+	return &ManifestCache{ttl: ttl, entries: lru.New(maxEntries)}
+}
+
+func (c *ManifestCache) get(key string) (*etagEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.entries.Get(key)
+	if !ok {
+		return nil, false
+	}
+	return v.(*etagEntry), true
+}
+
+func (c *ManifestCache) add(key string, e *etagEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries.Add(key, e)
+}
+
+func (c *ManifestCache) fresh(e *etagEntry) bool {
+	return c.ttl > 0 && time.Since(e.fetched) < c.ttl
+}
+
+// etagTransport serves manifests from ManifestCache. It sends "If-None-Match" for
+// stale manifests and serves the cached manifest when the registry responds with
+// "304 Not Modified".
+type etagTransport struct {
+	rt    http.RoundTripper
+	cache *ManifestCache
+}
+
+func (t *etagTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || !strings.Contains(req.URL.Path, "/manifests/") || req.Header.Get("If-None-Match") != "" {
+		return t.rt.RoundTrip(req)
+	}
+	key := cacheKey(req)
+	cached, ok := t.cache.get(key)
+	if ok && t.cache.fresh(cached) {
+		return cached.response(req), nil
+	}
+	revalidate := ok && cached.etag != ""
+	if revalidate {
+		req = req.Clone(req.Context())
+		req.Header.Set("If-None-Match", cached.etag)
+	}
+	resp, err := t.rt.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if revalidate && resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		t.cache.add(key, &etagEntry{etag: cached.etag, header: cached.header, body: cached.body, fetched: time.Now()})
+		return cached.response(req), nil
+	}
+	etag := resp.Header.Get("ETag")
+	if resp.StatusCode != http.StatusOK || (etag == "" && t.cache.ttl <= 0) {
+		return resp, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxETagBodySize+1))
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if len(body) > maxETagBodySize {
+		// Too large to keep; pass the response through
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return resp, nil
+	}
+	resp.Body.Close()
+	t.cache.add(key, &etagEntry{etag: etag, header: resp.Header.Clone(), body: body, fetched: time.Now()})
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+// cacheKey returns the key of the manifest requested by req. Registries negotiate the
+// manifest type based on the Accept header. The credentials are part of the key, so
+// that manifests fetched with some credentials aren't served to requests without
+// them; only their digest is kept in memory.
+func cacheKey(req *http.Request) string {
+	var creds string
+	if auth := req.Header.Get("Authorization"); auth != "" {
+		creds = digest.FromString(auth).Encoded()
+	}
+	return req.Header.Get("Accept") + " " + creds + " " + req.URL.String()
+}
+
+// response returns a "200 OK" response serving the cached manifest
+func (e *etagEntry) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(e.body)),
+		ContentLength: int64(len(e.body)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,170 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package resolver
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestETagConditionalGet(t *testing.T) {
+	const (
+		manifest = `{"schemaVersion":2}`
+		etag     = `"sha256:dummy"`
+	)
+	var full, notModified int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		full++
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+		io.WriteString(w, manifest)
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &etagTransport{rt: http.DefaultTransport, cache: NewManifestCache(0, 0)}}
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(srv.URL + "/v2/test/manifests/latest")
+		if err != nil {
+			t.Fatalf("failed to get manifest: %v", err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("failed to read manifest: %v", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("request %d: status = %d; want 200", i, resp.StatusCode)
+		}
+		if string(body) != manifest {
+			t.Errorf("request %d: body = %q; want %q", i, string(body), manifest)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "application/vnd.oci.image.manifest.v1+json" {
+			t.Errorf("request %d: unexpected content type %q", i, ct)
+		}
+	}
+	if full != 1 || notModified != 2 {
+		t.Errorf("served %d full and %d not modified responses; want 1 and 2", full, notModified)
+	}
+}
+
+func TestManifestCacheTTL(t *testing.T) {
+	const manifest = `{"schemaVersion":2}`
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		io.WriteString(w, manifest)
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &etagTransport{rt: http.DefaultTransport, cache: NewManifestCache(10, time.Hour)}}
+	get := func(path string) {
+		t.Helper()
+		resp, err := client.Get(srv.URL + path)
+		if err != nil {
+			t.Fatalf("failed to get manifest: %v", err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("failed to read manifest: %v", err)
+		}
+		if string(body) != manifest {
+			t.Errorf("body = %q; want %q", string(body), manifest)
+		}
+	}
+
+	// cache miss populates the cache
+	get("/v2/test/manifests/latest")
+	if requests != 1 {
+		t.Fatalf("%d requests on cache miss; want 1", requests)
+	}
+	// cache hit doesn't reach the registry
+	get("/v2/test/manifests/latest")
+	if requests != 1 {
+		t.Errorf("%d requests after cache hit; want 1", requests)
+	}
+	// blobs aren't cached
+	get("/v2/test/blobs/sha256:dummy")
+	get("/v2/test/blobs/sha256:dummy")
+	if requests != 3 {
+		t.Errorf("%d requests after fetching blobs twice; want 3", requests)
+	}
+}
+
+func TestManifestCacheCredentials(t *testing.T) {
+	const (
+		manifest = `{"schemaVersion":2}`
+		auth     = "Bearer authorized"
+	)
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("Authorization") != auth {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("ETag", `"sha256:private"`)
+		io.WriteString(w, manifest)
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &etagTransport{rt: http.DefaultTransport, cache: NewManifestCache(10, time.Hour)}}
+	get := func(auth string) int {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/v2/private/manifests/latest", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("failed to get manifest: %v", err)
+		}
+		defer resp.Body.Close()
+		if _, err := io.ReadAll(resp.Body); err != nil {
+			t.Fatalf("failed to read manifest: %v", err)
+		}
+		return resp.StatusCode
+	}
+
+	if status := get(auth); status != http.StatusOK {
+		t.Fatalf("status with credentials = %d; want 200", status)
+	}
+	// The manifest cached for the credentials isn't served without them
+	for _, other := range []string{"", "Bearer other"} {
+		if status := get(other); status != http.StatusUnauthorized {
+			t.Errorf("status with credentials %q = %d; want 401", other, status)
+		}
+	}
+	if requests != 3 {
+		t.Errorf("%d requests; want 3", requests)
+	}
+	// The same credentials hit the cache
+	if status := get(auth); status != http.StatusOK || requests != 3 {
+		t.Errorf("status with credentials = %d after %d requests; want 200 after 3", status, requests)
+	}
+}
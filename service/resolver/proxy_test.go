@@ -0,0 +1,94 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package resolver
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/containerd/containerd/v2/pkg/reference"
+)
+
+func TestHTTPProxy(t *testing.T) {
+	var proxied atomic.Int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied.Add(1)
+		if r.URL.Host != "registry.example.com" {
+			http.Error(w, "unexpected host "+r.URL.Host, http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte("proxied"))
+	}))
+	defer proxy.Close()
+	ref, err := reference.Parse("registry.example.com/test:latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hosts, err := RegistryHostsFromConfig(Config{HTTPProxy: proxy.URL})(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := hosts[0].Client.Get("http://registry.example.com/v2/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || string(body) != "proxied" {
+		t.Errorf("got %d %q; want the response of the proxy", resp.StatusCode, body)
+	}
+	if n := proxied.Load(); n != 1 {
+		t.Errorf("proxy received %d requests; want 1", n)
+	}
+}
+
+func TestProxyFuncNoProxy(t *testing.T) {
+	const proxyURL = "http://proxy.example.com:3128"
+	f := proxyFunc(proxyURL, "internal.example.com, .corp.example, 10.0.0.0/8")
+	for _, tc := range []struct {
+		url     string
+		proxied bool
+	}{
+		{"https://registry-1.docker.io/v2/", true},
+		{"https://internal.example.com/v2/", false},
+		{"https://sub.internal.example.com/v2/", false},
+		{"https://registry.corp.example/v2/", false},
+		{"https://corp.example.com/v2/", true},
+		{"http://10.1.2.3:5000/v2/", false},
+		{"http://192.168.1.1:5000/v2/", true},
+		{"http://localhost:5000/v2/", false},
+	} {
+		req, err := http.NewRequest(http.MethodGet, tc.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		u, err := f(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := u != nil && u.String() == proxyURL; got != tc.proxied {
+			t.Errorf("%s: got proxy %v; want proxied %v", tc.url, u, tc.proxied)
+		}
+	}
+}
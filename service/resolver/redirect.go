@@ -0,0 +1,86 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	rhttp "github.com/hashicorp/go-retryablehttp"
+)
+
+// defaultMaxRedirects is used when Config.MaxRedirects is zero.
+const defaultMaxRedirects = 10
+
+// RedirectError is returned for a redirect response from a registry when
+// Config.FollowRedirects is false.
+type RedirectError struct {
+	StatusCode int
+	Location   string
+}
+
+func (e *RedirectError) Error() string {
+	return fmt.Sprintf("registry redirected to %q (status %d) but following redirects is disabled", e.Location, e.StatusCode)
+}
+
+// TooManyRedirectsError is returned when a request to a registry is redirected more
+// than Config.MaxRedirects times. Count is the number of redirects and URL is the
+// location of the redirect that wasn't followed.
+type TooManyRedirectsError struct {
+	Count int
+	URL   string
+}
+
+func (e *TooManyRedirectsError) Error() string {
+	return fmt.Sprintf("stopped after %d redirects to %s: too many redirects", e.Count, e.URL)
+}
+
+// checkRedirect returns the http.Client.CheckRedirect applying FollowRedirects and
+// MaxRedirects of cfg.
+func checkRedirect(cfg Config) func(req *http.Request, via []*http.Request) error {
+	follow := cfg.FollowRedirects == nil || *cfg.FollowRedirects
+	maxRedirects := cfg.MaxRedirects
+	if maxRedirects == 0 {
+		maxRedirects = defaultMaxRedirects
+	}
+	return func(req *http.Request, via []*http.Request) error {
+		if !follow {
+			e := &RedirectError{Location: req.URL.String()}
+			if req.Response != nil {
+				e.StatusCode = req.Response.StatusCode
+				e.Location = req.Response.Header.Get("Location")
+			}
+			return e
+		}
+		if len(via) > maxRedirects {
+			return &TooManyRedirectsError{Count: len(via), URL: req.URL.String()}
+		}
+		return nil
+	}
+}
+
+// retryPolicy is rhttp.DefaultRetryPolicy except that redirect errors aren't retried.
+func retryPolicy(ctx context.Context, resp *http.Response, err error) (bool, error) {
+	var redirectErr *RedirectError
+	var tooManyErr *TooManyRedirectsError
+	if errors.As(err, &redirectErr) || errors.As(err, &tooManyErr) {
+		return false, err
+	}
+	return rhttp.DefaultRetryPolicy(ctx, resp, err)
+}
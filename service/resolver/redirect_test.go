@@ -0,0 +1,121 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package resolver
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/containerd/containerd/v2/pkg/reference"
+)
+
+func TestRedirects(t *testing.T) {
+	// /r/N redirects to /r/N-1 and /r/0 serves the blob
+	var requests atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		n, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/r/"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		if n == 0 {
+			w.Write([]byte("blob"))
+			return
+		}
+		http.Redirect(w, r, "/r/"+strconv.Itoa(n-1), http.StatusTemporaryRedirect)
+	}))
+	defer srv.Close()
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := reference.Parse(u.Host + "/test:latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func(t *testing.T, cfg Config, chain int) error {
+		hosts, err := RegistryHostsFromConfig(cfg)(ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		requests.Store(0)
+		resp, err := hosts[0].Client.Get(srv.URL + "/r/" + strconv.Itoa(chain))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status = %d; want %d", resp.StatusCode, http.StatusOK)
+		}
+		return nil
+	}
+	noFollow := false
+
+	t.Run("default limit", func(t *testing.T) {
+		if err := get(t, Config{}, defaultMaxRedirects); err != nil {
+			t.Errorf("following %d redirects: %v", defaultMaxRedirects, err)
+		}
+		err := get(t, Config{}, defaultMaxRedirects+1)
+		var tooMany *TooManyRedirectsError
+		if !errors.As(err, &tooMany) {
+			t.Fatalf("error = %v; want TooManyRedirectsError", err)
+		}
+		if tooMany.Count != defaultMaxRedirects+1 || !strings.HasSuffix(tooMany.URL, "/r/0") {
+			t.Errorf("error = %+v; want %d redirects to /r/0", tooMany, defaultMaxRedirects+1)
+		}
+	})
+	t.Run("max redirects", func(t *testing.T) {
+		if err := get(t, Config{MaxRedirects: 2}, 2); err != nil {
+			t.Errorf("following 2 redirects: %v", err)
+		}
+		err := get(t, Config{MaxRedirects: 2}, 5)
+		var tooMany *TooManyRedirectsError
+		if !errors.As(err, &tooMany) {
+			t.Fatalf("error = %v; want TooManyRedirectsError", err)
+		}
+		if tooMany.Count != 3 || !strings.HasSuffix(tooMany.URL, "/r/2") {
+			t.Errorf("error = %+v; want 3 redirects to /r/2", tooMany)
+		}
+		// The error isn't retried
+		if n := requests.Load(); n != 3 {
+			t.Errorf("server got %d requests; want 3", n)
+		}
+	})
+	t.Run("no follow", func(t *testing.T) {
+		err := get(t, Config{FollowRedirects: &noFollow}, 3)
+		var redirect *RedirectError
+		if !errors.As(err, &redirect) {
+			t.Fatalf("error = %v; want RedirectError", err)
+		}
+		if redirect.Location != "/r/2" || redirect.StatusCode != http.StatusTemporaryRedirect {
+			t.Errorf("error = %+v; want %d to /r/2", redirect, http.StatusTemporaryRedirect)
+		}
+		if n := requests.Load(); n != 1 {
+			t.Errorf("server got %d requests; want 1", n)
+		}
+		if err := get(t, Config{FollowRedirects: &noFollow}, 0); err != nil {
+			t.Errorf("request without redirect: %v", err)
+		}
+	})
+}
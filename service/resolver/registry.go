@@ -18,7 +18,9 @@ package resolver
 
 import (
 	"fmt"
+	"net"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/containerd/containerd/v2/core/remotes/docker"
@@ -29,9 +31,64 @@ import (
 
 const defaultRequestTimeoutSec = 30
 
+// defaultCircuitBreakerCooldown is used if Config.CircuitBreakerCooldown is zero
+const defaultCircuitBreakerCooldown = 30 * time.Second
+
 // Config is config for resolving registries.
 type Config struct {
 	Host map[string]HostConfig `toml:"host" json:"host"`
+
+	// DNSOverTLS enables resolving registry hostnames with DNS over TLS.
+	DNSOverTLS bool `toml:"dns_over_tls" json:"dns_over_tls"`
+
+	// DNSOverTLSServer is the DNS over TLS server ("host" or "host:port", default port 853).
+	DNSOverTLSServer string `toml:"dns_over_tls_server" json:"dns_over_tls_server"`
+
+	// RequestTimeout limits each HTTP request to the registries, including its retries.
+	// Unlike MirrorConfig.RequestTimeoutSec it also covers reading the response body.
+	// Zero means no limit.
+	RequestTimeout time.Duration `toml:"request_timeout" json:"request_timeout"`
+
+	// IPv6Preference makes the resolver connect to the IPv6 addresses of the registries
+	// before the IPv4 ones when the hostname resolves to both.
+	IPv6Preference bool `toml:"ipv6_preference" json:"ipv6_preference"`
+
+	// CustomCACertPath is a PEM file of CA certificates trusted for the registries in
+	// addition to the system ones, e.g. for self-signed registries. The file is read
+	// again on each new connection so it can be updated without restarting.
+	CustomCACertPath string `toml:"custom_ca_cert_path" json:"custom_ca_cert_path"`
+
+	// MaxConcurrentRequests limits the requests in flight to each registry host, from
+	// sending a request until its response body is read or closed. Zero means no limit.
+	MaxConcurrentRequests int `toml:"max_concurrent_requests" json:"max_concurrent_requests"`
+
+	// HTTPProxy is the URL of the proxy used for the requests to the registries
+	// (e.g. "http://proxy.example.com:3128") instead of the one specified by the
+	// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+	HTTPProxy string `toml:"http_proxy" json:"http_proxy"`
+
+	// NoProxy is a comma-separated list of hostnames, domain suffixes (".example.com"),
+	// IP addresses and CIDRs of the registries connected without HTTPProxy, following
+	// the rules of NO_PROXY. Requests to localhost are never proxied.
+	NoProxy string `toml:"no_proxy" json:"no_proxy"`
+
+	// FollowRedirects makes the requests to the registries follow redirects, e.g. of
+	// blob downloads to a CDN (default: true). If false, a redirect response fails
+	// the request with a RedirectError holding its Location.
+	FollowRedirects *bool `toml:"follow_redirects" json:"follow_redirects"`
+
+	// MaxRedirects is the maximum number of redirects followed by a request (default: 10).
+	// A request redirected more times fails with a TooManyRedirectsError.
+	MaxRedirects int `toml:"max_redirects" json:"max_redirects"`
+
+	// CircuitBreakerThreshold makes the requests to a registry host fail fast with
+	// ErrCircuitOpen for CircuitBreakerCooldown after that many consecutive failed
+	// requests (errors or 5xx responses). Zero disables the circuit breaker.
+	CircuitBreakerThreshold int `toml:"circuit_breaker_threshold" json:"circuit_breaker_threshold"`
+
+	// CircuitBreakerCooldown is how long the circuit of a registry host stays open
+	// before a request probes the host again (default: 30s).
+	CircuitBreakerCooldown time.Duration `toml:"circuit_breaker_cooldown" json:"circuit_breaker_cooldown"`
 }
 
 type HostConfig struct {
@@ -57,15 +114,55 @@ type MirrorConfig struct {
 
 type Credential func(string, reference.Spec) (string, string, error)
 
+// PodCredential returns the Credential of the images pulled by the pods in namespace.
+type PodCredential func(namespace string) Credential
+
 // RegistryHostsFromConfig creates RegistryHosts (a set of registry configuration) from Config.
 func RegistryHostsFromConfig(cfg Config, credsFuncs ...Credential) source.RegistryHosts {
+	return RegistryHostsWithManifestCache(cfg, NewManifestCache(0, 0), credsFuncs...)
+}
+
+// RegistryHostsWithManifestCache is the same as RegistryHostsFromConfig but manifests
+// are cached in the specified cache.
+func RegistryHostsWithManifestCache(cfg Config, manifests *ManifestCache, credsFuncs ...Credential) source.RegistryHosts {
+	var dot *dotResolver
+	var dotErr error
+	if cfg.DNSOverTLS {
+		dot, dotErr = newDoTResolver(cfg.DNSOverTLSServer, nil)
+	}
+	var caCerts *caCertPool
+	if cfg.CustomCACertPath != "" {
+		caCerts = newCACertPool(cfg.CustomCACertPath)
+	}
+	var proxy func(*http.Request) (*url.URL, error)
+	if cfg.HTTPProxy != "" {
+		proxy = proxyFunc(cfg.HTTPProxy, cfg.NoProxy)
+	}
+	var limits *hostLimiter
+	if cfg.MaxConcurrentRequests > 0 {
+		limits = newHostLimiter(cfg.MaxConcurrentRequests)
+	}
+	redirects := checkRedirect(cfg)
+	var breaker *CircuitBreaker
+	var breakerErr error
+	if cfg.CircuitBreakerThreshold > 0 {
+		breaker, breakerErr = sharedCircuitBreaker(cfg.CircuitBreakerThreshold, cfg.CircuitBreakerCooldown)
+	}
 	return func(ref reference.Spec) (hosts []docker.RegistryHost, _ error) {
+		if dotErr != nil {
+			return nil, dotErr
+		}
+		if breakerErr != nil {
+			return nil, breakerErr
+		}
 		host := ref.Hostname()
 		for _, h := range append(cfg.Host[host].Mirrors, MirrorConfig{
 			Host: host,
 		}) {
 			client := rhttp.NewClient()
 			client.Logger = nil // disable logging every request
+			client.HTTPClient.CheckRedirect = redirects
+			client.CheckRetry = retryPolicy
 			if h.RequestTimeoutSec >= 0 {
 				if h.RequestTimeoutSec == 0 {
 					client.HTTPClient.Timeout = defaultRequestTimeoutSec * time.Second
@@ -73,7 +170,37 @@ func RegistryHostsFromConfig(cfg Config, credsFuncs ...Credential) source.Regist
 					client.HTTPClient.Timeout = time.Duration(h.RequestTimeoutSec) * time.Second
 				}
 			} // h.RequestTimeoutSec < 0 means "no timeout"
+			if dot != nil || cfg.IPv6Preference || caCerts != nil || proxy != nil {
+				tr, ok := client.HTTPClient.Transport.(*http.Transport)
+				if !ok {
+					return nil, fmt.Errorf("unexpected transport %T", client.HTTPClient.Transport)
+				}
+				if dot != nil || cfg.IPv6Preference {
+					d := &dialer{lookup: net.DefaultResolver.LookupHost, dial: tr.DialContext, preferIPv6: cfg.IPv6Preference}
+					if dot != nil {
+						d.lookup = dot.lookup
+					}
+					tr.DialContext = d.DialContext
+				}
+				if caCerts != nil {
+					tr.TLSClientConfig = caCerts.tlsConfig(tr.TLSClientConfig)
+				}
+				if proxy != nil {
+					tr.Proxy = proxy
+				}
+			}
+			if limits != nil {
+				client.HTTPClient.Transport = &limitTransport{rt: client.HTTPClient.Transport, sem: limits.get(h.Host)}
+			}
+			client.HTTPClient.Transport = &etagTransport{rt: client.HTTPClient.Transport, cache: manifests}
 			tr := client.StandardClient()
+			if cfg.RequestTimeout > 0 {
+				tr.Transport = &timeoutTransport{rt: tr.Transport, timeout: cfg.RequestTimeout}
+			}
+			if breaker != nil {
+				// Outside of the retries, so a request counts once
+				tr.Transport = breaker.Transport(h.Host, tr.Transport)
+			}
 			var header http.Header
 			var err error
 			if h.Header != nil {
@@ -0,0 +1,66 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package resolver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/containerd/containerd/v2/pkg/reference"
+)
+
+func TestRequestTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(5 * time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := reference.Parse(u.Host + "/test:latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const timeout = 200 * time.Millisecond
+	hosts, err := RegistryHostsFromConfig(Config{RequestTimeout: timeout})(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	resp, err := hosts[0].Client.Get(srv.URL + "/v2/test/manifests/latest")
+	elapsed := time.Since(start)
+	if err == nil {
+		resp.Body.Close()
+		t.Fatal("request succeeded; want timeout")
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error = %v; want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed > timeout+50*time.Millisecond {
+		t.Errorf("request returned after %v; want within %v", elapsed, timeout+50*time.Millisecond)
+	}
+}
@@ -0,0 +1,183 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+//go:generate env UPDATE_SCHEMA_DESCRIPTIONS=1 go test -run TestSchemaDescriptions .
+
+// schemaDraft is the JSON Schema version of the documents returned by Config.JSONSchema
+const schemaDraft = "http://json-schema.org/draft-07/schema#"
+
+// durationPattern matches the durations accepted by time.ParseDuration (e.g. "1h30m")
+const durationPattern = `^[-+]?([0-9]*(\.[0-9]*)?(ns|us|µs|ms|s|m|h))+$|^[-+]?0$`
+
+// jsonSchema is a JSON Schema (draft-07) document or subschema.
+type jsonSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Type                 interface{}            `json:"type,omitempty"`
+	Pattern              string                 `json:"pattern,omitempty"`
+	Minimum              *int                   `json:"minimum,omitempty"`
+	Default              interface{}            `json:"default,omitempty"`
+	Properties           map[string]*jsonSchema `json:"properties,omitempty"`
+	AdditionalProperties interface{}            `json:"additionalProperties,omitempty"`
+	Items                *jsonSchema            `json:"items,omitempty"`
+}
+
+// JSONSchema returns a JSON Schema (draft-07) document describing the configuration,
+// for validating config files with tools like ajv. The descriptions are the doc
+// comments of the fields, generated into schemaDescriptions by `go generate`.
+//
+//   - The property names are the json keys of the fields. They are the same as the
+//     TOML keys except for a few fields (e.g. the resolver's configPath).
+//   - The fields of embedded structs without a json tag are at the level of the
+//     struct embedding them.
+//   - Durations are either strings parsed by time.ParseDuration or nanoseconds.
+//   - Unknown properties are rejected, except in maps.
+func (c *Config) JSONSchema() ([]byte, error) {
+	s, err := schemaOf(reflect.TypeOf(*c), "")
+	if err != nil {
+		return nil, err
+	}
+	s.Schema = schemaDraft
+	s.Title = "stargz snapshotter configuration"
+	s.Description = schemaDescriptions[typeKey(reflect.TypeOf(*c))]
+	return json.MarshalIndent(s, "", "  ")
+}
+
+// schemaOf returns the schema of the values of t. def is the default:"..." tag of the
+// field, if any.
+func schemaOf(t reflect.Type, def string) (*jsonSchema, error) {
+	if t == durationType {
+		return &jsonSchema{Type: []string{"string", "integer"}, Pattern: durationPattern}, nil
+	}
+	s := &jsonSchema{}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return schemaOf(t.Elem(), def)
+	case reflect.Interface:
+		return s, nil
+	case reflect.Bool:
+		s.Type = "boolean"
+	case reflect.String:
+		s.Type = "string"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		s.Type = "integer"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s.Type = "integer"
+		s.Minimum = new(int)
+	case reflect.Float32, reflect.Float64:
+		s.Type = "number"
+	case reflect.Slice, reflect.Array:
+		items, err := schemaOf(t.Elem(), "")
+		if err != nil {
+			return nil, err
+		}
+		s.Type = "array"
+		s.Items = items
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("unsupported map key type %v", t.Key())
+		}
+		values, err := schemaOf(t.Elem(), "")
+		if err != nil {
+			return nil, err
+		}
+		s.Type = "object"
+		s.AdditionalProperties = values
+	case reflect.Struct:
+		s.Type = "object"
+		s.Properties = make(map[string]*jsonSchema)
+		s.AdditionalProperties = false
+		if err := addProperties(s, t); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported type %v", t)
+	}
+	if def != "" {
+		v, err := parseDefault(t, def)
+		if err != nil {
+			return nil, err
+		}
+		s.Default = v
+	}
+	return s, nil
+}
+
+// addProperties adds the fields of the struct t to the properties of s
+func addProperties(s *jsonSchema, t reflect.Type) error {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			if f.Anonymous && f.Type.Kind() == reflect.Struct {
+				if err := addProperties(s, f.Type); err != nil {
+					return err
+				}
+				continue
+			}
+			name = f.Name
+		}
+		prop, err := schemaOf(f.Type, f.Tag.Get("default"))
+		if err != nil {
+			return fmt.Errorf("%s.%s: %w", t, f.Name, err)
+		}
+		prop.Description = schemaDescriptions[typeKey(t)+"."+f.Name]
+		if prop.Description == "" && f.Type.Kind() == reflect.Struct {
+			prop.Description = schemaDescriptions[typeKey(f.Type)]
+		}
+		s.Properties[name] = prop
+	}
+	return nil
+}
+
+// parseDefault parses the default:"..." tag of a field of type t
+func parseDefault(t reflect.Type, def string) (interface{}, error) {
+	switch t.Kind() {
+	case reflect.Bool:
+		return strconv.ParseBool(def)
+	case reflect.String:
+		return def, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.ParseInt(def, 10, t.Bits())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.ParseUint(def, 10, t.Bits())
+	case reflect.Float32, reflect.Float64:
+		return strconv.ParseFloat(def, t.Bits())
+	}
+	return nil, fmt.Errorf("unsupported default %q for type %v", def, t)
+}
+
+// typeKey is the key of the named type t in schemaDescriptions
+func typeKey(t reflect.Type) string {
+	return t.PkgPath() + "." + t.Name()
+}
@@ -0,0 +1,120 @@
+// Code generated by TestSchemaDescriptions; DO NOT EDIT.
+
+package service
+
+// schemaDescriptions are the doc comments of the config types and their fields,
+// keyed by "<package path>.<type>" and "<package path>.<type>.<field>"
+var schemaDescriptions = map[string]string{
+	"github.com/containerd/stargz-snapshotter/fs/config.BlobConfig":                                  "BlobConfig is configuration for the logic to fetching blobs.",
+	"github.com/containerd/stargz-snapshotter/fs/config.BlobConfig.CheckAlways":                      "CheckAlways overwrites ValidInterval to 0 if it's true. Default is false.",
+	"github.com/containerd/stargz-snapshotter/fs/config.BlobConfig.ChunkSize":                        "ChunkSize is the granularity (in bytes) at which background fetch and on-demand reads are fetched from the remote registry. Default is 50000.",
+	"github.com/containerd/stargz-snapshotter/fs/config.BlobConfig.FetchTimeoutSec":                  "FetchTimeoutSec is a timeout duration (in seconds) for fetching chunks from the registry. Default is 300.",
+	"github.com/containerd/stargz-snapshotter/fs/config.BlobConfig.ForceSingleRangeMode":             "ForceSingleRangeMode disables using of multiple ranges in a Range Request and always specifies one larger region that covers them. Default is false.",
+	"github.com/containerd/stargz-snapshotter/fs/config.BlobConfig.MaxRetries":                       "MaxRetries is a max number of reries of a HTTP request. Default is 5.",
+	"github.com/containerd/stargz-snapshotter/fs/config.BlobConfig.MaxWaitMSec":                      "MinWaitMSec is maximum delay (in seconds) for the next retrying after a request failure. Default is 30.",
+	"github.com/containerd/stargz-snapshotter/fs/config.BlobConfig.MinWaitMSec":                      "MinWaitMSec is minimal delay (in seconds) for the next retrying after a request failure. Default is 30.",
+	"github.com/containerd/stargz-snapshotter/fs/config.BlobConfig.PrefetchChunkSize":                "PrefetchChunkSize is the maximum bytes transferred per http GET from remote registry during prefetch. It is recommended to have PrefetchChunkSize > ChunkSize. If PrefetchChunkSize < ChunkSize prefetch bytes will be fetched as a single http GET, else total GET requests for prefetch = ceil(PrefetchSize / PrefetchChunkSize). Default is 0.",
+	"github.com/containerd/stargz-snapshotter/fs/config.BlobConfig.ValidInterval":                    "ValidInterval specifies a duration (in seconds) during which the layer can be reused without checking the connection to the registry. Default is 60.",
+	"github.com/containerd/stargz-snapshotter/fs/config.Config":                                      "Config is configuration for stargz snapshotter filesystem.",
+	"github.com/containerd/stargz-snapshotter/fs/config.Config.AllowNoVerification":                  "AllowNoVerification allows mouting images without verification. Default is false.",
+	"github.com/containerd/stargz-snapshotter/fs/config.Config.BlobConfig":                           "BlobConfig is config for layer blob management.",
+	"github.com/containerd/stargz-snapshotter/fs/config.Config.Debug":                                "Debug enables filesystem debug log.",
+	"github.com/containerd/stargz-snapshotter/fs/config.Config.DirectoryCacheConfig":                 "DirectoryCacheConfig is config for directory-based cache.",
+	"github.com/containerd/stargz-snapshotter/fs/config.Config.DisableVerification":                  "DisableVerification disables verifying layer contents. Default is false.",
+	"github.com/containerd/stargz-snapshotter/fs/config.Config.FSCacheType":                          "Type of cache for uncompressed files contents. \"memory\" stores them on memory. Other values default to cache them on disk.",
+	"github.com/containerd/stargz-snapshotter/fs/config.Config.FuseConfig":                           "FuseConfig is configurations for FUSE fs.",
+	"github.com/containerd/stargz-snapshotter/fs/config.Config.HTTPCacheType":                        "Type of cache for compressed contents fetched from the registry. \"memory\" stores them on memory. Other values default to cache them on disk.",
+	"github.com/containerd/stargz-snapshotter/fs/config.Config.MaxConcurrency":                       "MaxConcurrency is max number of concurrent background tasks for fetching layer contents. Default is 2.",
+	"github.com/containerd/stargz-snapshotter/fs/config.Config.NoBackgroundFetch":                    "NoBackgroundFetch disables the behaviour of fetching the entire layer contents in background. Default is false.",
+	"github.com/containerd/stargz-snapshotter/fs/config.Config.NoPrefetch":                           "NoPrefetch disables prefetching. Default is false.",
+	"github.com/containerd/stargz-snapshotter/fs/config.Config.NoPrometheus":                         "NoPrometheus disables exposing filesystem-related metrics. Default is false.",
+	"github.com/containerd/stargz-snapshotter/fs/config.Config.PrefetchSize":                         "PrefetchSize is the default size (in bytes) to prefetch when mounting a layer. Default is 0. Stargz-snapshotter still uses the value specified by the image using \"containerd.io/snapshot/remote/stargz.prefetch\" or the landmark file.",
+	"github.com/containerd/stargz-snapshotter/fs/config.Config.PrefetchTimeoutSec":                   "PrefetchTimeoutSec is the default timeout (in seconds) when the prefetching takes long. Default is 10s.",
+	"github.com/containerd/stargz-snapshotter/fs/config.Config.ResolveResultEntry":                   "ResolveResultEntry is a deprecated field.",
+	"github.com/containerd/stargz-snapshotter/fs/config.Config.ResolveResultEntryTTLSec":             "ResolveResultEntryTTLSec is TTL (in sec) to cache resolved layers for future use. (default 120s)",
+	"github.com/containerd/stargz-snapshotter/fs/config.DirectoryCacheConfig":                        "DirectoryCacheConfig is configuration for the disk-based cache.",
+	"github.com/containerd/stargz-snapshotter/fs/config.DirectoryCacheConfig.Direct":                 "Direct disables on-memory data cache. Default is true for saving memory usage.",
+	"github.com/containerd/stargz-snapshotter/fs/config.DirectoryCacheConfig.MaxCacheFds":            "MaxCacheFds is the number of entries of LRU cache to hold fds of files of cached contents. Default is 10.",
+	"github.com/containerd/stargz-snapshotter/fs/config.DirectoryCacheConfig.MaxLRUCacheEntry":       "MaxLRUCacheEntry is the number of entries of LRU cache to cache data on memory. Default is 10.",
+	"github.com/containerd/stargz-snapshotter/fs/config.DirectoryCacheConfig.SyncAdd":                "SyncAdd being true means that each adding of data to the cache blocks until the data is fully written to the cache directory. Default is false.",
+	"github.com/containerd/stargz-snapshotter/fs/config.FuseConfig":                                  "FuseConfig is configuration for FUSE fs.",
+	"github.com/containerd/stargz-snapshotter/fs/config.FuseConfig.AttrTimeout":                      "AttrTimeout defines overall timeout attribute for a file system in seconds.",
+	"github.com/containerd/stargz-snapshotter/fs/config.FuseConfig.EntryTimeout":                     "EntryTimeout defines TTL for directory, name lookup in seconds.",
+	"github.com/containerd/stargz-snapshotter/fs/config.FuseConfig.MergeBufferSize":                  "MergeBufferSize is the size of the buffer to merge chunks (in bytes) for passthrough mode. Default is 400MB.",
+	"github.com/containerd/stargz-snapshotter/fs/config.FuseConfig.MergeWorkerCount":                 "MergeWorkerCount is the number of workers to merge chunks for passthrough mode. Default is 10.",
+	"github.com/containerd/stargz-snapshotter/fs/config.FuseConfig.PassThrough":                      "PassThrough indicates whether to enable FUSE passthrough mode to improve local file read performance. Default is false.",
+	"github.com/containerd/stargz-snapshotter/service.CRIKeychainConfig":                             "CRIKeychainConfig is config for CRI-based keychain.",
+	"github.com/containerd/stargz-snapshotter/service.CRIKeychainConfig.EnableKeychain":              "EnableKeychain enables CRI-based keychain",
+	"github.com/containerd/stargz-snapshotter/service.CRIKeychainConfig.ImageServicePath":            "ImageServicePath is the path to the unix socket of backing CRI Image Service (e.g. containerd CRI plugin)",
+	"github.com/containerd/stargz-snapshotter/service.CRIKeychainConfig.ListenPath":                  "ListenPath is the path to the unix socket to listen",
+	"github.com/containerd/stargz-snapshotter/service.CacheConfig":                                   "CacheConfig is config for the in-memory manifest cache.",
+	"github.com/containerd/stargz-snapshotter/service.CacheConfig.MaxEntries":                        "MaxEntries is the maximum number of manifests kept in memory (default: 256).",
+	"github.com/containerd/stargz-snapshotter/service.CacheConfig.TTL":                               "TTL is the duration a cached manifest is served without asking the registry. Zero means that cached manifests are always revalidated using their ETag.",
+	"github.com/containerd/stargz-snapshotter/service.CacheConfig.WarmPaths":                         "WarmPaths lists references of images (e.g. \"ghcr.io/org/app:latest\") whose manifests are resolved at startup. Glob patterns aren't supported because registries can't be listed.",
+	"github.com/containerd/stargz-snapshotter/service.CompressionConfig":                             "CompressionConfig is config for compression settings.",
+	"github.com/containerd/stargz-snapshotter/service.CompressionConfig.ZstdChunkedCompressionLevel": "ZstdChunkedCompressionLevel default compression level for zstd:chunked (1-22)",
+	"github.com/containerd/stargz-snapshotter/service.CompressionConfig.ZstdChunkedHashAlgorithm":    "ZstdChunkedHashAlgorithm is the algorithm of the file and chunk digests in the TOCs of zstd:chunked layers: \"sha256\" (default), \"sha384\" or \"sha512\"",
+	"github.com/containerd/stargz-snapshotter/service.CompressionConfig.ZstdImplementation":          "ZstdImplementation specifies which zstd implementation to use: \"auto\" (default), \"klauspost\", \"gozstd\"",
+	"github.com/containerd/stargz-snapshotter/service.CompressionConfig.ZstdWorkers":                 "ZstdWorkers is the number of zstd compression workers (up to 256). It takes precedence over the ZSTD_WORKERS environment variable. 0 (default) uses ZSTD_WORKERS if set and otherwise detects it from the CPUs available to the snapshotter.",
+	"github.com/containerd/stargz-snapshotter/service.Config":                                        "Config is configuration for stargz snapshotter service.",
+	"github.com/containerd/stargz-snapshotter/service.Config.CRIKeychainConfig":                      "CRIKeychainConfig is config for CRI-based keychain.",
+	"github.com/containerd/stargz-snapshotter/service.Config.CacheConfig":                            "CacheConfig is config for the in-memory manifest cache.",
+	"github.com/containerd/stargz-snapshotter/service.Config.CompressionConfig":                      "CompressionConfig is config for compression settings.",
+	"github.com/containerd/stargz-snapshotter/service.Config.ConversionTimeout":                      "ConversionTimeout limits each layer conversion (see nativeconverter.WithTimeout). The partially written blob of a timed out conversion is removed. Zero means no timeout.",
+	"github.com/containerd/stargz-snapshotter/service.Config.HealthCheckConfig":                      "HealthCheckConfig is config for the liveness and readiness probes.",
+	"github.com/containerd/stargz-snapshotter/service.Config.KubeconfigKeychainConfig":               "KubeconfigKeychainConfig is config for kubeconfig-based keychain.",
+	"github.com/containerd/stargz-snapshotter/service.Config.LogLevel":                               "LogLevel is the logging level: \"debug\", \"info\", \"warn\" or \"error\". It can be changed at runtime via LogLevelPath on the HealthCheckConfig address.",
+	"github.com/containerd/stargz-snapshotter/service.Config.MaxParallelConversions":                 "MaxParallelConversions is the maximum number of layers converted at once (default: 4). Each in-flight conversion buffers a compressed layer.",
+	"github.com/containerd/stargz-snapshotter/service.Config.NetworkConfig":                          "NetworkConfig is config for the gRPC listener.",
+	"github.com/containerd/stargz-snapshotter/service.Config.ResolverConfig":                         "ResolverConfig is config for resolving registries.",
+	"github.com/containerd/stargz-snapshotter/service.Config.SecurityConfig":                         "SecurityConfig is config for hardening the snapshotter process.",
+	"github.com/containerd/stargz-snapshotter/service.Config.SnapshotterConfig":                      "SnapshotterConfig is snapshotter-related config.",
+	"github.com/containerd/stargz-snapshotter/service.Config.StorageBackend":                         "StorageBackend selects the content store driver of the image conversions (see NewConverter): \"containerd\" (default). \"s3\" and \"gcs\" are reserved but not implemented yet.",
+	"github.com/containerd/stargz-snapshotter/service.Config.StorageBackendConfig":                   "StorageBackendConfig is backend-specific parameters passed to the selected StorageBackend.",
+	"github.com/containerd/stargz-snapshotter/service.Config.Version":                                "Version is the version of the configuration format. Empty means ConfigVersion. Builds reject versions they don't know instead of ignoring the unknown fields.",
+	"github.com/containerd/stargz-snapshotter/service.HealthCheckConfig":                             "HealthCheckConfig is config for the liveness and readiness probe endpoints.",
+	"github.com/containerd/stargz-snapshotter/service.HealthCheckConfig.Address":                     "Address is the TCP address to serve the probes on. The probes are disabled if empty.",
+	"github.com/containerd/stargz-snapshotter/service.HealthCheckConfig.CheckInterval":               "CheckInterval is the interval of the periodic readiness check once the snapshotter is ready. Zero disables the periodic check.",
+	"github.com/containerd/stargz-snapshotter/service.HealthCheckConfig.LivenessPath":                "LivenessPath is the HTTP path of the liveness probe (default: \"/livez\").",
+	"github.com/containerd/stargz-snapshotter/service.HealthCheckConfig.ReadinessPath":               "ReadinessPath is the HTTP path of the readiness probe (default: \"/readyz\").",
+	"github.com/containerd/stargz-snapshotter/service.HealthCheckConfig.StartupDelay":                "StartupDelay is the minimum duration after startup before reporting ready.",
+	"github.com/containerd/stargz-snapshotter/service.KubeconfigKeychainConfig":                      "KubeconfigKeychainConfig is config for kubeconfig-based keychain.",
+	"github.com/containerd/stargz-snapshotter/service.KubeconfigKeychainConfig.EnableKeychain":       "EnableKeychain enables kubeconfig-based keychain",
+	"github.com/containerd/stargz-snapshotter/service.KubeconfigKeychainConfig.KubeconfigPath":       "KubeconfigPath is the path to kubeconfig which can be used to sync secrets on the cluster into this snapshotter.",
+	"github.com/containerd/stargz-snapshotter/service.KubeconfigKeychainConfig.NamespaceScope":       "NamespaceScope restricts the secrets used by the keychain: \"pod\" uses only the secrets in the namespace of the pod pulling the image (known through the CRI keychain) and a namespace name uses only the secrets of that namespace. Empty uses the secrets of all namespaces.",
+	"github.com/containerd/stargz-snapshotter/service.NetworkConfig":                                 "NetworkConfig is config for the snapshotter's gRPC listener.",
+	"github.com/containerd/stargz-snapshotter/service.NetworkConfig.MaxConnAge":                      "MaxConnAge is the maximum age of a connection before the server closes it. Zero means no limit.",
+	"github.com/containerd/stargz-snapshotter/service.NetworkConfig.SocketPath":                      "SocketPath is the path to the unix socket of the gRPC server. The \"-address\" flag takes precedence when specified.",
+	"github.com/containerd/stargz-snapshotter/service.NetworkConfig.TLSCAFile":                       "TLSCAFile enables mutual TLS. Clients must present a certificate signed by this CA.",
+	"github.com/containerd/stargz-snapshotter/service.NetworkConfig.TLSCertFile":                     "TLSCertFile and TLSKeyFile enable TLS on the gRPC server when both are set.",
+	"github.com/containerd/stargz-snapshotter/service.ResolverConfig":                                "ResolverConfig is config for resolving registries.",
+	"github.com/containerd/stargz-snapshotter/service.ResolverConfig.CircuitBreakerCooldown":         "CircuitBreakerCooldown is how long the circuit of a registry host stays open before a request probes the host again (default: 30s).",
+	"github.com/containerd/stargz-snapshotter/service.ResolverConfig.CircuitBreakerThreshold":        "CircuitBreakerThreshold makes the requests to a registry host fail fast with ErrCircuitOpen for CircuitBreakerCooldown after that many consecutive failed requests (errors or 5xx responses). Zero disables the circuit breaker.",
+	"github.com/containerd/stargz-snapshotter/service.ResolverConfig.CustomCACertPath":               "CustomCACertPath is a PEM file of CA certificates trusted for the registries in addition to the system ones, e.g. for self-signed registries. The file is read again on each new connection so it can be updated without restarting.",
+	"github.com/containerd/stargz-snapshotter/service.ResolverConfig.DNSOverTLS":                     "DNSOverTLS enables resolving registry hostnames with DNS over TLS.",
+	"github.com/containerd/stargz-snapshotter/service.ResolverConfig.DNSOverTLSServer":               "DNSOverTLSServer is the DNS over TLS server (\"host\" or \"host:port\", default port 853).",
+	"github.com/containerd/stargz-snapshotter/service.ResolverConfig.FollowRedirects":                "FollowRedirects makes the requests to the registries follow redirects, e.g. of blob downloads to a CDN (default: true). If false, a redirect response fails the request with a RedirectError holding its Location.",
+	"github.com/containerd/stargz-snapshotter/service.ResolverConfig.HTTPProxy":                      "HTTPProxy is the URL of the proxy used for the requests to the registries (e.g. \"http://proxy.example.com:3128\") instead of the one specified by the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.",
+	"github.com/containerd/stargz-snapshotter/service.ResolverConfig.IPv6Preference":                 "IPv6Preference makes the resolver connect to the IPv6 addresses of the registries before the IPv4 ones when the hostname resolves to both.",
+	"github.com/containerd/stargz-snapshotter/service.ResolverConfig.MaxConcurrentRequests":          "MaxConcurrentRequests limits the requests in flight to each registry host, from sending a request until its response body is read or closed. Zero means no limit.",
+	"github.com/containerd/stargz-snapshotter/service.ResolverConfig.MaxRedirects":                   "MaxRedirects is the maximum number of redirects followed by a request (default: 10). A request redirected more times fails with a TooManyRedirectsError.",
+	"github.com/containerd/stargz-snapshotter/service.ResolverConfig.NoProxy":                        "NoProxy is a comma-separated list of hostnames, domain suffixes (\".example.com\"), IP addresses and CIDRs of the registries connected without HTTPProxy, following the rules of NO_PROXY. Requests to localhost are never proxied.",
+	"github.com/containerd/stargz-snapshotter/service.ResolverConfig.RequestTimeout":                 "RequestTimeout limits each HTTP request to the registries, including its retries. Unlike MirrorConfig.RequestTimeoutSec it also covers reading the response body. Zero means no limit.",
+	"github.com/containerd/stargz-snapshotter/service.SecurityConfig":                                "SecurityConfig is config for hardening the snapshotter process.",
+	"github.com/containerd/stargz-snapshotter/service.SecurityConfig.AppArmorProfile":                "AppArmorProfile is the AppArmor profile the snapshotter is expected to be confined by. The profile needs to be set by the service manager (e.g. systemd AppArmorProfile=); startup fails if the process runs under a different one.",
+	"github.com/containerd/stargz-snapshotter/service.SecurityConfig.NoNewPrivileges":                "NoNewPrivileges sets the no_new_privs bit of the snapshotter process.",
+	"github.com/containerd/stargz-snapshotter/service.SecurityConfig.SeccompProfilePath":             "SeccompProfilePath is the path to a seccomp profile in the JSON format used by container runtimes (\"defaultAction\" and \"syscalls\" with \"names\" and \"action\"; argument conditions aren't supported). The filter is applied to the snapshotter and the processes it starts (e.g. the FUSE manager) before mounting layers.",
+	"github.com/containerd/stargz-snapshotter/service.SnapshotterConfig":                             "SnapshotterConfig is snapshotter-related config.",
+	"github.com/containerd/stargz-snapshotter/service.SnapshotterConfig.AllowInvalidMountsOnRestart": "AllowInvalidMountsOnRestart allows that there are snapshot mounts that cannot access to the data source when restarting the snapshotter. Those snapshots are logged in warnings with the reasons of the failures and listed by the /debug/invalid-mounts endpoint. If this is false, the snapshotter fails to start with an error listing them. NOTE: User needs to manually remove the snapshots from containerd's metadata store using ctr (e.g. `ctr snapshot rm`).",
+	"github.com/containerd/stargz-snapshotter/service.SnapshotterConfig.FuseWriteBack":               "FuseWriteBack requests FUSE write-back caching mode. NOTE: This is currently rejected by Validate. Stargz layers are mounted read-only (writes go to the overlayfs upper directory, not to FUSE) and go-fuse doesn't negotiate the kernel's writeback cache capability.",
+	"github.com/containerd/stargz-snapshotter/service.SnapshotterConfig.GCPolicy":                    "GCPolicy evicts the committed snapshots that no other snapshot is based on and that their creator labelled with snapshot.EvictableLabel. Disabled by default.",
+	"github.com/containerd/stargz-snapshotter/service.SnapshotterConfig.PreloadOnMount":              "PreloadOnMount starts fetching the priority files of a layer, as recorded in its TOC, in the background as soon as the layer is mounted instead of on the first read.",
+	"github.com/containerd/stargz-snapshotter/service/resolver.MirrorConfig.Header":                  "Header are additional headers to send to the server",
+	"github.com/containerd/stargz-snapshotter/service/resolver.MirrorConfig.Host":                    "Host is the hostname of the host.",
+	"github.com/containerd/stargz-snapshotter/service/resolver.MirrorConfig.Insecure":                "Insecure is true means use http scheme instead of https.",
+	"github.com/containerd/stargz-snapshotter/service/resolver.MirrorConfig.RequestTimeoutSec":       "RequestTimeoutSec is timeout seconds of each request to the registry. RequestTimeoutSec == 0 indicates the default timeout (defaultRequestTimeoutSec). RequestTimeoutSec < 0 indicates no timeout.",
+	"github.com/containerd/stargz-snapshotter/snapshot.GCPolicy":                                     "GCPolicy configures the eviction of the committed snapshots labelled with EvictableLabel that aren't the parent of any other snapshot.",
+	"github.com/containerd/stargz-snapshotter/snapshot.GCPolicy.GCInterval":                          "GCInterval is the interval of the eviction. Zero disables the GC.",
+	"github.com/containerd/stargz-snapshotter/snapshot.GCPolicy.MaxAge":                              "MaxAge evicts unused snapshots created longer than MaxAge ago. Zero disables it.",
+	"github.com/containerd/stargz-snapshotter/snapshot.GCPolicy.MaxUnusedSize":                       "MaxUnusedSize evicts the oldest unused snapshots while their total size exceeds MaxUnusedSize bytes. Zero disables it.",
+}
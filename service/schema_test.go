@@ -0,0 +1,303 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// descriptionSources are the packages declaring the types reachable from Config
+var descriptionSources = map[string]string{
+	"github.com/containerd/stargz-snapshotter/service":          ".",
+	"github.com/containerd/stargz-snapshotter/service/resolver": "resolver",
+	"github.com/containerd/stargz-snapshotter/fs/config":        "../fs/config",
+	"github.com/containerd/stargz-snapshotter/snapshot":         "../snapshot",
+}
+
+const descriptionsFile = "schema_descriptions.go"
+
+// TestSchemaDescriptions checks that schemaDescriptions has the current doc comments
+// of the config types. Run with UPDATE_SCHEMA_DESCRIPTIONS=1 (or `go generate`) to
+// regenerate it.
+func TestSchemaDescriptions(t *testing.T) {
+	descs := make(map[string]string)
+	aliases := make(map[string]string)
+	for pkg, dir := range descriptionSources {
+		if err := parseDescriptions(pkg, dir, descs, aliases); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Defined types like ResolverConfig have the fields of the type they are defined from
+	for alias, target := range aliases {
+		for k, v := range descs {
+			if field, ok := strings.CutPrefix(k, target+"."); ok {
+				descs[alias+"."+field] = v
+			}
+		}
+	}
+
+	reachable := make(map[string]bool)
+	walkTypes(reflect.TypeOf(Config{}), reachable)
+	var keys []string
+	for k := range descs {
+		i := strings.LastIndex(k, "/") + 1
+		parts := strings.SplitN(k[i:], ".", 3) // package name, type and field
+		if reachable[k[:i]+parts[0]+"."+parts[1]] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	buf.WriteString(`// Code generated by TestSchemaDescriptions; DO NOT EDIT.
+
+package service
+
+// schemaDescriptions are the doc comments of the config types and their fields,
+// keyed by "<package path>.<type>" and "<package path>.<type>.<field>"
+var schemaDescriptions = map[string]string{
+`)
+	for _, k := range keys {
+		fmt.Fprintf(&buf, "%q: %q,\n", k, descs[k])
+	}
+	buf.WriteString("}\n")
+	want, err := format.Source(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if os.Getenv("UPDATE_SCHEMA_DESCRIPTIONS") != "" {
+		if err := os.WriteFile(descriptionsFile, want, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	got, err := os.ReadFile(descriptionsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s is out of date; run `go generate ./service`", descriptionsFile)
+	}
+}
+
+// parseDescriptions adds the doc comments of the types of the package pkg in dir and
+// of their fields to descs. The types defined from a type of another package are
+// added to aliases.
+func parseDescriptions(pkg, dir string, descs, aliases map[string]string) error {
+	pkgs, err := parser.ParseDir(token.NewFileSet(), dir, func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, parser.ParseComments)
+	if err != nil {
+		return err
+	}
+	for _, p := range pkgs {
+		for _, f := range p.Files {
+			imports := make(map[string]string)
+			for _, imp := range f.Imports {
+				path, _ := strconv.Unquote(imp.Path.Value)
+				name := path[strings.LastIndex(path, "/")+1:]
+				if imp.Name != nil {
+					name = imp.Name.Name
+				}
+				imports[name] = path
+			}
+			for _, decl := range f.Decls {
+				gd, ok := decl.(*ast.GenDecl)
+				if !ok || gd.Tok != token.TYPE {
+					continue
+				}
+				for _, spec := range gd.Specs {
+					ts := spec.(*ast.TypeSpec)
+					key := pkg + "." + ts.Name.Name
+					doc := ts.Doc
+					if doc == nil && len(gd.Specs) == 1 {
+						doc = gd.Doc
+					}
+					if d := commentText(doc); d != "" {
+						descs[key] = d
+					}
+					switch typ := ts.Type.(type) {
+					case *ast.SelectorExpr:
+						if x, ok := typ.X.(*ast.Ident); ok && imports[x.Name] != "" {
+							aliases[key] = imports[x.Name] + "." + typ.Sel.Name
+						}
+					case *ast.StructType:
+						for _, field := range typ.Fields.List {
+							d := commentText(field.Doc)
+							if d == "" {
+								d = commentText(field.Comment)
+							}
+							if d == "" {
+								continue
+							}
+							for _, name := range field.Names {
+								descs[key+"."+name.Name] = d
+							}
+							if len(field.Names) == 0 {
+								descs[key+"."+embeddedName(field.Type)] = d
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// commentText returns the text of c in a single line
+func commentText(c *ast.CommentGroup) string {
+	if c == nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(c.Text()), " ")
+}
+
+// embeddedName returns the field name of the embedded type expression e
+func embeddedName(e ast.Expr) string {
+	switch e := e.(type) {
+	case *ast.StarExpr:
+		return embeddedName(e.X)
+	case *ast.SelectorExpr:
+		return e.Sel.Name
+	case *ast.Ident:
+		return e.Name
+	}
+	return ""
+}
+
+// walkTypes adds the keys of the named struct types reachable from t to seen
+func walkTypes(t reflect.Type, seen map[string]bool) {
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Array, reflect.Map:
+		walkTypes(t.Elem(), seen)
+	case reflect.Struct:
+		if seen[typeKey(t)] {
+			return
+		}
+		seen[typeKey(t)] = true
+		for i := 0; i < t.NumField(); i++ {
+			walkTypes(t.Field(i).Type, seen)
+		}
+	}
+}
+
+func TestConfigJSONSchema(t *testing.T) {
+	b, err := new(Config).JSONSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(b, &schema); err != nil {
+		t.Fatal(err)
+	}
+	if schema["$schema"] != "http://json-schema.org/draft-07/schema#" {
+		t.Errorf("$schema = %v; want draft-07", schema["$schema"])
+	}
+	sl := gojsonschema.NewSchemaLoader()
+	sl.Draft = gojsonschema.Draft7
+	sl.Validate = true // against the draft-07 meta-schema
+	compiled, err := sl.Compile(gojsonschema.NewBytesLoader(b))
+	if err != nil {
+		t.Fatalf("invalid schema: %v", err)
+	}
+	validate := func(cfg string) *gojsonschema.Result {
+		t.Helper()
+		res, err := compiled.Validate(gojsonschema.NewStringLoader(cfg))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	for _, tt := range []struct {
+		path []string
+		want string
+	}{
+		{[]string{"noprefetch"}, "NoPrefetch disables prefetching."},
+		{[]string{"blob", "chunk_size"}, "ChunkSize is the granularity (in bytes) at which background fetch and on-demand reads are fetched from the remote registry."},
+		{[]string{"resolver", "request_timeout"}, "RequestTimeout limits each HTTP request to the registries"},
+		{[]string{"snapshotter", "gc_policy", "max_age"}, "MaxAge evicts unused snapshots"},
+		{[]string{"compression"}, "CompressionConfig is config for compression settings."},
+	} {
+		s := schema
+		for _, p := range tt.path {
+			s, _ = s["properties"].(map[string]interface{})[p].(map[string]interface{})
+		}
+		if d, _ := s["description"].(string); !strings.HasPrefix(d, tt.want) {
+			t.Errorf("description of %s = %q; want prefix %q", strings.Join(tt.path, "."), d, tt.want)
+		}
+	}
+
+	good := `{
+  "version": "v1",
+  "noprefetch": true,
+  "blob": {"chunk_size": 65536, "check_always": false},
+  "fuse": {"attr_timeout": 1, "passthrough": true},
+  "resolver": {
+    "request_timeout": "30s",
+    "host": {
+      "docker.io": {"mirrors": [{"host": "mirror.example.com", "header": {"x-custom": ["a", "b"]}}]}
+    }
+  },
+  "snapshotter": {"gc_policy": {"max_age": "24h", "max_unused_size_bytes": 1073741824, "gc_interval": "1h30m"}},
+  "compression": {"zstd_implementation": "auto", "zstd_workers": 4},
+  "cache": {"ttl": 300000000000, "warm_paths": ["docker.io/library/alpine:latest"]},
+  "storage_backend_config": {"bucket": "layers"},
+  "log_level": "info"
+}`
+	var filled Config
+	fillNonZero(t, reflect.ValueOf(&filled).Elem(), "Config")
+	filledJSON, err := json.Marshal(filled)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, cfg := range map[string]string{"good": good, "filled": string(filledJSON), "empty": "{}"} {
+		if res := validate(cfg); !res.Valid() {
+			t.Errorf("%s config is rejected: %v", name, res.Errors())
+		}
+	}
+
+	for _, bad := range []string{
+		`{"no_prefetch": true}`,
+		`{"noprefetch": "yes"}`,
+		`{"blob": {"chunk_size": 1.5}}`,
+		`{"resolver": {"request_timeout": "soon"}}`,
+		`{"snapshotter": {"gc_policy": {"max_unused_size_bytes": -1}}}`,
+		`{"cache": {"warm_paths": "docker.io/library/alpine:latest"}}`,
+		`{"resolver": {"host": {"docker.io": {"mirrors": [{"hots": "mirror.example.com"}]}}}}`,
+	} {
+		if validate(bad).Valid() {
+			t.Errorf("config %s is accepted", bad)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	seccomp "github.com/elastic/go-seccomp-bpf"
+)
+
+// SecurityConfig is config for hardening the snapshotter process.
+type SecurityConfig struct {
+	// SeccompProfilePath is the path to a seccomp profile in the JSON format used by
+	// container runtimes ("defaultAction" and "syscalls" with "names" and "action";
+	// argument conditions aren't supported). The filter is applied to the snapshotter
+	// and the processes it starts (e.g. the FUSE manager) before mounting layers.
+	SeccompProfilePath string `toml:"seccomp_profile_path" json:"seccomp_profile_path"`
+
+	// AppArmorProfile is the AppArmor profile the snapshotter is expected to be
+	// confined by. The profile needs to be set by the service manager (e.g. systemd
+	// AppArmorProfile=); startup fails if the process runs under a different one.
+	AppArmorProfile string `toml:"apparmor_profile" json:"apparmor_profile"`
+
+	// NoNewPrivileges sets the no_new_privs bit of the snapshotter process.
+	NoNewPrivileges bool `toml:"no_new_privileges" json:"no_new_privileges"`
+}
+
+// appArmorCurrentPath contains the AppArmor confinement of the current process
+const appArmorCurrentPath = "/proc/self/attr/current"
+
+// seccompProfile is the subset of the container runtimes' seccomp profile format
+// supported by SecurityConfig.
+type seccompProfile struct {
+	DefaultAction string `json:"defaultAction"`
+	Syscalls      []struct {
+		Names  []string          `json:"names"`
+		Action string            `json:"action"`
+		Args   []json.RawMessage `json:"args"`
+	} `json:"syscalls"`
+}
+
+func (c SecurityConfig) validate() error {
+	if c.SeccompProfilePath != "" {
+		if _, err := loadSeccompProfile(c.SeccompProfilePath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ApplySecurityConfig applies cfg to the current process. This must be called
+// before mounting any layer. The seccomp filter and the no_new_privs bit are
+// applied to all threads and can't be removed afterwards.
+func ApplySecurityConfig(cfg SecurityConfig) error {
+	if cfg.AppArmorProfile != "" {
+		if err := checkAppArmorProfile(cfg.AppArmorProfile); err != nil {
+			return err
+		}
+	}
+	var policy *seccomp.Policy
+	if cfg.SeccompProfilePath != "" {
+		var err error
+		if policy, err = loadSeccompProfile(cfg.SeccompProfilePath); err != nil {
+			return err
+		}
+	} else if cfg.NoNewPrivileges {
+		// Install an allow-all filter for synchronizing no_new_privs with all threads
+		policy = &seccomp.Policy{
+			DefaultAction: seccomp.ActionAllow,
+			Syscalls:      []seccomp.SyscallGroup{{Names: []string{"getpid"}, Action: seccomp.ActionAllow}},
+		}
+	} else {
+		return nil
+	}
+	if !seccomp.Supported() {
+		return fmt.Errorf("seccomp is not supported on this system")
+	}
+	// no_new_privs is set on the calling thread and the filter is synchronized from it
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	return seccomp.LoadFilter(seccomp.Filter{
+		NoNewPrivs: cfg.NoNewPrivileges,
+		Flag:       seccomp.FilterFlagTSync,
+		Policy:     *policy,
+	})
+}
+
+// loadSeccompProfile reads the seccomp profile at path and converts it to a policy
+func loadSeccompProfile(path string) (*seccomp.Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read seccomp profile: %w", err)
+	}
+	var profile seccompProfile
+	if err := json.Unmarshal(data, &profile); err != nil {
+		return nil, fmt.Errorf("invalid seccomp profile %q: %w", path, err)
+	}
+	policy := &seccomp.Policy{}
+	if policy.DefaultAction, err = seccompAction(profile.DefaultAction); err != nil {
+		return nil, fmt.Errorf("invalid seccomp profile %q: %w", path, err)
+	}
+	for _, s := range profile.Syscalls {
+		if len(s.Args) > 0 {
+			return nil, fmt.Errorf("invalid seccomp profile %q: argument conditions are not supported (syscalls %v)", path, s.Names)
+		}
+		action, err := seccompAction(s.Action)
+		if err != nil {
+			return nil, fmt.Errorf("invalid seccomp profile %q: %w", path, err)
+		}
+		policy.Syscalls = append(policy.Syscalls, seccomp.SyscallGroup{Names: s.Names, Action: action})
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid seccomp profile %q: %w", path, err)
+	}
+	// Assembling checks that all the syscall names are known
+	if _, err := policy.Assemble(); err != nil {
+		return nil, fmt.Errorf("invalid seccomp profile %q: %w", path, err)
+	}
+	return policy, nil
+}
+
+// seccompAction converts an action of the profile (e.g. "SCMP_ACT_ALLOW") to seccomp.Action
+func seccompAction(s string) (seccomp.Action, error) {
+	name := strings.ToLower(strings.TrimPrefix(s, "SCMP_ACT_"))
+	if name == "kill" {
+		name = "kill_thread"
+	}
+	var a seccomp.Action
+	if err := a.Unpack(name); err != nil {
+		return 0, fmt.Errorf("unsupported seccomp action %q", s)
+	}
+	return a, nil
+}
+
+func checkAppArmorProfile(want string) error {
+	data, err := os.ReadFile(appArmorCurrentPath)
+	if err != nil {
+		return fmt.Errorf("failed to get AppArmor profile: %w", err)
+	}
+	// The content is "unconfined" or "<profile> (<mode>)"
+	current, _, _ := strings.Cut(strings.TrimSpace(string(data)), " (")
+	if current != want {
+		return fmt.Errorf("snapshotter runs under AppArmor profile %q, not %q", current, want)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	seccomp "github.com/elastic/go-seccomp-bpf"
+)
+
+func TestSecurityConfigInvalidProfilePath(t *testing.T) {
+	cfg := SecurityConfig{SeccompProfilePath: filepath.Join(t.TempDir(), "missing.json")}
+	if err := (&Config{SecurityConfig: cfg}).Validate(); err == nil {
+		t.Errorf("Validate should fail for a missing seccomp profile")
+	}
+	if err := ApplySecurityConfig(cfg); err == nil {
+		t.Errorf("ApplySecurityConfig should fail for a missing seccomp profile")
+	}
+}
+
+func TestLoadSeccompProfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile string
+		wantErr bool
+	}{
+		{
+			name:    "valid",
+			profile: `{"defaultAction": "SCMP_ACT_ERRNO", "syscalls": [{"names": ["read", "write", "openat"], "action": "SCMP_ACT_ALLOW"}, {"names": ["ptrace"], "action": "SCMP_ACT_KILL"}]}`,
+		},
+		{
+			name:    "unknown syscall",
+			profile: `{"defaultAction": "SCMP_ACT_ERRNO", "syscalls": [{"names": ["no_such_syscall"], "action": "SCMP_ACT_ALLOW"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "unsupported action",
+			profile: `{"defaultAction": "SCMP_ACT_NOTIFY", "syscalls": [{"names": ["read"], "action": "SCMP_ACT_ALLOW"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "argument conditions",
+			profile: `{"defaultAction": "SCMP_ACT_ERRNO", "syscalls": [{"names": ["personality"], "action": "SCMP_ACT_ALLOW", "args": [{"index": 0, "value": 0, "op": "SCMP_CMP_EQ"}]}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "no syscalls",
+			profile: `{"defaultAction": "SCMP_ACT_ALLOW"}`,
+			wantErr: true,
+		},
+		{
+			name:    "malformed",
+			profile: `{"defaultAction": `,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "profile.json")
+			if err := os.WriteFile(path, []byte(tt.profile), 0600); err != nil {
+				t.Fatal(err)
+			}
+			policy, err := loadSeccompProfile(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadSeccompProfile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if policy.DefaultAction != seccomp.ActionErrno || len(policy.Syscalls) != 2 ||
+				policy.Syscalls[0].Action != seccomp.ActionAllow || policy.Syscalls[1].Action != seccomp.ActionKillThread {
+				t.Errorf("unexpected policy %+v", policy)
+			}
+		})
+	}
+}
+
+func TestSecurityConfigAppArmorMismatch(t *testing.T) {
+	if err := ApplySecurityConfig(SecurityConfig{AppArmorProfile: "stargz-test-no-such-profile"}); err == nil {
+		t.Errorf("ApplySecurityConfig should fail when not confined by the AppArmor profile")
+	}
+}
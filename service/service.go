@@ -21,6 +21,7 @@ import (
 	"errors"
 	"fmt"
 	"path/filepath"
+	"slices"
 
 	"github.com/containerd/containerd/v2/core/snapshots"
 	"github.com/containerd/containerd/v2/pkg/reference"
@@ -39,9 +40,11 @@ import (
 type Option func(*options)
 
 type options struct {
-	credsFuncs    []resolver.Credential
-	registryHosts source.RegistryHosts
-	fsOpts        []stargzfs.Option
+	credsFuncs       []resolver.Credential
+	podCredsFuncs    []resolver.PodCredential
+	registryHosts    source.RegistryHosts
+	podRegistryHosts func(namespace string) source.RegistryHosts
+	fsOpts           []stargzfs.Option
 }
 
 // WithCredsFuncs specifies credsFuncs to be used for connecting to the registries.
@@ -51,6 +54,16 @@ func WithCredsFuncs(creds ...resolver.Credential) Option {
 	}
 }
 
+// WithPodCredsFuncs specifies the credentials of the layers pulled by the pods in a
+// namespace (e.g. kubeconfig.NewKubeconfigPodKeychain), used in addition to
+// credsFuncs. The namespace of the pod is recorded for each layer when it's pulled
+// through the CRI keychain.
+func WithPodCredsFuncs(creds ...resolver.PodCredential) Option {
+	return func(o *options) {
+		o.podCredsFuncs = append(o.podCredsFuncs, creds...)
+	}
+}
+
 // WithCustomRegistryHosts is registry hosts to use instead.
 func WithCustomRegistryHosts(hosts source.RegistryHosts) Option {
 	return func(o *options) {
@@ -58,6 +71,14 @@ func WithCustomRegistryHosts(hosts source.RegistryHosts) Option {
 	}
 }
 
+// WithCustomPodRegistryHosts is registry hosts to use instead for the layers pulled by
+// the pods in a namespace, typically with WithCustomRegistryHosts.
+func WithCustomPodRegistryHosts(hosts func(namespace string) source.RegistryHosts) Option {
+	return func(o *options) {
+		o.podRegistryHosts = hosts
+	}
+}
+
 // WithFilesystemOptions allowes to pass filesystem-related configuration.
 func WithFilesystemOptions(opts ...stargzfs.Option) Option {
 	return func(o *options) {
@@ -65,8 +86,19 @@ func WithFilesystemOptions(opts ...stargzfs.Option) Option {
 	}
 }
 
+// usesPodNamespaces returns whether the layers are fetched with the registry hosts of
+// the namespaces of the pods pulling them
+func (o *options) usesPodNamespaces() bool {
+	return o.podRegistryHosts != nil || (o.registryHosts == nil && len(o.podCredsFuncs) > 0)
+}
+
 // NewStargzSnapshotterService returns stargz snapshotter.
 func NewStargzSnapshotterService(ctx context.Context, root string, config *Config, opts ...Option) (snapshots.Snapshotter, error) {
+	var sOpts options
+	for _, o := range opts {
+		o(&sOpts)
+	}
+
 	fs, err := NewFileSystem(ctx, root, config, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to configure filesystem: %w", err)
@@ -78,6 +110,10 @@ func NewStargzSnapshotterService(ctx context.Context, root string, config *Confi
 	if config.AllowInvalidMountsOnRestart {
 		snOpts = append(snOpts, snapshot.AllowInvalidMountsOnRestart)
 	}
+	snOpts = append(snOpts, snapshot.WithGCPolicy(config.GCPolicy))
+	if sOpts.usesPodNamespaces() {
+		snOpts = append(snOpts, snapshot.WithRemoteLabels(podNamespaceLabels))
+	}
 
 	snapshotter, err = snapshot.NewSnapshotter(ctx, snapshotterRoot(root), fs, snOpts...)
 	if err != nil {
@@ -93,10 +129,28 @@ func NewFileSystem(ctx context.Context, root string, config *Config, opts ...Opt
 		o(&sOpts)
 	}
 
-	hosts := sOpts.registryHosts
+	// Applies the compression config (e.g. ZstdWorkers) also when Validate isn't called
+	if _, err := GetCompressorFromConfig(config.CompressionConfig); err != nil {
+		return nil, err
+	}
+
+	hosts, podHosts := sOpts.registryHosts, sOpts.podRegistryHosts
 	if hosts == nil {
 		// Use RegistryHosts based on ResolverConfig and keychain
-		hosts = resolver.RegistryHostsFromConfig(resolver.Config(config.ResolverConfig), sOpts.credsFuncs...)
+		manifests := resolver.NewManifestCache(config.CacheConfig.MaxEntries, config.CacheConfig.TTL)
+		hosts = resolver.RegistryHostsWithManifestCache(resolver.Config(config.ResolverConfig), manifests, sOpts.credsFuncs...)
+		if len(config.CacheConfig.WarmPaths) > 0 {
+			go warmManifestCache(log.WithLogger(context.Background(), log.G(ctx)), hosts, config.CacheConfig.WarmPaths)
+		}
+		if podHosts == nil && len(sOpts.podCredsFuncs) > 0 {
+			podHosts = func(namespace string) source.RegistryHosts {
+				credsFuncs := slices.Clone(sOpts.credsFuncs)
+				for _, f := range sOpts.podCredsFuncs {
+					credsFuncs = append(credsFuncs, f(namespace))
+				}
+				return resolver.RegistryHostsWithManifestCache(resolver.Config(config.ResolverConfig), manifests, credsFuncs...)
+			}
+		}
 	}
 
 	userxattr, err := overlayutils.NeedsUserXAttr(snapshotterRoot(root))
@@ -108,11 +162,16 @@ func NewFileSystem(ctx context.Context, root string, config *Config, opts ...Opt
 		opq = layer.OverlayOpaqueUser
 	}
 	// Configure filesystem and snapshotter
-	fsOpts := append(sOpts.fsOpts, stargzfs.WithGetSources(sources(
+	getSources := sources(
 		sourceFromCRILabels(hosts),      // provides source info based on CRI labels
 		source.FromDefaultLabels(hosts), // provides source info based on default labels
-	)),
+	)
+	if podHosts != nil {
+		getSources = podNamespaceSources(getSources, podHosts)
+	}
+	fsOpts := append(sOpts.fsOpts, stargzfs.WithGetSources(getSources),
 		stargzfs.WithOverlayOpaqueType(opq),
+		stargzfs.WithPreloadOnMount(config.PreloadOnMount),
 		stargzfs.WithAdditionalDecompressors(func(ctx context.Context, hosts source.RegistryHosts, refspec reference.Spec, desc ocispec.Descriptor) []metadata.Decompressor {
 			return []metadata.Decompressor{esgzexternaltoc.NewRemoteDecompressor(ctx, hosts, refspec, desc)}
 		}),
@@ -0,0 +1,127 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/containerd/containerd/v2/core/content"
+	"github.com/containerd/containerd/v2/plugins/content/local"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const (
+	// StorageBackendContainerd stores layer data in a containerd local content store (default).
+	StorageBackendContainerd = "containerd"
+
+	// StorageBackendS3 stores layer data in an S3-compatible object store.
+	StorageBackendS3 = "s3"
+
+	// StorageBackendGCS stores layer data in Google Cloud Storage.
+	StorageBackendGCS = "gcs"
+)
+
+// ErrNotImplemented is returned by storage backends that are not implemented yet.
+var ErrNotImplemented = errors.New("not implemented")
+
+func validateStorageBackend(name string) error {
+	switch name {
+	case "", StorageBackendContainerd:
+		return nil
+	case StorageBackendS3, StorageBackendGCS:
+		return fmt.Errorf("storage_backend %q is not implemented yet", name)
+	}
+	return fmt.Errorf("unknown storage_backend %q", name)
+}
+
+// NewContentStore instantiates the content store selected by StorageBackend.
+// The containerd backend keeps its data under the "content" directory of root.
+// The placeholder S3 and GCS stores are returned although Validate rejects them.
+func NewContentStore(root string, config *Config) (content.Store, error) {
+	switch config.StorageBackend {
+	case "", StorageBackendContainerd:
+		return local.NewStore(filepath.Join(root, "content"))
+	case StorageBackendS3:
+		return &S3Store{Params: config.StorageBackendConfig}, nil
+	case StorageBackendGCS:
+		return &GCSStore{Params: config.StorageBackendConfig}, nil
+	}
+	return nil, fmt.Errorf("unknown storage_backend %q", config.StorageBackend)
+}
+
+// S3Store is a placeholder content store backed by an S3-compatible object store.
+// All operations currently return ErrNotImplemented.
+type S3Store struct {
+	unimplementedStore
+
+	// Params is the backend-specific configuration from StorageBackendConfig.
+	Params map[string]string
+}
+
+// GCSStore is a placeholder content store backed by Google Cloud Storage.
+// All operations currently return ErrNotImplemented.
+type GCSStore struct {
+	unimplementedStore
+
+	// Params is the backend-specific configuration from StorageBackendConfig.
+	Params map[string]string
+}
+
+// unimplementedStore implements content.Store by returning ErrNotImplemented.
+type unimplementedStore struct{}
+
+var _ content.Store = &unimplementedStore{}
+
+func (unimplementedStore) Info(ctx context.Context, dgst digest.Digest) (content.Info, error) {
+	return content.Info{}, ErrNotImplemented
+}
+
+func (unimplementedStore) Update(ctx context.Context, info content.Info, fieldpaths ...string) (content.Info, error) {
+	return content.Info{}, ErrNotImplemented
+}
+
+func (unimplementedStore) Walk(ctx context.Context, fn content.WalkFunc, filters ...string) error {
+	return ErrNotImplemented
+}
+
+func (unimplementedStore) Delete(ctx context.Context, dgst digest.Digest) error {
+	return ErrNotImplemented
+}
+
+func (unimplementedStore) ReaderAt(ctx context.Context, desc ocispec.Descriptor) (content.ReaderAt, error) {
+	return nil, ErrNotImplemented
+}
+
+func (unimplementedStore) Status(ctx context.Context, ref string) (content.Status, error) {
+	return content.Status{}, ErrNotImplemented
+}
+
+func (unimplementedStore) ListStatuses(ctx context.Context, filters ...string) ([]content.Status, error) {
+	return nil, ErrNotImplemented
+}
+
+func (unimplementedStore) Abort(ctx context.Context, ref string) error {
+	return ErrNotImplemented
+}
+
+func (unimplementedStore) Writer(ctx context.Context, opts ...content.WriterOpt) (content.Writer, error) {
+	return nil, ErrNotImplemented
+}
@@ -0,0 +1,158 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package snapshot
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/containerd/containerd/v2/core/snapshots"
+	"github.com/containerd/log"
+)
+
+// EvictableLabel opts a snapshot in to the eviction by GCPolicy. containerd still
+// references the snapshots made by e.g. `ctr snapshot commit` or buildkit and removes
+// the unreferenced ones itself, so only the snapshots labelled by their creator are
+// evicted. The label is passed to Prepare or Commit; the snapshotter keeps it on the
+// snapshot committed from a labelled active snapshot.
+const EvictableLabel = "containerd.io/snapshot/stargz.evictable"
+
+// GCPolicy configures the eviction of the committed snapshots labelled with
+// EvictableLabel that aren't the parent of any other snapshot.
+type GCPolicy struct {
+	// MaxAge evicts unused snapshots created longer than MaxAge ago. Zero disables it.
+	MaxAge time.Duration `toml:"max_age" json:"max_age"`
+
+	// MaxUnusedSize evicts the oldest unused snapshots while their total size exceeds
+	// MaxUnusedSize bytes. Zero disables it.
+	MaxUnusedSize uint64 `toml:"max_unused_size_bytes" json:"max_unused_size_bytes"`
+
+	// GCInterval is the interval of the eviction. Zero disables the GC.
+	GCInterval time.Duration `toml:"gc_interval" json:"gc_interval"`
+}
+
+func (p GCPolicy) enabled() bool {
+	return p.GCInterval > 0 && (p.MaxAge > 0 || p.MaxUnusedSize > 0)
+}
+
+// WithGCPolicy makes the snapshotter evict unused snapshots as specified by policy
+// in the background.
+func WithGCPolicy(policy GCPolicy) Opt {
+	return func(config *SnapshotterConfig) error {
+		config.gcPolicy = policy
+		return nil
+	}
+}
+
+// runGC calls evictStaleSnapshots every GCInterval until gcStop is closed
+func (o *snapshotter) runGC(ctx context.Context) {
+	defer close(o.gcDone)
+	ticker := time.NewTicker(o.gcPolicy.GCInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			n, err := o.evictStaleSnapshots(ctx)
+			if err != nil {
+				log.G(ctx).WithError(err).Warn("failed to evict stale snapshots")
+			} else if n > 0 {
+				log.G(ctx).Infof("evicted %d stale snapshots", n)
+			}
+		case <-o.gcStop:
+			return
+		}
+	}
+}
+
+// evictStaleSnapshots removes the unused snapshots exceeding the GC policy and
+// returns the number of removed snapshots. The parents of the removed snapshots
+// are evicted in the same run if they become unused.
+func (o *snapshotter) evictStaleSnapshots(ctx context.Context) (int, error) {
+	var removed int
+	for {
+		unused, err := o.unusedSnapshots(ctx)
+		if err != nil {
+			return removed, err
+		}
+		var evict []snapshots.Info
+		if maxAge := o.gcPolicy.MaxAge; maxAge > 0 {
+			now := o.now()
+			unused = slices.DeleteFunc(unused, func(info snapshots.Info) bool {
+				if now.Sub(info.Created) > maxAge {
+					evict = append(evict, info)
+					return true
+				}
+				return false
+			})
+		}
+		if maxSize := o.gcPolicy.MaxUnusedSize; maxSize > 0 {
+			sizes := make([]uint64, len(unused))
+			var total uint64
+			for i, info := range unused {
+				usage, err := o.Usage(ctx, info.Name)
+				if err != nil {
+					return removed, err
+				}
+				sizes[i] = uint64(usage.Size)
+				total += sizes[i]
+			}
+			// unused is sorted from the oldest
+			for i := 0; total > maxSize && i < len(unused); i++ {
+				evict = append(evict, unused[i])
+				total -= sizes[i]
+			}
+		}
+		if len(evict) == 0 {
+			break
+		}
+		for _, info := range evict {
+			if err := o.Remove(ctx, info.Name); err != nil {
+				return removed, err
+			}
+			log.G(ctx).WithField("key", info.Name).Debug("evicted stale snapshot")
+			removed++
+		}
+	}
+	if removed > 0 && o.asyncRemove {
+		if err := o.Cleanup(ctx); err != nil {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
+
+// unusedSnapshots returns the committed snapshots labelled with EvictableLabel that
+// aren't the parent of any other snapshot, from the oldest
+func (o *snapshotter) unusedSnapshots(ctx context.Context) ([]snapshots.Info, error) {
+	var committed []snapshots.Info
+	parents := make(map[string]bool)
+	if err := o.Walk(ctx, func(ctx context.Context, info snapshots.Info) error {
+		if info.Parent != "" {
+			parents[info.Parent] = true
+		}
+		if _, ok := info.Labels[EvictableLabel]; ok && info.Kind == snapshots.KindCommitted {
+			committed = append(committed, info)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	unused := slices.DeleteFunc(committed, func(info snapshots.Info) bool { return parents[info.Name] })
+	slices.SortFunc(unused, func(a, b snapshots.Info) int { return a.Created.Compare(b.Created) })
+	return unused, nil
+}
@@ -0,0 +1,125 @@
+/*
+   Copyright The containerd Authors.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package snapshot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/containerd/containerd/v2/core/snapshots"
+)
+
+func TestEvictStaleSnapshots(t *testing.T) {
+	ctx := context.TODO()
+	sn, err := NewSnapshotter(ctx, t.TempDir(), dummyFileSystem(), WithGCPolicy(GCPolicy{MaxAge: time.Hour}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sn.Close()
+	o := sn.(*snapshotter)
+
+	evictable := snapshots.WithLabels(map[string]string{EvictableLabel: "true"})
+	commit := func(name, parent string, opts ...snapshots.Opt) {
+		key := name + "-active"
+		if _, err := o.Prepare(ctx, key, parent); err != nil {
+			t.Fatal(err)
+		}
+		if err := o.Commit(ctx, name, key, opts...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	commit("stale", "", evictable)
+	commit("chain-base", "", evictable)
+	commit("chain-top", "chain-base", evictable)
+	commit("in-use", "", evictable)
+	// Snapshots not opted in, e.g. image layers or ones made by `ctr snapshot commit`,
+	// are still referenced by containerd
+	commit("image-base", "", snapshots.WithLabels(map[string]string{targetSnapshotLabel: "sha256:base"}))
+	commit("image-top", "image-base", snapshots.WithLabels(map[string]string{targetSnapshotLabel: "sha256:top"}))
+	commit("committed", "")
+	if _, err := o.Prepare(ctx, "container", "in-use"); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := o.evictStaleSnapshots(ctx); err != nil || n != 0 {
+		t.Fatalf("evicted %d fresh snapshots (err: %v)", n, err)
+	}
+
+	o.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	n, err := o.evictStaleSnapshots(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("evicted %d snapshots; want 3", n)
+	}
+	if got, want := snapshotNames(ctx, t, o), []string{"committed", "container", "image-base", "image-top", "in-use"}; !slices.Equal(got, want) {
+		t.Errorf("remaining snapshots %v; want %v", got, want)
+	}
+}
+
+func TestEvictStaleSnapshotsMaxUnusedSize(t *testing.T) {
+	ctx := context.TODO()
+	sn, err := NewSnapshotter(ctx, t.TempDir(), dummyFileSystem(), WithGCPolicy(GCPolicy{MaxUnusedSize: 1024*1024 + 1024*1024/2}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sn.Close()
+	o := sn.(*snapshotter)
+
+	for _, name := range []string{"oldest", "older", "newest"} {
+		key := name + "-active"
+		// The label of the active snapshot is kept by Commit
+		mounts, err := o.Prepare(ctx, key, "", snapshots.WithLabels(map[string]string{EvictableLabel: "true"}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(mounts[0].Source, name), make([]byte, 1024*1024), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := o.Commit(ctx, name, key); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond) // keeps the creation times ordered
+	}
+
+	n, err := o.evictStaleSnapshots(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("evicted %d snapshots; want 2", n)
+	}
+	if got, want := snapshotNames(ctx, t, o), []string{"newest"}; !slices.Equal(got, want) {
+		t.Errorf("remaining snapshots %v; want %v", got, want)
+	}
+}
+
+func snapshotNames(ctx context.Context, t *testing.T, sn snapshots.Snapshotter) (names []string) {
+	if err := sn.Walk(ctx, func(ctx context.Context, info snapshots.Info) error {
+		names = append(names, info.Name)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(names)
+	return names
+}
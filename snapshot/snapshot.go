@@ -18,11 +18,14 @@ package snapshot
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/containerd/containerd/v2/core/mount"
 	"github.com/containerd/containerd/v2/core/snapshots"
@@ -73,6 +76,8 @@ type SnapshotterConfig struct {
 	asyncRemove                 bool
 	noRestore                   bool
 	allowInvalidMountsOnRestart bool
+	gcPolicy                    GCPolicy
+	remoteLabels                func(labels map[string]string) map[string]string
 }
 
 // Opt is an option to configure the remote snapshotter
@@ -97,6 +102,37 @@ func AllowInvalidMountsOnRestart(config *SnapshotterConfig) error {
 	return nil
 }
 
+// WithRemoteLabels makes Prepare add the labels returned by fn to the remote
+// snapshots before mounting them, e.g. for recording how they were pulled. fn is
+// called with the labels passed to Prepare. The added labels are also passed to
+// FileSystem.Mount when the snapshot is restored.
+func WithRemoteLabels(fn func(labels map[string]string) map[string]string) Opt {
+	return func(config *SnapshotterConfig) error {
+		config.remoteLabels = fn
+		return nil
+	}
+}
+
+// InvalidMount is a remote snapshot that couldn't be mounted when the snapshotter
+// restarted, e.g. because the data of its layer is no longer available.
+type InvalidMount struct {
+	// SnapshotID is the name of the snapshot, as used by `ctr snapshot rm`.
+	SnapshotID string `json:"snapshot_id"`
+
+	// ParentID is the name of the parent snapshot, empty if there is none.
+	ParentID string `json:"parent_id,omitempty"`
+
+	// Reason is the error of mounting the snapshot.
+	Reason string `json:"reason"`
+}
+
+// InvalidMountLister is implemented by the snapshotters returned by NewSnapshotter.
+type InvalidMountLister interface {
+	// ListInvalidMounts returns the remote snapshots that couldn't be mounted when
+	// the snapshotter started. They can only exist with AllowInvalidMountsOnRestart.
+	ListInvalidMounts(ctx context.Context) ([]InvalidMount, error)
+}
+
 type snapshotter struct {
 	root        string
 	ms          *storage.MetaStore
@@ -107,6 +143,13 @@ type snapshotter struct {
 	userxattr                   bool // whether to enable "userxattr" mount option
 	noRestore                   bool
 	allowInvalidMountsOnRestart bool
+	invalidMounts               []InvalidMount // set by restoreRemoteSnapshot
+	remoteLabels                func(labels map[string]string) map[string]string
+
+	gcPolicy GCPolicy
+	gcStop   chan struct{}
+	gcDone   chan struct{}
+	now      func() time.Time // replaced in tests
 }
 
 // NewSnapshotter returns a Snapshotter which can use unpacked remote layers
@@ -157,12 +200,22 @@ func NewSnapshotter(ctx context.Context, root string, targetFs FileSystem, opts
 		userxattr:                   userxattr,
 		noRestore:                   config.noRestore,
 		allowInvalidMountsOnRestart: config.allowInvalidMountsOnRestart,
+		gcPolicy:                    config.gcPolicy,
+		remoteLabels:                config.remoteLabels,
+		now:                         time.Now,
 	}
 
 	if err := o.restoreRemoteSnapshot(ctx); err != nil {
+		// unmount the restored snapshots and release the metadata store
+		o.Close()
 		return nil, fmt.Errorf("failed to restore remote snapshot: %w", err)
 	}
 
+	if o.gcPolicy.enabled() {
+		o.gcStop, o.gcDone = make(chan struct{}), make(chan struct{})
+		go o.runGC(log.WithLogger(context.Background(), log.G(ctx)))
+	}
+
 	return o, nil
 }
 
@@ -259,6 +312,9 @@ func (o *snapshotter) Prepare(ctx context.Context, key, parent string, opts ...s
 		//       or not, using the key `remoteSnapshotLogKey` defined in the above. This
 		//       log is used by tests in this project.
 		lCtx := log.WithLogger(ctx, log.G(ctx).WithField("key", key).WithField("parent", parent))
+		if o.remoteLabels != nil {
+			maps.Copy(base.Labels, o.remoteLabels(base.Labels))
+		}
 		if err := o.prepareRemoteSnapshot(lCtx, key, base.Labels); err != nil {
 			log.G(lCtx).WithField(remoteSnapshotLogKey, prepareFailed).
 				WithError(err).Warn("failed to prepare remote snapshot")
@@ -325,10 +381,13 @@ func (o *snapshotter) commit(ctx context.Context, isRemote bool, name, key strin
 	}()
 
 	// grab the existing id
-	id, _, usage, err := storage.GetInfo(ctx, key)
+	id, info, usage, err := storage.GetInfo(ctx, key)
 	if err != nil {
 		return err
 	}
+	if v, ok := info.Labels[EvictableLabel]; ok {
+		opts = append([]snapshots.Opt{snapshots.WithLabels(map[string]string{EvictableLabel: v})}, opts...)
+	}
 
 	if !isRemote { // skip diskusage for remote snapshots for allowing lazy preparation of nodes
 		du, err := fs.DiskUsage(ctx, o.upperPath(id))
@@ -652,6 +711,10 @@ func (o *snapshotter) workPath(id string) string {
 
 // Close closes the snapshotter
 func (o *snapshotter) Close() error {
+	if o.gcStop != nil {
+		close(o.gcStop)
+		<-o.gcDone
+	}
 	// unmount all mounts including Committed
 	const cleanupCommitted = true
 	ctx := context.Background()
@@ -748,6 +811,10 @@ func (o *snapshotter) restoreRemoteSnapshot(ctx context.Context) error {
 	}); err != nil && !errdefs.IsNotFound(err) {
 		return err
 	}
+	var (
+		invalid []InvalidMount
+		errs    []error
+	)
 	for _, info := range task {
 		// First, prepare the snapshot directory
 		if err := func() error {
@@ -771,17 +838,36 @@ func (o *snapshotter) restoreRemoteSnapshot(ctx context.Context) error {
 			return fmt.Errorf("failed to create remote snapshot directory: %s: %w", info.Name, err)
 		}
 		if err := o.prepareRemoteSnapshot(ctx, info.Name, info.Labels); err != nil {
-			if o.allowInvalidMountsOnRestart {
-				log.G(ctx).WithError(err).Warnf("failed to restore remote snapshot %s; remove this snapshot manually", info.Name)
-				// This snapshot mount is invalid but allow this.
-				// NOTE: snapshotter.Mount() will fail to return the mountpoint of these invalid snapshots so
-				//       containerd cannot use them anymore. User needs to manually remove the snapshots from
-				//       containerd's metadata store using ctr (e.g. `ctr snapshot rm`).
-				continue
-			}
-			return fmt.Errorf("failed to prepare remote snapshot: %s: %w", info.Name, err)
+			invalid = append(invalid, InvalidMount{SnapshotID: info.Name, ParentID: info.Parent, Reason: err.Error()})
+			errs = append(errs, fmt.Errorf("%s: %w", info.Name, err))
 		}
 	}
+	if len(invalid) == 0 {
+		return nil
+	}
+	names := make([]string, len(invalid))
+	for i, m := range invalid {
+		names[i] = m.SnapshotID
+	}
+	if o.allowInvalidMountsOnRestart {
+		// These snapshot mounts are invalid but allow this.
+		// NOTE: snapshotter.Mount() will fail to return the mountpoint of these invalid snapshots so
+		//       containerd cannot use them anymore. User needs to manually remove the snapshots from
+		//       containerd's metadata store using ctr (e.g. `ctr snapshot rm`).
+		for _, m := range invalid {
+			log.G(ctx).WithField("snapshot", m.SnapshotID).WithField("parent", m.ParentID).WithField("reason", m.Reason).
+				Warn("invalid remote snapshot mount")
+		}
+		log.G(ctx).WithError(errors.Join(errs...)).Warnf("failed to restore %d remote snapshots; remove these snapshots manually: %s",
+			len(invalid), strings.Join(names, ", "))
+		o.invalidMounts = invalid
+		return nil
+	}
+	return fmt.Errorf("failed to prepare remote snapshots %s: %w", strings.Join(names, ", "), errors.Join(errs...))
+}
 
-	return nil
+// ListInvalidMounts returns the remote snapshots that couldn't be mounted when the
+// snapshotter started.
+func (o *snapshotter) ListInvalidMounts(ctx context.Context) ([]InvalidMount, error) {
+	return append([]InvalidMount(nil), o.invalidMounts...), nil
 }
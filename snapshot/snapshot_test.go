@@ -17,11 +17,14 @@
 package snapshot
 
 import (
+	"bytes"
 	"context"
 	_ "crypto/sha256"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"testing"
 
@@ -31,6 +34,8 @@ import (
 	"github.com/containerd/containerd/v2/core/snapshots/testsuite"
 	"github.com/containerd/containerd/v2/pkg/testutil"
 	"github.com/containerd/errdefs"
+	"github.com/containerd/log"
+	"github.com/sirupsen/logrus"
 )
 
 const (
@@ -373,6 +378,146 @@ func TestFailureDetection(t *testing.T) {
 	}
 }
 
+func TestRestoreInvalidMounts(t *testing.T) {
+	testutil.RequiresRoot(t)
+	for _, allow := range []bool{false, true} {
+		t.Run(fmt.Sprintf("allow=%v", allow), func(t *testing.T) {
+			ctx := context.TODO()
+			root := t.TempDir()
+			fs := &contentStoreFs{bindFs: bindFileSystem(t).(*bindFs), content: make(map[string]bool)}
+			targets := []string{"/tmp/restoreTarget0", "/tmp/restoreTarget1", "/tmp/restoreTarget2"}
+			for _, target := range targets {
+				fs.content[target] = true
+			}
+			sn, err := NewSnapshotter(ctx, root, fs)
+			if err != nil {
+				t.Fatalf("failed to make new Snapshotter: %q", err)
+			}
+			for i, target := range targets {
+				prepareWithTarget(t, sn, target, fmt.Sprintf("/tmp/restoreKey%d", i), "", nil)
+			}
+			if err := sn.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			// The data of two layers is lost while the snapshotter is down
+			delete(fs.content, targets[0])
+			delete(fs.content, targets[2])
+
+			var logs bytes.Buffer
+			logger := logrus.New()
+			logger.SetOutput(&logs)
+			ctx = log.WithLogger(ctx, logrus.NewEntry(logger))
+			var opts []Opt
+			if allow {
+				opts = append(opts, AllowInvalidMountsOnRestart)
+			}
+			sn, err = NewSnapshotter(ctx, root, fs, opts...)
+			if !allow {
+				if err == nil {
+					sn.Close()
+					t.Fatal("snapshotter started with invalid mounts")
+				}
+				if !strings.Contains(err.Error(), targets[0]+", "+targets[2]+":") || strings.Contains(err.Error(), targets[1]) {
+					t.Errorf("error doesn't list the invalid snapshots: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to restart Snapshotter: %v", err)
+			}
+			defer sn.Close()
+			var warning string
+			for _, line := range strings.Split(logs.String(), "\n") {
+				if strings.Contains(line, "level=warning") && strings.Contains(line, "failed to restore") {
+					warning = line
+				}
+			}
+			if !strings.Contains(warning, targets[0]+", "+targets[2]) {
+				t.Errorf("startup warning doesn't list the invalid snapshots: %q", logs.String())
+			}
+			invalid, err := sn.(InvalidMountLister).ListInvalidMounts(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(invalid) != 2 || invalid[0].SnapshotID != targets[0] || invalid[1].SnapshotID != targets[2] {
+				t.Fatalf("invalid mounts = %+v; want %s and %s", invalid, targets[0], targets[2])
+			}
+			for _, m := range invalid {
+				if !strings.Contains(m.Reason, "not found") {
+					t.Errorf("%s: reason %q doesn't say the content isn't found", m.SnapshotID, m.Reason)
+				}
+				if !strings.Contains(logs.String(), fmt.Sprintf("parent= reason=%q snapshot=%s", m.Reason, m.SnapshotID)) {
+					t.Errorf("%s isn't logged with its reason: %q", m.SnapshotID, logs.String())
+				}
+			}
+			key := "/tmp/restoreContainer"
+			if _, err := sn.Prepare(ctx, key, targets[1]); err != nil {
+				t.Errorf("valid snapshot isn't restored: %v", err)
+			}
+			defer sn.Remove(ctx, key)
+		})
+	}
+}
+
+func TestRemoteLabels(t *testing.T) {
+	ctx := context.TODO()
+	root := t.TempDir()
+	const podLabel = "containerd.io/snapshot/remote/pod"
+	addLabels := WithRemoteLabels(func(labels map[string]string) map[string]string {
+		return map[string]string{podLabel: "pod of " + labels[targetSnapshotLabel]}
+	})
+	fs := &labelsFs{}
+	sn, err := NewSnapshotter(ctx, root, fs, addLabels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := prepareWithTarget(t, sn, "testTarget", "prepareTarget", "", nil)
+	info, err := sn.Stat(ctx, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := info.Labels[podLabel], "pod of testTarget"; got != want {
+		t.Errorf("label of the snapshot is %q; want %q", got, want)
+	}
+	if err := sn.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The labels are passed to the filesystem on preparing and restoring the snapshot
+	sn, err = NewSnapshotter(ctx, root, fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sn.Close()
+	if len(fs.mounted) != 2 {
+		t.Fatalf("mounted %d times; want 2", len(fs.mounted))
+	}
+	for i, labels := range fs.mounted {
+		if got, want := labels[podLabel], "pod of testTarget"; got != want {
+			t.Errorf("mount %d: label is %q; want %q", i, got, want)
+		}
+	}
+}
+
+// labelsFs records the labels of the mounted layers without mounting them
+type labelsFs struct {
+	mounted []map[string]string
+}
+
+func (fs *labelsFs) Mount(ctx context.Context, mountpoint string, labels map[string]string) error {
+	fs.mounted = append(fs.mounted, maps.Clone(labels))
+	return nil
+}
+
+func (fs *labelsFs) Check(ctx context.Context, mountpoint string, labels map[string]string) error {
+	return nil
+}
+
+func (fs *labelsFs) Unmount(ctx context.Context, mountpoint string) error {
+	return nil
+}
+
 func bindFileSystem(t *testing.T) FileSystem {
 	root, err := os.MkdirTemp("", "remote")
 	if err != nil {
@@ -418,6 +563,19 @@ func (fs *bindFs) Unmount(ctx context.Context, mountpoint string) error {
 	return syscall.Unmount(mountpoint, 0)
 }
 
+// contentStoreFs mounts only the layers whose data is in the content store
+type contentStoreFs struct {
+	*bindFs
+	content map[string]bool // target snapshot names of the stored layers
+}
+
+func (fs *contentStoreFs) Mount(ctx context.Context, mountpoint string, labels map[string]string) error {
+	if target := labels[targetSnapshotLabel]; !fs.content[target] {
+		return fmt.Errorf("data of layer %q: %w", target, errdefs.ErrNotFound)
+	}
+	return fs.bindFs.Mount(ctx, mountpoint, labels)
+}
+
 func dummyFileSystem() FileSystem { return &dummyFs{} }
 
 type dummyFs struct{}
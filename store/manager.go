@@ -19,7 +19,6 @@ package store
 import (
 	"context"
 	"fmt"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -251,11 +250,11 @@ func (r *LayerManager) resolveLayer(ctx context.Context, refspec reference.Spec,
 	// Resolve this layer.
 	var esgzOpts []metadata.Option
 	if target.Annotations != nil {
-		if tocOffsetStr, ok := target.Annotations[zstdchunked.ManifestPositionAnnotation]; ok {
-			if parts := strings.Split(tocOffsetStr, ":"); len(parts) == 4 {
-				tocOffset, err := strconv.ParseInt(parts[0], 10, 64)
-				if err == nil {
-					esgzOpts = append(esgzOpts, metadata.WithTOCOffset(tocOffset))
+		if positions, err := new(zstdchunked.Decompressor).ParseManifestPosition(target.Annotations); err == nil {
+			for _, p := range positions {
+				if p.Digest == "" || p.Digest == target.Digest {
+					esgzOpts = append(esgzOpts, metadata.WithTOCOffset(p.Offset))
+					break
 				}
 			}
 		}